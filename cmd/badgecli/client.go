@@ -31,6 +31,7 @@ type BadgeCriteria struct {
 	ID             int                    `json:"id"`
 	BadgeID        int                    `json:"badge_id"`
 	FlowDefinition map[string]interface{} `json:"flow_definition"`
+	Expression     string                 `json:"expression,omitempty"`
 	CreatedAt      time.Time              `json:"created_at"`
 	UpdatedAt      time.Time              `json:"updated_at"`
 }
@@ -46,7 +47,21 @@ type NewBadgeRequest struct {
 	Name           string                 `json:"name"`
 	Description    string                 `json:"description"`
 	ImageURL       string                 `json:"image_url"`
-	FlowDefinition map[string]interface{} `json:"flow_definition"`
+	FlowDefinition map[string]interface{} `json:"flow_definition,omitempty"`
+	Expression     string                 `json:"expression,omitempty"`
+}
+
+// BadgeViolation is a problem found in a badge definition
+type BadgeViolation struct {
+	Path    string `json:"path"` // JSON pointer to the offending value, "" for the whole badge
+	Keyword string `json:"keyword"`
+	Message string `json:"message"`
+}
+
+// BadgeValidation is the result of validating a badge definition
+type BadgeValidation struct {
+	Valid      bool             `json:"valid"`
+	Violations []BadgeViolation `json:"violations"`
 }
 
 // EventType represents an event type in the system
@@ -66,6 +81,46 @@ type NewEventTypeRequest struct {
 	Schema      map[string]interface{} `json:"schema"`
 }
 
+// EventRequest is an event sent to the system
+type EventRequest struct {
+	EventType      string                 `json:"event_type"`
+	UserID         string                 `json:"user_id"`
+	Payload        map[string]interface{} `json:"payload"`
+	Timestamp      string                 `json:"timestamp,omitempty"`
+	Timezone       string                 `json:"timezone,omitempty"`
+	IdempotencyKey string                 `json:"idempotency_key,omitempty"`
+}
+
+// EventBatchRequest is used for sending several events at once
+type EventBatchRequest struct {
+	Events []EventRequest `json:"events"`
+}
+
+// EventBatchItem is the outcome of one event of a batch
+type EventBatchItem struct {
+	Index    int    `json:"index"`
+	EventID  int    `json:"event_id"`
+	Status   string `json:"status"`
+	Replayed bool   `json:"replayed"`
+	Error    string `json:"error"`
+}
+
+// EventBatchAward is a badge awarded by the events of a batch
+type EventBatchAward struct {
+	UserID    string `json:"user_id"`
+	BadgeID   int    `json:"badge_id"`
+	BadgeName string `json:"badge_name"`
+}
+
+// EventBatchResult is the outcome of a batch of events
+type EventBatchResult struct {
+	Accepted int               `json:"accepted"`
+	Replayed int               `json:"replayed"`
+	Rejected int               `json:"rejected"`
+	Events   []EventBatchItem  `json:"events"`
+	Awarded  []EventBatchAward `json:"awarded"`
+}
+
 // NewAPIClient creates a new API client
 func NewAPIClient(baseURL string) *APIClient {
 	return &APIClient{
@@ -148,6 +203,36 @@ func (c *APIClient) CreateBadge(badge *NewBadgeRequest) (*BadgeWithCriteria, err
 	return &badgeWithCriteria, nil
 }
 
+// ValidateBadge checks a badge definition without creating it
+func (c *APIClient) ValidateBadge(badge *NewBadgeRequest) (*BadgeValidation, error) {
+	jsonData, err := json.Marshal(badge)
+	if err != nil {
+		return nil, fmt.Errorf("error serializing badge: %w", err)
+	}
+
+	resp, err := c.HTTPClient.Post(
+		fmt.Sprintf("%s/api/v1/admin/badges/validate", c.BaseURL),
+		"application/json",
+		bytes.NewBuffer(jsonData),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("error making request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("API error: %s - %s", resp.Status, string(body))
+	}
+
+	var validation BadgeValidation
+	if err := json.NewDecoder(resp.Body).Decode(&validation); err != nil {
+		return nil, fmt.Errorf("error decoding response: %w", err)
+	}
+
+	return &validation, nil
+}
+
 // GetEventTypes gets all event types from the system
 func (c *APIClient) GetEventTypes() ([]EventType, error) {
 	resp, err := c.HTTPClient.Get(fmt.Sprintf("%s/api/v1/admin/event-types", c.BaseURL))
@@ -219,3 +304,33 @@ func (c *APIClient) CreateEventType(eventType *NewEventTypeRequest) (*EventType,
 
 	return &createdEventType, nil
 }
+
+// SendEventBatch sends several events at once
+func (c *APIClient) SendEventBatch(batch *EventBatchRequest) (*EventBatchResult, error) {
+	jsonData, err := json.Marshal(batch)
+	if err != nil {
+		return nil, fmt.Errorf("error serializing events: %w", err)
+	}
+
+	resp, err := c.HTTPClient.Post(
+		fmt.Sprintf("%s/api/v1/events/batch", c.BaseURL),
+		"application/json",
+		bytes.NewBuffer(jsonData),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("error making request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusAccepted {
+		body, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("API error: %s - %s", resp.Status, string(body))
+	}
+
+	var result EventBatchResult
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("error decoding response: %w", err)
+	}
+
+	return &result, nil
+}
@@ -1,6 +1,9 @@
 package main
 
 import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"io/fs"
@@ -17,11 +20,15 @@ type APIClientInterface interface {
 	GetBadges() ([]Badge, error)
 	GetBadgeWithCriteria(id string) (*BadgeWithCriteria, error)
 	CreateBadge(badge *NewBadgeRequest) (*BadgeWithCriteria, error)
+	ValidateBadge(badge *NewBadgeRequest) (*BadgeValidation, error)
 
 	// Event type operations
 	GetEventTypes() ([]EventType, error)
 	GetEventTypeByID(id string) (*EventType, error)
 	CreateEventType(eventType *NewEventTypeRequest) (*EventType, error)
+
+	// Event operations
+	SendEventBatch(batch *EventBatchRequest) (*EventBatchResult, error)
 }
 
 // ImportBadge imports a badge from a JSON file
@@ -36,6 +43,10 @@ func ImportBadge(client APIClientInterface, filePath string) error {
 		return fmt.Errorf("failed to parse badge JSON: %w", err)
 	}
 
+	if err := validateBadge(client, &badge); err != nil {
+		return err
+	}
+
 	createdBadge, err := client.CreateBadge(&badge)
 	if err != nil {
 		return fmt.Errorf("failed to create badge: %w", err)
@@ -47,6 +58,27 @@ func ImportBadge(client APIClientInterface, filePath string) error {
 	return nil
 }
 
+// validateBadge checks a badge definition with the API, returning an error listing every problem found
+func validateBadge(client APIClientInterface, badge *NewBadgeRequest) error {
+	validation, err := client.ValidateBadge(badge)
+	if err != nil {
+		return fmt.Errorf("failed to validate badge: %w", err)
+	}
+	if validation.Valid {
+		return nil
+	}
+
+	problems := make([]string, len(validation.Violations))
+	for i, violation := range validation.Violations {
+		path := violation.Path
+		if path == "" {
+			path = "/"
+		}
+		problems[i] = fmt.Sprintf("  %s: %s", path, violation.Message)
+	}
+	return fmt.Errorf("invalid badge definition:\n%s", strings.Join(problems, "\n"))
+}
+
 // ExportBadge exports a badge to a JSON file
 func ExportBadge(client APIClientInterface, id, outputPath string) error {
 	badgeWithCriteria, err := client.GetBadgeWithCriteria(id)
@@ -60,6 +92,7 @@ func ExportBadge(client APIClientInterface, id, outputPath string) error {
 		Description:    badgeWithCriteria.Badge.Description,
 		ImageURL:       badgeWithCriteria.Badge.ImageURL,
 		FlowDefinition: badgeWithCriteria.Criteria.FlowDefinition,
+		Expression:     badgeWithCriteria.Criteria.Expression,
 	}
 
 	jsonData, err := json.MarshalIndent(exportBadge, "", "  ")
@@ -112,6 +145,7 @@ func ExportAllBadges(client APIClientInterface, outputDir string) error {
 			Description:    badge.Description,
 			ImageURL:       badge.ImageURL,
 			FlowDefinition: badgeWithCriteria.Criteria.FlowDefinition,
+			Expression:     badgeWithCriteria.Criteria.Expression,
 		}
 
 		// Create filename
@@ -507,12 +541,19 @@ func ImportAllBadges(client APIClientInterface, dirPath string) error {
 		}
 
 		// Skip if missing required fields
-		if badge.Name == "" || badge.Description == "" || badge.FlowDefinition == nil {
+		if badge.Name == "" || badge.Description == "" || (badge.FlowDefinition == nil && badge.Expression == "") {
 			fmt.Printf("Warning: skipping %s - doesn't appear to be a valid badge definition\n", filePath)
 			failCount++
 			continue
 		}
 
+		// Check the badge before importing it, so every problem is reported at once
+		if err := validateBadge(client, &badge); err != nil {
+			fmt.Printf("Error importing badge %s: %v\n", filePath, err)
+			failCount++
+			continue
+		}
+
 		// Import the badge
 		createdBadge, err := client.CreateBadge(&badge)
 		if err != nil {
@@ -600,3 +641,107 @@ func ImportAllEventTypes(client APIClientInterface, dirPath string) error {
 	fmt.Printf("\nImport summary: %d event types imported, %d failed\n", importCount, failCount)
 	return nil
 }
+
+// maxReplayBatchSize is the largest batch accepted by the events batch endpoint
+const maxReplayBatchSize = 1000
+
+// replayEvent is an event read from a replay file and the line it was read from
+type replayEvent struct {
+	line  int
+	event EventRequest
+}
+
+// ReplayEvents sends the events of a JSON Lines file, one event per line, in batches. Events
+// carrying an idempotency key are only stored once, so a replay can be run again after a
+// failure. With deriveKeys, events without a key get one derived from their content, so that
+// replaying the same file twice does not store its events twice.
+func ReplayEvents(client APIClientInterface, filePath string, batchSize int, deriveKeys bool) error {
+	if batchSize <= 0 || batchSize > maxReplayBatchSize {
+		return fmt.Errorf("batch size must be between 1 and %d", maxReplayBatchSize)
+	}
+
+	events, err := readReplayEvents(filePath, deriveKeys)
+	if err != nil {
+		return err
+	}
+	if len(events) == 0 {
+		return fmt.Errorf("no events found in %s", filePath)
+	}
+
+	accepted, replayed, rejected, awarded := 0, 0, 0, 0
+	for start := 0; start < len(events); start += batchSize {
+		end := start + batchSize
+		if end > len(events) {
+			end = len(events)
+		}
+
+		batch := &EventBatchRequest{Events: make([]EventRequest, 0, end-start)}
+		for _, event := range events[start:end] {
+			batch.Events = append(batch.Events, event.event)
+		}
+
+		result, err := client.SendEventBatch(batch)
+		if err != nil {
+			return fmt.Errorf("failed to send events from line %d: %w (%d events sent before)", events[start].line, err, start)
+		}
+
+		for _, item := range result.Events {
+			if item.Error != "" {
+				fmt.Printf("Line %d: %s\n", events[start+item.Index].line, item.Error)
+			}
+		}
+		for _, award := range result.Awarded {
+			fmt.Printf("Awarded '%s' (ID: %d) to %s\n", award.BadgeName, award.BadgeID, award.UserID)
+		}
+		accepted += result.Accepted
+		replayed += result.Replayed
+		rejected += result.Rejected
+		awarded += len(result.Awarded)
+	}
+
+	fmt.Printf("\nReplay summary: %d events stored, %d already stored, %d rejected, %d badges awarded\n",
+		accepted, replayed, rejected, awarded)
+	return nil
+}
+
+// readReplayEvents reads the events of a JSON Lines file, skipping blank lines
+func readReplayEvents(filePath string, deriveKeys bool) ([]replayEvent, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read file: %w", err)
+	}
+	defer file.Close()
+
+	var events []replayEvent
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 10*1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" {
+			continue
+		}
+
+		var event EventRequest
+		if err := json.Unmarshal([]byte(text), &event); err != nil {
+			return nil, fmt.Errorf("failed to parse event on line %d: %w", line, err)
+		}
+		if event.IdempotencyKey == "" && deriveKeys {
+			event.IdempotencyKey = deriveIdempotencyKey(event)
+		}
+		events = append(events, replayEvent{line: line, event: event})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read file: %w", err)
+	}
+
+	return events, nil
+}
+
+// deriveIdempotencyKey derives an idempotency key from the content of an event, so that the
+// same event always gets the same key
+func deriveIdempotencyKey(event EventRequest) string {
+	// Payload keys are sorted when encoded, so equal events encode identically
+	data, _ := json.Marshal(event)
+	sum := sha256.Sum256(data)
+	return "replay-" + hex.EncodeToString(sum[:])
+}
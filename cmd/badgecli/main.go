@@ -15,6 +15,9 @@ var (
 	serverURL string
 	badgesDir string
 	outputDir string
+
+	replayBatchSize  int
+	replayDeriveKeys bool
 )
 
 // Embed all JSON files from the badges directory
@@ -184,6 +187,20 @@ var importAllEventTypesCmd = &cobra.Command{
 	},
 }
 
+// Commands for sending events
+var replayEventsCmd = &cobra.Command{
+	Use:   "replay-events [file_path]",
+	Short: "Send the events of a JSON Lines file, skipping those already stored",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		client := NewAPIClient(serverURL)
+		if err := ReplayEvents(client, args[0], replayBatchSize, replayDeriveKeys); err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+	},
+}
+
 // rootCmd represents the base command when called without any subcommands
 var rootCmd = &cobra.Command{
 	Use:   "badgecli",
@@ -210,6 +227,10 @@ func init() {
 	// Export flags
 	exportExamplesCmd.Flags().StringVar(&outputDir, "output-dir", "./examples", "directory to export examples to")
 
+	// Replay flags
+	replayEventsCmd.Flags().IntVar(&replayBatchSize, "batch-size", 100, "number of events sent per request")
+	replayEventsCmd.Flags().BoolVar(&replayDeriveKeys, "derive-keys", false, "derive an idempotency key from the content of events sent without one")
+
 	// Add commands
 	rootCmd.AddCommand(listExamplesCmd)
 	rootCmd.AddCommand(importCmd)
@@ -225,6 +246,7 @@ func init() {
 	rootCmd.AddCommand(exportAllEventTypesCmd)
 	rootCmd.AddCommand(importAllBadgesCmd)
 	rootCmd.AddCommand(importAllEventTypesCmd)
+	rootCmd.AddCommand(replayEventsCmd)
 }
 
 // initConfig reads in config file and ENV variables if set
@@ -1,16 +1,30 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"log"
+	"net"
+	"net/http"
 	"os"
+	"os/signal"
+	"strconv"
+	"syscall"
+	"time"
 
 	"github.com/badge-assignment-system/internal/api"
+	"github.com/badge-assignment-system/internal/jobs"
 	"github.com/badge-assignment-system/internal/models"
+	"github.com/badge-assignment-system/internal/queue"
 	"github.com/badge-assignment-system/internal/service"
+	"github.com/badge-assignment-system/internal/webhook"
 	"github.com/gin-gonic/gin"
 	"github.com/joho/godotenv"
 )
 
+// shutdownTimeout is how long requests in progress are given to finish when the server stops
+const shutdownTimeout = 30 * time.Second
+
 func main() {
 	// Load environment variables from .env file if it exists
 	if err := godotenv.Load(); err != nil {
@@ -26,17 +40,89 @@ func main() {
 	// Create service layer
 	svc := service.NewService(db)
 
+	// Evaluate events in a background worker pool if enabled
+	if getEnv("ASYNC_PROCESSING", "false") == "true" {
+		config := queue.DefaultConfig()
+		if concurrency, err := strconv.Atoi(getEnv("WORKER_CONCURRENCY", "")); err == nil && concurrency > 0 {
+			config.Concurrency = concurrency
+		}
+		svc.EnableAsyncProcessing(config)
+		log.Printf("Async event processing enabled with %d workers\n", config.Concurrency)
+	}
+
+	// Expire lapsed badges and re-check holders in the background unless disabled
+	if interval, err := time.ParseDuration(getEnv("BADGE_RECHECK_INTERVAL", "1h")); err == nil && interval > 0 {
+		svc.EnableBadgeRecheck(interval)
+		log.Printf("Badge recheck job enabled every %s\n", interval)
+	}
+
+	// Deliver badge notifications to webhook subscriptions unless disabled
+	if getEnv("WEBHOOK_DELIVERY", "true") == "true" {
+		config := webhook.DefaultConfig()
+		if maxAttempts, err := strconv.Atoi(getEnv("WEBHOOK_MAX_ATTEMPTS", "")); err == nil && maxAttempts > 0 {
+			config.MaxAttempts = maxAttempts
+		}
+		svc.EnableWebhookDelivery(config)
+		log.Printf("Webhook delivery enabled with up to %d attempts per delivery\n", config.MaxAttempts)
+	}
+
+	// Share badge notifications with the other replicas, so streams receive those of every replica, unless disabled
+	if getEnv("NOTIFICATION_RELAY", "true") == "true" {
+		if err := svc.EnableNotificationRelay(models.ConnectionString()); err != nil {
+			log.Printf("Notification relay disabled, streams only receive notifications of this server: %v\n", err)
+		} else {
+			log.Println("Notification relay enabled")
+		}
+	}
+
+	// Run admin-triggered backfill jobs unless disabled
+	if getEnv("BACKFILL_JOBS", "true") == "true" {
+		config := jobs.DefaultBackfillConfig()
+		if concurrency, err := strconv.Atoi(getEnv("BACKFILL_CONCURRENCY", "")); err == nil && concurrency > 0 {
+			config.Concurrency = concurrency
+		}
+		svc.EnableBackfills(config)
+		log.Printf("Backfill jobs enabled with %d workers\n", config.Concurrency)
+	}
+
 	// Set up the HTTP server
 	router := setupServer(svc)
 
 	// Get the port to listen on
 	port := getEnv("PORT", "8080")
 
+	// Stop on SIGINT or SIGTERM. Requests see their context canceled, which ends badge streams.
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+	server := &http.Server{
+		Addr:        ":" + port,
+		Handler:     router,
+		BaseContext: func(net.Listener) context.Context { return ctx },
+	}
+
 	// Start the server
-	log.Printf("Server starting on port %s...\n", port)
-	if err := router.Run(":" + port); err != nil {
-		log.Fatalf("Failed to start server: %v", err)
+	go func() {
+		log.Printf("Server starting on port %s...\n", port)
+		if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Fatalf("Failed to start server: %v", err)
+		}
+	}()
+
+	<-ctx.Done()
+	log.Println("Shutting down...")
+
+	// Let requests in progress finish, then the background jobs, so that no claimed event or
+	// job lease is left to expire
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		log.Printf("Failed to finish requests in progress: %v\n", err)
+	}
+	svc.Stop()
+	if err := db.Close(); err != nil {
+		log.Printf("Failed to close database connection: %v\n", err)
 	}
+	log.Println("Server stopped")
 }
 
 // setupServer configures the HTTP server
@@ -0,0 +1,10 @@
+DROP TABLE IF EXISTS event_dead_letters;
+
+DROP INDEX IF EXISTS idx_events_queue;
+
+ALTER TABLE events
+    DROP COLUMN IF EXISTS processing_status,
+    DROP COLUMN IF EXISTS attempts,
+    DROP COLUMN IF EXISTS next_attempt_at,
+    DROP COLUMN IF EXISTS last_error,
+    DROP COLUMN IF EXISTS processed_at;
@@ -0,0 +1,20 @@
+-- Track the processing state of each event so it can be evaluated asynchronously
+ALTER TABLE events
+    ADD COLUMN processing_status VARCHAR(20) NOT NULL DEFAULT 'processed',  -- pending, processing, processed, dead
+    ADD COLUMN attempts INTEGER NOT NULL DEFAULT 0,
+    ADD COLUMN next_attempt_at TIMESTAMP DEFAULT NOW(),                     -- When the event may next be claimed
+    ADD COLUMN last_error TEXT,
+    ADD COLUMN processed_at TIMESTAMP;
+
+-- Events that kept failing after all retries
+CREATE TABLE event_dead_letters (
+    id SERIAL PRIMARY KEY,
+    event_id INTEGER REFERENCES events(id) ON DELETE CASCADE,
+    user_id VARCHAR(100) NOT NULL,
+    attempts INTEGER NOT NULL,
+    last_error TEXT,
+    failed_at TIMESTAMP DEFAULT NOW()
+);
+
+CREATE INDEX idx_events_queue ON events(next_attempt_at) WHERE processing_status IN ('pending', 'processing');
+CREATE INDEX idx_event_dead_letters_event_id ON event_dead_letters(event_id);
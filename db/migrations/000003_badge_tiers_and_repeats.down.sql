@@ -0,0 +1,10 @@
+DROP INDEX IF EXISTS idx_user_badges_award;
+
+ALTER TABLE user_badges
+    DROP COLUMN IF EXISTS tier,
+    DROP COLUMN IF EXISTS occurrence,
+    DROP COLUMN IF EXISTS period_key;
+
+DROP TABLE IF EXISTS badge_tiers;
+
+ALTER TABLE badges DROP COLUMN IF EXISTS repeat_policy;
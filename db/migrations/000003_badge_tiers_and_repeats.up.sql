@@ -0,0 +1,30 @@
+-- How often a badge may be awarded to the same user; NULL means once
+ALTER TABLE badges ADD COLUMN repeat_policy JSONB;
+
+-- Levels of a tiered badge (e.g. Bronze, Silver, Gold), awarded in order of level
+CREATE TABLE badge_tiers (
+    id SERIAL PRIMARY KEY,
+    badge_id INTEGER REFERENCES badges(id) ON DELETE CASCADE,
+    level INTEGER NOT NULL,
+    name VARCHAR(100) NOT NULL,
+    flow_definition JSONB NOT NULL,  -- Criteria the user must meet to reach this tier
+    created_at TIMESTAMP DEFAULT NOW(),
+    updated_at TIMESTAMP DEFAULT NOW(),
+    UNIQUE (badge_id, level)
+);
+
+ALTER TABLE user_badges
+    ADD COLUMN tier INTEGER,                           -- Tier level reached, for tiered badges
+    ADD COLUMN occurrence INTEGER NOT NULL DEFAULT 1,  -- Award number, for repeatable badges
+    ADD COLUMN period_key VARCHAR(20);                 -- Period the award belongs to, e.g. 2024-Q2
+
+-- Existing duplicate awards all default to occurrence 1; number them in award order
+UPDATE user_badges ub
+SET occurrence = numbered.n
+FROM (
+    SELECT id, ROW_NUMBER() OVER (PARTITION BY user_id, badge_id ORDER BY awarded_at, id) AS n
+    FROM user_badges
+) numbered
+WHERE ub.id = numbered.id AND numbered.n > 1;
+
+CREATE UNIQUE INDEX idx_user_badges_award ON user_badges(user_id, badge_id, COALESCE(tier, 0), occurrence);
@@ -0,0 +1,10 @@
+DROP INDEX IF EXISTS idx_user_badges_expires_at;
+
+ALTER TABLE user_badges
+    DROP COLUMN IF EXISTS status,
+    DROP COLUMN IF EXISTS expires_at,
+    DROP COLUMN IF EXISTS revoked_at,
+    DROP COLUMN IF EXISTS revocation_reason,
+    DROP COLUMN IF EXISTS last_checked_at;
+
+ALTER TABLE badges DROP COLUMN IF EXISTS expiry_policy;
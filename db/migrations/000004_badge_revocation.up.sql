@@ -0,0 +1,12 @@
+-- How long awards of a badge stay valid and how often holders are re-checked; NULL means forever
+ALTER TABLE badges ADD COLUMN expiry_policy JSONB;
+
+-- Awards are revoked or expired instead of deleted, so the history is kept
+ALTER TABLE user_badges
+    ADD COLUMN status VARCHAR(20) NOT NULL DEFAULT 'active',  -- active, revoked, expired
+    ADD COLUMN expires_at TIMESTAMP,                          -- When the award lapses, if the badge has a validity period
+    ADD COLUMN revoked_at TIMESTAMP,                          -- When the award was revoked or expired
+    ADD COLUMN revocation_reason TEXT,
+    ADD COLUMN last_checked_at TIMESTAMP;                     -- When the holder was last re-evaluated
+
+CREATE INDEX idx_user_badges_expires_at ON user_badges(expires_at) WHERE status = 'active';
@@ -0,0 +1,49 @@
+-- Admin-managed endpoints notified when badges are awarded or revoked
+CREATE TABLE webhook_subscriptions (
+    id SERIAL PRIMARY KEY,
+    url TEXT NOT NULL,
+    secret TEXT NOT NULL,             -- Key used to sign payloads with HMAC-SHA256
+    filter JSONB,                     -- Events and badge IDs to deliver; NULL means everything
+    active BOOLEAN DEFAULT TRUE,
+    created_at TIMESTAMP DEFAULT NOW(),
+    updated_at TIMESTAMP DEFAULT NOW()
+);
+
+-- Badge notifications, written in the same transaction as the award or revocation
+CREATE TABLE webhook_outbox (
+    id SERIAL PRIMARY KEY,
+    event_type VARCHAR(50) NOT NULL,  -- badge.awarded or badge.revoked
+    user_id VARCHAR(100) NOT NULL,
+    badge_id INTEGER NOT NULL,
+    payload JSONB NOT NULL,
+    created_at TIMESTAMP DEFAULT NOW(),
+    dispatched_at TIMESTAMP           -- When deliveries were created for the matching subscriptions
+);
+
+-- One notification to be sent to one subscription
+CREATE TABLE webhook_deliveries (
+    id SERIAL PRIMARY KEY,
+    subscription_id INTEGER REFERENCES webhook_subscriptions(id) ON DELETE CASCADE,
+    outbox_id INTEGER REFERENCES webhook_outbox(id) ON DELETE CASCADE,
+    status VARCHAR(20) NOT NULL DEFAULT 'pending',  -- pending, delivering, delivered, failed
+    attempts INTEGER NOT NULL DEFAULT 0,
+    next_attempt_at TIMESTAMP DEFAULT NOW(),
+    last_error TEXT,
+    created_at TIMESTAMP DEFAULT NOW(),
+    delivered_at TIMESTAMP
+);
+
+-- Every HTTP request made for a delivery
+CREATE TABLE webhook_delivery_attempts (
+    id SERIAL PRIMARY KEY,
+    delivery_id INTEGER REFERENCES webhook_deliveries(id) ON DELETE CASCADE,
+    response_status INTEGER,          -- NULL when no response was received
+    error TEXT,
+    duration_ms INTEGER NOT NULL,
+    attempted_at TIMESTAMP DEFAULT NOW()
+);
+
+CREATE INDEX idx_webhook_outbox_pending ON webhook_outbox(id) WHERE dispatched_at IS NULL;
+CREATE INDEX idx_webhook_deliveries_queue ON webhook_deliveries(next_attempt_at) WHERE status IN ('pending', 'delivering');
+CREATE INDEX idx_webhook_deliveries_subscription_id ON webhook_deliveries(subscription_id);
+CREATE INDEX idx_webhook_delivery_attempts_delivery_id ON webhook_delivery_attempts(delivery_id);
@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS idx_condition_types_name;
+
+ALTER TABLE condition_types
+    DROP COLUMN IF EXISTS flow_template,
+    DROP COLUMN IF EXISTS parameters;
@@ -0,0 +1,7 @@
+-- Condition types become parameterized flow definition templates invoked with $condition
+ALTER TABLE condition_types
+    ADD COLUMN parameters JSONB NOT NULL DEFAULT '[]',  -- Declared parameters: name, type and optional default
+    ADD COLUMN flow_template JSONB;                     -- Flow definition with {"$param": name} placeholders
+
+-- Badge flows refer to condition types by name
+CREATE UNIQUE INDEX idx_condition_types_name ON condition_types(name);
@@ -0,0 +1,6 @@
+-- Expression criteria cannot be converted back; their flow definition is left empty
+UPDATE badge_criteria SET flow_definition = '{}' WHERE flow_definition IS NULL;
+
+ALTER TABLE badge_criteria
+    ALTER COLUMN flow_definition SET NOT NULL,
+    DROP COLUMN IF EXISTS expression;
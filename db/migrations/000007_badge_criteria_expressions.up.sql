@@ -0,0 +1,4 @@
+-- Badge criteria can be written as a CEL expression instead of a flow definition
+ALTER TABLE badge_criteria
+    ADD COLUMN expression TEXT NOT NULL DEFAULT '',
+    ALTER COLUMN flow_definition DROP NOT NULL;
@@ -0,0 +1,20 @@
+-- Admin-triggered jobs that evaluate badges against every user who has sent events
+CREATE TABLE backfill_jobs (
+    id SERIAL PRIMARY KEY,
+    badge_ids INTEGER[] NOT NULL,
+    dry_run BOOLEAN NOT NULL DEFAULT FALSE,  -- Count would-be awards without recording them
+    status VARCHAR(20) NOT NULL DEFAULT 'pending',  -- pending, running, completed, failed
+    last_user_id VARCHAR(100) NOT NULL DEFAULT '',  -- Last user of the last completed batch; users are processed in order
+    total_users INTEGER NOT NULL DEFAULT 0,  -- Users with events when the job was created
+    processed_users INTEGER NOT NULL DEFAULT 0,
+    failed_users INTEGER NOT NULL DEFAULT 0,
+    awarded INTEGER NOT NULL DEFAULT 0,      -- Badges awarded, or that would be awarded in a dry run
+    last_error TEXT,
+    lease_expires_at TIMESTAMP,              -- A running job whose lease expired is resumed after last_user_id
+    created_at TIMESTAMP DEFAULT NOW(),
+    started_at TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT NOW(),
+    completed_at TIMESTAMP
+);
+
+CREATE INDEX idx_backfill_jobs_unfinished ON backfill_jobs(id) WHERE status IN ('pending', 'running');
@@ -0,0 +1,9 @@
+-- Named sets of holidays that time-based criteria skip, referenced from flows by name
+CREATE TABLE holiday_calendars (
+    id SERIAL PRIMARY KEY,
+    name VARCHAR(100) NOT NULL UNIQUE,
+    description TEXT NOT NULL DEFAULT '',
+    holidays JSONB NOT NULL DEFAULT '[]',  -- Dates, each once or yearly: date, name, yearly and until
+    created_at TIMESTAMPTZ DEFAULT NOW(),
+    updated_at TIMESTAMPTZ DEFAULT NOW()
+);
@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_events_user_idempotency_key;
+
+ALTER TABLE events DROP COLUMN IF EXISTS idempotency_key;
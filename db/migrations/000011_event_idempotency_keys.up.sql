@@ -0,0 +1,6 @@
+-- A key chosen by the client so that an event sent again, e.g. when a request is retried, is
+-- only stored once per user
+ALTER TABLE events ADD COLUMN idempotency_key VARCHAR(255);
+
+CREATE UNIQUE INDEX idx_events_user_idempotency_key ON events(user_id, idempotency_key)
+    WHERE idempotency_key IS NOT NULL;
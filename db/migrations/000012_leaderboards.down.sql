@@ -0,0 +1,7 @@
+DROP TABLE IF EXISTS leaderboard_badge_daily;
+DROP TABLE IF EXISTS leaderboard_badge_totals;
+
+DROP TABLE IF EXISTS leaderboard_daily;
+DROP TABLE IF EXISTS leaderboard_totals;
+
+ALTER TABLE badges DROP COLUMN IF EXISTS points;
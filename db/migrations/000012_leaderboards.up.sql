@@ -0,0 +1,63 @@
+-- Points each award of a badge scores on weighted leaderboards
+ALTER TABLE badges ADD COLUMN points INTEGER NOT NULL DEFAULT 0;
+
+-- Active awards of each user and the points they score, updated in the same statement as
+-- every award, revocation and expiry so that rankings never scan user_badges
+CREATE TABLE leaderboard_totals (
+    user_id VARCHAR(100) PRIMARY KEY,
+    badge_count INTEGER NOT NULL DEFAULT 0,
+    points INTEGER NOT NULL DEFAULT 0
+);
+
+-- The same, by the day the awards were made in UTC, for rankings over a time range
+CREATE TABLE leaderboard_daily (
+    user_id VARCHAR(100) NOT NULL,
+    day DATE NOT NULL,
+    badge_count INTEGER NOT NULL DEFAULT 0,
+    points INTEGER NOT NULL DEFAULT 0,
+    PRIMARY KEY (user_id, day)
+);
+
+CREATE INDEX idx_leaderboard_totals_badge_count ON leaderboard_totals(badge_count DESC);
+CREATE INDEX idx_leaderboard_totals_points ON leaderboard_totals(points DESC);
+CREATE INDEX idx_leaderboard_daily_day ON leaderboard_daily(day);
+
+-- Active awards of each badge held by each user and when the first of them was made, updated
+-- with the tables above, for rankings of a badge's earners. Rows whose count drops to zero are
+-- kept, and no longer rank.
+CREATE TABLE leaderboard_badge_totals (
+    badge_id INTEGER NOT NULL,
+    user_id VARCHAR(100) NOT NULL,
+    badge_count INTEGER NOT NULL DEFAULT 0,
+    first_awarded_at TIMESTAMPTZ,
+    PRIMARY KEY (badge_id, user_id)
+);
+
+-- The same, by the day the awards were made in UTC
+CREATE TABLE leaderboard_badge_daily (
+    badge_id INTEGER NOT NULL,
+    user_id VARCHAR(100) NOT NULL,
+    day DATE NOT NULL,
+    badge_count INTEGER NOT NULL DEFAULT 0,
+    first_awarded_at TIMESTAMPTZ,
+    PRIMARY KEY (badge_id, user_id, day)
+);
+
+-- Earners of a badge in the order they earned it
+CREATE INDEX idx_leaderboard_badge_totals_first_awarded_at ON leaderboard_badge_totals(badge_id, first_awarded_at, user_id)
+    WHERE badge_count > 0;
+CREATE INDEX idx_leaderboard_badge_daily_day ON leaderboard_badge_daily(badge_id, day);
+
+-- Count the awards made so far; they score no points until badges are given some
+INSERT INTO leaderboard_totals (user_id, badge_count)
+SELECT user_id, COUNT(*) FROM user_badges WHERE status = 'active' GROUP BY user_id;
+
+INSERT INTO leaderboard_daily (user_id, day, badge_count)
+SELECT user_id, (awarded_at AT TIME ZONE 'UTC')::date, COUNT(*) FROM user_badges WHERE status = 'active' GROUP BY 1, 2;
+
+INSERT INTO leaderboard_badge_totals (badge_id, user_id, badge_count, first_awarded_at)
+SELECT badge_id, user_id, COUNT(*), MIN(awarded_at) FROM user_badges WHERE status = 'active' GROUP BY 1, 2;
+
+INSERT INTO leaderboard_badge_daily (badge_id, user_id, day, badge_count, first_awarded_at)
+SELECT badge_id, user_id, (awarded_at AT TIME ZONE 'UTC')::date, COUNT(*), MIN(awarded_at)
+FROM user_badges WHERE status = 'active' GROUP BY 1, 2, 3;
@@ -1,11 +1,18 @@
 package api
 
 import (
+	"errors"
+	"fmt"
+	"io"
 	"net/http"
 	"strconv"
+	"time"
 
 	"github.com/badge-assignment-system/internal/models"
+	"github.com/badge-assignment-system/internal/notify"
+	"github.com/badge-assignment-system/internal/schema"
 	"github.com/badge-assignment-system/internal/service"
+	"github.com/gin-contrib/sse"
 	"github.com/gin-gonic/gin"
 )
 
@@ -28,6 +35,14 @@ func respondWithError(c *gin.Context, code int, message string) {
 	})
 }
 
+// respondWithValidationError responds with a JSON error listing every schema violation
+func respondWithValidationError(c *gin.Context, code int, err *schema.ValidationError) {
+	c.JSON(code, gin.H{
+		"error":      err.Message,
+		"violations": err.Violations,
+	})
+}
+
 // Health checks the health of the API
 func (h *Handler) Health(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{
@@ -44,6 +59,11 @@ func (h *Handler) CreateEventType(c *gin.Context) {
 	}
 
 	eventType, err := h.Service.CreateEventType(&req)
+	var validationErr *schema.ValidationError
+	if errors.As(err, &validationErr) {
+		respondWithValidationError(c, http.StatusBadRequest, validationErr)
+		return
+	}
 	if err != nil {
 		respondWithError(c, http.StatusInternalServerError, err.Error())
 		return
@@ -95,6 +115,11 @@ func (h *Handler) UpdateEventType(c *gin.Context) {
 	}
 
 	eventType, err := h.Service.UpdateEventType(id, &req)
+	var validationErr *schema.ValidationError
+	if errors.As(err, &validationErr) {
+		respondWithValidationError(c, http.StatusBadRequest, validationErr)
+		return
+	}
 	if err != nil {
 		respondWithError(c, http.StatusInternalServerError, err.Error())
 		return
@@ -128,6 +153,11 @@ func (h *Handler) CreateBadge(c *gin.Context) {
 	}
 
 	badge, err := h.Service.CreateBadge(&req)
+	var validationErr *schema.ValidationError
+	if errors.As(err, &validationErr) {
+		respondWithValidationError(c, http.StatusBadRequest, validationErr)
+		return
+	}
 	if err != nil {
 		respondWithError(c, http.StatusInternalServerError, err.Error())
 		return
@@ -136,6 +166,26 @@ func (h *Handler) CreateBadge(c *gin.Context) {
 	c.JSON(http.StatusCreated, badge)
 }
 
+// ValidateBadge handles checking a badge definition without creating it
+func (h *Handler) ValidateBadge(c *gin.Context) {
+	var req models.NewBadgeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondWithError(c, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+
+	violations, err := h.Service.ValidateBadge(&req)
+	if err != nil {
+		respondWithError(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"valid":      len(violations) == 0,
+		"violations": violations,
+	})
+}
+
 // GetBadges handles getting all badges
 func (h *Handler) GetBadges(c *gin.Context) {
 	badges, err := h.Service.GetBadges()
@@ -207,6 +257,11 @@ func (h *Handler) UpdateBadge(c *gin.Context) {
 	}
 
 	badge, err := h.Service.UpdateBadge(id, &req)
+	var validationErr *schema.ValidationError
+	if errors.As(err, &validationErr) {
+		respondWithValidationError(c, http.StatusBadRequest, validationErr)
+		return
+	}
 	if err != nil {
 		respondWithError(c, http.StatusInternalServerError, err.Error())
 		return
@@ -231,6 +286,49 @@ func (h *Handler) DeleteBadge(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"message": "Badge deleted successfully"})
 }
 
+// EvaluateBadge handles dry-running a badge's criteria for a user
+func (h *Handler) EvaluateBadge(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		respondWithError(c, http.StatusBadRequest, "Invalid ID format")
+		return
+	}
+
+	userID := c.Query("user_id")
+	if userID == "" {
+		respondWithError(c, http.StatusBadRequest, "User ID is required")
+		return
+	}
+
+	result, err := h.Service.EvaluateBadge(id, userID)
+	if err != nil {
+		respondWithError(c, http.StatusNotFound, err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, result)
+}
+
+// EvaluateFlow handles dry-running an unsaved flow definition for a user
+func (h *Handler) EvaluateFlow(c *gin.Context) {
+	var req models.EvaluateFlowRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondWithError(c, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+	if userID := c.Query("user_id"); userID != "" {
+		req.UserID = userID
+	}
+
+	result, err := h.Service.EvaluateFlow(&req)
+	if err != nil {
+		respondWithError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, result)
+}
+
 // ProcessEvent handles processing an event
 func (h *Handler) ProcessEvent(c *gin.Context) {
 	var req models.NewEventRequest
@@ -239,12 +337,121 @@ func (h *Handler) ProcessEvent(c *gin.Context) {
 		return
 	}
 
-	if err := h.Service.ProcessEvent(&req); err != nil {
+	// The key may also be sent as a header, so that clients can retry a request unchanged
+	if req.IdempotencyKey == "" {
+		req.IdempotencyKey = c.GetHeader("Idempotency-Key")
+	}
+
+	event, result, err := h.Service.ProcessEvent(&req)
+	var validationErr *schema.ValidationError
+	if errors.As(err, &validationErr) {
+		respondWithValidationError(c, http.StatusUnprocessableEntity, validationErr)
+		return
+	}
+	if err != nil {
 		respondWithError(c, http.StatusInternalServerError, err.Error())
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"message": "Event processed successfully"})
+	if event.Replayed {
+		c.JSON(http.StatusOK, gin.H{
+			"message":  "Event already received",
+			"event_id": event.ID,
+			"status":   event.ProcessingStatus,
+			"replayed": true,
+		})
+		return
+	}
+
+	if h.Service.AsyncProcessing() {
+		c.JSON(http.StatusAccepted, gin.H{
+			"message":  "Event accepted for processing",
+			"event_id": event.ID,
+			"status":   event.ProcessingStatus,
+		})
+		return
+	}
+
+	message := "Event processed successfully"
+	if event.ProcessingStatus == models.EventStatusFailed {
+		message = "Event processed, but some badges could not be evaluated"
+	}
+	response := gin.H{
+		"message":          message,
+		"event_id":         event.ID,
+		"status":           event.ProcessingStatus,
+		"badges_evaluated": result.Evaluated,
+		"awarded":          result.Awarded,
+	}
+	if len(result.Errors) > 0 {
+		response["errors"] = result.Errors
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// ProcessEventBatch handles submitting several events at once
+func (h *Handler) ProcessEventBatch(c *gin.Context) {
+	var req models.NewEventBatchRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondWithError(c, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+
+	result, err := h.Service.ProcessEventBatch(&req)
+	var validationErr *schema.ValidationError
+	if errors.As(err, &validationErr) {
+		respondWithValidationError(c, http.StatusUnprocessableEntity, validationErr)
+		return
+	}
+	if err != nil {
+		respondWithError(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	if h.Service.AsyncProcessing() {
+		c.JSON(http.StatusAccepted, result)
+		return
+	}
+
+	c.JSON(http.StatusOK, result)
+}
+
+// GetEvent handles getting an event and its processing status
+func (h *Handler) GetEvent(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		respondWithError(c, http.StatusBadRequest, "Invalid ID format")
+		return
+	}
+
+	event, err := h.Service.GetEvent(id)
+	if err != nil {
+		respondWithError(c, http.StatusNotFound, err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, event)
+}
+
+// GetEventDeadLetters handles listing events that failed processing after all retries
+func (h *Handler) GetEventDeadLetters(c *gin.Context) {
+	limit := 100
+	if limitParam := c.Query("limit"); limitParam != "" {
+		parsed, err := strconv.Atoi(limitParam)
+		if err != nil || parsed <= 0 {
+			respondWithError(c, http.StatusBadRequest, "Invalid limit")
+			return
+		}
+		limit = parsed
+	}
+
+	deadLetters, err := h.Service.GetEventDeadLetters(limit)
+	if err != nil {
+		respondWithError(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, deadLetters)
 }
 
 // GetUserBadges handles getting all badges awarded to a user
@@ -264,6 +471,283 @@ func (h *Handler) GetUserBadges(c *gin.Context) {
 	c.JSON(http.StatusOK, badges)
 }
 
+// Badge notification streams
+const (
+	streamReplayPageSize    = 500              // Missed notifications read at a time when a stream resumes
+	streamHeartbeatInterval = 15 * time.Second // How often a comment is sent on idle streams to keep them open
+)
+
+// StreamUserBadges handles streaming the badges awarded to and revoked from a user as Server-Sent Events
+func (h *Handler) StreamUserBadges(c *gin.Context) {
+	userID := c.Param("id")
+	if userID == "" {
+		respondWithError(c, http.StatusBadRequest, "User ID is required")
+		return
+	}
+
+	h.streamBadgeNotifications(c, userID)
+}
+
+// StreamBadgeNotifications handles streaming the badges awarded to and revoked from every user as Server-Sent Events
+func (h *Handler) StreamBadgeNotifications(c *gin.Context) {
+	h.streamBadgeNotifications(c, "")
+}
+
+// streamBadgeNotifications sends the badge notifications of a user, or of every user, as they happen.
+// A client reconnecting with the ID of the last notification it received, in the Last-Event-ID
+// header or the last_event_id query parameter, first receives the notifications it missed.
+// Notifications are resumed by ID, so one whose award committed after a notification with a
+// higher ID was sent is skipped when the client reconnects; a connected client receives it.
+func (h *Handler) streamBadgeNotifications(c *gin.Context, userID string) {
+	lastEventID := c.GetHeader("Last-Event-ID")
+	if lastEventID == "" {
+		lastEventID = c.Query("last_event_id")
+	}
+	afterID := 0
+	if lastEventID != "" {
+		id, err := strconv.Atoi(lastEventID)
+		if err != nil || id < 0 {
+			respondWithError(c, http.StatusBadRequest, "Invalid last event ID")
+			return
+		}
+		afterID = id
+	}
+
+	// Subscribe before reading the missed notifications, so that none are lost in between
+	subscription := h.Service.SubscribeBadgeNotifications(userID)
+	defer h.Service.UnsubscribeBadgeNotifications(subscription)
+
+	var missed []notify.Notification
+	if lastEventID != "" {
+		var err error
+		if missed, err = h.Service.GetBadgeNotificationsAfter(userID, afterID, streamReplayPageSize); err != nil {
+			respondWithError(c, http.StatusInternalServerError, err.Error())
+			return
+		}
+	}
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("X-Accel-Buffering", "no")
+	c.Status(http.StatusOK)
+
+	// Notifications sent while catching up may also have been received by the subscription
+	sent := make(map[int]bool)
+	for len(missed) > 0 {
+		for _, notification := range missed {
+			c.Render(-1, notificationEvent(notification))
+			sent[notification.ID] = true
+			afterID = notification.ID
+		}
+		if len(missed) < streamReplayPageSize {
+			break
+		}
+
+		var err error
+		if missed, err = h.Service.GetBadgeNotificationsAfter(userID, afterID, streamReplayPageSize); err != nil {
+			// The client resumes from the last notification sent when it reconnects
+			return
+		}
+	}
+	c.Writer.Flush()
+
+	heartbeat := time.NewTicker(streamHeartbeatInterval)
+	defer heartbeat.Stop()
+
+	c.Stream(func(w io.Writer) bool {
+		select {
+		case <-c.Request.Context().Done():
+			return false
+		case notification, ok := <-subscription.Notifications():
+			if !ok {
+				// The stream fell behind; the client resumes from the last notification sent
+				return false
+			}
+			if !sent[notification.ID] {
+				c.Render(-1, notificationEvent(notification))
+			}
+			return true
+		case <-heartbeat.C:
+			fmt.Fprint(w, ": keep-alive\n\n")
+			return true
+		}
+	})
+}
+
+// notificationEvent creates the Server-Sent Event of a badge notification
+func notificationEvent(notification notify.Notification) sse.Event {
+	return sse.Event{
+		Id:    strconv.Itoa(notification.ID),
+		Event: notification.Event,
+		Data:  notification,
+	}
+}
+
+// GetLeaderboard handles getting a page of a leaderboard
+func (h *Handler) GetLeaderboard(c *gin.Context) {
+	query := models.LeaderboardQuery{
+		By:   c.Query("by"),
+		From: c.Query("from"),
+		To:   c.Query("to"),
+	}
+	for _, param := range []struct {
+		name  string
+		value *int
+	}{{"badge_id", &query.BadgeID}, {"limit", &query.Limit}, {"offset", &query.Offset}} {
+		if value := c.Query(param.name); value != "" {
+			parsed, err := strconv.Atoi(value)
+			if err != nil || parsed < 0 {
+				respondWithError(c, http.StatusBadRequest, "Invalid "+param.name)
+				return
+			}
+			*param.value = parsed
+		}
+	}
+
+	leaderboard, err := h.Service.GetLeaderboard(query)
+	var validationErr *schema.ValidationError
+	if errors.As(err, &validationErr) {
+		respondWithValidationError(c, http.StatusBadRequest, validationErr)
+		return
+	}
+	if err != nil {
+		respondWithError(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, leaderboard)
+}
+
+// GetUserProfile handles getting a user's profile
+func (h *Handler) GetUserProfile(c *gin.Context) {
+	userID := c.Param("id")
+	if userID == "" {
+		respondWithError(c, http.StatusBadRequest, "User ID is required")
+		return
+	}
+
+	profile, err := h.Service.GetUserProfile(userID)
+	if err != nil {
+		respondWithError(c, http.StatusNotFound, err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, profile)
+}
+
+// UpdateUserProfile handles creating or replacing a user's profile
+func (h *Handler) UpdateUserProfile(c *gin.Context) {
+	userID := c.Param("id")
+	if userID == "" {
+		respondWithError(c, http.StatusBadRequest, "User ID is required")
+		return
+	}
+
+	var req models.UserProfileRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondWithError(c, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+
+	profile, err := h.Service.UpdateUserProfile(userID, &req)
+	var validationErr *schema.ValidationError
+	if errors.As(err, &validationErr) {
+		respondWithValidationError(c, http.StatusBadRequest, validationErr)
+		return
+	}
+	if err != nil {
+		respondWithError(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, profile)
+}
+
+// GetUserProgress handles getting a user's progress towards all active badges
+func (h *Handler) GetUserProgress(c *gin.Context) {
+	userID := c.Param("id")
+	if userID == "" {
+		respondWithError(c, http.StatusBadRequest, "User ID is required")
+		return
+	}
+
+	progress, err := h.Service.GetUserProgress(userID)
+	if err != nil {
+		respondWithError(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, progress)
+}
+
+// GetUserBadgeProgress handles getting a user's progress towards a single badge
+func (h *Handler) GetUserBadgeProgress(c *gin.Context) {
+	userID := c.Param("id")
+	if userID == "" {
+		respondWithError(c, http.StatusBadRequest, "User ID is required")
+		return
+	}
+
+	badgeID, err := strconv.Atoi(c.Param("badgeId"))
+	if err != nil {
+		respondWithError(c, http.StatusBadRequest, "Invalid badge ID format")
+		return
+	}
+
+	progress, err := h.Service.GetUserBadgeProgress(userID, badgeID)
+	if errors.Is(err, service.ErrBadgeNotFound) {
+		respondWithError(c, http.StatusNotFound, err.Error())
+		return
+	}
+	if err != nil {
+		respondWithError(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, progress)
+}
+
+// RevokeUserBadge handles manually revoking a badge from a user.
+// The audit reason is read from the JSON body or the reason query parameter.
+func (h *Handler) RevokeUserBadge(c *gin.Context) {
+	userID := c.Param("id")
+	if userID == "" {
+		respondWithError(c, http.StatusBadRequest, "User ID is required")
+		return
+	}
+
+	badgeID, err := strconv.Atoi(c.Param("badgeId"))
+	if err != nil {
+		respondWithError(c, http.StatusBadRequest, "Invalid badge ID format")
+		return
+	}
+
+	req := models.RevokeBadgeRequest{Reason: c.Query("reason")}
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			respondWithError(c, http.StatusBadRequest, "Invalid request payload")
+			return
+		}
+	}
+
+	if req.Reason == "" {
+		respondWithError(c, http.StatusBadRequest, "Revocation reason is required")
+		return
+	}
+
+	if err := h.Service.RevokeUserBadge(userID, badgeID, req.Reason); err != nil {
+		if errors.Is(err, service.ErrBadgeNotHeld) {
+			respondWithError(c, http.StatusNotFound, err.Error())
+			return
+		}
+		respondWithError(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Badge revoked successfully"})
+}
+
 // CreateConditionType handles creating a new condition type
 func (h *Handler) CreateConditionType(c *gin.Context) {
 	var req models.NewConditionTypeRequest
@@ -347,3 +831,310 @@ func (h *Handler) DeleteConditionType(c *gin.Context) {
 
 	c.JSON(http.StatusOK, gin.H{"message": "Condition type deleted successfully"})
 }
+
+// maxCalendarSize is the largest iCalendar file accepted when importing holidays
+const maxCalendarSize = 1 << 20
+
+// CreateHolidayCalendar handles creating a new holiday calendar
+func (h *Handler) CreateHolidayCalendar(c *gin.Context) {
+	var req models.NewHolidayCalendarRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondWithError(c, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+
+	calendar, err := h.Service.CreateHolidayCalendar(&req)
+	var validationErr *schema.ValidationError
+	if errors.As(err, &validationErr) {
+		respondWithValidationError(c, http.StatusBadRequest, validationErr)
+		return
+	}
+	if err != nil {
+		respondWithError(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	c.JSON(http.StatusCreated, calendar)
+}
+
+// GetHolidayCalendars handles getting all holiday calendars
+func (h *Handler) GetHolidayCalendars(c *gin.Context) {
+	calendars, err := h.Service.GetHolidayCalendars()
+	if err != nil {
+		respondWithError(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, calendars)
+}
+
+// GetHolidayCalendar handles getting a holiday calendar by ID
+func (h *Handler) GetHolidayCalendar(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		respondWithError(c, http.StatusBadRequest, "Invalid ID format")
+		return
+	}
+
+	calendar, err := h.Service.GetHolidayCalendarByID(id)
+	if err != nil {
+		respondWithError(c, http.StatusNotFound, err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, calendar)
+}
+
+// UpdateHolidayCalendar handles updating a holiday calendar
+func (h *Handler) UpdateHolidayCalendar(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		respondWithError(c, http.StatusBadRequest, "Invalid ID format")
+		return
+	}
+
+	var req models.UpdateHolidayCalendarRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondWithError(c, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+
+	calendar, err := h.Service.UpdateHolidayCalendar(id, &req)
+	var validationErr *schema.ValidationError
+	if errors.As(err, &validationErr) {
+		respondWithValidationError(c, http.StatusBadRequest, validationErr)
+		return
+	}
+	if err != nil {
+		respondWithError(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, calendar)
+}
+
+// ImportHolidayCalendar handles adding the holidays of an iCalendar file sent as the request
+// body to a holiday calendar; with ?replace=true they replace the calendar's holidays
+func (h *Handler) ImportHolidayCalendar(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		respondWithError(c, http.StatusBadRequest, "Invalid ID format")
+		return
+	}
+	replace := c.Query("replace") == "true"
+
+	calendar, err := h.Service.ImportHolidayCalendar(id, http.MaxBytesReader(c.Writer, c.Request.Body, maxCalendarSize), replace)
+	var validationErr *schema.ValidationError
+	if errors.As(err, &validationErr) {
+		respondWithValidationError(c, http.StatusBadRequest, validationErr)
+		return
+	}
+	if err != nil {
+		respondWithError(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, calendar)
+}
+
+// DeleteHolidayCalendar handles deleting a holiday calendar
+func (h *Handler) DeleteHolidayCalendar(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		respondWithError(c, http.StatusBadRequest, "Invalid ID format")
+		return
+	}
+
+	err = h.Service.DeleteHolidayCalendar(id)
+	var validationErr *schema.ValidationError
+	if errors.As(err, &validationErr) {
+		respondWithValidationError(c, http.StatusBadRequest, validationErr)
+		return
+	}
+	if err != nil {
+		respondWithError(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Holiday calendar deleted successfully"})
+}
+
+// CreateWebhookSubscription handles creating a new webhook subscription
+func (h *Handler) CreateWebhookSubscription(c *gin.Context) {
+	var req models.WebhookSubscriptionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondWithError(c, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+
+	subscription, err := h.Service.CreateWebhookSubscription(&req)
+	if err != nil {
+		respondWithError(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	c.JSON(http.StatusCreated, subscription)
+}
+
+// GetWebhookSubscriptions handles getting all webhook subscriptions
+func (h *Handler) GetWebhookSubscriptions(c *gin.Context) {
+	subscriptions, err := h.Service.GetWebhookSubscriptions()
+	if err != nil {
+		respondWithError(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, subscriptions)
+}
+
+// GetWebhookSubscription handles getting a webhook subscription by ID
+func (h *Handler) GetWebhookSubscription(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		respondWithError(c, http.StatusBadRequest, "Invalid ID format")
+		return
+	}
+
+	subscription, err := h.Service.GetWebhookSubscriptionByID(id)
+	if err != nil {
+		respondWithError(c, http.StatusNotFound, err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, subscription)
+}
+
+// UpdateWebhookSubscription handles updating a webhook subscription
+func (h *Handler) UpdateWebhookSubscription(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		respondWithError(c, http.StatusBadRequest, "Invalid ID format")
+		return
+	}
+
+	var req models.WebhookSubscriptionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondWithError(c, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+
+	subscription, err := h.Service.UpdateWebhookSubscription(id, &req)
+	if err != nil {
+		respondWithError(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, subscription)
+}
+
+// DeleteWebhookSubscription handles deleting a webhook subscription
+func (h *Handler) DeleteWebhookSubscription(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		respondWithError(c, http.StatusBadRequest, "Invalid ID format")
+		return
+	}
+
+	if err := h.Service.DeleteWebhookSubscription(id); err != nil {
+		respondWithError(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Webhook subscription deleted successfully"})
+}
+
+// GetWebhookDeliveries handles listing the most recent deliveries of a webhook subscription
+func (h *Handler) GetWebhookDeliveries(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		respondWithError(c, http.StatusBadRequest, "Invalid ID format")
+		return
+	}
+
+	limit := 100
+	if limitParam := c.Query("limit"); limitParam != "" {
+		parsed, err := strconv.Atoi(limitParam)
+		if err != nil || parsed <= 0 {
+			respondWithError(c, http.StatusBadRequest, "Invalid limit")
+			return
+		}
+		limit = parsed
+	}
+
+	deliveries, err := h.Service.GetWebhookDeliveries(id, limit)
+	if err != nil {
+		respondWithError(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, deliveries)
+}
+
+// StartBackfill handles starting a job that evaluates badges against every existing user
+func (h *Handler) StartBackfill(c *gin.Context) {
+	var req models.BackfillRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondWithError(c, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+
+	if len(req.BadgeIDs) == 0 {
+		respondWithError(c, http.StatusBadRequest, "At least one badge ID is required")
+		return
+	}
+
+	job, err := h.Service.StartBackfill(&req)
+	if errors.Is(err, service.ErrBackfillsDisabled) {
+		respondWithError(c, http.StatusServiceUnavailable, "Backfills are disabled")
+		return
+	}
+	var validationErr *schema.ValidationError
+	if errors.As(err, &validationErr) {
+		respondWithValidationError(c, http.StatusBadRequest, validationErr)
+		return
+	}
+	if err != nil {
+		respondWithError(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	c.JSON(http.StatusAccepted, job)
+}
+
+// GetBackfillJobs handles listing the most recent backfill jobs
+func (h *Handler) GetBackfillJobs(c *gin.Context) {
+	limit := 100
+	if limitParam := c.Query("limit"); limitParam != "" {
+		parsed, err := strconv.Atoi(limitParam)
+		if err != nil || parsed <= 0 {
+			respondWithError(c, http.StatusBadRequest, "Invalid limit")
+			return
+		}
+		limit = parsed
+	}
+
+	jobs, err := h.Service.GetBackfillJobs(limit)
+	if err != nil {
+		respondWithError(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, jobs)
+}
+
+// GetBackfillJob handles getting the status and progress of a backfill job
+func (h *Handler) GetBackfillJob(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		respondWithError(c, http.StatusBadRequest, "Invalid ID format")
+		return
+	}
+
+	job, err := h.Service.GetBackfillJob(id)
+	if err != nil {
+		respondWithError(c, http.StatusNotFound, err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, job)
+}
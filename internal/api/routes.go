@@ -21,9 +21,19 @@ func SetupRoutes(router *gin.Engine, handler *Handler) {
 
 		// User badges endpoints
 		v1.GET("/users/:id/badges", handler.GetUserBadges)
+		v1.GET("/users/:id/badges/stream", handler.StreamUserBadges)
+		v1.GET("/users/:id/badges/:badgeId/progress", handler.GetUserBadgeProgress)
+		v1.GET("/users/:id/progress", handler.GetUserProgress)
+		v1.GET("/users/:id/profile", handler.GetUserProfile)
+		v1.PUT("/users/:id/profile", handler.UpdateUserProfile)
 
-		// Event processing endpoint
+		// Leaderboards endpoint
+		v1.GET("/leaderboards", handler.GetLeaderboard)
+
+		// Event processing endpoints
 		v1.POST("/events", handler.ProcessEvent)
+		v1.POST("/events/batch", handler.ProcessEventBatch)
+		v1.GET("/events/:id", handler.GetEvent)
 
 		// Admin API endpoints
 		admin := v1.Group("/admin")
@@ -35,11 +45,21 @@ func SetupRoutes(router *gin.Engine, handler *Handler) {
 			admin.PUT("/event-types/:id", handler.UpdateEventType)
 			admin.DELETE("/event-types/:id", handler.DeleteEventType)
 
+			// Event processing
+			admin.GET("/events/dead-letters", handler.GetEventDeadLetters)
+
 			// Badge management
 			admin.POST("/badges", handler.CreateBadge)
+			admin.POST("/badges/validate", handler.ValidateBadge)
 			admin.GET("/badges/:id/criteria", handler.GetBadgeWithCriteria)
 			admin.PUT("/badges/:id", handler.UpdateBadge)
 			admin.DELETE("/badges/:id", handler.DeleteBadge)
+			admin.POST("/badges/evaluate", handler.EvaluateFlow)
+			admin.POST("/badges/:id/evaluate", handler.EvaluateBadge)
+
+			// User badges management
+			admin.DELETE("/users/:id/badges/:badgeId", handler.RevokeUserBadge)
+			admin.GET("/badges/stream", handler.StreamBadgeNotifications)
 
 			// Condition types management
 			admin.POST("/condition-types", handler.CreateConditionType)
@@ -47,6 +67,27 @@ func SetupRoutes(router *gin.Engine, handler *Handler) {
 			admin.GET("/condition-types/:id", handler.GetConditionType)
 			admin.PUT("/condition-types/:id", handler.UpdateConditionType)
 			admin.DELETE("/condition-types/:id", handler.DeleteConditionType)
+
+			// Holiday calendars management
+			admin.POST("/holiday-calendars", handler.CreateHolidayCalendar)
+			admin.GET("/holiday-calendars", handler.GetHolidayCalendars)
+			admin.GET("/holiday-calendars/:id", handler.GetHolidayCalendar)
+			admin.PUT("/holiday-calendars/:id", handler.UpdateHolidayCalendar)
+			admin.POST("/holiday-calendars/:id/import", handler.ImportHolidayCalendar)
+			admin.DELETE("/holiday-calendars/:id", handler.DeleteHolidayCalendar)
+
+			// Webhook subscriptions management
+			admin.POST("/webhooks", handler.CreateWebhookSubscription)
+			admin.GET("/webhooks", handler.GetWebhookSubscriptions)
+			admin.GET("/webhooks/:id", handler.GetWebhookSubscription)
+			admin.PUT("/webhooks/:id", handler.UpdateWebhookSubscription)
+			admin.DELETE("/webhooks/:id", handler.DeleteWebhookSubscription)
+			admin.GET("/webhooks/:id/deliveries", handler.GetWebhookDeliveries)
+
+			// Backfill jobs
+			admin.POST("/backfills", handler.StartBackfill)
+			admin.GET("/backfills", handler.GetBackfillJobs)
+			admin.GET("/backfills/:id", handler.GetBackfillJob)
 		}
 	}
 }
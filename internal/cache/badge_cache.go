@@ -159,16 +159,6 @@ type Event struct {
 	CreatedAt  time.Time
 }
 
-// BadgeProgress represents a user's progress towards earning a badge
-type BadgeProgress struct {
-	BadgeID      string
-	Badge        *Badge
-	UserID       string
-	Progress     float64
-	Requirements map[string]interface{}
-	UpdatedAt    time.Time
-}
-
 // BadgeService defines the operations for managing badges
 type BadgeService interface {
 	GetBadge(id string) (*Badge, error)
@@ -187,7 +177,6 @@ type UserBadgeService interface {
 // EvaluationService defines the operations for badge evaluation
 type EvaluationService interface {
 	EvaluateUserEvents(userID string, events []*Event) ([]*Badge, error)
-	GetUserProgress(userID string) ([]*BadgeProgress, error)
 }
 
 // CachedBadgeService provides cached access to badge operations
@@ -363,29 +352,3 @@ func (s *CachedEvaluationService) EvaluateUserEvents(userID string, events []*Ev
 
 	return s.nextService.EvaluateUserEvents(userID, events)
 }
-
-// GetUserProgress retrieves a user's progress towards badges, using the cache when possible
-func (s *CachedEvaluationService) GetUserProgress(userID string) ([]*BadgeProgress, error) {
-	cacheKey := "user_progress:" + userID
-
-	// Try to get the user progress from the cache
-	if cachedProgress, found := s.cache.Get(cacheKey); found {
-		return cachedProgress.([]*BadgeProgress), nil
-	}
-
-	// Get the user progress from the next service
-	progress, err := s.nextService.GetUserProgress(userID)
-	if err != nil {
-		return nil, err
-	}
-
-	// Cache the user progress
-	s.cache.Set(cacheKey, progress, 0) // Use default expiration
-
-	return progress, nil
-}
-
-// InvalidateUserCache invalidates all cache entries for a user
-func (s *CachedEvaluationService) InvalidateUserCache(userID string) {
-	s.cache.Delete("user_progress:" + userID)
-}
@@ -0,0 +1,438 @@
+package engine
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/badge-assignment-system/internal/models"
+)
+
+// policyDurationPattern matches policy durations such as "30m", "12h", "7d" or "2w"
+var policyDurationPattern = regexp.MustCompile(`^(\d+)([mhdw])$`)
+
+// PolicyDuration parses a duration used by badge repeat and expiry policies
+func PolicyDuration(value string) (time.Duration, error) {
+	matches := policyDurationPattern.FindStringSubmatch(value)
+	if matches == nil {
+		return 0, fmt.Errorf("invalid duration format: %s", value)
+	}
+
+	amount, _ := strconv.Atoi(matches[1])
+	switch matches[2] {
+	case "m":
+		return time.Duration(amount) * time.Minute, nil
+	case "h":
+		return time.Duration(amount) * time.Hour, nil
+	case "d":
+		return time.Duration(amount) * 24 * time.Hour, nil
+	default:
+		return time.Duration(amount) * 7 * 24 * time.Hour, nil
+	}
+}
+
+// ValidateRepeatPolicy checks that a badge repeat policy is well formed; a nil policy means once
+func ValidateRepeatPolicy(policy *models.RepeatPolicy) error {
+	if policy == nil {
+		return nil
+	}
+
+	switch policy.Type {
+	case models.RepeatOnce:
+		return nil
+	case models.RepeatPerPeriod:
+		if _, err := getPeriodKey(time.Now(), policy.Period); err != nil {
+			return fmt.Errorf("invalid repeat policy period: %w", err)
+		}
+		return nil
+	case models.RepeatUnlimited:
+		if policy.Cooldown == "" {
+			return nil
+		}
+		if _, err := PolicyDuration(policy.Cooldown); err != nil {
+			return fmt.Errorf("invalid repeat policy cooldown: %w", err)
+		}
+		return nil
+	default:
+		return fmt.Errorf("unsupported repeat policy type: %s", policy.Type)
+	}
+}
+
+// ValidateExpiryPolicy checks that a badge expiry policy is well formed; a nil policy means awards never lapse
+func ValidateExpiryPolicy(policy *models.ExpiryPolicy) error {
+	if policy == nil {
+		return nil
+	}
+
+	if policy.ValidFor != "" {
+		if _, err := PolicyDuration(policy.ValidFor); err != nil {
+			return fmt.Errorf("invalid expiry policy validity period: %w", err)
+		}
+	}
+	if policy.Recheck != "" {
+		if _, err := PolicyDuration(policy.Recheck); err != nil {
+			return fmt.Errorf("invalid expiry policy recheck interval: %w", err)
+		}
+	}
+	return nil
+}
+
+// activeAwards returns the awards the user still holds
+func activeAwards(awards []models.UserBadge, now time.Time) []models.UserBadge {
+	var active []models.UserBadge
+	for _, award := range awards {
+		if award.IsActive(now) {
+			active = append(active, award)
+		}
+	}
+	return active
+}
+
+// isManuallyRevoked checks whether an administrator revoked the badge from the user.
+// Such badges are never awarded again automatically, whereas expired ones can be earned anew.
+func isManuallyRevoked(awards []models.UserBadge) bool {
+	for _, award := range awards {
+		if award.Status == models.UserBadgeStatusRevoked {
+			return true
+		}
+	}
+	return false
+}
+
+// isRepeatable checks whether a badge the user already holds may be awarded again.
+// Awards with a tier mean the badge is tiered and higher tiers may still be reached.
+func isRepeatable(badge models.Badge, awards []models.UserBadge) bool {
+	if badge.RepeatPolicy != nil && badge.RepeatPolicy.Type != "" && badge.RepeatPolicy.Type != models.RepeatOnce {
+		return true
+	}
+	for _, award := range awards {
+		if award.Tier != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// processBadge evaluates a badge for a user given all of the user's previous awards of it,
+// including lapsed ones, and awards it according to the badge's tiers or repeat policy.
+// It returns the awards made.
+func (re *RuleEngine) processBadge(ctx *evaluationContext, badgeID int, awards []models.UserBadge) ([]models.UserBadge, error) {
+	badgeWithCriteria, err := re.DB.GetBadgeWithCriteria(badgeID)
+	if err != nil {
+		re.Logger.Error("Failed to get badge criteria: %v", err)
+		return nil, fmt.Errorf("failed to get badge criteria: %w", err)
+	}
+
+	if len(badgeWithCriteria.Tiers) > 0 {
+		return re.awardTiers(ctx, badgeWithCriteria, awards)
+	}
+	return re.awardRepeatable(ctx, badgeWithCriteria, awards)
+}
+
+// award records an award, setting its expiry from the badge's validity period. It reports
+// whether the award was recorded, which it is not when another evaluation of the same user
+// recorded it first. In a dry run the award is only counted by the caller.
+func (re *RuleEngine) award(ctx *evaluationContext, badge models.Badge, userBadge *models.UserBadge) (bool, error) {
+	userBadge.Status = models.UserBadgeStatusActive
+	if badge.ExpiryPolicy != nil && badge.ExpiryPolicy.ValidFor != "" {
+		validFor, err := PolicyDuration(badge.ExpiryPolicy.ValidFor)
+		if err != nil {
+			return false, fmt.Errorf("invalid expiry policy validity period: %w", err)
+		}
+		expiresAt := ctx.timeVars.now.Add(validFor)
+		userBadge.ExpiresAt = &expiresAt
+	}
+	if re.DryRun {
+		return true, nil
+	}
+	return re.DB.AwardBadgeToUser(userBadge)
+}
+
+// awardTiers awards the tiers of a badge in order of level, starting after the highest
+// tier the user holds and stopping at the first tier whose criteria are not met
+func (re *RuleEngine) awardTiers(ctx *evaluationContext, badge models.BadgeWithCriteria, awards []models.UserBadge) ([]models.UserBadge, error) {
+	current := currentTier(activeAwards(awards, ctx.timeVars.now))
+
+	var awarded []models.UserBadge
+	for _, tier := range badge.Tiers {
+		if tier.Level <= current {
+			continue
+		}
+
+		re.Logger.Debug("Evaluating tier %d (%s) of badge ID %d", tier.Level, tier.Name, badge.Badge.ID)
+		result, metadata, err := re.evaluateBadgeFlow(badge.Badge.ID, tier.FlowDefinition, ctx)
+		if err != nil {
+			return awarded, err
+		}
+		if !result {
+			re.Logger.Debug("Tier %d of badge ID %d not reached by user %s", tier.Level, badge.Badge.ID, ctx.userID)
+			break
+		}
+
+		// A tier that lapsed before is awarded again as a new occurrence
+		occurrence := 1
+		for _, award := range awards {
+			if award.Tier != nil && *award.Tier == tier.Level {
+				occurrence++
+			}
+		}
+
+		level := tier.Level
+		userBadge := &models.UserBadge{
+			UserID:     ctx.userID,
+			BadgeID:    badge.Badge.ID,
+			Metadata:   models.JSONB(metadata),
+			Tier:       &level,
+			Occurrence: occurrence,
+		}
+		recorded, err := re.award(ctx, badge.Badge, userBadge)
+		if err != nil {
+			return awarded, fmt.Errorf("failed to award tier %d: %w", tier.Level, err)
+		}
+		if !recorded {
+			re.Logger.Debug("Tier %d of badge ID %d was already awarded to user %s", tier.Level, badge.Badge.ID, ctx.userID)
+			continue
+		}
+		awarded = append(awarded, *userBadge)
+		re.Logger.Info("Tier %d (%s) of badge ID %d (%s) awarded to user %s",
+			tier.Level, tier.Name, badge.Badge.ID, badge.Badge.Name, ctx.userID)
+	}
+
+	return awarded, nil
+}
+
+// awardRepeatable awards an untiered badge according to its repeat policy.
+// Per-period badges only count events within the current period, and unlimited
+// badges only count events since the previous award, so every award is earned anew.
+func (re *RuleEngine) awardRepeatable(ctx *evaluationContext, badge models.BadgeWithCriteria, awards []models.UserBadge) ([]models.UserBadge, error) {
+	policy := badge.Badge.RepeatPolicy
+	now := ctx.timeVars.now
+	held := activeAwards(awards, now)
+
+	// Occurrences count lapsed awards too, so each award has its own number
+	userBadge := &models.UserBadge{
+		UserID:     ctx.userID,
+		BadgeID:    badge.Badge.ID,
+		Occurrence: len(awards) + 1,
+	}
+
+	switch {
+	case policy == nil || policy.Type == "" || policy.Type == models.RepeatOnce:
+		if len(held) > 0 {
+			return nil, nil
+		}
+
+	case policy.Type == models.RepeatPerPeriod:
+		// Periods start at midnight in the user's timezone
+		location, err := re.userLocation(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get user timezone: %w", err)
+		}
+		start, end, err := getPeriodBounds(now.In(location), policy.Period)
+		if err != nil {
+			return nil, err
+		}
+		periodKey, _ := getPeriodKey(now.In(location), policy.Period)
+		for _, award := range held {
+			if award.PeriodKey != nil && *award.PeriodKey == periodKey {
+				re.Logger.Debug("Badge ID %d already awarded to user %s for period %s",
+					badge.Badge.ID, ctx.userID, periodKey)
+				return nil, nil
+			}
+		}
+		ctx = ctx.withWindow(start, end)
+		userBadge.PeriodKey = &periodKey
+
+	case policy.Type == models.RepeatUnlimited:
+		if latest := latestAward(held); latest != nil {
+			if policy.Cooldown != "" {
+				cooldown, err := PolicyDuration(policy.Cooldown)
+				if err != nil {
+					return nil, fmt.Errorf("invalid repeat policy cooldown: %w", err)
+				}
+				if now.Before(latest.AwardedAt.Add(cooldown)) {
+					re.Logger.Debug("Badge ID %d is cooling down for user %s", badge.Badge.ID, ctx.userID)
+					return nil, nil
+				}
+			}
+			ctx = ctx.withWindow(latest.AwardedAt, now)
+		}
+
+	default:
+		return nil, fmt.Errorf("unsupported repeat policy type: %s", policy.Type)
+	}
+
+	result, metadata, err := re.evaluateBadgeFlow(badge.Badge.ID, criteriaFlow(badge.Criteria), ctx)
+	if err != nil {
+		return nil, err
+	}
+	if !result {
+		re.Logger.Debug("Badge criteria not met for badge ID %d for user %s", badge.Badge.ID, ctx.userID)
+		return nil, nil
+	}
+
+	userBadge.Metadata = models.JSONB(metadata)
+	recorded, err := re.award(ctx, badge.Badge, userBadge)
+	if err != nil {
+		return nil, fmt.Errorf("failed to award badge: %w", err)
+	}
+	if !recorded {
+		re.Logger.Debug("Badge ID %d was already awarded to user %s (occurrence %d)",
+			badge.Badge.ID, ctx.userID, userBadge.Occurrence)
+		return nil, nil
+	}
+	re.Logger.Info("Badge ID %d (%s) awarded to user %s (occurrence %d)",
+		badge.Badge.ID, badge.Badge.Name, ctx.userID, userBadge.Occurrence)
+	return []models.UserBadge{*userBadge}, nil
+}
+
+// LapsedAwards re-evaluates a user's active awards of a badge the way they were earned, and
+// returns the awards whose criteria the user no longer meets. Tiers are re-checked in order of
+// level, so a holder who no longer reaches a tier loses it and every tier above it. Per-period
+// awards only count the events of their own period, and unlimited awards the events since the
+// award held when they were made, even one that has lapsed since.
+func (re *RuleEngine) LapsedAwards(badgeID int, userID string) ([]models.UserBadge, error) {
+	ctx := newEvaluationContext(userID)
+
+	badgeWithCriteria, err := re.DB.GetBadgeWithCriteria(badgeID)
+	if err != nil {
+		re.Logger.Error("Failed to get badge criteria: %v", err)
+		return nil, fmt.Errorf("failed to get badge criteria: %w", err)
+	}
+
+	userBadges, err := re.DB.GetUserBadges(userID)
+	if err != nil {
+		re.Logger.Error("Failed to retrieve user badges: %v", err)
+		return nil, fmt.Errorf("failed to retrieve user badges: %w", err)
+	}
+	var awards []models.UserBadge
+	for _, award := range userBadges {
+		if award.BadgeID == badgeID {
+			awards = append(awards, award)
+		}
+	}
+	held := activeAwards(awards, ctx.timeVars.now)
+	if len(held) == 0 {
+		return nil, nil
+	}
+
+	if len(badgeWithCriteria.Tiers) > 0 {
+		return re.lapsedTiers(ctx, badgeWithCriteria, held)
+	}
+	return re.lapsedRepeatable(ctx, badgeWithCriteria, held, awards)
+}
+
+// lapsedTiers returns the tiers held above the highest tier whose criteria, and those of
+// every tier below it, the user still meets
+func (re *RuleEngine) lapsedTiers(ctx *evaluationContext, badge models.BadgeWithCriteria, held []models.UserBadge) ([]models.UserBadge, error) {
+	current := currentTier(held)
+
+	reached := 0
+	for _, tier := range badge.Tiers {
+		if tier.Level > current {
+			break
+		}
+		met, _, err := re.evaluateBadgeFlow(badge.Badge.ID, tier.FlowDefinition, ctx)
+		if err != nil {
+			return nil, err
+		}
+		if !met {
+			re.Logger.Debug("Tier %d of badge ID %d no longer reached by user %s", tier.Level, badge.Badge.ID, ctx.userID)
+			break
+		}
+		reached = tier.Level
+	}
+
+	var lapsed []models.UserBadge
+	for _, award := range held {
+		if award.Tier != nil && *award.Tier > reached {
+			lapsed = append(lapsed, award)
+		}
+	}
+	return lapsed, nil
+}
+
+// lapsedRepeatable returns the held awards of an untiered badge whose criteria the user no
+// longer meets, counting the same events as when each was awarded. All of the user's awards
+// of the badge, including lapsed ones, are needed to find the award each one followed.
+func (re *RuleEngine) lapsedRepeatable(ctx *evaluationContext, badge models.BadgeWithCriteria, held, awards []models.UserBadge) ([]models.UserBadge, error) {
+	policy := badge.Badge.RepeatPolicy
+	flowDefinition := criteriaFlow(badge.Criteria)
+
+	held = append([]models.UserBadge(nil), held...)
+	sort.Slice(held, func(i, j int) bool { return held[i].AwardedAt.Before(held[j].AwardedAt) })
+
+	var lapsed []models.UserBadge
+	for _, award := range held {
+		awardCtx := ctx
+		switch {
+		case policy != nil && policy.Type == models.RepeatPerPeriod && award.PeriodKey != nil:
+			location, err := re.userLocation(ctx)
+			if err != nil {
+				return nil, fmt.Errorf("failed to get user timezone: %w", err)
+			}
+			start, end, err := getPeriodBounds(award.AwardedAt.In(location), policy.Period)
+			if err != nil {
+				return nil, err
+			}
+			awardCtx = ctx.withWindow(start, end)
+		case policy != nil && policy.Type == models.RepeatUnlimited:
+			// Only the award held when this one was made started its window, as in awardRepeatable
+			if previous := latestAward(awardsHeldAt(awards, award.AwardedAt)); previous != nil {
+				awardCtx = ctx.withWindow(previous.AwardedAt, award.AwardedAt)
+			}
+		}
+
+		met, _, err := re.evaluateBadgeFlow(badge.Badge.ID, flowDefinition, awardCtx)
+		if err != nil {
+			return nil, err
+		}
+		if !met {
+			lapsed = append(lapsed, award)
+		}
+	}
+	return lapsed, nil
+}
+
+// awardsHeldAt returns the awards that were made before the given time and had not yet
+// expired or been revoked at it
+func awardsHeldAt(awards []models.UserBadge, at time.Time) []models.UserBadge {
+	var held []models.UserBadge
+	for _, award := range awards {
+		if !award.AwardedAt.Before(at) {
+			continue
+		}
+		if award.ExpiresAt != nil && !at.Before(*award.ExpiresAt) {
+			continue
+		}
+		if award.RevokedAt != nil && !at.Before(*award.RevokedAt) {
+			continue
+		}
+		held = append(held, award)
+	}
+	return held
+}
+
+// currentTier returns the highest tier level among a user's awards of a badge, or 0
+func currentTier(awards []models.UserBadge) int {
+	current := 0
+	for _, award := range awards {
+		if award.Tier != nil && *award.Tier > current {
+			current = *award.Tier
+		}
+	}
+	return current
+}
+
+// latestAward returns the most recent of a user's awards of a badge, or nil
+func latestAward(awards []models.UserBadge) *models.UserBadge {
+	var latest *models.UserBadge
+	for i := range awards {
+		if latest == nil || awards[i].AwardedAt.After(latest.AwardedAt) {
+			latest = &awards[i]
+		}
+	}
+	return latest
+}
@@ -0,0 +1,358 @@
+package engine
+
+import (
+	"testing"
+	"time"
+
+	"github.com/badge-assignment-system/internal/models"
+	"github.com/badge-assignment-system/internal/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+// checkInCountFlow requires at least count check-in events
+func checkInCountFlow(count float64) map[string]interface{} {
+	return map[string]interface{}{
+		"event":    "check-in",
+		"criteria": map[string]interface{}{"$eventCount": map[string]interface{}{"$gte": count}},
+	}
+}
+
+// checkIns creates one check-in event per given time
+func checkIns(userID string, times ...time.Time) []models.Event {
+	events := make([]models.Event, 0, len(times))
+	for i, t := range times {
+		events = append(events, models.Event{ID: i + 1, EventTypeID: 1, UserID: userID, OccurredAt: t, Payload: models.JSONB{}})
+	}
+	return events
+}
+
+// recordedAwards returns the awards passed to AwardBadgeToUser
+func recordedAwards(mockDB *testutil.MockDB) []*models.UserBadge {
+	var awards []*models.UserBadge
+	for _, call := range mockDB.Calls {
+		if call.Method == "AwardBadgeToUser" {
+			awards = append(awards, call.Arguments.Get(0).(*models.UserBadge))
+		}
+	}
+	return awards
+}
+
+// TestTieredBadgeAwardsTiersInOrder checks that tiers above the current one are awarded until one is not reached
+func TestTieredBadgeAwardsTiersInOrder(t *testing.T) {
+	mockDB := testutil.NewMockDB()
+
+	badge := testutil.CreateTestBadgeWithCriteria(1, "Regular", checkInCountFlow(1))
+	badge.Tiers = []models.BadgeTier{
+		{BadgeID: 1, Level: 1, Name: "Bronze", FlowDefinition: models.JSONB(checkInCountFlow(1))},
+		{BadgeID: 1, Level: 2, Name: "Silver", FlowDefinition: models.JSONB(checkInCountFlow(3))},
+		{BadgeID: 1, Level: 3, Name: "Gold", FlowDefinition: models.JSONB(checkInCountFlow(5))},
+		{BadgeID: 1, Level: 4, Name: "Platinum", FlowDefinition: models.JSONB(checkInCountFlow(10))},
+	}
+
+	bronze := 1
+	mockDB.On("GetActiveBadges").Return([]models.Badge{badge.Badge}, nil)
+	mockDB.On("GetUserBadges", "user-1").Return([]models.UserBadge{{UserID: "user-1", BadgeID: 1, Tier: &bronze, Occurrence: 1}}, nil)
+	mockDB.On("GetBadgeWithCriteria", 1).Return(badge, nil)
+	mockDB.On("GetEventTypeByName", "check-in").Return(models.EventType{ID: 1, Name: "check-in"}, nil)
+
+	now := time.Now()
+	mockDB.On("GetUserEvents", "user-1").Return(checkIns("user-1", now, now, now, now, now, now), nil)
+	mockDB.On("AwardBadgeToUser", mock.Anything).Return(true, nil)
+
+	engine := NewRuleEngine(mockDB)
+	result, err := engine.ProcessEvents("user-1")
+	require.NoError(t, err)
+
+	// Silver and Gold are reached, Platinum is not, and Bronze is not awarded again
+	awards := recordedAwards(mockDB)
+	require.Len(t, awards, 2)
+	assert.Equal(t, 2, *awards[0].Tier)
+	assert.Equal(t, 3, *awards[1].Tier)
+
+	// Both tiers are reported, for a single badge
+	require.Len(t, result.Awarded, 2)
+	assert.Equal(t, 2, *result.Awarded[0].Tier)
+	assert.Equal(t, 3, *result.Awarded[1].Tier)
+	assert.Equal(t, []int{1}, result.AwardedBadgeIDs())
+	assert.Equal(t, 1, result.Evaluated)
+}
+
+// TestAwardRecordedConcurrentlyIsNotReported checks that an award another evaluation of the
+// user recorded first is not reported again
+func TestAwardRecordedConcurrentlyIsNotReported(t *testing.T) {
+	mockDB := testutil.NewMockDB()
+
+	badge := testutil.CreateTestBadgeWithCriteria(1, "Regular", checkInCountFlow(1))
+	mockDB.On("GetActiveBadges").Return([]models.Badge{badge.Badge}, nil)
+	mockDB.On("GetUserBadges", "user-1").Return([]models.UserBadge{}, nil)
+	mockDB.On("GetBadgeWithCriteria", 1).Return(badge, nil)
+	mockDB.On("GetEventTypeByName", "check-in").Return(models.EventType{ID: 1, Name: "check-in"}, nil)
+	mockDB.On("GetUserEvents", "user-1").Return(checkIns("user-1", time.Now()), nil)
+	mockDB.On("AwardBadgeToUser", mock.Anything).Return(false, nil)
+
+	engine := NewRuleEngine(mockDB)
+	result, err := engine.ProcessEvents("user-1")
+	require.NoError(t, err)
+
+	assert.Len(t, recordedAwards(mockDB), 1)
+	assert.Empty(t, result.Awarded)
+	assert.Equal(t, 1, result.Evaluated)
+}
+
+// TestPerPeriodBadgeCountsCurrentPeriodOnly checks that a per-period badge is earned again each period
+func TestPerPeriodBadgeCountsCurrentPeriodOnly(t *testing.T) {
+	mockDB := testutil.NewMockDB()
+
+	badge := testutil.CreateTestBadgeWithCriteria(1, "Monthly Regular", checkInCountFlow(2))
+	badge.Badge.RepeatPolicy = &models.RepeatPolicy{Type: models.RepeatPerPeriod, Period: "month"}
+
+	now := time.Now().UTC()
+	lastMonth, _ := getPeriodKey(now.AddDate(0, -1, 0), "month")
+	mockDB.On("GetBadgeWithCriteria", 1).Return(badge, nil)
+	mockDB.On("GetEventTypeByName", "check-in").Return(models.EventType{ID: 1, Name: "check-in"}, nil)
+
+	// Only the events within the current month are loaded
+	start, end, err := getPeriodBounds(now, "month")
+	require.NoError(t, err)
+	mockDB.On("GetUserEventsInRange", "user-1", start, end).Return(checkIns("user-1", now, now), nil)
+	mockDB.On("AwardBadgeToUser", mock.Anything).Return(true, nil)
+
+	engine := NewRuleEngine(mockDB)
+	_, err = engine.processBadge(newEvaluationContext("user-1"), 1, []models.UserBadge{
+		{UserID: "user-1", BadgeID: 1, Occurrence: 1, PeriodKey: &lastMonth},
+	})
+	require.NoError(t, err)
+
+	awards := recordedAwards(mockDB)
+	require.Len(t, awards, 1)
+	thisMonth, _ := getPeriodKey(now, "month")
+	assert.Equal(t, thisMonth, *awards[0].PeriodKey)
+	assert.Equal(t, 2, awards[0].Occurrence)
+
+	// Once awarded for the period, the badge is not evaluated again until the next one
+	mockDB.Calls = nil
+	_, err = engine.processBadge(newEvaluationContext("user-1"), 1, []models.UserBadge{
+		{UserID: "user-1", BadgeID: 1, Occurrence: 2, PeriodKey: &thisMonth},
+	})
+	require.NoError(t, err)
+	assert.Empty(t, recordedAwards(mockDB))
+}
+
+// TestUnlimitedBadgeRespectsCooldown checks that an unlimited badge waits for its cooldown
+// and only counts the events since the previous award
+func TestUnlimitedBadgeRespectsCooldown(t *testing.T) {
+	mockDB := testutil.NewMockDB()
+
+	badge := testutil.CreateTestBadgeWithCriteria(1, "High Five", checkInCountFlow(1))
+	badge.Badge.RepeatPolicy = &models.RepeatPolicy{Type: models.RepeatUnlimited, Cooldown: "1d"}
+	mockDB.On("GetBadgeWithCriteria", 1).Return(badge, nil)
+	mockDB.On("GetEventTypeByName", "check-in").Return(models.EventType{ID: 1, Name: "check-in"}, nil)
+	mockDB.On("AwardBadgeToUser", mock.Anything).Return(true, nil)
+
+	engine := NewRuleEngine(mockDB)
+	now := time.Now().UTC()
+
+	// Awarded an hour ago: still cooling down
+	recent := []models.UserBadge{{UserID: "user-1", BadgeID: 1, Occurrence: 1, AwardedAt: now.Add(-time.Hour)}}
+	awarded, err := engine.processBadge(newEvaluationContext("user-1"), 1, recent)
+	require.NoError(t, err)
+	assert.Empty(t, awarded)
+	mockDB.AssertNotCalled(t, "GetEventTypeByName", "check-in")
+
+	// Awarded two days ago: evaluated against the events since then
+	lastAward := now.AddDate(0, 0, -2)
+	mockDB.On("GetUserEventsInRange", "user-1", lastAward, mock.Anything).Return(checkIns("user-1", now.Add(-time.Hour)), nil)
+	awarded, err = engine.processBadge(newEvaluationContext("user-1"), 1, []models.UserBadge{
+		{UserID: "user-1", BadgeID: 1, Occurrence: 1, AwardedAt: lastAward},
+	})
+	require.NoError(t, err)
+	assert.Len(t, awarded, 1)
+
+	awards := recordedAwards(mockDB)
+	require.Len(t, awards, 1)
+	assert.Equal(t, 2, awards[0].Occurrence)
+}
+
+func TestGetPeriodBounds(t *testing.T) {
+	at := time.Date(2024, time.May, 15, 13, 30, 0, 0, time.UTC)
+
+	start, end, err := getPeriodBounds(at, "quarter")
+	require.NoError(t, err)
+	assert.Equal(t, time.Date(2024, time.April, 1, 0, 0, 0, 0, time.UTC), start)
+	assert.Equal(t, time.Date(2024, time.July, 1, 0, 0, 0, 0, time.UTC).Add(-time.Nanosecond), end)
+
+	start, _, err = getPeriodBounds(at, "week")
+	require.NoError(t, err)
+	assert.Equal(t, time.Date(2024, time.May, 13, 0, 0, 0, 0, time.UTC), start)
+
+	_, _, err = getPeriodBounds(at, "fortnight")
+	assert.Error(t, err)
+}
+
+func TestValidateRepeatPolicy(t *testing.T) {
+	assert.NoError(t, ValidateRepeatPolicy(nil))
+	assert.NoError(t, ValidateRepeatPolicy(&models.RepeatPolicy{Type: models.RepeatPerPeriod, Period: "quarter"}))
+	assert.NoError(t, ValidateRepeatPolicy(&models.RepeatPolicy{Type: models.RepeatUnlimited, Cooldown: "12h"}))
+	assert.Error(t, ValidateRepeatPolicy(&models.RepeatPolicy{Type: models.RepeatPerPeriod, Period: "fortnight"}))
+	assert.Error(t, ValidateRepeatPolicy(&models.RepeatPolicy{Type: models.RepeatUnlimited, Cooldown: "soon"}))
+	assert.Error(t, ValidateRepeatPolicy(&models.RepeatPolicy{Type: "sometimes"}))
+}
+
+// TestLapsedBadgesAreEarnedAgain checks that expired awards can be earned anew with an
+// expiry set from the validity period, while manually revoked badges are never re-awarded
+func TestLapsedBadgesAreEarnedAgain(t *testing.T) {
+	mockDB := testutil.NewMockDB()
+
+	expiring := testutil.CreateTestBadgeWithCriteria(1, "Consistency King", checkInCountFlow(1))
+	expiring.Badge.ExpiryPolicy = &models.ExpiryPolicy{ValidFor: "30d"}
+	revoked := testutil.CreateTestBadgeWithCriteria(2, "Early Bird", checkInCountFlow(1))
+
+	now := time.Now().UTC()
+	lapsedAt := now.Add(-time.Hour)
+	mockDB.On("GetActiveBadges").Return([]models.Badge{expiring.Badge, revoked.Badge}, nil)
+	mockDB.On("GetUserBadges", "user-1").Return([]models.UserBadge{
+		{UserID: "user-1", BadgeID: 1, Occurrence: 1, Status: models.UserBadgeStatusActive, ExpiresAt: &lapsedAt},
+		{UserID: "user-1", BadgeID: 2, Occurrence: 1, Status: models.UserBadgeStatusRevoked},
+	}, nil)
+	mockDB.On("GetBadgeWithCriteria", 1).Return(expiring, nil)
+	mockDB.On("GetBadgeWithCriteria", 2).Return(revoked, nil)
+	mockDB.On("GetEventTypeByName", "check-in").Return(models.EventType{ID: 1, Name: "check-in"}, nil)
+	mockDB.On("GetUserEvents", "user-1").Return(checkIns("user-1", now), nil)
+	mockDB.On("AwardBadgeToUser", mock.Anything).Return(true, nil)
+
+	engine := NewRuleEngine(mockDB)
+	_, err := engine.ProcessEvents("user-1")
+	require.NoError(t, err)
+
+	// The revoked badge's criteria are only read when the award looks for dependent badges
+	revokedReads := 0
+	for _, call := range mockDB.Calls {
+		if call.Method == "GetBadgeWithCriteria" && call.Arguments.Int(0) == 2 {
+			revokedReads++
+		}
+	}
+	assert.Equal(t, 1, revokedReads)
+	awards := recordedAwards(mockDB)
+	require.Len(t, awards, 1)
+	assert.Equal(t, 1, awards[0].BadgeID)
+	assert.Equal(t, 2, awards[0].Occurrence)
+	require.NotNil(t, awards[0].ExpiresAt)
+	assert.WithinDuration(t, now.AddDate(0, 0, 30), *awards[0].ExpiresAt, time.Minute)
+}
+
+// TestDryRunCountsAwardsWithoutRecordingThem checks that a dry run reports the awards it would make
+func TestDryRunCountsAwardsWithoutRecordingThem(t *testing.T) {
+	mockDB := testutil.NewMockDB()
+
+	badge := testutil.CreateTestBadgeWithCriteria(1, "Regular", checkInCountFlow(1))
+	badge.Tiers = []models.BadgeTier{
+		{BadgeID: 1, Level: 1, Name: "Bronze", FlowDefinition: models.JSONB(checkInCountFlow(1))},
+		{BadgeID: 1, Level: 2, Name: "Silver", FlowDefinition: models.JSONB(checkInCountFlow(3))},
+	}
+
+	mockDB.On("GetActiveBadges").Return([]models.Badge{badge.Badge}, nil)
+	mockDB.On("GetUserBadges", "user-1").Return([]models.UserBadge{}, nil)
+	mockDB.On("GetBadgeWithCriteria", 1).Return(badge, nil)
+	mockDB.On("GetEventTypeByName", "check-in").Return(models.EventType{ID: 1, Name: "check-in"}, nil)
+	now := time.Now()
+	mockDB.On("GetUserEvents", "user-1").Return(checkIns("user-1", now, now, now), nil)
+
+	engine := NewRuleEngine(mockDB)
+	engine.DryRun = true
+	result, err := engine.ProcessBadges("user-1", []models.Badge{badge.Badge})
+	require.NoError(t, err)
+
+	// Both tiers are reached, and the badge is counted once
+	assert.Len(t, result.Awarded, 2)
+	assert.Equal(t, []int{1}, result.AwardedBadgeIDs())
+	assert.Empty(t, recordedAwards(mockDB))
+}
+
+// TestLapsedAwardsDropsTiersNoLongerReached checks that a holder who no longer reaches a tier
+// loses it and the tiers above it
+func TestLapsedAwardsDropsTiersNoLongerReached(t *testing.T) {
+	badge := badgeWithFlow(1, "Regular", checkInCountFlow(1))
+	badge.Tiers = []models.BadgeTier{
+		{BadgeID: 1, Level: 1, Name: "Bronze", FlowDefinition: models.JSONB(checkInCountFlow(1))},
+		{BadgeID: 1, Level: 2, Name: "Silver", FlowDefinition: models.JSONB(checkInCountFlow(3))},
+		{BadgeID: 1, Level: 3, Name: "Gold", FlowDefinition: models.JSONB(checkInCountFlow(5))},
+	}
+
+	now := time.Now()
+	bronze, silver, gold := 1, 2, 3
+	db := &awardingDB{
+		badges: []models.BadgeWithCriteria{badge},
+		events: checkIns("user-1", now, now),
+		awards: []models.UserBadge{
+			{ID: 1, UserID: "user-1", BadgeID: 1, Tier: &bronze, Status: models.UserBadgeStatusActive},
+			{ID: 2, UserID: "user-1", BadgeID: 1, Tier: &silver, Status: models.UserBadgeStatusActive},
+			{ID: 3, UserID: "user-1", BadgeID: 1, Tier: &gold, Status: models.UserBadgeStatusActive},
+		},
+	}
+
+	lapsed, err := NewRuleEngine(db).LapsedAwards(1, "user-1")
+	require.NoError(t, err)
+
+	var ids []int
+	for _, award := range lapsed {
+		ids = append(ids, award.ID)
+	}
+	assert.Equal(t, []int{2, 3}, ids)
+}
+
+// TestLapsedAwardsChecksPerPeriodAwardsInTheirPeriod checks that each per-period award is
+// re-checked against the events of the period it was awarded for
+func TestLapsedAwardsChecksPerPeriodAwardsInTheirPeriod(t *testing.T) {
+	badge := badgeWithFlow(1, "Monthly Regular", checkInCountFlow(2))
+	badge.Badge.RepeatPolicy = &models.RepeatPolicy{Type: models.RepeatPerPeriod, Period: "month"}
+
+	now := time.Now().UTC()
+	thisMonthStart, _, err := getPeriodBounds(now, "month")
+	require.NoError(t, err)
+	lastMonth := thisMonthStart.Add(-24 * time.Hour)
+	lastMonthKey, _ := getPeriodKey(lastMonth, "month")
+	thisMonthKey, _ := getPeriodKey(now, "month")
+
+	db := &awardingDB{
+		badges: []models.BadgeWithCriteria{badge},
+		events: checkIns("user-1", lastMonth, now, now),
+		awards: []models.UserBadge{
+			{ID: 1, UserID: "user-1", BadgeID: 1, Occurrence: 1, PeriodKey: &lastMonthKey, AwardedAt: lastMonth, Status: models.UserBadgeStatusActive},
+			{ID: 2, UserID: "user-1", BadgeID: 1, Occurrence: 2, PeriodKey: &thisMonthKey, AwardedAt: now, Status: models.UserBadgeStatusActive},
+		},
+	}
+
+	// Last month's single check-in no longer meets the criteria, this month's two do
+	lapsed, err := NewRuleEngine(db).LapsedAwards(1, "user-1")
+	require.NoError(t, err)
+	require.Len(t, lapsed, 1)
+	assert.Equal(t, 1, lapsed[0].ID)
+}
+
+// TestLapsedAwardsChecksFirstHeldUnlimitedAwardSincePreviousAward checks that the first held
+// award of an unlimited badge only counts the events since the award held when it was made,
+// even though that award has expired since
+func TestLapsedAwardsChecksFirstHeldUnlimitedAwardSincePreviousAward(t *testing.T) {
+	badge := badgeWithFlow(1, "High Five", checkInCountFlow(1))
+	badge.Badge.RepeatPolicy = &models.RepeatPolicy{Type: models.RepeatUnlimited, Cooldown: "1d"}
+
+	now := time.Now().UTC()
+	expiredAt := now.AddDate(0, 0, -1)
+	db := &awardingDB{
+		badges: []models.BadgeWithCriteria{badge},
+		events: checkIns("user-1", now.AddDate(0, 0, -20)),
+		awards: []models.UserBadge{
+			{ID: 1, UserID: "user-1", BadgeID: 1, Occurrence: 1, AwardedAt: now.AddDate(0, 0, -10),
+				ExpiresAt: &expiredAt, RevokedAt: &expiredAt, Status: models.UserBadgeStatusExpired},
+			{ID: 2, UserID: "user-1", BadgeID: 1, Occurrence: 2, AwardedAt: now.AddDate(0, 0, -2), Status: models.UserBadgeStatusActive},
+		},
+	}
+
+	// The only check-in predates the first award, so it does not count towards the second
+	lapsed, err := NewRuleEngine(db).LapsedAwards(1, "user-1")
+	require.NoError(t, err)
+	require.Len(t, lapsed, 1)
+	assert.Equal(t, 2, lapsed[0].ID)
+}
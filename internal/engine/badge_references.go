@@ -0,0 +1,352 @@
+package engine
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/badge-assignment-system/internal/models"
+)
+
+// badgeRef identifies a badge referenced from a flow, either by ID or by name
+type badgeRef struct {
+	id   int
+	name string
+}
+
+// String returns the reference as written in the flow
+func (r badgeRef) String() string {
+	if r.name != "" {
+		return r.name
+	}
+	return fmt.Sprintf("%d", r.id)
+}
+
+// parseBadgeRef reads a badge reference, which is either a badge ID or a badge name
+func parseBadgeRef(value interface{}) (badgeRef, error) {
+	switch v := value.(type) {
+	case string:
+		if v == "" {
+			return badgeRef{}, errors.New("badge name must not be empty")
+		}
+		return badgeRef{name: v}, nil
+	default:
+		id, err := toFloat64(v)
+		if err != nil || id < 1 || id != float64(int(id)) {
+			return badgeRef{}, fmt.Errorf("invalid badge reference: %v", value)
+		}
+		return badgeRef{id: int(id)}, nil
+	}
+}
+
+// awardFilter selects the awards a badge operator counts
+type awardFilter struct {
+	minTier int           // Minimum tier held; 0 accepts any award
+	within  time.Duration // Only awards earned this recently count; 0 accepts any
+}
+
+// parseAwardFilter reads the optional "tier" and "within" settings of a badge operator
+func parseAwardFilter(criteria map[string]interface{}) (awardFilter, error) {
+	var filter awardFilter
+	if tier, ok := criteria["tier"]; ok {
+		level, err := toFloat64(tier)
+		if err != nil || level < 1 {
+			return filter, fmt.Errorf("invalid tier: %v", tier)
+		}
+		filter.minTier = int(level)
+	}
+	if within, ok := criteria["within"]; ok {
+		str, _ := within.(string)
+		duration, err := PolicyDuration(str)
+		if err != nil {
+			return filter, fmt.Errorf("invalid within duration: %w", err)
+		}
+		filter.within = duration
+	}
+	return filter, nil
+}
+
+// evaluateHasBadgeCriteria checks whether the user holds a badge. The criteria is a badge ID
+// or name, or an object {"badge": ..., "tier": 2, "within": "30d"}.
+func (re *RuleEngine) evaluateHasBadgeCriteria(value interface{}, ctx *evaluationContext, metadata map[string]interface{}) (bool, error) {
+	badge := value
+	var filter awardFilter
+	if criteria, ok := value.(map[string]interface{}); ok {
+		badge = criteria["badge"]
+		var err error
+		if filter, err = parseAwardFilter(criteria); err != nil {
+			return false, fmt.Errorf("invalid $hasBadge criteria: %w", err)
+		}
+	}
+
+	ref, err := parseBadgeRef(badge)
+	if err != nil {
+		return false, fmt.Errorf("invalid $hasBadge criteria: %w", err)
+	}
+
+	held, err := re.heldBadges(ctx, filter)
+	if err != nil {
+		return false, err
+	}
+	badgeID, err := re.resolveBadgeRef(ctx, ref)
+	if err != nil {
+		return false, err
+	}
+
+	result := held[badgeID]
+	metadata[fmt.Sprintf("has_badge_%s", ref)] = result
+	re.Logger.Debug("User %s holds badge %s: %v", ctx.userID, ref, result)
+	return result, nil
+}
+
+// evaluateBadgeCountCriteria checks how many of a list of badges the user holds, as in
+// {"badges": ["Early Bird", 4, "Night Owl"], "count": {"$gte": 2}, "within": "90d"}
+func (re *RuleEngine) evaluateBadgeCountCriteria(criteria map[string]interface{}, ctx *evaluationContext, metadata map[string]interface{}) (bool, error) {
+	badges, ok := criteria["badges"].([]interface{})
+	if !ok || len(badges) == 0 {
+		return false, errors.New("$badgeCount requires a non-empty 'badges' array")
+	}
+	count, ok := criteria["count"].(map[string]interface{})
+	if !ok {
+		return false, errors.New("$badgeCount requires a 'count' comparison object")
+	}
+	filter, err := parseAwardFilter(criteria)
+	if err != nil {
+		return false, fmt.Errorf("invalid $badgeCount criteria: %w", err)
+	}
+
+	held, err := re.heldBadges(ctx, filter)
+	if err != nil {
+		return false, err
+	}
+
+	matched := make(map[int]bool)
+	for _, badge := range badges {
+		ref, err := parseBadgeRef(badge)
+		if err != nil {
+			return false, fmt.Errorf("invalid $badgeCount criteria: %w", err)
+		}
+		badgeID, err := re.resolveBadgeRef(ctx, ref)
+		if err != nil {
+			return false, err
+		}
+		if held[badgeID] {
+			matched[badgeID] = true
+		}
+	}
+
+	metadata["badge_count"] = len(matched)
+	re.Logger.Debug("User %s holds %d of %d listed badges", ctx.userID, len(matched), len(badges))
+	return re.evaluateNumericCriteria(float64(len(matched)), count)
+}
+
+// heldBadges returns the IDs of the badges the user holds with an award matching the filter.
+// Inside a $timeWindow only awards earned within the window count.
+func (re *RuleEngine) heldBadges(ctx *evaluationContext, filter awardFilter) (map[int]bool, error) {
+	awards, err := re.userAwards(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user badges: %w", err)
+	}
+
+	now := ctx.timeVars.now
+	held := make(map[int]bool)
+	for _, award := range awards {
+		if !award.IsActive(now) {
+			continue
+		}
+		if filter.minTier > 0 && (award.Tier == nil || *award.Tier < filter.minTier) {
+			continue
+		}
+		if filter.within > 0 && award.AwardedAt.Before(now.Add(-filter.within)) {
+			continue
+		}
+		if ctx.window != nil && !ctx.window.contains(award.AwardedAt) {
+			continue
+		}
+		held[award.BadgeID] = true
+	}
+	return held, nil
+}
+
+// userAwards returns the user's awards, loading them once per evaluation pass
+func (re *RuleEngine) userAwards(ctx *evaluationContext) ([]models.UserBadge, error) {
+	snapshot := ctx.snapshot
+	if !snapshot.awardsLoaded {
+		awards, err := re.DB.GetUserBadges(ctx.userID)
+		if err != nil {
+			return nil, err
+		}
+		snapshot.awards = awards
+		snapshot.awardsLoaded = true
+	}
+	return snapshot.awards, nil
+}
+
+// resolveBadgeRef returns the ID of a referenced badge, looking names up among the active badges
+func (re *RuleEngine) resolveBadgeRef(ctx *evaluationContext, ref badgeRef) (int, error) {
+	if ref.name == "" {
+		return ref.id, nil
+	}
+
+	if ctx.snapshot.badgeIDs == nil {
+		badges, err := re.DB.GetActiveBadges()
+		if err != nil {
+			return 0, fmt.Errorf("failed to retrieve active badges: %w", err)
+		}
+		ctx.snapshot.badgeIDs = make(map[string]int, len(badges))
+		for _, badge := range badges {
+			ctx.snapshot.badgeIDs[badge.Name] = badge.ID
+		}
+	}
+
+	badgeID, ok := ctx.snapshot.badgeIDs[ref.name]
+	if !ok {
+		return 0, fmt.Errorf("badge '%s' not found", ref.name)
+	}
+	return badgeID, nil
+}
+
+// collectBadgeReferences returns the badges referenced by $hasBadge and $badgeCount anywhere in a flow
+func collectBadgeReferences(flow interface{}, refs []badgeRef) []badgeRef {
+	switch v := flow.(type) {
+	case []interface{}:
+		for _, item := range v {
+			refs = collectBadgeReferences(item, refs)
+		}
+	case models.JSONB:
+		return collectBadgeReferences(map[string]interface{}(v), refs)
+	case map[string]interface{}:
+		for key, value := range v {
+			switch key {
+			case "$hasBadge":
+				badge := value
+				if criteria, ok := value.(map[string]interface{}); ok {
+					badge = criteria["badge"]
+				}
+				if ref, err := parseBadgeRef(badge); err == nil {
+					refs = append(refs, ref)
+				}
+			case "$badgeCount":
+				criteria, _ := value.(map[string]interface{})
+				badges, _ := criteria["badges"].([]interface{})
+				for _, badge := range badges {
+					if ref, err := parseBadgeRef(badge); err == nil {
+						refs = append(refs, ref)
+					}
+				}
+			default:
+				refs = collectBadgeReferences(value, refs)
+			}
+		}
+	}
+	return refs
+}
+
+// badgeFlows returns every flow definition of a badge: its criteria and the criteria of its tiers
+func badgeFlows(badge models.BadgeWithCriteria) []models.JSONB {
+	flows := []models.JSONB{criteriaFlow(badge.Criteria)}
+	for _, tier := range badge.Tiers {
+		flows = append(flows, tier.FlowDefinition)
+	}
+	return flows
+}
+
+// CheckBadgeReferences validates the badges referenced by the flows of a badge about to be
+// saved and makes sure saving it does not create a cycle between badge definitions, which
+// would make their awards depend on each other. The badge's ID is 0 when it is being created.
+// The flows must have their $condition calls expanded.
+func CheckBadgeReferences(db DBInterface, badge models.Badge, flows []models.JSONB) error {
+	var refs []badgeRef
+	for _, flow := range flows {
+		refs = collectBadgeReferences(flow, refs)
+	}
+	if len(refs) == 0 {
+		return nil
+	}
+
+	badges, err := db.GetActiveBadges()
+	if err != nil {
+		return fmt.Errorf("failed to retrieve active badges: %w", err)
+	}
+
+	// Index the other active badges together with the badge being saved
+	names := map[int]string{badge.ID: badge.Name}
+	ids := map[string]int{badge.Name: badge.ID}
+	for _, other := range badges {
+		if other.ID == badge.ID {
+			continue
+		}
+		names[other.ID] = other.Name
+		if _, taken := ids[other.Name]; !taken {
+			ids[other.Name] = other.ID
+		}
+	}
+
+	resolve := func(ref badgeRef) (int, bool) {
+		if ref.name != "" {
+			id, ok := ids[ref.name]
+			return id, ok
+		}
+		_, ok := names[ref.id]
+		return ref.id, ok
+	}
+
+	// The badge being saved must only reference existing active badges
+	edges := make(map[int][]int)
+	for _, ref := range refs {
+		id, ok := resolve(ref)
+		if !ok {
+			return fmt.Errorf("referenced badge '%s' not found among active badges", ref)
+		}
+		edges[badge.ID] = append(edges[badge.ID], id)
+	}
+
+	for _, other := range badges {
+		if other.ID == badge.ID {
+			continue
+		}
+		otherWithCriteria, err := db.GetBadgeWithCriteria(other.ID)
+		if err != nil {
+			return fmt.Errorf("failed to get criteria for badge ID %d: %w", other.ID, err)
+		}
+		var otherRefs []badgeRef
+		for _, flow := range expandBadgeFlows(db, otherWithCriteria) {
+			otherRefs = collectBadgeReferences(flow, otherRefs)
+		}
+		for _, ref := range otherRefs {
+			// Dangling references of other badges are reported when they are evaluated
+			if id, ok := resolve(ref); ok {
+				edges[other.ID] = append(edges[other.ID], id)
+			}
+		}
+	}
+
+	// Any new cycle must pass through the badge being saved
+	if path := findCycle(edges, badge.ID, badge.ID, map[int]bool{}); path != nil {
+		labels := []string{badge.Name}
+		for _, id := range path {
+			labels = append(labels, names[id])
+		}
+		return fmt.Errorf("badge dependency cycle: %s", strings.Join(labels, " -> "))
+	}
+	return nil
+}
+
+// findCycle searches for a path of references from a badge back to the target,
+// returning the badges along the path
+func findCycle(edges map[int][]int, from, target int, visited map[int]bool) []int {
+	for _, next := range edges[from] {
+		if next == target {
+			return []int{next}
+		}
+		if visited[next] {
+			continue
+		}
+		visited[next] = true
+		if path := findCycle(edges, next, target, visited); path != nil {
+			return append([]int{next}, path...)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,220 @@
+package engine
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/badge-assignment-system/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// awardingDB is an in-memory DBInterface whose awards are visible to later reads of the user's badges
+type awardingDB struct {
+	badges     []models.BadgeWithCriteria
+	events     []models.Event
+	awards     []models.UserBadge
+	conditions []models.ConditionType
+	calendars  []models.HolidayCalendar
+}
+
+func (db *awardingDB) GetBadgeWithCriteria(id int) (models.BadgeWithCriteria, error) {
+	for _, badge := range db.badges {
+		if badge.Badge.ID == id {
+			return badge, nil
+		}
+	}
+	return models.BadgeWithCriteria{}, fmt.Errorf("badge %d not found", id)
+}
+
+func (db *awardingDB) GetEventTypeByName(name string) (models.EventType, error) {
+	return models.EventType{ID: 1, Name: name}, nil
+}
+
+func (db *awardingDB) GetEventTypeByID(id int) (models.EventType, error) {
+	return models.EventType{ID: id, Name: "check-in"}, nil
+}
+
+func (db *awardingDB) GetUserEventsByType(userID string, eventTypeID int) ([]models.Event, error) {
+	return append([]models.Event(nil), db.events...), nil
+}
+
+func (db *awardingDB) GetUserEvents(userID string) ([]models.Event, error) {
+	return append([]models.Event(nil), db.events...), nil
+}
+
+func (db *awardingDB) GetUserEventsInRange(userID string, start, end time.Time) ([]models.Event, error) {
+	return append([]models.Event(nil), db.events...), nil
+}
+
+func (db *awardingDB) GetActiveBadges() ([]models.Badge, error) {
+	var badges []models.Badge
+	for _, badge := range db.badges {
+		badges = append(badges, badge.Badge)
+	}
+	return badges, nil
+}
+
+func (db *awardingDB) GetUserBadges(userID string) ([]models.UserBadge, error) {
+	return db.awards, nil
+}
+
+func (db *awardingDB) AwardBadgeToUser(userBadge *models.UserBadge) (bool, error) {
+	userBadge.ID = len(db.awards) + 1
+	userBadge.AwardedAt = time.Now()
+	userBadge.Notification = &models.WebhookOutbox{
+		ID:        userBadge.ID,
+		EventType: models.WebhookEventBadgeAwarded,
+		UserID:    userBadge.UserID,
+		BadgeID:   userBadge.BadgeID,
+		Payload:   models.JSONB{"user_badge_id": userBadge.ID, "tier": userBadge.Tier},
+		CreatedAt: userBadge.AwardedAt,
+	}
+	db.awards = append(db.awards, *userBadge)
+	return true, nil
+}
+
+func (db *awardingDB) GetUserTimezone(userID string) (string, error) {
+	return "", nil
+}
+
+func (db *awardingDB) GetHolidayCalendarByName(name string) (models.HolidayCalendar, error) {
+	for _, calendar := range db.calendars {
+		if calendar.Name == name {
+			return calendar, nil
+		}
+	}
+	return models.HolidayCalendar{}, fmt.Errorf("holiday calendar '%s' not found", name)
+}
+
+func (db *awardingDB) GetConditionTypeByName(name string) (models.ConditionType, error) {
+	for _, conditionType := range db.conditions {
+		if conditionType.Name == name {
+			return conditionType, nil
+		}
+	}
+	return models.ConditionType{}, fmt.Errorf("condition type '%s' not found", name)
+}
+
+// badgeWithFlow creates an active badge with the given criteria
+func badgeWithFlow(id int, name string, flow map[string]interface{}) models.BadgeWithCriteria {
+	return models.BadgeWithCriteria{
+		Badge:    models.Badge{ID: id, Name: name, Active: true},
+		Criteria: models.BadgeCriteria{BadgeID: id, FlowDefinition: models.JSONB(flow)},
+	}
+}
+
+func TestBadgeOperators(t *testing.T) {
+	now := time.Now()
+	silver := 2
+	db := &awardingDB{
+		badges: []models.BadgeWithCriteria{
+			badgeWithFlow(1, "Early Bird", checkInCountFlow(1)),
+			badgeWithFlow(2, "Night Owl", checkInCountFlow(1)),
+			badgeWithFlow(3, "Regular", checkInCountFlow(1)),
+			badgeWithFlow(4, "Focus", checkInCountFlow(1)),
+		},
+		awards: []models.UserBadge{
+			{UserID: "user-1", BadgeID: 1, Status: models.UserBadgeStatusActive, AwardedAt: now.AddDate(0, 0, -60)},
+			{UserID: "user-1", BadgeID: 2, Status: models.UserBadgeStatusActive, AwardedAt: now.AddDate(0, 0, -2)},
+			{UserID: "user-1", BadgeID: 3, Status: models.UserBadgeStatusActive, AwardedAt: now.AddDate(0, 0, -1), Tier: &silver},
+			{UserID: "user-1", BadgeID: 4, Status: models.UserBadgeStatusRevoked, AwardedAt: now.AddDate(0, 0, -1)},
+		},
+	}
+	engine := NewRuleEngine(db)
+
+	tests := []struct {
+		name     string
+		flow     map[string]interface{}
+		expected bool
+	}{
+		{"has badge by name", map[string]interface{}{"$hasBadge": "Early Bird"}, true},
+		{"has badge by ID", map[string]interface{}{"$hasBadge": float64(2)}, true},
+		{"revoked badge is not held", map[string]interface{}{"$hasBadge": "Focus"}, false},
+		{"earned within window", map[string]interface{}{"$hasBadge": map[string]interface{}{"badge": "Night Owl", "within": "7d"}}, true},
+		{"earned before window", map[string]interface{}{"$hasBadge": map[string]interface{}{"badge": "Early Bird", "within": "30d"}}, false},
+		{"minimum tier held", map[string]interface{}{"$hasBadge": map[string]interface{}{"badge": "Regular", "tier": float64(2)}}, true},
+		{"minimum tier not held", map[string]interface{}{"$hasBadge": map[string]interface{}{"badge": "Regular", "tier": float64(3)}}, false},
+		{"badge count", map[string]interface{}{"$badgeCount": map[string]interface{}{
+			"badges": []interface{}{"Early Bird", float64(2), "Regular", "Focus"},
+			"count":  map[string]interface{}{"$gte": float64(3)},
+		}}, true},
+		{"badge count within window", map[string]interface{}{"$badgeCount": map[string]interface{}{
+			"badges": []interface{}{"Early Bird", float64(2), "Regular", "Focus"},
+			"count":  map[string]interface{}{"$gte": float64(3)},
+			"within": "30d",
+		}}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, _, err := engine.evaluateBadgeFlow(99, models.JSONB(tt.flow), newEvaluationContext("user-1"))
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, result)
+		})
+	}
+
+	_, _, err := engine.evaluateBadgeFlow(99, models.JSONB{"$hasBadge": "Unknown"}, newEvaluationContext("user-1"))
+	assert.Error(t, err)
+	_, _, err = engine.evaluateBadgeFlow(99, models.JSONB{"$badgeCount": map[string]interface{}{"count": map[string]interface{}{"$gte": float64(1)}}}, newEvaluationContext("user-1"))
+	assert.Error(t, err)
+}
+
+// TestDependentBadgesResolveInOnePass checks that a chain of badges depending on each other is awarded by a single event
+func TestDependentBadgesResolveInOnePass(t *testing.T) {
+	db := &awardingDB{
+		badges: []models.BadgeWithCriteria{
+			badgeWithFlow(1, "Gold", map[string]interface{}{"$hasBadge": "Silver"}),
+			badgeWithFlow(2, "Silver", map[string]interface{}{"$and": []interface{}{
+				map[string]interface{}{"$hasBadge": "Bronze"},
+				checkInCountFlow(2),
+			}}),
+			badgeWithFlow(3, "Bronze", checkInCountFlow(1)),
+			badgeWithFlow(4, "Collector", map[string]interface{}{"$badgeCount": map[string]interface{}{
+				"badges": []interface{}{"Bronze", "Silver", "Gold"},
+				"count":  map[string]interface{}{"$gte": float64(3)},
+			}}),
+		},
+		events: checkIns("user-1", time.Now().Add(-time.Hour), time.Now()),
+	}
+
+	engine := NewRuleEngine(db)
+	result, err := engine.ProcessEvent(&db.events[1])
+	require.NoError(t, err)
+
+	var awarded []int
+	for _, award := range db.awards {
+		awarded = append(awarded, award.BadgeID)
+	}
+	assert.Equal(t, []int{3, 2, 1, 4}, awarded)
+	assert.Equal(t, awarded, result.AwardedBadgeIDs())
+}
+
+func TestCheckBadgeReferences(t *testing.T) {
+	db := &awardingDB{
+		badges: []models.BadgeWithCriteria{
+			badgeWithFlow(1, "Bronze", checkInCountFlow(1)),
+			badgeWithFlow(2, "Silver", map[string]interface{}{"$hasBadge": "Bronze"}),
+			badgeWithFlow(3, "Gold", map[string]interface{}{"$hasBadge": float64(2)}),
+		},
+	}
+
+	// A new badge may reference existing ones
+	err := CheckBadgeReferences(db, models.Badge{Name: "Platinum"}, []models.JSONB{{"$hasBadge": "Gold"}})
+	assert.NoError(t, err)
+
+	// References must resolve
+	err = CheckBadgeReferences(db, models.Badge{Name: "Platinum"}, []models.JSONB{{"$hasBadge": "Diamond"}})
+	assert.ErrorContains(t, err, "not found")
+
+	// Making Bronze depend on Gold closes the loop Bronze -> Gold -> Silver -> Bronze
+	err = CheckBadgeReferences(db, models.Badge{ID: 1, Name: "Bronze"}, []models.JSONB{
+		{"$badgeCount": map[string]interface{}{"badges": []interface{}{"Gold"}, "count": map[string]interface{}{"$gte": float64(1)}}},
+	})
+	assert.EqualError(t, err, "badge dependency cycle: Bronze -> Gold -> Silver -> Bronze")
+
+	// A badge cannot depend on itself
+	err = CheckBadgeReferences(db, models.Badge{ID: 3, Name: "Gold"}, []models.JSONB{{"$hasBadge": "Gold"}})
+	assert.EqualError(t, err, "badge dependency cycle: Gold -> Gold")
+}
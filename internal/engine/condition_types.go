@@ -0,0 +1,406 @@
+package engine
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/badge-assignment-system/internal/models"
+)
+
+// errConditionTypeRemoved is returned when looking up a condition type that is being deleted or renamed
+var errConditionTypeRemoved = errors.New("condition type is being deleted or renamed")
+
+// conditionParamTypes are the types a condition parameter may declare; empty accepts any value
+var conditionParamTypes = map[string]bool{
+	"":                            true,
+	models.ConditionParamString:   true,
+	models.ConditionParamNumber:   true,
+	models.ConditionParamBoolean:  true,
+	models.ConditionParamDuration: true,
+	models.ConditionParamArray:    true,
+	models.ConditionParamObject:   true,
+}
+
+// parseConditionCall reads the name and parameters of a $condition call, as in
+// {"name": "early-checkin", "params": {"before": "09:00:00", "days": 5}}
+func parseConditionCall(value interface{}) (string, map[string]interface{}, error) {
+	call, ok := value.(map[string]interface{})
+	if !ok {
+		return "", nil, errors.New("$condition requires an object with a 'name'")
+	}
+	name, _ := call["name"].(string)
+	if name == "" {
+		return "", nil, errors.New("$condition requires a condition type 'name'")
+	}
+
+	params := map[string]interface{}{}
+	if raw, ok := call["params"]; ok {
+		if params, ok = raw.(map[string]interface{}); !ok {
+			return "", nil, fmt.Errorf("$condition 'params' of '%s' must be an object", name)
+		}
+	}
+	return name, params, nil
+}
+
+// paramPlaceholder returns the parameter name of a {"$param": name} placeholder
+func paramPlaceholder(value interface{}) (string, bool) {
+	placeholder, ok := value.(map[string]interface{})
+	if !ok || len(placeholder) != 1 {
+		return "", false
+	}
+	name, ok := placeholder["$param"].(string)
+	return name, ok
+}
+
+// checkParamType checks a parameter value against the type the parameter declares
+func checkParamType(param models.ConditionParameter, value interface{}) error {
+	// Placeholders are only left in a value while a template is validated;
+	// they are bound when the enclosing template is expanded
+	if _, ok := paramPlaceholder(value); ok {
+		return nil
+	}
+
+	valid := true
+	switch param.Type {
+	case "":
+	case models.ConditionParamString:
+		_, valid = value.(string)
+	case models.ConditionParamNumber:
+		_, isString := value.(string)
+		_, err := toFloat64(value)
+		valid = err == nil && !isString
+	case models.ConditionParamBoolean:
+		_, valid = value.(bool)
+	case models.ConditionParamDuration:
+		str, _ := value.(string)
+		_, err := PolicyDuration(str)
+		valid = err == nil
+	case models.ConditionParamArray:
+		_, valid = value.([]interface{})
+	case models.ConditionParamObject:
+		_, valid = value.(map[string]interface{})
+	default:
+		return fmt.Errorf("parameter '%s' has unknown type '%s'", param.Name, param.Type)
+	}
+
+	if !valid {
+		return fmt.Errorf("parameter '%s' must be a %s, got %v", param.Name, param.Type, value)
+	}
+	return nil
+}
+
+// bindConditionParams checks the parameters of a $condition call against those the
+// condition type declares and returns the value of every declared parameter
+func bindConditionParams(conditionType models.ConditionType, params map[string]interface{}) (map[string]interface{}, error) {
+	declared := make(map[string]bool, len(conditionType.Parameters))
+	values := make(map[string]interface{}, len(conditionType.Parameters))
+	for _, param := range conditionType.Parameters {
+		declared[param.Name] = true
+		value, ok := params[param.Name]
+		if !ok {
+			if param.Default == nil {
+				return nil, fmt.Errorf("missing required parameter '%s'", param.Name)
+			}
+			value = param.Default
+		}
+		if err := checkParamType(param, value); err != nil {
+			return nil, err
+		}
+		values[param.Name] = value
+	}
+
+	var unknown []string
+	for name := range params {
+		if !declared[name] {
+			unknown = append(unknown, name)
+		}
+	}
+	if len(unknown) > 0 {
+		sort.Strings(unknown)
+		return nil, fmt.Errorf("unknown parameter '%s'", unknown[0])
+	}
+	return values, nil
+}
+
+// substituteParams returns a copy of a template with every {"$param": name} placeholder
+// replaced by the value of the parameter
+func substituteParams(template interface{}, values map[string]interface{}) (interface{}, error) {
+	switch v := template.(type) {
+	case models.JSONB:
+		return substituteParams(map[string]interface{}(v), values)
+	case map[string]interface{}:
+		if name, ok := paramPlaceholder(v); ok {
+			value, ok := values[name]
+			if !ok {
+				return nil, fmt.Errorf("undeclared parameter '%s'", name)
+			}
+			return value, nil
+		}
+		result := make(map[string]interface{}, len(v))
+		for key, value := range v {
+			substituted, err := substituteParams(value, values)
+			if err != nil {
+				return nil, err
+			}
+			result[key] = substituted
+		}
+		return result, nil
+	case []interface{}:
+		result := make([]interface{}, len(v))
+		for i, value := range v {
+			substituted, err := substituteParams(value, values)
+			if err != nil {
+				return nil, err
+			}
+			result[i] = substituted
+		}
+		return result, nil
+	default:
+		return v, nil
+	}
+}
+
+// instantiateCondition binds the parameters of a call to a condition type and
+// substitutes them into the condition type's flow template
+func instantiateCondition(conditionType models.ConditionType, params map[string]interface{}) (map[string]interface{}, error) {
+	if len(conditionType.FlowTemplate) == 0 {
+		return nil, fmt.Errorf("condition type '%s' has no flow template", conditionType.Name)
+	}
+
+	values, err := bindConditionParams(conditionType, params)
+	if err != nil {
+		return nil, fmt.Errorf("invalid parameters for condition type '%s': %w", conditionType.Name, err)
+	}
+
+	flow, err := substituteParams(conditionType.FlowTemplate, values)
+	if err != nil {
+		return nil, fmt.Errorf("invalid flow template of condition type '%s': %w", conditionType.Name, err)
+	}
+	return flow.(map[string]interface{}), nil
+}
+
+// conditionExpander replaces $condition calls with the flows of their condition types
+type conditionExpander struct {
+	lookup func(name string) (models.ConditionType, error)
+}
+
+// expand returns a copy of a flow with every $condition call expanded. The stack holds the
+// condition types whose templates are being expanded, to detect templates that invoke themselves.
+func (e conditionExpander) expand(flow interface{}, stack []string) (interface{}, error) {
+	switch v := flow.(type) {
+	case models.JSONB:
+		return e.expand(map[string]interface{}(v), stack)
+	case map[string]interface{}:
+		if call, ok := v["$condition"]; ok {
+			return e.expandCall(call, stack)
+		}
+		result := make(map[string]interface{}, len(v))
+		for key, value := range v {
+			expanded, err := e.expand(value, stack)
+			if err != nil {
+				return nil, err
+			}
+			result[key] = expanded
+		}
+		return result, nil
+	case []interface{}:
+		result := make([]interface{}, len(v))
+		for i, value := range v {
+			expanded, err := e.expand(value, stack)
+			if err != nil {
+				return nil, err
+			}
+			result[i] = expanded
+		}
+		return result, nil
+	default:
+		return v, nil
+	}
+}
+
+// expandCall expands a single $condition call, including the calls in its template
+func (e conditionExpander) expandCall(call interface{}, stack []string) (map[string]interface{}, error) {
+	name, params, err := parseConditionCall(call)
+	if err != nil {
+		return nil, err
+	}
+
+	for i, entered := range stack {
+		if entered == name {
+			cycle := append(append([]string{}, stack[i:]...), name)
+			return nil, fmt.Errorf("condition type cycle: %s", strings.Join(cycle, " -> "))
+		}
+	}
+
+	conditionType, err := e.lookup(name)
+	if err != nil {
+		return nil, fmt.Errorf("condition type '%s' not found: %w", name, err)
+	}
+
+	flow, err := instantiateCondition(conditionType, params)
+	if err != nil {
+		return nil, err
+	}
+
+	expanded, err := e.expand(flow, append(stack[:len(stack):len(stack)], name))
+	if err != nil {
+		return nil, err
+	}
+	return expanded.(map[string]interface{}), nil
+}
+
+// ExpandConditions returns a copy of a flow definition in which every $condition call is
+// replaced by the flow template of its condition type, checking the parameters of each call
+func ExpandConditions(db DBInterface, flow models.JSONB) (models.JSONB, error) {
+	expanded, err := conditionExpander{lookup: db.GetConditionTypeByName}.expand(flow, nil)
+	if err != nil {
+		return nil, err
+	}
+	return models.JSONB(expanded.(map[string]interface{})), nil
+}
+
+// ValidateConditionType checks the parameters a condition type declares and its flow
+// template, including the condition types the template invokes
+func ValidateConditionType(db DBInterface, conditionType models.ConditionType) error {
+	declared := make(map[string]bool, len(conditionType.Parameters))
+	for _, param := range conditionType.Parameters {
+		if param.Name == "" {
+			return errors.New("condition type parameters must have a name")
+		}
+		if declared[param.Name] {
+			return fmt.Errorf("parameter '%s' is declared more than once", param.Name)
+		}
+		declared[param.Name] = true
+
+		if !conditionParamTypes[param.Type] {
+			return fmt.Errorf("parameter '%s' has unknown type '%s'", param.Name, param.Type)
+		}
+		if param.Default != nil {
+			if err := checkParamType(param, param.Default); err != nil {
+				return fmt.Errorf("invalid default: %w", err)
+			}
+		}
+	}
+
+	if len(conditionType.FlowTemplate) == 0 {
+		return errors.New("condition type flow template is required")
+	}
+
+	// Every placeholder must refer to a declared parameter
+	placeholders := make(map[string]interface{}, len(declared))
+	for name := range declared {
+		placeholders[name] = map[string]interface{}{"$param": name}
+	}
+	if _, err := substituteParams(conditionType.FlowTemplate, placeholders); err != nil {
+		return fmt.Errorf("invalid flow template: %w", err)
+	}
+
+	// Invoked condition types must exist and must not lead back to this one
+	expander := conditionExpander{lookup: func(name string) (models.ConditionType, error) {
+		if name == conditionType.Name {
+			return conditionType, nil
+		}
+		return db.GetConditionTypeByName(name)
+	}}
+	if _, err := expander.expand(conditionType.FlowTemplate, []string{conditionType.Name}); err != nil {
+		return fmt.Errorf("invalid flow template: %w", err)
+	}
+	return nil
+}
+
+// CheckConditionTypeUsage makes sure that the active badges invoking a condition type remain
+// valid once it is replaced by conditionType, or once it is deleted when conditionType is nil
+func CheckConditionTypeUsage(db DBInterface, name string, conditionType *models.ConditionType) error {
+	badges, err := db.GetActiveBadges()
+	if err != nil {
+		return fmt.Errorf("failed to retrieve active badges: %w", err)
+	}
+
+	expander := conditionExpander{lookup: func(lookupName string) (models.ConditionType, error) {
+		if lookupName == name {
+			if conditionType == nil || conditionType.Name != name {
+				return models.ConditionType{}, errConditionTypeRemoved
+			}
+			return *conditionType, nil
+		}
+		return db.GetConditionTypeByName(lookupName)
+	}}
+
+	for _, badge := range badges {
+		badgeWithCriteria, err := db.GetBadgeWithCriteria(badge.ID)
+		if err != nil {
+			return fmt.Errorf("failed to get criteria for badge ID %d: %w", badge.ID, err)
+		}
+		for _, flow := range badgeFlows(badgeWithCriteria) {
+			if !invokesCondition(flow, name) {
+				continue
+			}
+			if _, err := expander.expand(flow, nil); err != nil {
+				return fmt.Errorf("badge '%s' would no longer be valid: %w", badge.Name, err)
+			}
+		}
+	}
+	return nil
+}
+
+// invokesCondition reports whether a flow calls the named condition type directly
+func invokesCondition(flow interface{}, name string) bool {
+	switch v := flow.(type) {
+	case models.JSONB:
+		return invokesCondition(map[string]interface{}(v), name)
+	case map[string]interface{}:
+		for key, value := range v {
+			if key == "$condition" {
+				if callName, _, err := parseConditionCall(value); err == nil && callName == name {
+					return true
+				}
+			}
+			if invokesCondition(value, name) {
+				return true
+			}
+		}
+	case []interface{}:
+		for _, value := range v {
+			if invokesCondition(value, name) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// evaluateConditionCriteria expands a $condition call and evaluates the resulting flow
+func (re *RuleEngine) evaluateConditionCriteria(value interface{}, ctx *evaluationContext, metadata map[string]interface{}) (bool, error) {
+	flow, err := re.expandCondition(value, ctx)
+	if err != nil {
+		return false, err
+	}
+	return re.evaluateFlow(flow, ctx, metadata)
+}
+
+// expandCondition expands a $condition call, loading each condition type once per evaluation pass
+func (re *RuleEngine) expandCondition(call interface{}, ctx *evaluationContext) (models.JSONB, error) {
+	snapshot := ctx.snapshot
+	expander := conditionExpander{lookup: func(name string) (models.ConditionType, error) {
+		if conditionType, ok := snapshot.conditionTypes[name]; ok {
+			return conditionType, nil
+		}
+		conditionType, err := re.DB.GetConditionTypeByName(name)
+		if err != nil {
+			return conditionType, err
+		}
+		if snapshot.conditionTypes == nil {
+			snapshot.conditionTypes = make(map[string]models.ConditionType)
+		}
+		snapshot.conditionTypes[name] = conditionType
+		return conditionType, nil
+	}}
+
+	flow, err := expander.expandCall(call, nil)
+	if err != nil {
+		return nil, err
+	}
+	return models.JSONB(flow), nil
+}
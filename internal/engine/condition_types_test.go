@@ -0,0 +1,186 @@
+package engine
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/badge-assignment-system/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// decodeJSONB decodes a flow the way it arrives from the API
+func decodeJSONB(t *testing.T, document string) models.JSONB {
+	var flow models.JSONB
+	require.NoError(t, json.Unmarshal([]byte(document), &flow))
+	return flow
+}
+
+// earlyCheckIn is a condition type matching users who checked in before a time and often enough
+func earlyCheckIn(t *testing.T) models.ConditionType {
+	return models.ConditionType{
+		ID:   1,
+		Name: "early-checkin",
+		Parameters: models.ConditionParameters{
+			{Name: "before", Type: models.ConditionParamString},
+			{Name: "days", Type: models.ConditionParamNumber, Default: float64(5)},
+		},
+		FlowTemplate: decodeJSONB(t, `{"$and": [
+			{"event": "check-in", "criteria": {"time": {"$lt": {"$param": "before"}}}},
+			{"event": "check-in", "criteria": {"$eventCount": {"$gte": {"$param": "days"}}}}
+		]}`),
+	}
+}
+
+// checkInsAt creates one check-in event per day at each of the given times of day
+func checkInsAt(userID string, times ...string) []models.Event {
+	events := make([]models.Event, 0, len(times))
+	for i, timeOfDay := range times {
+		events = append(events, models.Event{
+			ID:          i + 1,
+			EventTypeID: 1,
+			UserID:      userID,
+			OccurredAt:  time.Now().AddDate(0, 0, i-len(times)),
+			Payload:     models.JSONB{"time": timeOfDay},
+		})
+	}
+	return events
+}
+
+func TestConditionTypeEvaluation(t *testing.T) {
+	db := &awardingDB{
+		conditions: []models.ConditionType{earlyCheckIn(t)},
+		events:     checkInsAt("user-1", "08:10:00", "08:45:00", "08:55:00", "09:30:00"),
+	}
+	engine := NewRuleEngine(db)
+
+	tests := []struct {
+		name     string
+		flow     string
+		expected bool
+	}{
+		{"enough early check-ins", `{"$condition": {"name": "early-checkin", "params": {"before": "09:00:00", "days": 3}}}`, true},
+		{"no check-in early enough", `{"$condition": {"name": "early-checkin", "params": {"before": "08:00:00", "days": 3}}}`, false},
+		{"default parameter", `{"$condition": {"name": "early-checkin", "params": {"before": "10:00:00"}}}`, false},
+		{"inside logical operators", `{"$or": [
+			{"$condition": {"name": "early-checkin", "params": {"before": "08:00:00", "days": 1}}},
+			{"$not": {"$condition": {"name": "early-checkin", "params": {"before": "10:00:00", "days": 5}}}}
+		]}`, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, _, err := engine.evaluateBadgeFlow(1, decodeJSONB(t, tt.flow), newEvaluationContext("user-1"))
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, result)
+		})
+	}
+
+	invalid := []string{
+		`{"$condition": {"name": "late-checkin"}}`,
+		`{"$condition": {"name": "early-checkin", "params": {"days": 3}}}`,
+		`{"$condition": {"name": "early-checkin", "params": {"before": "09:00:00", "weeks": 3}}}`,
+		`{"$condition": {"name": "early-checkin", "params": {"before": 9}}}`,
+		`{"$condition": "early-checkin"}`,
+	}
+	for _, flow := range invalid {
+		_, _, err := engine.evaluateBadgeFlow(1, decodeJSONB(t, flow), newEvaluationContext("user-1"))
+		assert.Error(t, err, flow)
+	}
+}
+
+func TestExpandConditions(t *testing.T) {
+	weekly := models.ConditionType{
+		Name:       "weekly-early-checkin",
+		Parameters: models.ConditionParameters{{Name: "before", Type: models.ConditionParamString}},
+		FlowTemplate: decodeJSONB(t, `{"$timeWindow": {"last": "1w", "flow":
+			{"$condition": {"name": "early-checkin", "params": {"before": {"$param": "before"}, "days": 3}}}
+		}}`),
+	}
+	db := &awardingDB{conditions: []models.ConditionType{earlyCheckIn(t), weekly}}
+
+	expanded, err := ExpandConditions(db, decodeJSONB(t, `{"$and": [
+		{"$condition": {"name": "weekly-early-checkin", "params": {"before": "07:30:00"}}},
+		{"$hasBadge": "Early Bird"}
+	]}`))
+	require.NoError(t, err)
+	assert.Equal(t, decodeJSONB(t, `{"$and": [
+		{"$timeWindow": {"last": "1w", "flow": {"$and": [
+			{"event": "check-in", "criteria": {"time": {"$lt": "07:30:00"}}},
+			{"event": "check-in", "criteria": {"$eventCount": {"$gte": 3}}}
+		]}}},
+		{"$hasBadge": "Early Bird"}
+	]}`), expanded)
+
+	// Badges invoking a condition type depend on the events of its template
+	badge := badgeWithFlow(7, "Early Riser", map[string]interface{}{
+		"$condition": map[string]interface{}{"name": "weekly-early-checkin", "params": map[string]interface{}{"before": "07:30:00"}},
+	})
+	db.badges = []models.BadgeWithCriteria{badge}
+	affected, err := NewDependencyIndex().affectedBadges(db, "check-in")
+	require.NoError(t, err)
+	assert.True(t, affected[7])
+	affected, err = NewDependencyIndex().affectedBadges(db, "bug-report")
+	require.NoError(t, err)
+	assert.False(t, affected[7])
+}
+
+func TestValidateConditionType(t *testing.T) {
+	db := &awardingDB{conditions: []models.ConditionType{earlyCheckIn(t)}}
+
+	assert.NoError(t, ValidateConditionType(db, earlyCheckIn(t)))
+
+	tests := []struct {
+		name       string
+		parameters models.ConditionParameters
+		template   string
+		err        string
+	}{
+		{"undeclared parameter", nil, `{"event": "check-in", "criteria": {"time": {"$lt": {"$param": "before"}}}}`, "undeclared parameter 'before'"},
+		{"duplicate parameter", models.ConditionParameters{{Name: "days"}, {Name: "days"}}, `{"event": "check-in", "criteria": {}}`, "declared more than once"},
+		{"unknown type", models.ConditionParameters{{Name: "days", Type: "integer"}}, `{"event": "check-in", "criteria": {}}`, "unknown type 'integer'"},
+		{"invalid default", models.ConditionParameters{{Name: "within", Type: models.ConditionParamDuration, Default: "a week"}}, `{"event": "check-in", "criteria": {}}`, "invalid default"},
+		{"missing template", nil, ``, "flow template is required"},
+		{"invalid nested call", nil, `{"$condition": {"name": "early-checkin", "params": {"days": 2}}}`, "missing required parameter 'before'"},
+		{"invokes itself", nil, `{"$not": {"$condition": {"name": "streak"}}}`, "condition type cycle: streak -> streak"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conditionType := models.ConditionType{Name: "streak", Parameters: tt.parameters}
+			if tt.template != "" {
+				conditionType.FlowTemplate = decodeJSONB(t, tt.template)
+			}
+			assert.ErrorContains(t, ValidateConditionType(db, conditionType), tt.err)
+		})
+	}
+}
+
+func TestCheckConditionTypeUsage(t *testing.T) {
+	db := &awardingDB{
+		conditions: []models.ConditionType{earlyCheckIn(t)},
+		badges: []models.BadgeWithCriteria{
+			badgeWithFlow(1, "Early Bird", map[string]interface{}{
+				"$condition": map[string]interface{}{"name": "early-checkin", "params": map[string]interface{}{"before": "09:00:00", "days": float64(5)}},
+			}),
+			badgeWithFlow(2, "Regular", checkInCountFlow(10)),
+		},
+	}
+
+	// Adding a parameter with a default keeps existing calls valid
+	updated := earlyCheckIn(t)
+	updated.Parameters = append(updated.Parameters, models.ConditionParameter{Name: "weekdays", Type: models.ConditionParamBoolean, Default: false})
+	assert.NoError(t, CheckConditionTypeUsage(db, "early-checkin", &updated))
+
+	// Removing a parameter a badge passes does not
+	updated = earlyCheckIn(t)
+	updated.Parameters = updated.Parameters[:1]
+	assert.ErrorContains(t, CheckConditionTypeUsage(db, "early-checkin", &updated), "badge 'Early Bird' would no longer be valid")
+
+	// Neither does renaming or deleting it
+	updated = earlyCheckIn(t)
+	updated.Name = "morning-checkin"
+	assert.Error(t, CheckConditionTypeUsage(db, "early-checkin", &updated))
+	assert.ErrorIs(t, CheckConditionTypeUsage(db, "early-checkin", nil), errConditionTypeRemoved)
+}
@@ -0,0 +1,290 @@
+package engine
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/badge-assignment-system/internal/models"
+)
+
+// DependencyIndex maps event types to the active badges whose criteria reference them,
+// so that an incoming event only re-evaluates the badges it can affect. It also maps
+// badges to the badges whose criteria reference them through $hasBadge or $badgeCount,
+// so that an award re-evaluates the badges that depend on it.
+// The index is built lazily and is safe for concurrent use.
+type DependencyIndex struct {
+	mu          sync.RWMutex
+	built       bool
+	generation  int                     // Incremented on invalidation to discard in-flight builds
+	byEventType map[string]map[int]bool // Event type name -> badge IDs
+	allEvents   map[int]bool            // Badges that depend on every event type
+	byBadge     map[int]map[int]bool    // Badge ID -> IDs of the badges that reference it
+}
+
+// NewDependencyIndex creates an empty dependency index
+func NewDependencyIndex() *DependencyIndex {
+	return &DependencyIndex{}
+}
+
+// Invalidate discards the index so that it is rebuilt on next use
+func (idx *DependencyIndex) Invalidate() {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	idx.built = false
+	idx.generation++
+	idx.byEventType = nil
+	idx.allEvents = nil
+	idx.byBadge = nil
+}
+
+// affectedBadges returns the IDs of the active badges that may be affected by an event of the given type
+func (idx *DependencyIndex) affectedBadges(db DBInterface, eventType string) (map[int]bool, error) {
+	byEventType, allEvents, _, err := idx.get(db)
+	if err != nil {
+		return nil, err
+	}
+
+	affected := make(map[int]bool, len(allEvents)+len(byEventType[eventType]))
+	for badgeID := range allEvents {
+		affected[badgeID] = true
+	}
+	for badgeID := range byEventType[eventType] {
+		affected[badgeID] = true
+	}
+	return affected, nil
+}
+
+// dependentBadges returns the IDs of the active badges whose criteria reference any of the given badges
+func (idx *DependencyIndex) dependentBadges(db DBInterface, badgeIDs []int) (map[int]bool, error) {
+	_, _, byBadge, err := idx.get(db)
+	if err != nil {
+		return nil, err
+	}
+
+	dependents := make(map[int]bool)
+	for _, badgeID := range badgeIDs {
+		for dependent := range byBadge[badgeID] {
+			dependents[dependent] = true
+		}
+	}
+	return dependents, nil
+}
+
+// get returns the index, building it first if needed
+func (idx *DependencyIndex) get(db DBInterface) (map[string]map[int]bool, map[int]bool, map[int]map[int]bool, error) {
+	idx.mu.RLock()
+	built, byEventType, allEvents, byBadge := idx.built, idx.byEventType, idx.allEvents, idx.byBadge
+	idx.mu.RUnlock()
+
+	if built {
+		return byEventType, allEvents, byBadge, nil
+	}
+	return idx.build(db)
+}
+
+// build reads the criteria of every active badge and records which event types and badges they reference
+func (idx *DependencyIndex) build(db DBInterface) (map[string]map[int]bool, map[int]bool, map[int]map[int]bool, error) {
+	idx.mu.RLock()
+	generation := idx.generation
+	idx.mu.RUnlock()
+
+	badges, err := db.GetActiveBadges()
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("failed to retrieve active badges: %w", err)
+	}
+
+	badgeIDs := make(map[string]int, len(badges))
+	for _, badge := range badges {
+		badgeIDs[badge.Name] = badge.ID
+	}
+
+	byEventType := make(map[string]map[int]bool)
+	allEvents := make(map[int]bool)
+	byBadge := make(map[int]map[int]bool)
+	for _, badge := range badges {
+		badgeWithCriteria, err := db.GetBadgeWithCriteria(badge.ID)
+		if err != nil {
+			return nil, nil, nil, fmt.Errorf("failed to get criteria for badge ID %d: %w", badge.ID, err)
+		}
+
+		// A tiered badge depends on the event types and badges of every one of its tiers
+		flows := expandBadgeFlows(db, badgeWithCriteria)
+		var refs []badgeRef
+		for _, flow := range flows {
+			refs = collectBadgeReferences(flow, refs)
+		}
+		for _, ref := range refs {
+			referenced := ref.id
+			if ref.name != "" {
+				id, ok := badgeIDs[ref.name]
+				if !ok {
+					continue
+				}
+				referenced = id
+			}
+			if byBadge[referenced] == nil {
+				byBadge[referenced] = make(map[int]bool)
+			}
+			byBadge[referenced][badge.ID] = true
+		}
+
+		eventTypes := make(map[string]bool)
+		dependsOnAll := false
+		for _, flow := range flows {
+			if collectFlowDependencies(flow, eventTypes) {
+				dependsOnAll = true
+			}
+		}
+		if dependsOnAll {
+			allEvents[badge.ID] = true
+			continue
+		}
+		for eventType := range eventTypes {
+			if byEventType[eventType] == nil {
+				byEventType[eventType] = make(map[int]bool)
+			}
+			byEventType[eventType][badge.ID] = true
+		}
+	}
+
+	// Only keep the result if no badge changed while it was being built
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	if idx.generation == generation {
+		idx.byEventType = byEventType
+		idx.allEvents = allEvents
+		idx.byBadge = byBadge
+		idx.built = true
+	}
+	return byEventType, allEvents, byBadge, nil
+}
+
+// expandBadgeFlows returns the flows of a badge with their $condition calls expanded. Flows
+// that cannot be expanded are returned as they are; they fail when they are evaluated.
+func expandBadgeFlows(db DBInterface, badge models.BadgeWithCriteria) []models.JSONB {
+	flows := badgeFlows(badge)
+	for i, flow := range flows {
+		if expanded, err := ExpandConditions(db, flow); err == nil {
+			flows[i] = expanded
+		}
+	}
+	return flows
+}
+
+// collectFlowDependencies adds the event types referenced by a flow definition to eventTypes.
+// It returns true when the flow depends on every event type, either through an operator
+// that evaluates all of the user's events or through an operator it does not recognise.
+func collectFlowDependencies(flow map[string]interface{}, eventTypes map[string]bool) bool {
+	if eventType, ok := flow["event"].(string); ok {
+		eventTypes[eventType] = true
+		return false
+	}
+
+	for operator, value := range flow {
+		switch operator {
+		case "$and", "$or":
+			conditions, ok := value.([]interface{})
+			if !ok {
+				return true
+			}
+			for _, condition := range conditions {
+				conditionMap, ok := condition.(map[string]interface{})
+				if !ok || collectFlowDependencies(conditionMap, eventTypes) {
+					return true
+				}
+			}
+		case "$not":
+			conditionMap, ok := value.(map[string]interface{})
+			if !ok || collectFlowDependencies(conditionMap, eventTypes) {
+				return true
+			}
+		case "$sequence":
+			criteria, _ := value.(map[string]interface{})
+			sequence, ok := criteria["sequence"].([]interface{})
+			if !ok {
+				return true
+			}
+			for _, item := range sequence {
+				if eventType, ok := item.(string); ok {
+					eventTypes[eventType] = true
+				}
+			}
+		case "$streak":
+			// A streak of one event type only depends on that type
+			criteria, _ := value.(map[string]interface{})
+			eventType, ok := criteria["event"].(string)
+			if !ok {
+				return true
+			}
+			eventTypes[eventType] = true
+		case "$timeWindow":
+			criteria, _ := value.(map[string]interface{})
+			subFlow, ok := criteria["flow"].(map[string]interface{})
+			if !ok || collectFlowDependencies(subFlow, eventTypes) {
+				return true
+			}
+		case "$hasBadge", "$badgeCount":
+			// Badge operators depend on awards, not events; awards re-evaluate their dependents
+		default:
+			// $timePeriod, $pattern, $gap, $duration, $aggregate and $expression evaluate all of the
+			// user's events; operators the index does not know, and $condition calls
+			// that could not be expanded, are treated the same way
+			return true
+		}
+	}
+
+	return false
+}
+
+// badgesAffectedByEvent returns the active badges that could be affected by an event
+func (re *RuleEngine) badgesAffectedByEvent(event *models.Event) ([]models.Badge, error) {
+	return re.badgesAffectedByEventTypes([]int{event.EventTypeID})
+}
+
+// badgesAffectedByEventTypes returns the active badges that could be affected by events of any
+// of the given types
+func (re *RuleEngine) badgesAffectedByEventTypes(eventTypeIDs []int) ([]models.Badge, error) {
+	badges, err := re.DB.GetActiveBadges()
+	if err != nil {
+		re.Logger.Error("Failed to retrieve active badges: %v", err)
+		return nil, fmt.Errorf("failed to retrieve active badges: %w", err)
+	}
+
+	affected := make(map[int]bool)
+	var names []string
+	seen := make(map[int]bool)
+	for _, eventTypeID := range eventTypeIDs {
+		if seen[eventTypeID] {
+			continue
+		}
+		seen[eventTypeID] = true
+
+		eventType, err := re.DB.GetEventTypeByID(eventTypeID)
+		if err != nil {
+			// Without the type name the index cannot be used, so evaluate everything
+			re.Logger.Warning("Event type ID %d not found, evaluating all badges: %v", eventTypeID, err)
+			return badges, nil
+		}
+
+		typeAffected, err := re.Dependencies.affectedBadges(re.DB, eventType.Name)
+		if err != nil {
+			re.Logger.Warning("Failed to build badge dependency index, evaluating all badges: %v", err)
+			return badges, nil
+		}
+		for badgeID := range typeAffected {
+			affected[badgeID] = true
+		}
+		names = append(names, eventType.Name)
+	}
+
+	filtered := make([]models.Badge, 0, len(affected))
+	for _, badge := range badges {
+		if affected[badge.ID] {
+			filtered = append(filtered, badge)
+		}
+	}
+
+	re.Logger.Debug("Event types %v affect %d of %d active badges", names, len(filtered), len(badges))
+	return filtered, nil
+}
@@ -0,0 +1,123 @@
+package engine
+
+import (
+	"testing"
+	"time"
+
+	"github.com/badge-assignment-system/internal/models"
+	"github.com/badge-assignment-system/internal/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCollectFlowDependencies(t *testing.T) {
+	eventTypes := make(map[string]bool)
+	allEvents := collectFlowDependencies(map[string]interface{}{
+		"$and": []interface{}{
+			map[string]interface{}{"event": "check-in", "criteria": map[string]interface{}{}},
+			map[string]interface{}{"$not": map[string]interface{}{"event": "bug-report", "criteria": map[string]interface{}{}}},
+			map[string]interface{}{"$sequence": map[string]interface{}{"sequence": []interface{}{"code-review", "deploy"}}},
+			map[string]interface{}{"$timeWindow": map[string]interface{}{
+				"last": "30d",
+				"flow": map[string]interface{}{"event": "task-completion", "criteria": map[string]interface{}{}},
+			}},
+		},
+	}, eventTypes)
+
+	assert.False(t, allEvents)
+	assert.Equal(t, map[string]bool{
+		"check-in": true, "bug-report": true, "code-review": true, "deploy": true, "task-completion": true,
+	}, eventTypes)
+
+	assert.True(t, collectFlowDependencies(map[string]interface{}{
+		"$or": []interface{}{
+			map[string]interface{}{"event": "check-in", "criteria": map[string]interface{}{}},
+			map[string]interface{}{"$gap": map[string]interface{}{"maxGapHours": float64(24)}},
+		},
+	}, make(map[string]bool)))
+}
+
+// TestProcessEventOnlyEvaluatesAffectedBadges checks that badges not referencing the event's type are skipped
+func TestProcessEventOnlyEvaluatesAffectedBadges(t *testing.T) {
+	mockDB := testutil.NewMockDB()
+
+	checkInFlow := map[string]interface{}{"event": "check-in", "criteria": map[string]interface{}{}}
+	reviewFlow := map[string]interface{}{"event": "code-review", "criteria": map[string]interface{}{}}
+	periodFlow := map[string]interface{}{"$timePeriod": map[string]interface{}{"periodType": "day"}}
+
+	mockDB.On("GetActiveBadges").Return([]models.Badge{{ID: 1}, {ID: 2}, {ID: 3}}, nil)
+	mockDB.On("GetBadgeWithCriteria", 1).Return(testutil.CreateTestBadgeWithCriteria(1, "Early Bird", checkInFlow), nil)
+	mockDB.On("GetBadgeWithCriteria", 2).Return(testutil.CreateTestBadgeWithCriteria(2, "Reviewer", reviewFlow), nil)
+	mockDB.On("GetBadgeWithCriteria", 3).Return(testutil.CreateTestBadgeWithCriteria(3, "Regular", periodFlow), nil)
+	mockDB.On("GetEventTypeByID", 1).Return(models.EventType{ID: 1, Name: "check-in"}, nil)
+	mockDB.On("GetEventTypeByName", "check-in").Return(models.EventType{ID: 1, Name: "check-in"}, nil)
+	mockDB.On("GetUserBadges", "user-1").Return([]models.UserBadge{}, nil)
+
+	event := models.Event{ID: 5, EventTypeID: 1, UserID: "user-1", OccurredAt: time.Now(), Payload: models.JSONB{}}
+	mockDB.On("GetUserEvents", "user-1").Return([]models.Event{event}, nil)
+	mockDB.On("AwardBadgeToUser", mock.Anything).Return(true, nil)
+
+	engine := NewRuleEngine(mockDB)
+	_, err := engine.ProcessEvent(&event)
+	require.NoError(t, err)
+
+	// The check-in badge and the all-events badge are awarded; the review badge is never evaluated
+	mockDB.AssertNotCalled(t, "GetEventTypeByName", "code-review")
+	awarded := make(map[int]bool)
+	for _, call := range mockDB.Calls {
+		if call.Method == "AwardBadgeToUser" {
+			awarded[call.Arguments.Get(0).(*models.UserBadge).BadgeID] = true
+		}
+	}
+	assert.Equal(t, map[int]bool{1: true, 3: true}, awarded)
+
+	// The index is rebuilt once invalidated
+	engine.Dependencies.Invalidate()
+	_, err = engine.Dependencies.affectedBadges(mockDB, "check-in")
+	require.NoError(t, err)
+	// Two index builds over three badges, plus the two badges that were evaluated
+	mockDB.AssertNumberOfCalls(t, "GetBadgeWithCriteria", 2*3+2)
+}
+
+// TestProcessUserEvents checks that the badges affected by any of a user's events are evaluated once
+func TestProcessUserEvents(t *testing.T) {
+	mockDB := testutil.NewMockDB()
+
+	checkInFlow := map[string]interface{}{"event": "check-in", "criteria": map[string]interface{}{}}
+	reviewFlow := map[string]interface{}{"event": "code-review", "criteria": map[string]interface{}{}}
+	deployFlow := map[string]interface{}{"event": "deploy", "criteria": map[string]interface{}{}}
+
+	mockDB.On("GetActiveBadges").Return([]models.Badge{{ID: 1, Name: "Early Bird"}, {ID: 2, Name: "Reviewer"}, {ID: 3, Name: "Shipper"}}, nil)
+	mockDB.On("GetBadgeWithCriteria", 1).Return(testutil.CreateTestBadgeWithCriteria(1, "Early Bird", checkInFlow), nil)
+	mockDB.On("GetBadgeWithCriteria", 2).Return(testutil.CreateTestBadgeWithCriteria(2, "Reviewer", reviewFlow), nil)
+	mockDB.On("GetBadgeWithCriteria", 3).Return(testutil.CreateTestBadgeWithCriteria(3, "Shipper", deployFlow), nil)
+	mockDB.On("GetEventTypeByID", 1).Return(models.EventType{ID: 1, Name: "check-in"}, nil)
+	mockDB.On("GetEventTypeByID", 2).Return(models.EventType{ID: 2, Name: "code-review"}, nil)
+	mockDB.On("GetEventTypeByName", "check-in").Return(models.EventType{ID: 1, Name: "check-in"}, nil)
+	mockDB.On("GetEventTypeByName", "code-review").Return(models.EventType{ID: 2, Name: "code-review"}, nil)
+	mockDB.On("GetUserBadges", "user-1").Return([]models.UserBadge{}, nil)
+
+	events := []models.Event{
+		{ID: 5, EventTypeID: 1, UserID: "user-1", OccurredAt: time.Now(), Payload: models.JSONB{}},
+		{ID: 6, EventTypeID: 2, UserID: "user-1", OccurredAt: time.Now(), Payload: models.JSONB{}},
+		{ID: 7, EventTypeID: 1, UserID: "user-1", OccurredAt: time.Now(), Payload: models.JSONB{}},
+	}
+	mockDB.On("GetUserEvents", "user-1").Return(events, nil)
+	mockDB.On("AwardBadgeToUser", mock.Anything).Return(true, nil)
+
+	engine := NewRuleEngine(mockDB)
+	result, err := engine.ProcessUserEvents("user-1", events)
+	require.NoError(t, err)
+
+	var names []string
+	for _, award := range result.Awarded {
+		names = append(names, award.BadgeName)
+	}
+	assert.Equal(t, []string{"Early Bird", "Reviewer"}, names)
+
+	// Each event type is looked up once, and the user's events are read once for both badges
+	mockDB.AssertNumberOfCalls(t, "GetEventTypeByID", 2)
+	mockDB.AssertNumberOfCalls(t, "GetUserEvents", 1)
+	mockDB.AssertNotCalled(t, "GetEventTypeByName", "deploy")
+}
@@ -0,0 +1,278 @@
+package engine
+
+import (
+	"time"
+
+	"github.com/badge-assignment-system/internal/models"
+)
+
+// evaluationContext carries the state of a single evaluation through evaluateFlow.
+// It holds a snapshot of the user's events and the event types looked up so far,
+// so that every operator in a flow is served from memory instead of the database.
+type evaluationContext struct {
+	userID   string
+	snapshot *eventSnapshot
+	window   *timeRange         // Events visible to the current node; nil means all time
+	scope    *timeRange         // Widest range read by the flow being evaluated; nil means all time
+	holidays *holidaySet        // When set, only events on business days outside these holidays are visible
+	tracer   *evaluationTracer  // nil when tracing is disabled
+	timeVars *TimeVariableCache // Time $NOW and the other time variables resolve against
+}
+
+// eventSnapshot is the user's events and the event types resolved during an evaluation,
+// along with the user's awards and badge names read by $hasBadge and $badgeCount
+type eventSnapshot struct {
+	loaded       bool
+	bounds       *timeRange // Range the loaded events cover; nil means all time
+	events       []models.Event
+	eventTypes   map[string]models.EventType
+	awardsLoaded bool
+	awards       []models.UserBadge
+	badgeIDs     map[string]int // Active badge name -> ID
+	// Condition types invoked by $condition, by name
+	conditionTypes map[string]models.ConditionType
+	location       *time.Location // User's timezone; nil until loaded
+}
+
+// timeRange is an inclusive range of time
+type timeRange struct {
+	start time.Time
+	end   time.Time
+}
+
+// newEvaluationContext creates the context for evaluating flows for a user
+func newEvaluationContext(userID string) *evaluationContext {
+	return &evaluationContext{
+		userID:   userID,
+		snapshot: &eventSnapshot{eventTypes: make(map[string]models.EventType)},
+		timeVars: NewTimeVariableCache(),
+	}
+}
+
+// withWindow returns a copy of the context that only sees events in [start, end].
+// Nested windows intersect, so a sub-flow never sees events outside any enclosing window.
+func (ctx *evaluationContext) withWindow(start, end time.Time) *evaluationContext {
+	child := *ctx
+	child.window = intersectRanges(ctx.window, &timeRange{start: start, end: end})
+	return &child
+}
+
+// withBusinessDays returns a copy of the context that only sees events on weekdays that are
+// not holidays. Nested windows skip the holidays of every enclosing window.
+func (ctx *evaluationContext) withBusinessDays(holidays *holidaySet) *evaluationContext {
+	child := *ctx
+	child.holidays = holidays.union(ctx.holidays)
+	return &child
+}
+
+// windowContext returns the context the flow of a $timeWindow is evaluated in: only events
+// in [start, end], and only those on business days when the window sets businessDaysOnly
+func (re *RuleEngine) windowContext(ctx *evaluationContext, criteria map[string]interface{}, start, end time.Time) (*evaluationContext, error) {
+	windowCtx := ctx.withWindow(start, end)
+	if businessDaysOnly, _ := criteria["businessDaysOnly"].(bool); !businessDaysOnly {
+		return windowCtx, nil
+	}
+
+	calendar, _ := criteria["holidayCalendar"].(string)
+	holidays, err := re.holidays(nil, calendar)
+	if err != nil {
+		return nil, err
+	}
+	return windowCtx.withBusinessDays(holidays), nil
+}
+
+// contains checks whether a time falls within the range
+func (r *timeRange) contains(t time.Time) bool {
+	return !t.Before(r.start) && !t.After(r.end)
+}
+
+// covers checks whether the range includes another range; a nil range is unbounded
+func (r *timeRange) covers(other *timeRange) bool {
+	if r == nil {
+		return true
+	}
+	if other == nil {
+		return false
+	}
+	return !other.start.Before(r.start) && !other.end.After(r.end)
+}
+
+// intersectRanges returns the overlap of two ranges; nil ranges are unbounded
+func intersectRanges(a, b *timeRange) *timeRange {
+	if a == nil {
+		return b
+	}
+	if b == nil {
+		return a
+	}
+
+	result := *a
+	if b.start.After(result.start) {
+		result.start = b.start
+	}
+	if b.end.Before(result.end) {
+		result.end = b.end
+	}
+	return &result
+}
+
+// unionRanges returns the smallest range including both ranges; nil ranges are unbounded
+func unionRanges(a, b *timeRange) *timeRange {
+	if a == nil || b == nil {
+		return nil
+	}
+
+	result := *a
+	if b.start.Before(result.start) {
+		result.start = b.start
+	}
+	if b.end.After(result.end) {
+		result.end = b.end
+	}
+	return &result
+}
+
+// beginFlow prepares the context for evaluating a top-level flow, recording the widest
+// time range the flow reads so the snapshot is loaded with a single bounded query
+func (re *RuleEngine) beginFlow(ctx *evaluationContext, flow models.JSONB) {
+	ctx.scope = re.flowScope(flow, ctx.window, ctx.timeVars)
+}
+
+// flowScope returns the widest time range that the leaves of a flow read events from.
+// Anything outside a $timeWindow reads all of the user's events, giving an unbounded (nil) scope.
+func (re *RuleEngine) flowScope(flow map[string]interface{}, window *timeRange, timeVars *TimeVariableCache) *timeRange {
+	if _, isEvent := flow["event"]; isEvent {
+		return window
+	}
+
+	var scope *timeRange
+	first := true
+	include := func(r *timeRange) {
+		if first {
+			scope, first = r, false
+		} else {
+			scope = unionRanges(scope, r)
+		}
+	}
+
+	for operator, value := range flow {
+		switch operator {
+		case "$and", "$or":
+			conditions, _ := value.([]interface{})
+			for _, condition := range conditions {
+				if conditionMap, ok := condition.(map[string]interface{}); ok {
+					include(re.flowScope(conditionMap, window, timeVars))
+				}
+			}
+		case "$not":
+			if conditionMap, ok := value.(map[string]interface{}); ok {
+				include(re.flowScope(conditionMap, window, timeVars))
+			}
+		case "$timeWindow":
+			criteria, _ := value.(map[string]interface{})
+			subFlow, ok := criteria["flow"].(map[string]interface{})
+			if !ok {
+				include(window)
+				continue
+			}
+			start, end, err := parseTimeWindow(criteria, timeVars)
+			if err != nil {
+				// The error is reported when the window is evaluated
+				include(window)
+				continue
+			}
+			include(re.flowScope(subFlow, intersectRanges(window, &timeRange{start: start, end: end}), timeVars))
+		default:
+			include(window)
+		}
+	}
+
+	if first {
+		return window
+	}
+	return scope
+}
+
+// loadSnapshot makes sure the snapshot holds every event visible in the current window
+func (re *RuleEngine) loadSnapshot(ctx *evaluationContext) error {
+	snapshot := ctx.snapshot
+	if snapshot.loaded && snapshot.bounds.covers(ctx.window) {
+		return nil
+	}
+
+	// Load the widest range the flow needs at once; when the snapshot is shared by
+	// several badges, grow it to also cover what earlier badges loaded
+	bounds := ctx.window
+	if ctx.scope.covers(bounds) {
+		bounds = ctx.scope
+	}
+	if snapshot.loaded {
+		bounds = unionRanges(snapshot.bounds, bounds)
+	}
+
+	var events []models.Event
+	var err error
+	if bounds == nil {
+		re.Logger.Debug("Loading event snapshot for user %s", ctx.userID)
+		events, err = re.DB.GetUserEvents(ctx.userID)
+	} else {
+		re.Logger.Debug("Loading event snapshot for user %s from %s to %s",
+			ctx.userID, bounds.start.Format(time.RFC3339), bounds.end.Format(time.RFC3339))
+		events, err = re.DB.GetUserEventsInRange(ctx.userID, bounds.start, bounds.end)
+	}
+	if err != nil {
+		return err
+	}
+	re.localizeEvents(events)
+
+	snapshot.events = events
+	snapshot.bounds = bounds
+	snapshot.loaded = true
+	return nil
+}
+
+// userEvents returns the user's events visible in the current window, loading them on first use.
+// The returned slice is a copy, so operators may sort it in place.
+func (re *RuleEngine) userEvents(ctx *evaluationContext) ([]models.Event, error) {
+	return re.userEventsMatching(ctx, func(models.Event) bool { return true })
+}
+
+// userEventsByType returns the user's events of a single type visible in the current window
+func (re *RuleEngine) userEventsByType(ctx *evaluationContext, eventTypeID int) ([]models.Event, error) {
+	return re.userEventsMatching(ctx, func(event models.Event) bool { return event.EventTypeID == eventTypeID })
+}
+
+// userEventsMatching returns the snapshot events in the current window that satisfy a predicate
+func (re *RuleEngine) userEventsMatching(ctx *evaluationContext, matches func(models.Event) bool) ([]models.Event, error) {
+	if err := re.loadSnapshot(ctx); err != nil {
+		return nil, err
+	}
+
+	var events []models.Event
+	for _, event := range ctx.snapshot.events {
+		if ctx.window != nil && !ctx.window.contains(event.OccurredAt) {
+			continue
+		}
+		if ctx.holidays != nil && !isBusinessDay(event.OccurredAt, ctx.holidays) {
+			continue
+		}
+		if matches(event) {
+			events = append(events, event)
+		}
+	}
+	return events, nil
+}
+
+// eventTypeByName resolves an event type by name, caching it for the rest of the evaluation
+func (re *RuleEngine) eventTypeByName(ctx *evaluationContext, name string) (models.EventType, error) {
+	if eventType, ok := ctx.snapshot.eventTypes[name]; ok {
+		return eventType, nil
+	}
+
+	eventType, err := re.DB.GetEventTypeByName(name)
+	if err != nil {
+		return models.EventType{}, err
+	}
+	ctx.snapshot.eventTypes[name] = eventType
+	return eventType, nil
+}
@@ -0,0 +1,180 @@
+package engine
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/badge-assignment-system/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// countingDB is an in-memory DBInterface that counts the queries issued against it
+type countingDB struct {
+	badge      models.BadgeWithCriteria
+	eventTypes map[string]models.EventType
+	events     []models.Event
+	queries    int
+}
+
+func (db *countingDB) GetBadgeWithCriteria(id int) (models.BadgeWithCriteria, error) {
+	db.queries++
+	return db.badge, nil
+}
+
+func (db *countingDB) GetEventTypeByName(name string) (models.EventType, error) {
+	db.queries++
+	eventType, ok := db.eventTypes[name]
+	if !ok {
+		return models.EventType{}, fmt.Errorf("event type '%s' not found", name)
+	}
+	return eventType, nil
+}
+
+func (db *countingDB) GetEventTypeByID(id int) (models.EventType, error) {
+	db.queries++
+	for _, eventType := range db.eventTypes {
+		if eventType.ID == id {
+			return eventType, nil
+		}
+	}
+	return models.EventType{}, fmt.Errorf("event type %d not found", id)
+}
+
+func (db *countingDB) GetUserEventsByType(userID string, eventTypeID int) ([]models.Event, error) {
+	db.queries++
+	var events []models.Event
+	for _, event := range db.events {
+		if event.UserID == userID && event.EventTypeID == eventTypeID {
+			events = append(events, event)
+		}
+	}
+	return events, nil
+}
+
+func (db *countingDB) GetUserEvents(userID string) ([]models.Event, error) {
+	db.queries++
+	var events []models.Event
+	for _, event := range db.events {
+		if event.UserID == userID {
+			events = append(events, event)
+		}
+	}
+	return events, nil
+}
+
+func (db *countingDB) GetUserEventsInRange(userID string, start, end time.Time) ([]models.Event, error) {
+	db.queries++
+	var events []models.Event
+	for _, event := range db.events {
+		if event.UserID == userID && !event.OccurredAt.Before(start) && !event.OccurredAt.After(end) {
+			events = append(events, event)
+		}
+	}
+	return events, nil
+}
+
+func (db *countingDB) GetActiveBadges() ([]models.Badge, error) {
+	db.queries++
+	return []models.Badge{db.badge.Badge}, nil
+}
+
+func (db *countingDB) GetUserBadges(userID string) ([]models.UserBadge, error) {
+	db.queries++
+	return nil, nil
+}
+
+func (db *countingDB) AwardBadgeToUser(userBadge *models.UserBadge) (bool, error) {
+	db.queries++
+	return true, nil
+}
+
+func (db *countingDB) GetConditionTypeByName(name string) (models.ConditionType, error) {
+	db.queries++
+	return models.ConditionType{}, fmt.Errorf("condition type '%s' not found", name)
+}
+
+func (db *countingDB) GetUserTimezone(userID string) (string, error) {
+	db.queries++
+	return "", nil
+}
+
+func (db *countingDB) GetHolidayCalendarByName(name string) (models.HolidayCalendar, error) {
+	db.queries++
+	return models.HolidayCalendar{}, fmt.Errorf("holiday calendar '%s' not found", name)
+}
+
+// newCountingDB builds a badge whose $and combines five conditions over two event types
+func newCountingDB() *countingDB {
+	flow := models.JSONB{
+		"$and": []interface{}{
+			map[string]interface{}{"event": "task-completion", "criteria": map[string]interface{}{"$eventCount": map[string]interface{}{"$gte": float64(10)}}},
+			map[string]interface{}{"event": "task-completion", "criteria": map[string]interface{}{"priority": "high"}},
+			map[string]interface{}{"$not": map[string]interface{}{"event": "bug-report", "criteria": map[string]interface{}{"severity": "critical"}}},
+			map[string]interface{}{"$timePeriod": map[string]interface{}{"periodType": "day", "periodCount": map[string]interface{}{"$gte": float64(5)}}},
+			map[string]interface{}{"$sequence": map[string]interface{}{"sequence": []interface{}{"bug-report", "task-completion"}}},
+		},
+	}
+
+	db := &countingDB{
+		badge: models.BadgeWithCriteria{
+			Badge:    models.Badge{ID: 1, Name: "All Rounder", Active: true},
+			Criteria: models.BadgeCriteria{BadgeID: 1, FlowDefinition: flow},
+		},
+		eventTypes: map[string]models.EventType{
+			"task-completion": {ID: 1, Name: "task-completion"},
+			"bug-report":      {ID: 2, Name: "bug-report"},
+		},
+	}
+
+	start := time.Now().AddDate(0, 0, -30)
+	for i := 0; i < 30; i++ {
+		db.events = append(db.events, models.Event{
+			ID:          len(db.events) + 1,
+			EventTypeID: 1,
+			UserID:      "user-1",
+			OccurredAt:  start.AddDate(0, 0, i),
+			Payload:     models.JSONB{"priority": "high"},
+		})
+		if i%7 == 0 {
+			db.events = append(db.events, models.Event{
+				ID:          len(db.events) + 1,
+				EventTypeID: 2,
+				UserID:      "user-1",
+				OccurredAt:  start.AddDate(0, 0, i).Add(-time.Hour),
+				Payload:     models.JSONB{"severity": "minor"},
+			})
+		}
+	}
+	return db
+}
+
+// TestEvaluationLoadsEventsOnce checks that a flow with many conditions loads the user's events a single time
+func TestEvaluationLoadsEventsOnce(t *testing.T) {
+	db := newCountingDB()
+	engine := NewRuleEngine(db)
+
+	result, _, err := engine.EvaluateBadgeCriteria(1, "user-1")
+	require.NoError(t, err)
+	assert.True(t, result)
+
+	// One query for the badge, one per distinct event type, and one for the events
+	assert.Equal(t, 4, db.queries)
+}
+
+// BenchmarkEvaluateBadgeQueries reports the number of database queries issued per badge evaluation
+func BenchmarkEvaluateBadgeQueries(b *testing.B) {
+	db := newCountingDB()
+	engine := NewRuleEngine(db)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		result, _, err := engine.EvaluateBadgeCriteria(1, "user-1")
+		if err != nil || !result {
+			b.Fatalf("unexpected evaluation result: %v, %v", result, err)
+		}
+	}
+
+	b.ReportMetric(float64(db.queries)/float64(b.N), "queries/op")
+}
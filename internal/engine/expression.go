@@ -0,0 +1,89 @@
+package engine
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/badge-assignment-system/internal/expr"
+	"github.com/badge-assignment-system/internal/models"
+)
+
+// criteriaFlow returns the flow evaluated for a badge's criteria. Criteria written as an
+// expression are evaluated through a {"$expression": ...} node, so that they are traced,
+// windowed and indexed like any other flow.
+func criteriaFlow(criteria models.BadgeCriteria) models.JSONB {
+	if criteria.Expression != "" {
+		return models.JSONB{"$expression": criteria.Expression}
+	}
+	return criteria.FlowDefinition
+}
+
+// evaluateExpressionCriteria evaluates a CEL expression against the user's events
+func (re *RuleEngine) evaluateExpressionCriteria(value interface{}, ctx *evaluationContext, metadata map[string]interface{}) (bool, error) {
+	source, ok := value.(string)
+	if !ok {
+		return false, errors.New("$expression requires an expression string")
+	}
+
+	program, err := expr.Compile(source)
+	if err != nil {
+		return false, err
+	}
+
+	events, err := re.userEvents(ctx)
+	if err != nil {
+		return false, fmt.Errorf("failed to get user events: %w", err)
+	}
+	ctx.recordEvents(events)
+
+	input := expr.Input{
+		UserID: ctx.userID,
+		Now:    ctx.timeVars.now,
+		Events: make([]expr.Event, 0, len(events)),
+		ResolveTime: func(value string) (time.Time, error) {
+			return ParseDynamicTimeVariable(value, ctx.timeVars)
+		},
+	}
+	for _, event := range events {
+		eventType, err := re.eventTypeByID(ctx, event.EventTypeID)
+		if err != nil {
+			return false, fmt.Errorf("event type %d not found: %w", event.EventTypeID, err)
+		}
+		input.Events = append(input.Events, expr.Event{
+			ID:         event.ID,
+			Type:       eventType.Name,
+			OccurredAt: event.OccurredAt,
+			Payload:    event.Payload,
+		})
+	}
+	sort.SliceStable(input.Events, func(i, j int) bool {
+		return input.Events[i].OccurredAt.Before(input.Events[j].OccurredAt)
+	})
+
+	result, err := program.Eval(input)
+	metadata["expression_cost"] = result.Cost
+	if err != nil {
+		return false, err
+	}
+
+	re.Logger.Debug("Expression for user %s evaluated to %v (cost %d)", ctx.userID, result.Matched, result.Cost)
+	return result.Matched, nil
+}
+
+// eventTypeByID resolves an event type by ID, caching it for the rest of the evaluation
+func (re *RuleEngine) eventTypeByID(ctx *evaluationContext, id int) (models.EventType, error) {
+	for _, eventType := range ctx.snapshot.eventTypes {
+		if eventType.ID == id {
+			return eventType, nil
+		}
+	}
+
+	eventType, err := re.DB.GetEventTypeByID(id)
+	if err != nil {
+		return models.EventType{}, err
+	}
+	ctx.snapshot.eventTypes[eventType.Name] = eventType
+	return eventType, nil
+}
@@ -0,0 +1,54 @@
+package engine
+
+import (
+	"testing"
+
+	"github.com/badge-assignment-system/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// badgeWithExpression creates an active badge whose criteria is a CEL expression
+func badgeWithExpression(id int, name, expression string) models.BadgeWithCriteria {
+	return models.BadgeWithCriteria{
+		Badge:    models.Badge{ID: id, Name: name, Active: true},
+		Criteria: models.BadgeCriteria{BadgeID: id, Expression: expression},
+	}
+}
+
+func TestExpressionCriteria(t *testing.T) {
+	db := &awardingDB{
+		badges: []models.BadgeWithCriteria{
+			badgeWithExpression(1, "Regular", `count(within(events.filter(e, e.type == "check-in"), "$NOW(-7d)")) >= 3`),
+			badgeWithExpression(2, "Devoted", `distinctDays(events) >= 10`),
+		},
+		events: checkInsAt("user-1", "08:00:00", "08:30:00", "09:00:00"),
+	}
+	engine := NewRuleEngine(db)
+
+	tests := []struct {
+		badgeID  int
+		expected bool
+	}{
+		{1, true},
+		{2, false},
+	}
+	for _, tt := range tests {
+		badge, err := db.GetBadgeWithCriteria(tt.badgeID)
+		require.NoError(t, err)
+		result, metadata, err := engine.evaluateBadgeFlow(tt.badgeID, criteriaFlow(badge.Criteria), newEvaluationContext("user-1"))
+		require.NoError(t, err)
+		assert.Equal(t, tt.expected, result, badge.Badge.Name)
+		assert.NotZero(t, metadata["expression_cost"])
+	}
+
+	// Expression badges are awarded like any other when an event arrives
+	_, err := engine.ProcessEvent(&db.events[2])
+	require.NoError(t, err)
+	require.Len(t, db.awards, 1)
+	assert.Equal(t, 1, db.awards[0].BadgeID)
+
+	// A malformed expression is an evaluation error rather than a silent false
+	_, _, err = engine.evaluateBadgeFlow(3, models.JSONB{"$expression": "count(events) >="}, newEvaluationContext("user-1"))
+	assert.Error(t, err)
+}
@@ -0,0 +1,108 @@
+package engine
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/badge-assignment-system/internal/models"
+)
+
+// pathSegment is one step of a field path: either a map key or an array index
+type pathSegment struct {
+	key     string
+	index   int
+	isIndex bool
+}
+
+// parseFieldPath splits a field path such as "project.owner.team" or "items[0].sku" into segments
+func parseFieldPath(path string) ([]pathSegment, error) {
+	if path == "" {
+		return nil, fmt.Errorf("empty field path")
+	}
+
+	var segments []pathSegment
+	for _, part := range strings.Split(path, ".") {
+		key := part
+		var indexes []int
+
+		if open := strings.Index(part, "["); open >= 0 {
+			key = part[:open]
+			rest := part[open:]
+			for rest != "" {
+				end := strings.Index(rest, "]")
+				if rest[0] != '[' || end < 0 {
+					return nil, fmt.Errorf("invalid field path '%s'", path)
+				}
+				index, err := strconv.Atoi(rest[1:end])
+				if err != nil || index < 0 {
+					return nil, fmt.Errorf("invalid array index in field path '%s'", path)
+				}
+				indexes = append(indexes, index)
+				rest = rest[end+1:]
+			}
+		}
+
+		if key == "" && (len(indexes) == 0 || len(segments) > 0) {
+			return nil, fmt.Errorf("invalid field path '%s'", path)
+		}
+		if key != "" {
+			segments = append(segments, pathSegment{key: key})
+		}
+		for _, index := range indexes {
+			segments = append(segments, pathSegment{index: index, isIndex: true})
+		}
+	}
+	return segments, nil
+}
+
+// lookupField resolves a field path against an event payload or a nested object,
+// reporting whether the field exists. A key containing a literal dot or bracket is
+// still found when it exists as is, so flat payloads keep working.
+func lookupField(document map[string]interface{}, path string) (interface{}, bool, error) {
+	if value, ok := document[path]; ok {
+		return value, true, nil
+	}
+	if !strings.ContainsAny(path, ".[") {
+		return nil, false, nil
+	}
+
+	segments, err := parseFieldPath(path)
+	if err != nil {
+		return nil, false, err
+	}
+
+	var current interface{} = document
+	for _, segment := range segments {
+		if segment.isIndex {
+			array := reflect.ValueOf(current)
+			if (array.Kind() != reflect.Slice && array.Kind() != reflect.Array) || segment.index >= array.Len() {
+				return nil, false, nil
+			}
+			current = array.Index(segment.index).Interface()
+			continue
+		}
+
+		object, ok := asObject(current)
+		if !ok {
+			return nil, false, nil
+		}
+		if current, ok = object[segment.key]; !ok {
+			return nil, false, nil
+		}
+	}
+	return current, true, nil
+}
+
+// asObject returns a value as a JSON object if it is one
+func asObject(value interface{}) (map[string]interface{}, bool) {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		return v, true
+	case models.JSONB:
+		return v, true
+	default:
+		return nil, false
+	}
+}
@@ -0,0 +1,139 @@
+package engine
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/badge-assignment-system/internal/logging"
+	"github.com/badge-assignment-system/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// ticketPayload decodes a nested ticketing system payload the way it arrives from the API
+func ticketPayload(t *testing.T) models.JSONB {
+	var payload models.JSONB
+	require.NoError(t, json.Unmarshal([]byte(`{
+		"project": {"priority": 1, "owner": {"team": "platform"}},
+		"tags": ["urgent", "customer", "billing"],
+		"items": [
+			{"sku": "A-1", "quantity": 2, "price": 10},
+			{"sku": "B-7", "quantity": 5, "price": 3}
+		],
+		"matrix": [[1, 2], [3, 4]],
+		"legacy.key": "flat"
+	}`), &payload))
+	return payload
+}
+
+func TestLookupField(t *testing.T) {
+	payload := ticketPayload(t)
+
+	tests := []struct {
+		path   string
+		value  interface{}
+		exists bool
+	}{
+		{"project.owner.team", "platform", true},
+		{"project.priority", float64(1), true},
+		{"items[1].sku", "B-7", true},
+		{"tags[0]", "urgent", true},
+		{"matrix[1][0]", float64(3), true},
+		{"legacy.key", "flat", true},
+		{"project.owner.name", nil, false},
+		{"items[5].sku", nil, false},
+		{"tags.first", nil, false},
+		{"project[0]", nil, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			value, exists, err := lookupField(payload, tt.path)
+			require.NoError(t, err)
+			assert.Equal(t, tt.exists, exists)
+			assert.Equal(t, tt.value, value)
+		})
+	}
+
+	for _, path := range []string{"items[x].sku", "items[0", "project..team", "items[-1]"} {
+		_, _, err := lookupField(payload, path)
+		assert.Error(t, err, path)
+	}
+}
+
+func TestNestedFieldCriteria(t *testing.T) {
+	re := &RuleEngine{
+		Logger: logging.NewLogger("TEST-ENGINE", logging.LogLevelError),
+	}
+	event := models.Event{ID: 1, Payload: ticketPayload(t)}
+
+	tests := []struct {
+		name     string
+		criteria string
+		expected bool
+	}{
+		{"dotted equality", `{"project.owner.team": "platform"}`, true},
+		{"dotted comparison", `{"project.priority": {"$lte": 2}}`, true},
+		{"indexed field", `{"items[0].sku": "A-1"}`, true},
+		{"missing nested field", `{"project.owner.name": "alice"}`, false},
+		{"exists", `{"project.owner": {"$exists": true}}`, true},
+		{"exists on missing field", `{"project.deadline": {"$exists": true}}`, false},
+		{"not exists on missing field", `{"project.deadline": {"$exists": false}}`, true},
+		{"not exists on present field", `{"tags": {"$exists": false}}`, false},
+		{"size", `{"tags": {"$size": 3}}`, true},
+		{"size mismatch", `{"tags": {"$size": 2}}`, false},
+		{"size comparison", `{"items": {"$size": {"$gte": 2}}}`, true},
+		{"size of non-array", `{"project": {"$size": 1}}`, false},
+		{"all", `{"tags": {"$all": ["billing", "urgent"]}}`, true},
+		{"all missing element", `{"tags": {"$all": ["urgent", "internal"]}}`, false},
+		{"elemMatch on objects", `{"items": {"$elemMatch": {"sku": "B-7", "quantity": {"$gte": 5}}}}`, true},
+		{"elemMatch requires one element to match every condition", `{"items": {"$elemMatch": {"sku": "A-1", "quantity": {"$gte": 5}}}}`, false},
+		{"elemMatch on values", `{"matrix[1]": {"$elemMatch": {"$gt": 3}}}`, true},
+		{"elemMatch with nested operators", `{"items": {"$elemMatch": {"sku": {"$in": ["C-3", "B-7"]}}}}`, true},
+		{"regex", `{"project.owner.team": {"$regex": "^plat"}}`, true},
+		{"regex mismatch", `{"project.owner.team": {"$regex": "^billing$"}}`, false},
+		{"regex on non-string", `{"project.priority": {"$regex": "2"}}`, false},
+		{"regex on elements", `{"items": {"$elemMatch": {"sku": {"$regex": "^B-"}}}}`, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var criteria map[string]interface{}
+			require.NoError(t, json.Unmarshal([]byte(tt.criteria), &criteria))
+
+			result, err := re.eventMatchesCriteria(event, criteria, NewTimeVariableCache())
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, result)
+		})
+	}
+
+	_, err := re.eventMatchesCriteria(event, map[string]interface{}{"tags": map[string]interface{}{"$all": "urgent"}}, NewTimeVariableCache())
+	assert.Error(t, err)
+	_, err = re.eventMatchesCriteria(event, map[string]interface{}{"tags": map[string]interface{}{"$regex": "(urgent"}}, NewTimeVariableCache())
+	assert.Error(t, err)
+}
+
+func TestAggregationOverNestedField(t *testing.T) {
+	re := &RuleEngine{
+		Logger: logging.NewLogger("TEST-ENGINE", logging.LogLevelError),
+	}
+
+	var events []models.Event
+	for i := 0; i < 3; i++ {
+		payload := ticketPayload(t)
+		events = append(events, models.Event{ID: i + 1, OccurredAt: time.Now(), Payload: payload})
+	}
+
+	criteria := map[string]interface{}{
+		"type":  "sum",
+		"field": "items[1].quantity",
+		"value": map[string]interface{}{"$gte": float64(15)},
+	}
+
+	metadata := make(map[string]interface{})
+	result, err := re.evaluateAggregationCriteria(criteria, events, NewTimeVariableCache(), metadata)
+	require.NoError(t, err)
+	assert.True(t, result)
+	assert.Equal(t, float64(15), metadata["sum_items[1].quantity"])
+}
@@ -0,0 +1,234 @@
+package engine
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/badge-assignment-system/internal/models"
+	"github.com/badge-assignment-system/internal/schema"
+)
+
+// holidaySet is the set of days skipped as holidays: single dates and days repeated every year
+type holidaySet struct {
+	dates  map[string]bool             // YYYY-MM-DD
+	yearly map[string][]models.Holiday // MM-DD -> yearly holidays on that day
+}
+
+// newHolidaySet creates an empty set of holidays
+func newHolidaySet() *holidaySet {
+	return &holidaySet{dates: make(map[string]bool), yearly: make(map[string][]models.Holiday)}
+}
+
+// add adds the holidays of a calendar to the set
+func (h *holidaySet) add(holidays ...models.Holiday) {
+	for _, holiday := range holidays {
+		if holiday.Yearly && len(holiday.Date) == len("2006-01-02") {
+			monthDay := holiday.Date[5:]
+			h.yearly[monthDay] = append(h.yearly[monthDay], holiday)
+		} else {
+			h.dates[holiday.Date] = true
+		}
+	}
+}
+
+// addDates adds YYYY-MM-DD dates listed in criteria to the set
+func (h *holidaySet) addDates(dates []string) {
+	for _, date := range dates {
+		h.dates[date] = true
+	}
+}
+
+// contains reports whether the date of t, in t's timezone, is a holiday
+func (h *holidaySet) contains(t time.Time) bool {
+	if h == nil {
+		return false
+	}
+	date := t.Format("2006-01-02")
+	if h.dates[date] {
+		return true
+	}
+	for _, holiday := range h.yearly[date[5:]] {
+		if date >= holiday.Date && (holiday.Until == "" || date <= holiday.Until) {
+			return true
+		}
+	}
+	return false
+}
+
+// union returns a set holding the holidays of both sets; a nil set is empty
+func (h *holidaySet) union(other *holidaySet) *holidaySet {
+	result := newHolidaySet()
+	for _, set := range []*holidaySet{h, other} {
+		if set == nil {
+			continue
+		}
+		for date := range set.dates {
+			result.dates[date] = true
+		}
+		for monthDay, holidays := range set.yearly {
+			result.yearly[monthDay] = append(result.yearly[monthDay], holidays...)
+		}
+	}
+	return result
+}
+
+// HolidayCalendars caches holiday calendars by name, so that criteria naming a calendar do not
+// read it from the database on every evaluation. Calendars are read on first use and read again
+// once invalidated. The cache is safe for concurrent use.
+type HolidayCalendars struct {
+	mu         sync.RWMutex
+	generation int // Incremented on invalidation to discard in-flight reads
+	calendars  map[string]*holidaySet
+}
+
+// NewHolidayCalendars creates an empty holiday calendar cache
+func NewHolidayCalendars() *HolidayCalendars {
+	return &HolidayCalendars{calendars: make(map[string]*holidaySet)}
+}
+
+// Invalidate discards the named calendars so that they are read again on next use
+func (c *HolidayCalendars) Invalidate(names ...string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.generation++
+	for _, name := range names {
+		delete(c.calendars, name)
+	}
+}
+
+// get returns the holidays of a calendar, reading it on first use
+func (c *HolidayCalendars) get(db DBInterface, name string) (*holidaySet, error) {
+	c.mu.RLock()
+	holidays, ok := c.calendars[name]
+	generation := c.generation
+	c.mu.RUnlock()
+	if ok {
+		return holidays, nil
+	}
+
+	calendar, err := db.GetHolidayCalendarByName(name)
+	if err != nil {
+		return nil, fmt.Errorf("holiday calendar '%s' not found: %w", name, err)
+	}
+	holidays = newHolidaySet()
+	holidays.add(calendar.Holidays...)
+
+	c.mu.Lock()
+	if c.generation == generation {
+		c.calendars[name] = holidays
+	}
+	c.mu.Unlock()
+	return holidays, nil
+}
+
+// holidays returns the holidays a criterion skips: the dates it lists and those of the
+// calendar it names, if any
+func (re *RuleEngine) holidays(dates []string, calendar string) (*holidaySet, error) {
+	holidays := newHolidaySet()
+	holidays.addDates(dates)
+	if calendar == "" {
+		return holidays, nil
+	}
+
+	calendars := re.HolidayCalendars
+	if calendars == nil {
+		calendars = NewHolidayCalendars()
+	}
+	named, err := calendars.get(re.DB, calendar)
+	if err != nil {
+		return nil, err
+	}
+	return holidays.union(named), nil
+}
+
+// ValidateHolidayCalendar checks a holiday calendar's name and the dates of its holidays
+func ValidateHolidayCalendar(calendar models.HolidayCalendar) error {
+	var violations []schema.Violation
+	add := func(path, keyword, format string, args ...interface{}) {
+		violations = append(violations, schema.Violation{Path: path, Keyword: keyword, Message: fmt.Sprintf(format, args...)})
+	}
+
+	if calendar.Name == "" {
+		add("/name", "name", "holiday calendar name is required")
+	}
+	for i, holiday := range calendar.Holidays {
+		path := pointer("/holidays", i)
+		date, err := time.Parse("2006-01-02", holiday.Date)
+		if err != nil {
+			add(pointer(path, "date"), "date", "holiday '%s' is not a YYYY-MM-DD date", holiday.Date)
+		}
+		if holiday.Until == "" {
+			continue
+		}
+		if !holiday.Yearly {
+			add(pointer(path, "until"), "until", "until only applies to yearly holidays")
+		}
+		if until, err := time.Parse("2006-01-02", holiday.Until); err != nil {
+			add(pointer(path, "until"), "until", "until '%s' is not a YYYY-MM-DD date", holiday.Until)
+		} else if until.Before(date) {
+			add(pointer(path, "until"), "until", "until %s is before the holiday's date %s", holiday.Until, holiday.Date)
+		}
+	}
+
+	if len(violations) > 0 {
+		return &schema.ValidationError{Message: "invalid holiday calendar", Violations: violations}
+	}
+	return nil
+}
+
+// CheckHolidayCalendarUsage makes sure that no active badge names a holiday calendar that is
+// about to be renamed or deleted
+func CheckHolidayCalendarUsage(db DBInterface, name string) error {
+	badges, err := db.GetActiveBadges()
+	if err != nil {
+		return fmt.Errorf("failed to retrieve active badges: %w", err)
+	}
+
+	var violations []schema.Violation
+	for _, badge := range badges {
+		badgeWithCriteria, err := db.GetBadgeWithCriteria(badge.ID)
+		if err != nil {
+			return fmt.Errorf("failed to get criteria for badge ID %d: %w", badge.ID, err)
+		}
+		for _, flow := range badgeFlows(badgeWithCriteria) {
+			if namesHolidayCalendar(flow, name) {
+				violations = append(violations, schema.Violation{
+					Keyword: "holidayCalendar",
+					Message: fmt.Sprintf("badge '%s' skips the holidays of '%s'", badge.Name, name),
+				})
+				break
+			}
+		}
+	}
+
+	if len(violations) > 0 {
+		return &schema.ValidationError{Message: "holiday calendar is in use", Violations: violations}
+	}
+	return nil
+}
+
+// namesHolidayCalendar reports whether a flow names a holiday calendar anywhere
+func namesHolidayCalendar(flow interface{}, name string) bool {
+	switch v := flow.(type) {
+	case models.JSONB:
+		return namesHolidayCalendar(map[string]interface{}(v), name)
+	case map[string]interface{}:
+		for key, value := range v {
+			if calendar, ok := value.(string); ok && key == "holidayCalendar" && calendar == name {
+				return true
+			}
+			if namesHolidayCalendar(value, name) {
+				return true
+			}
+		}
+	case []interface{}:
+		for _, value := range v {
+			if namesHolidayCalendar(value, name) {
+				return true
+			}
+		}
+	}
+	return false
+}
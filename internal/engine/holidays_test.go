@@ -0,0 +1,171 @@
+package engine
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/badge-assignment-system/internal/models"
+	"github.com/badge-assignment-system/internal/schema"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// day parses a YYYY-MM-DD date at noon UTC
+func day(t *testing.T, date string) time.Time {
+	parsed, err := time.Parse("2006-01-02", date)
+	require.NoError(t, err)
+	return parsed.Add(12 * time.Hour)
+}
+
+func TestHolidaySet(t *testing.T) {
+	holidays := newHolidaySet()
+	holidays.add(
+		models.Holiday{Date: "2024-05-17", Name: "Company Day"},
+		models.Holiday{Date: "2020-12-25", Name: "Christmas Day", Yearly: true},
+		models.Holiday{Date: "2021-07-04", Name: "Founders' Day", Yearly: true, Until: "2023-07-04"},
+		models.Holiday{Date: "2024-02-29", Name: "Leap Day", Yearly: true},
+	)
+	holidays.addDates([]string{"2024-01-02"})
+
+	for date, expected := range map[string]bool{
+		"2024-05-17": true,
+		"2025-05-17": false,
+		"2019-12-25": false,
+		"2020-12-25": true,
+		"2031-12-25": true,
+		"2021-07-04": true,
+		"2023-07-04": true,
+		"2024-07-04": false,
+		"2028-02-29": true,
+		"2025-02-28": false,
+		"2024-01-02": true,
+	} {
+		assert.Equal(t, expected, isHoliday(day(t, date), holidays), date)
+	}
+
+	var none *holidaySet
+	assert.False(t, isHoliday(day(t, "2024-05-17"), none))
+	assert.True(t, isHoliday(day(t, "2024-05-17"), none.union(holidays)))
+}
+
+func TestBusinessHoursBetween(t *testing.T) {
+	holidays := newHolidaySet()
+	holidays.addDates([]string{"2024-05-15"})
+	at := func(value string) time.Time {
+		parsed, err := time.Parse(time.RFC3339, value)
+		require.NoError(t, err)
+		return parsed
+	}
+
+	// From Friday noon to Monday noon, only Friday afternoon and Monday morning count
+	assert.Equal(t, 24.0, businessHoursBetween(at("2024-05-10T12:00:00Z"), at("2024-05-13T12:00:00Z"), holidays))
+	// Tuesday 18:00 to Thursday 06:00 skips the Wednesday holiday
+	assert.Equal(t, 12.0, businessHoursBetween(at("2024-05-14T18:00:00Z"), at("2024-05-16T06:00:00Z"), holidays))
+	assert.Equal(t, 2.0, businessHoursBetween(at("2024-05-13T08:00:00Z"), at("2024-05-13T10:00:00Z"), nil))
+}
+
+// holidayCheckIns are check-ins from Monday 13 to Monday 20 May 2024, on a Wednesday holiday
+// repeated every year, a Friday company holiday and a Saturday
+func holidayCheckIns(t *testing.T) *awardingDB {
+	var events []models.Event
+	for i, date := range []string{"2024-05-13", "2024-05-14", "2024-05-15", "2024-05-17", "2024-05-18", "2024-05-20"} {
+		events = append(events, models.Event{ID: i + 1, EventTypeID: 1, UserID: "user-1", OccurredAt: day(t, date).Add(-4 * time.Hour), Payload: models.JSONB{}})
+	}
+	return &awardingDB{
+		events: events,
+		calendars: []models.HolidayCalendar{{Name: "company", Holidays: models.Holidays{
+			{Date: "2020-05-15", Name: "Founders' Day", Yearly: true},
+			{Date: "2024-05-17", Name: "Company Day"},
+		}}},
+	}
+}
+
+func TestHolidayCalendarCriteria(t *testing.T) {
+	engine := NewRuleEngine(holidayCheckIns(t))
+	window := `{"$timeWindow": {"start": "2024-05-01T00:00:00Z", "end": "2024-05-20T23:59:59Z", %s, "flow": %s}}`
+
+	tests := []struct {
+		name     string
+		flow     string
+		expected bool
+	}{
+		{"days outside calendar holidays", `{"$timePeriod": {"periodType": "day", "excludeHolidays": true, "holidayCalendar": "company", "periodCount": {"$eq": 4}}}`, true},
+		{"days outside inline and calendar holidays", `{"$timePeriod": {"periodType": "day", "excludeHolidays": true, "holidays": ["2024-05-13"], "holidayCalendar": "company", "periodCount": {"$eq": 3}}}`, true},
+		{"business days in window", fmt.Sprintf(window, `"businessDaysOnly": true, "holidayCalendar": "company"`, `{"$timePeriod": {"periodType": "day", "periodCount": {"$eq": 3}}}`), true},
+		{"weekdays in window", fmt.Sprintf(window, `"businessDaysOnly": true`, `{"$timePeriod": {"periodType": "day", "periodCount": {"$eq": 5}}}`), true},
+		{"business day gaps", `{"$gap": {"maxGapHours": 24, "periodType": "business-days", "holidayCalendar": "company"}}`, true},
+		{"weekday gaps", `{"$gap": {"maxGapHours": 24, "periodType": "business-days"}}`, false},
+		{"calendar time gaps", `{"$gap": {"maxGapHours": 24}}`, false},
+		{"streak over holidays", streakUntil(`{"periodType": "day", "excludeWeekends": true, "excludeHolidays": true, "holidayCalendar": "company", "freezes": 1, "current": {"$eq": 3}}`), true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := engine.ExplainFlow(decodeJSONB(t, tt.flow), "user-1")
+			require.Empty(t, result.Error)
+			assert.Equal(t, tt.expected, result.Result)
+		})
+	}
+
+	result := engine.ExplainFlow(models.JSONB{"$timePeriod": map[string]interface{}{"periodType": "day", "excludeHolidays": true, "holidayCalendar": "bank"}}, "user-1")
+	assert.Contains(t, result.Error, "holiday calendar 'bank' not found")
+}
+
+func TestHolidayCalendarsAreCachedUntilInvalidated(t *testing.T) {
+	db := &awardingDB{calendars: []models.HolidayCalendar{{Name: "company", Holidays: models.Holidays{{Date: "2024-05-17"}}}}}
+	calendars := NewHolidayCalendars()
+
+	holidays, err := calendars.get(db, "company")
+	require.NoError(t, err)
+	assert.True(t, isHoliday(day(t, "2024-05-17"), holidays))
+
+	db.calendars[0].Holidays = models.Holidays{{Date: "2024-05-20"}}
+	holidays, err = calendars.get(db, "company")
+	require.NoError(t, err)
+	assert.True(t, isHoliday(day(t, "2024-05-17"), holidays), "cached")
+
+	calendars.Invalidate("company")
+	holidays, err = calendars.get(db, "company")
+	require.NoError(t, err)
+	assert.False(t, isHoliday(day(t, "2024-05-17"), holidays))
+	assert.True(t, isHoliday(day(t, "2024-05-20"), holidays))
+}
+
+func TestValidateHolidayCalendar(t *testing.T) {
+	assert.NoError(t, ValidateHolidayCalendar(models.HolidayCalendar{Name: "us-federal", Holidays: models.Holidays{
+		{Date: "2024-11-28", Name: "Thanksgiving Day"},
+		{Date: "2020-12-25", Name: "Christmas Day", Yearly: true, Until: "2030-12-25"},
+	}}))
+
+	err := ValidateHolidayCalendar(models.HolidayCalendar{Holidays: models.Holidays{
+		{Date: "25/12/2024"},
+		{Date: "2024-01-01", Until: "2030-01-01"},
+		{Date: "2024-01-01", Yearly: true, Until: "2023-01-01"},
+	}})
+	var validationErr *schema.ValidationError
+	require.ErrorAs(t, err, &validationErr)
+
+	var paths []string
+	for _, violation := range validationErr.Violations {
+		paths = append(paths, violation.Path)
+	}
+	assert.Equal(t, []string{"/name", "/holidays/0/date", "/holidays/1/until", "/holidays/2/until"}, paths)
+}
+
+func TestCheckHolidayCalendarUsage(t *testing.T) {
+	db := &awardingDB{badges: []models.BadgeWithCriteria{
+		badgeWithFlow(1, "Regular", map[string]interface{}{
+			"$timeWindow": map[string]interface{}{"last": "30d", "businessDaysOnly": true, "holidayCalendar": "company", "flow": checkInCountFlow(5)},
+		}),
+		badgeWithFlow(2, "Early Bird", checkInCountFlow(1)),
+	}}
+
+	assert.NoError(t, CheckHolidayCalendarUsage(db, "us-federal"))
+
+	err := CheckHolidayCalendarUsage(db, "company")
+	var validationErr *schema.ValidationError
+	require.ErrorAs(t, err, &validationErr)
+	require.Len(t, validationErr.Violations, 1)
+	assert.Equal(t, "badge 'Regular' skips the holidays of 'company'", validationErr.Violations[0].Message)
+}
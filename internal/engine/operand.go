@@ -0,0 +1,165 @@
+package engine
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// errUndefinedOperand is returned when an operand has no value for an event, such as a
+// reference to a missing field or a division by zero. Comparisons against it do not match.
+var errUndefinedOperand = errors.New("operand is undefined")
+
+// operandOperators are the operators that compute a value from the event being evaluated
+var operandOperators = map[string]bool{
+	"$field": true,
+	"$add":   true,
+	"$sub":   true,
+	"$mul":   true,
+	"$div":   true,
+	"$lower": true,
+	"$len":   true,
+}
+
+// resolvesOperands lists the comparison operators whose value may be an operand expression
+var resolvesOperands = map[string]bool{
+	"$eq":  true,
+	"$ne":  true,
+	"$gt":  true,
+	"$gte": true,
+	"$lt":  true,
+	"$lte": true,
+	"$in":  true,
+	"$nin": true,
+	"$all": true,
+}
+
+// operandExpression returns the operator and argument of a value such as {"$field": "estimated_hours"}
+func operandExpression(value interface{}) (string, interface{}, bool) {
+	expression, ok := value.(map[string]interface{})
+	if !ok || len(expression) != 1 {
+		return "", nil, false
+	}
+	for operator, argument := range expression {
+		if operandOperators[operator] {
+			return operator, argument, true
+		}
+	}
+	return "", nil, false
+}
+
+// resolveOperand computes the value of an operand against a document, usually the payload of
+// the event being evaluated. Literal values are returned unchanged and arrays are resolved
+// element by element, so {"$in": ["a", {"$field": "b"}]} works too.
+func resolveOperand(document map[string]interface{}, value interface{}) (interface{}, error) {
+	if array, ok := value.([]interface{}); ok {
+		resolved := make([]interface{}, len(array))
+		for i, element := range array {
+			var err error
+			if resolved[i], err = resolveOperand(document, element); err != nil {
+				return nil, err
+			}
+		}
+		return resolved, nil
+	}
+
+	operator, argument, ok := operandExpression(value)
+	if !ok {
+		return value, nil
+	}
+
+	switch operator {
+	case "$field":
+		path, ok := argument.(string)
+		if !ok {
+			return nil, errors.New("$field value must be a field name")
+		}
+		fieldValue, exists, err := lookupField(document, path)
+		if err != nil {
+			return nil, err
+		}
+		if !exists {
+			return nil, fmt.Errorf("field '%s' not found: %w", path, errUndefinedOperand)
+		}
+		return fieldValue, nil
+
+	case "$add", "$mul":
+		numbers, err := resolveNumbers(document, operator, argument)
+		if err != nil {
+			return nil, err
+		}
+		if len(numbers) < 2 {
+			return nil, fmt.Errorf("%s requires at least two operands", operator)
+		}
+		result := numbers[0]
+		for _, number := range numbers[1:] {
+			if operator == "$add" {
+				result += number
+			} else {
+				result *= number
+			}
+		}
+		return result, nil
+
+	case "$sub", "$div":
+		numbers, err := resolveNumbers(document, operator, argument)
+		if err != nil {
+			return nil, err
+		}
+		if len(numbers) != 2 {
+			return nil, fmt.Errorf("%s requires exactly two operands", operator)
+		}
+		if operator == "$sub" {
+			return numbers[0] - numbers[1], nil
+		}
+		if numbers[1] == 0 {
+			return nil, fmt.Errorf("division by zero: %w", errUndefinedOperand)
+		}
+		return numbers[0] / numbers[1], nil
+
+	case "$lower":
+		resolved, err := resolveOperand(document, argument)
+		if err != nil {
+			return nil, err
+		}
+		str, ok := resolved.(string)
+		if !ok {
+			return nil, fmt.Errorf("$lower requires a string, got %T", resolved)
+		}
+		return strings.ToLower(str), nil
+
+	default: // $len
+		resolved, err := resolveOperand(document, argument)
+		if err != nil {
+			return nil, err
+		}
+		if str, ok := resolved.(string); ok {
+			return float64(utf8.RuneCountInString(str)), nil
+		}
+		if array, ok := asArray(resolved); ok {
+			return float64(len(array)), nil
+		}
+		return nil, fmt.Errorf("$len requires a string or an array, got %T", resolved)
+	}
+}
+
+// resolveNumbers resolves the operands of an arithmetic operator to numbers
+func resolveNumbers(document map[string]interface{}, operator string, argument interface{}) ([]float64, error) {
+	operands, ok := argument.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("%s value must be an array of operands", operator)
+	}
+
+	numbers := make([]float64, len(operands))
+	for i, operand := range operands {
+		resolved, err := resolveOperand(document, operand)
+		if err != nil {
+			return nil, err
+		}
+		if numbers[i], err = toFloat64(resolved); err != nil {
+			return nil, fmt.Errorf("invalid %s operand: %w", operator, err)
+		}
+	}
+	return numbers, nil
+}
@@ -0,0 +1,114 @@
+package engine
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/badge-assignment-system/internal/logging"
+	"github.com/badge-assignment-system/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestResolveOperand(t *testing.T) {
+	document := map[string]interface{}{
+		"estimated_hours": float64(8),
+		"actual_hours":    float64(6),
+		"zero":            float64(0),
+		"title":           "Fix Login Bug",
+		"tags":            []interface{}{"a", "b", "c"},
+		"task":            map[string]interface{}{"points": float64(3)},
+	}
+
+	tests := []struct {
+		operand  string
+		expected interface{}
+	}{
+		{`{"$field": "estimated_hours"}`, float64(8)},
+		{`{"$field": "task.points"}`, float64(3)},
+		{`{"$add": [{"$field": "actual_hours"}, 2, {"$field": "task.points"}]}`, float64(11)},
+		{`{"$sub": [{"$field": "estimated_hours"}, {"$field": "actual_hours"}]}`, float64(2)},
+		{`{"$mul": [{"$field": "estimated_hours"}, 0.5]}`, float64(4)},
+		{`{"$div": [{"$field": "actual_hours"}, {"$field": "estimated_hours"}]}`, float64(0.75)},
+		{`{"$lower": {"$field": "title"}}`, "fix login bug"},
+		{`{"$len": {"$field": "title"}}`, float64(13)},
+		{`{"$len": {"$field": "tags"}}`, float64(3)},
+		{`["x", {"$field": "title"}]`, []interface{}{"x", "Fix Login Bug"}},
+		{`42`, float64(42)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.operand, func(t *testing.T) {
+			var operand interface{}
+			require.NoError(t, json.Unmarshal([]byte(tt.operand), &operand))
+
+			value, err := resolveOperand(document, operand)
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, value)
+		})
+	}
+
+	for _, operand := range []string{`{"$field": "missing"}`, `{"$div": [1, {"$field": "zero"}]}`} {
+		var value interface{}
+		require.NoError(t, json.Unmarshal([]byte(operand), &value))
+		_, err := resolveOperand(document, value)
+		assert.ErrorIs(t, err, errUndefinedOperand, operand)
+	}
+
+	for _, operand := range []string{`{"$add": [1]}`, `{"$sub": [1, 2, 3]}`, `{"$lower": 5}`, `{"$mul": [{"$field": "title"}, 2]}`, `{"$field": 3}`} {
+		var value interface{}
+		require.NoError(t, json.Unmarshal([]byte(operand), &value))
+		_, err := resolveOperand(document, value)
+		assert.Error(t, err, operand)
+		assert.NotErrorIs(t, err, errUndefinedOperand, operand)
+	}
+}
+
+func TestCrossFieldCriteria(t *testing.T) {
+	re := &RuleEngine{
+		Logger: logging.NewLogger("TEST-ENGINE", logging.LogLevelError),
+	}
+	event := models.Event{ID: 1, Payload: models.JSONB{
+		"estimated_hours": float64(8),
+		"actual_hours":    float64(6),
+		"status":          "DONE",
+		"hours":           []interface{}{float64(9), float64(10)},
+		"subtasks": []interface{}{
+			map[string]interface{}{"estimate": float64(2), "actual": float64(3)},
+			map[string]interface{}{"estimate": float64(5), "actual": float64(4)},
+		},
+	}}
+
+	tests := []struct {
+		name     string
+		criteria string
+		expected bool
+	}{
+		{"finished under estimate", `{"actual_hours": {"$lt": {"$field": "estimated_hours"}}}`, true},
+		{"over estimate", `{"actual_hours": {"$gt": {"$field": "estimated_hours"}}}`, false},
+		{"within 80% of estimate", `{"actual_hours": {"$lte": {"$mul": [{"$field": "estimated_hours"}, 0.8]}}}`, true},
+		{"missing field operand", `{"actual_hours": {"$lt": {"$field": "budget"}}}`, false},
+		{"operand in array", `{"status": {"$in": ["CLOSED", {"$field": "status"}]}}`, true},
+		{"case-insensitive expression", `{"$expr": {"$eq": [{"$lower": {"$field": "status"}}, "done"]}}`, true},
+		{"expression with arithmetic on both sides", `{"$expr": {"$gte": [{"$sub": [{"$field": "estimated_hours"}, {"$field": "actual_hours"}]}, 2]}}`, true},
+		{"expression with undefined operand", `{"$expr": {"$eq": [{"$field": "budget"}, 1]}}`, false},
+		{"elemMatch operand refers to the element", `{"subtasks": {"$elemMatch": {"actual": {"$lt": {"$field": "estimate"}}}}}`, true},
+		{"elemMatch value operand refers to the payload", `{"hours": {"$elemMatch": {"$gt": {"$add": [{"$field": "estimated_hours"}, 1]}}}}`, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var criteria map[string]interface{}
+			require.NoError(t, json.Unmarshal([]byte(tt.criteria), &criteria))
+
+			result, err := re.eventMatchesCriteria(event, criteria, NewTimeVariableCache())
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, result)
+		})
+	}
+
+	var criteria map[string]interface{}
+	require.NoError(t, json.Unmarshal([]byte(`{"$expr": {"$lt": [1]}}`), &criteria))
+	_, err := re.eventMatchesCriteria(event, criteria, NewTimeVariableCache())
+	assert.Error(t, err)
+}
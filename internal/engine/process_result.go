@@ -0,0 +1,79 @@
+package engine
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/badge-assignment-system/internal/models"
+)
+
+// ProcessResult is the outcome of evaluating badges for a user
+type ProcessResult struct {
+	UserID    string         `json:"user_id"`
+	Evaluated int            `json:"badges_evaluated"` // Distinct badges whose criteria were evaluated
+	Awarded   []AwardedBadge `json:"awarded"`
+	Errors    []BadgeError   `json:"errors,omitempty"`
+}
+
+// AwardedBadge is an award made while evaluating badges. A tiered badge has one award per
+// tier reached.
+type AwardedBadge struct {
+	BadgeID    int          `json:"badge_id"`
+	BadgeName  string       `json:"badge_name"`
+	ImageURL   string       `json:"image_url,omitempty"`
+	Tier       *int         `json:"tier,omitempty"`
+	Occurrence int          `json:"occurrence"`
+	Metadata   models.JSONB `json:"metadata"`
+	ExpiresAt  *time.Time   `json:"expires_at,omitempty"`
+}
+
+// BadgeError is a badge whose evaluation failed. Other badges are still evaluated.
+type BadgeError struct {
+	BadgeID   int    `json:"badge_id"`
+	BadgeName string `json:"badge_name"`
+	Error     string `json:"error"`
+}
+
+// newProcessResult creates an empty result for a user
+func newProcessResult(userID string) *ProcessResult {
+	return &ProcessResult{UserID: userID, Awarded: []AwardedBadge{}}
+}
+
+// addAwards records the awards made for a badge
+func (r *ProcessResult) addAwards(badge models.Badge, awards []models.UserBadge) {
+	for _, award := range awards {
+		r.Awarded = append(r.Awarded, AwardedBadge{
+			BadgeID:    badge.ID,
+			BadgeName:  badge.Name,
+			ImageURL:   badge.ImageURL,
+			Tier:       award.Tier,
+			Occurrence: award.Occurrence,
+			Metadata:   award.Metadata,
+			ExpiresAt:  award.ExpiresAt,
+		})
+	}
+}
+
+// Err returns the errors of the badges whose evaluation failed, joined, or nil when every badge
+// was evaluated
+func (r *ProcessResult) Err() error {
+	errs := make([]error, 0, len(r.Errors))
+	for _, badgeErr := range r.Errors {
+		errs = append(errs, fmt.Errorf("badge %d (%s): %s", badgeErr.BadgeID, badgeErr.BadgeName, badgeErr.Error))
+	}
+	return errors.Join(errs...)
+}
+
+// AwardedBadgeIDs returns the IDs of the badges awarded, each tiered badge once
+func (r *ProcessResult) AwardedBadgeIDs() []int {
+	var ids []int
+	seen := make(map[int]bool)
+	for _, award := range r.Awarded {
+		if !seen[award.BadgeID] {
+			seen[award.BadgeID] = true
+			ids = append(ids, award.BadgeID)
+		}
+	}
+	return ids
+}
@@ -0,0 +1,434 @@
+package engine
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/badge-assignment-system/internal/models"
+)
+
+// ConditionProgress describes how close a user is to satisfying one node of a flow definition
+type ConditionProgress struct {
+	Operator   string              `json:"operator"`
+	EventType  string              `json:"event_type,omitempty"`
+	Current    *float64            `json:"current,omitempty"`
+	Target     *float64            `json:"target,omitempty"`
+	Comparison string              `json:"comparison,omitempty"`
+	Unit       string              `json:"unit,omitempty"`
+	Met        bool                `json:"met"`
+	Percentage float64             `json:"percentage"`
+	Conditions []ConditionProgress `json:"conditions,omitempty"`
+	Streak     *StreakProgress     `json:"streak,omitempty"` // Set for $streak
+}
+
+// StreakProgress describes a user's runs of consecutive periods with activity
+type StreakProgress struct {
+	Current     int `json:"current"`
+	Longest     int `json:"longest"`
+	FreezesUsed int `json:"freezes_used"` // Missed periods forgiven in the current run
+	FreezesLeft int `json:"freezes_left"`
+}
+
+// BadgeProgress describes how close a user is to earning a badge
+type BadgeProgress struct {
+	BadgeID      int                `json:"badge_id"`
+	BadgeName    string             `json:"badge_name"`
+	UserID       string             `json:"user_id"`
+	Earned       bool               `json:"earned"`
+	CurrentTier  int                `json:"current_tier,omitempty"` // Highest tier held, for tiered badges
+	NextTier     *int               `json:"next_tier,omitempty"`    // Tier the progress refers to, while one remains
+	NextTierName string             `json:"next_tier_name,omitempty"`
+	Percentage   float64            `json:"percentage"`
+	Progress     *ConditionProgress `json:"progress"`
+	EvaluatedAt  time.Time          `json:"evaluated_at"`
+}
+
+// lowerBoundOperators are the comparisons that describe a target to reach,
+// in the order they are preferred when a criterion has several operators
+var lowerBoundOperators = []string{"$gte", "$gt", "$eq"}
+
+// upperBoundOperators are the comparisons that describe a limit not to exceed
+var upperBoundOperators = []string{"$lte", "$lt", "$ne"}
+
+// EvaluateBadgeProgress reports how close a user is to each leaf condition of a badge
+func (re *RuleEngine) EvaluateBadgeProgress(badgeID int, userID string) (*BadgeProgress, error) {
+	return re.evaluateBadgeProgress(badgeID, newEvaluationContext(userID))
+}
+
+// evaluateBadgeProgress reports a badge's progress within an evaluation context
+func (re *RuleEngine) evaluateBadgeProgress(badgeID int, ctx *evaluationContext) (*BadgeProgress, error) {
+	userID := ctx.userID
+	re.Logger.Debug("Evaluating badge progress for badge ID %d and user %s", badgeID, userID)
+
+	badgeWithCriteria, err := re.DB.GetBadgeWithCriteria(badgeID)
+	if err != nil {
+		re.Logger.Error("Failed to get badge criteria: %v", err)
+		return nil, fmt.Errorf("failed to get badge criteria: %w", err)
+	}
+
+	userBadges, err := re.DB.GetUserBadges(userID)
+	if err != nil {
+		re.Logger.Error("Failed to retrieve user badges: %v", err)
+		return nil, fmt.Errorf("failed to retrieve user badges: %w", err)
+	}
+
+	var awards []models.UserBadge
+	for _, userBadge := range activeAwards(userBadges, ctx.timeVars.now) {
+		if userBadge.BadgeID == badgeID {
+			awards = append(awards, userBadge)
+		}
+	}
+	earned := len(awards) > 0
+
+	result := &BadgeProgress{
+		BadgeID:     badgeID,
+		BadgeName:   badgeWithCriteria.Badge.Name,
+		UserID:      userID,
+		Earned:      earned,
+		EvaluatedAt: ctx.timeVars.now,
+	}
+
+	// For tiered badges, report progress towards the next tier the user has not reached
+	flowDefinition := criteriaFlow(badgeWithCriteria.Criteria)
+	complete := earned
+	if len(badgeWithCriteria.Tiers) > 0 {
+		result.CurrentTier = currentTier(awards)
+		complete = true
+		for _, tier := range badgeWithCriteria.Tiers {
+			if tier.Level > result.CurrentTier {
+				level := tier.Level
+				result.NextTier = &level
+				result.NextTierName = tier.Name
+				flowDefinition = tier.FlowDefinition
+				complete = false
+				break
+			}
+		}
+		if complete {
+			flowDefinition = badgeWithCriteria.Tiers[len(badgeWithCriteria.Tiers)-1].FlowDefinition
+		}
+	}
+
+	re.beginFlow(ctx, flowDefinition)
+	progress, err := re.evaluateFlowProgress(flowDefinition, ctx)
+	if err != nil {
+		re.Logger.Error("Progress evaluation failed: %v", err)
+		return nil, fmt.Errorf("progress evaluation failed: %w", err)
+	}
+
+	result.Progress = progress
+	result.Percentage = progress.Percentage
+	if complete {
+		result.Percentage = 100
+	}
+
+	return result, nil
+}
+
+// GetUserProgress reports the user's progress towards every active badge
+func (re *RuleEngine) GetUserProgress(userID string) ([]BadgeProgress, error) {
+	badges, err := re.DB.GetActiveBadges()
+	if err != nil {
+		re.Logger.Error("Failed to retrieve active badges: %v", err)
+		return nil, fmt.Errorf("failed to retrieve active badges: %w", err)
+	}
+
+	// All badges are evaluated against the same snapshot of the user's events
+	ctx := newEvaluationContext(userID)
+
+	result := make([]BadgeProgress, 0, len(badges))
+	for _, badge := range badges {
+		progress, err := re.evaluateBadgeProgress(badge.ID, ctx)
+		if err != nil {
+			re.Logger.Error("Error evaluating progress for badge ID %d: %v", badge.ID, err)
+			continue
+		}
+		result = append(result, *progress)
+	}
+
+	return result, nil
+}
+
+// evaluateFlowProgress walks a flow definition the same way evaluateFlow does,
+// but evaluates every branch and records current values against targets
+func (re *RuleEngine) evaluateFlowProgress(flow models.JSONB, ctx *evaluationContext) (*ConditionProgress, error) {
+	// Event-based leaf criterion
+	if eventType, hasEventType := flow["event"].(string); hasEventType {
+		metadata := make(map[string]interface{})
+		met, err := re.evaluateFlow(flow, ctx, metadata)
+		if err != nil {
+			return nil, err
+		}
+
+		progress := &ConditionProgress{Operator: "event", EventType: eventType, Met: met, Unit: "events"}
+		criteria, _ := flow["criteria"].(map[string]interface{})
+		if eventCount, ok := criteria["$eventCount"].(map[string]interface{}); ok {
+			progress.Operator = "$eventCount"
+			setNumericProgress(progress, metadata["event_count"], eventCount)
+		} else {
+			// Without an explicit count, a single matching event satisfies the criterion
+			setNumericProgress(progress, metadata["filtered_event_count"], map[string]interface{}{"$gte": float64(1)})
+		}
+		finalizeProgress(progress)
+		return progress, nil
+	}
+
+	for operator, value := range flow {
+		switch operator {
+		case "$and", "$or":
+			conditions, ok := value.([]interface{})
+			if !ok {
+				return nil, fmt.Errorf("%s operator requires an array of conditions", operator)
+			}
+
+			progress := &ConditionProgress{Operator: operator}
+			for _, condition := range conditions {
+				conditionMap, ok := condition.(map[string]interface{})
+				if !ok {
+					return nil, fmt.Errorf("each condition in %s must be an object", operator)
+				}
+				child, err := re.evaluateFlowProgress(models.JSONB(conditionMap), ctx)
+				if err != nil {
+					return nil, err
+				}
+				progress.Conditions = append(progress.Conditions, *child)
+			}
+
+			combineProgress(progress)
+			return progress, nil
+		case "$not":
+			conditionMap, ok := value.(map[string]interface{})
+			if !ok {
+				return nil, errors.New("$not operator requires a condition object")
+			}
+			child, err := re.evaluateFlowProgress(models.JSONB(conditionMap), ctx)
+			if err != nil {
+				return nil, err
+			}
+
+			progress := &ConditionProgress{
+				Operator:   operator,
+				Met:        !child.Met,
+				Conditions: []ConditionProgress{*child},
+			}
+			finalizeProgress(progress)
+			return progress, nil
+		case "$timeWindow":
+			criteria, ok := value.(map[string]interface{})
+			if !ok {
+				return nil, errors.New("$timeWindow requires a criteria object")
+			}
+			subFlow, ok := criteria["flow"].(map[string]interface{})
+			if !ok {
+				return nil, errors.New("$timeWindow requires a 'flow' object")
+			}
+			windowStart, windowEnd, err := parseTimeWindow(criteria, ctx.timeVars)
+			if err != nil {
+				return nil, err
+			}
+			windowCtx, err := re.windowContext(ctx, criteria, windowStart, windowEnd)
+			if err != nil {
+				return nil, err
+			}
+			child, err := re.evaluateFlowProgress(models.JSONB(subFlow), windowCtx)
+			if err != nil {
+				return nil, err
+			}
+
+			progress := &ConditionProgress{
+				Operator:   operator,
+				Met:        child.Met,
+				Percentage: child.Percentage,
+				Conditions: []ConditionProgress{*child},
+			}
+			finalizeProgress(progress)
+			return progress, nil
+		case "$condition":
+			expanded, err := re.expandCondition(value, ctx)
+			if err != nil {
+				return nil, err
+			}
+			child, err := re.evaluateFlowProgress(expanded, ctx)
+			if err != nil {
+				return nil, err
+			}
+
+			progress := &ConditionProgress{
+				Operator:   operator,
+				Met:        child.Met,
+				Percentage: child.Percentage,
+				Conditions: []ConditionProgress{*child},
+			}
+			finalizeProgress(progress)
+			return progress, nil
+		case "$hasBadge", "$badgeCount":
+			metadata := make(map[string]interface{})
+			met, err := re.evaluateFlow(models.JSONB{operator: value}, ctx, metadata)
+			if err != nil {
+				return nil, err
+			}
+
+			progress := &ConditionProgress{Operator: operator, Met: met, Unit: "badges"}
+			if operator == "$badgeCount" {
+				criteria, _ := value.(map[string]interface{})
+				count, _ := criteria["count"].(map[string]interface{})
+				setNumericProgress(progress, metadata["badge_count"], count)
+			}
+			finalizeProgress(progress)
+			return progress, nil
+		case "$timePeriod", "$streak", "$pattern", "$sequence", "$gap", "$duration", "$aggregate", "$expression":
+			criteria, _ := value.(map[string]interface{})
+			metadata := make(map[string]interface{})
+			met, err := re.evaluateFlow(models.JSONB{operator: value}, ctx, metadata)
+			if err != nil {
+				return nil, err
+			}
+
+			progress := &ConditionProgress{Operator: operator, Met: met}
+			switch operator {
+			case "$timePeriod":
+				periodType, _ := criteria["periodType"].(string)
+				progress.Unit = periodType + "s"
+				periodCount, _ := criteria["periodCount"].(map[string]interface{})
+				if len(periodCount) == 0 {
+					periodCount = map[string]interface{}{"$gte": float64(1)}
+				}
+				setNumericProgress(progress, metadata["unique_period_count"], periodCount)
+			case "$streak":
+				periodType, _ := criteria["periodType"].(string)
+				progress.Unit = periodType + "s"
+				current, _ := metadata["current_streak"].(int)
+				longest, _ := metadata["longest_streak"].(int)
+				freezesUsed, _ := metadata["streak_freezes_used"].(int)
+				freezes, _ := criteria["freezes"].(float64)
+				progress.Streak = &StreakProgress{
+					Current:     current,
+					Longest:     longest,
+					FreezesUsed: freezesUsed,
+					FreezesLeft: int(freezes) - freezesUsed,
+				}
+
+				// The target is the current streak's unless only the longest streak is compared
+				target, ok := criteria["current"].(map[string]interface{})
+				streak := current
+				if !ok {
+					if target, ok = criteria["longest"].(map[string]interface{}); ok {
+						streak = longest
+					} else {
+						target = map[string]interface{}{"$gte": float64(1)}
+					}
+				}
+				setNumericProgress(progress, streak, target)
+			case "$aggregate":
+				aggType, _ := criteria["type"].(string)
+				field, _ := criteria["field"].(string)
+				progress.Unit = fmt.Sprintf("%s(%s)", aggType, field)
+				if target, ok := criteria["value"].(map[string]interface{}); ok {
+					setNumericProgress(progress, metadata[fmt.Sprintf("%s_%s", aggType, field)], target)
+				}
+			case "$duration":
+				progress.Unit, _ = criteria["unit"].(string)
+				if progress.Unit == "" {
+					progress.Unit = "hours"
+				}
+				if target, ok := criteria["duration"].(map[string]interface{}); ok {
+					setNumericProgress(progress, metadata["shortest_duration"], target)
+				}
+			case "$gap":
+				progress.Unit = "hours"
+				if maxGap, ok := criteria["maxGapHours"]; ok {
+					setNumericProgress(progress, metadata["max_gap_hours"], map[string]interface{}{"$lte": maxGap})
+				}
+			}
+			finalizeProgress(progress)
+			return progress, nil
+		default:
+			re.Logger.Warning("Unsupported operator: %s", operator)
+		}
+	}
+
+	return nil, errors.New("unsupported flow definition format")
+}
+
+// setNumericProgress records the current value and the target taken from a comparison criteria object
+func setNumericProgress(progress *ConditionProgress, current interface{}, criteria map[string]interface{}) {
+	if currentValue, err := toFloat64(current); err == nil {
+		progress.Current = &currentValue
+	} else {
+		zero := 0.0
+		progress.Current = &zero
+	}
+
+	for _, operators := range [][]string{lowerBoundOperators, upperBoundOperators} {
+		for _, operator := range operators {
+			value, ok := criteria[operator]
+			if !ok {
+				continue
+			}
+			target, err := toFloat64(value)
+			if err != nil {
+				continue
+			}
+			progress.Target = &target
+			progress.Comparison = operator
+			return
+		}
+	}
+}
+
+// finalizeProgress computes the percentage of a leaf or unary node
+func finalizeProgress(progress *ConditionProgress) {
+	if progress.Met {
+		progress.Percentage = 100
+		return
+	}
+
+	if len(progress.Conditions) == 0 && progress.Current != nil && progress.Target != nil && isLowerBound(progress.Comparison) && *progress.Target > 0 {
+		progress.Percentage = math.Min(*progress.Current / *progress.Target * 100, 100)
+	}
+
+	// A node that has not been met must not report completion, even when its
+	// counted value has reached the target (e.g. an upper bound failed)
+	if progress.Percentage >= 100 {
+		progress.Percentage = 99
+	}
+	progress.Percentage = math.Round(progress.Percentage*100) / 100
+}
+
+// combineProgress computes met and percentage for $and / $or nodes from their children
+func combineProgress(progress *ConditionProgress) {
+	if len(progress.Conditions) == 0 {
+		progress.Met = progress.Operator == "$and"
+		finalizeProgress(progress)
+		return
+	}
+
+	if progress.Operator == "$and" {
+		progress.Met = true
+		total := 0.0
+		for _, child := range progress.Conditions {
+			progress.Met = progress.Met && child.Met
+			total += child.Percentage
+		}
+		progress.Percentage = total / float64(len(progress.Conditions))
+	} else {
+		for _, child := range progress.Conditions {
+			progress.Met = progress.Met || child.Met
+			progress.Percentage = math.Max(progress.Percentage, child.Percentage)
+		}
+	}
+
+	finalizeProgress(progress)
+}
+
+// isLowerBound checks whether a comparison operator expresses a target to reach
+func isLowerBound(operator string) bool {
+	for _, candidate := range lowerBoundOperators {
+		if candidate == operator {
+			return true
+		}
+	}
+	return false
+}
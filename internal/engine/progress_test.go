@@ -0,0 +1,107 @@
+package engine
+
+import (
+	"testing"
+	"time"
+
+	"github.com/badge-assignment-system/internal/models"
+	"github.com/badge-assignment-system/internal/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestEvaluateBadgeProgress checks current values and targets reported for each leaf condition
+func TestEvaluateBadgeProgress(t *testing.T) {
+	mockDB := testutil.NewMockDB()
+
+	badgeID := 7
+	flow := map[string]interface{}{
+		"$and": []interface{}{
+			map[string]interface{}{
+				"event": "task-completion",
+				"criteria": map[string]interface{}{
+					"$eventCount": map[string]interface{}{"$gte": float64(5)},
+				},
+			},
+			map[string]interface{}{
+				"$timePeriod": map[string]interface{}{
+					"periodType":  "day",
+					"periodCount": map[string]interface{}{"$gte": float64(5)},
+				},
+			},
+			map[string]interface{}{
+				"$aggregate": map[string]interface{}{
+					"type":  "avg",
+					"field": "rating",
+					"value": map[string]interface{}{"$gte": float64(4.5)},
+				},
+			},
+		},
+	}
+	mockDB.On("GetBadgeWithCriteria", badgeID).Return(testutil.CreateTestBadgeWithCriteria(badgeID, "Task Master", flow), nil)
+	mockDB.On("GetUserBadges", "user-1").Return([]models.UserBadge{}, nil)
+
+	start := time.Date(2023, 6, 1, 10, 0, 0, 0, time.UTC)
+	events := []models.Event{
+		{ID: 1, EventTypeID: 3, UserID: "user-1", OccurredAt: start, Payload: models.JSONB{"rating": float64(4)}},
+		{ID: 2, EventTypeID: 3, UserID: "user-1", OccurredAt: start.Add(time.Hour), Payload: models.JSONB{"rating": float64(4)}},
+		{ID: 3, EventTypeID: 3, UserID: "user-1", OccurredAt: start.AddDate(0, 0, 1), Payload: models.JSONB{"rating": float64(4.3)}},
+	}
+	mockDB.On("GetEventTypeByName", "task-completion").Return(models.EventType{ID: 3, Name: "task-completion"}, nil)
+	mockDB.On("GetUserEvents", "user-1").Return(events, nil)
+
+	engine := NewRuleEngine(mockDB)
+
+	progress, err := engine.EvaluateBadgeProgress(badgeID, "user-1")
+	require.NoError(t, err)
+
+	assert.False(t, progress.Earned)
+	assert.Equal(t, "Task Master", progress.BadgeName)
+	require.Len(t, progress.Progress.Conditions, 3)
+
+	eventCount := progress.Progress.Conditions[0]
+	assert.Equal(t, "$eventCount", eventCount.Operator)
+	assert.Equal(t, 3.0, *eventCount.Current)
+	assert.Equal(t, 5.0, *eventCount.Target)
+	assert.Equal(t, 60.0, eventCount.Percentage)
+
+	timePeriod := progress.Progress.Conditions[1]
+	assert.Equal(t, "days", timePeriod.Unit)
+	assert.Equal(t, 2.0, *timePeriod.Current)
+	assert.Equal(t, 40.0, timePeriod.Percentage)
+
+	aggregate := progress.Progress.Conditions[2]
+	assert.Equal(t, "avg(rating)", aggregate.Unit)
+	assert.InDelta(t, 4.1, *aggregate.Current, 0.001)
+	assert.Equal(t, 4.5, *aggregate.Target)
+	assert.False(t, aggregate.Met)
+
+	assert.False(t, progress.Progress.Met)
+	assert.InDelta(t, (60.0+40.0+91.11)/3, progress.Percentage, 0.01)
+}
+
+// TestEvaluateBadgeProgressEarned checks that earned badges report full progress
+func TestEvaluateBadgeProgressEarned(t *testing.T) {
+	mockDB := testutil.NewMockDB()
+
+	flow := map[string]interface{}{
+		"$not": map[string]interface{}{
+			"event":    "bug-report",
+			"criteria": map[string]interface{}{"severity": "critical"},
+		},
+	}
+	mockDB.On("GetBadgeWithCriteria", 1).Return(testutil.CreateTestBadgeWithCriteria(1, "Clean Slate", flow), nil)
+	mockDB.On("GetUserBadges", "user-2").Return([]models.UserBadge{{UserID: "user-2", BadgeID: 1}}, nil)
+	mockDB.On("GetEventTypeByName", "bug-report").Return(models.EventType{ID: 2, Name: "bug-report"}, nil)
+	mockDB.On("GetUserEvents", "user-2").Return([]models.Event{}, nil)
+
+	engine := NewRuleEngine(mockDB)
+
+	progress, err := engine.EvaluateBadgeProgress(1, "user-2")
+	require.NoError(t, err)
+
+	assert.True(t, progress.Earned)
+	assert.Equal(t, 100.0, progress.Percentage)
+	assert.True(t, progress.Progress.Met)
+	assert.False(t, progress.Progress.Conditions[0].Met)
+}
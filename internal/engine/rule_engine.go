@@ -4,10 +4,13 @@ import (
 	"errors"
 	"fmt"
 	"reflect"
+	"regexp"
+	"strings"
 	"time"
 
 	"github.com/badge-assignment-system/internal/logging"
 	"github.com/badge-assignment-system/internal/models"
+	"github.com/badge-assignment-system/internal/notify"
 )
 
 // Ensure that *models.DB implements DBInterface
@@ -17,26 +20,35 @@ var _ DBInterface = (*models.DB)(nil)
 type DBInterface interface {
 	GetBadgeWithCriteria(id int) (models.BadgeWithCriteria, error)
 	GetEventTypeByName(name string) (models.EventType, error)
+	GetEventTypeByID(id int) (models.EventType, error)
 	GetUserEventsByType(userID string, eventTypeID int) ([]models.Event, error)
 	GetUserEvents(userID string) ([]models.Event, error)
+	GetUserEventsInRange(userID string, start, end time.Time) ([]models.Event, error)
 	GetActiveBadges() ([]models.Badge, error)
 	GetUserBadges(userID string) ([]models.UserBadge, error)
-	AwardBadgeToUser(userBadge *models.UserBadge) error
+	AwardBadgeToUser(userBadge *models.UserBadge) (bool, error)
+	GetConditionTypeByName(name string) (models.ConditionType, error)
+	GetUserTimezone(userID string) (string, error)
+	GetHolidayCalendarByName(name string) (models.HolidayCalendar, error)
 }
 
 // RuleEngine handles the dynamic evaluation of badge criteria against events
 type RuleEngine struct {
-	DB           DBInterface
-	Logger       *logging.Logger
-	TimeVarCache *TimeVariableCache
+	DB               DBInterface
+	Logger           *logging.Logger
+	Dependencies     *DependencyIndex
+	HolidayCalendars *HolidayCalendars
+	Notifications    notify.Publisher // Told about new awards as they are recorded; may be nil
+	DryRun           bool             // When set, awards are counted but not recorded
 }
 
 // NewRuleEngine creates a new rule engine
 func NewRuleEngine(db DBInterface) *RuleEngine {
 	return &RuleEngine{
-		DB:           db,
-		Logger:       logging.NewLogger("RULE-ENGINE", logging.LogLevelInfo),
-		TimeVarCache: NewTimeVariableCache(),
+		DB:               db,
+		Logger:           logging.NewLogger("RULE-ENGINE", logging.LogLevelInfo),
+		Dependencies:     NewDependencyIndex(),
+		HolidayCalendars: NewHolidayCalendars(),
 	}
 }
 
@@ -47,10 +59,13 @@ func (re *RuleEngine) SetLogLevel(level logging.LogLevel) {
 
 // EvaluateBadgeCriteria checks if a user meets the criteria for a badge
 func (re *RuleEngine) EvaluateBadgeCriteria(badgeID int, userID string) (bool, map[string]interface{}, error) {
-	re.Logger.Debug("Evaluating badge criteria for badge ID %d and user %s", badgeID, userID)
+	return re.evaluateBadgeCriteria(badgeID, newEvaluationContext(userID))
+}
 
-	// Reset time variable cache for new evaluation
-	re.TimeVarCache = NewTimeVariableCache()
+// evaluateBadgeCriteria checks a badge's criteria within an evaluation context, so that
+// several badges evaluated for the same user share one snapshot of the user's events
+func (re *RuleEngine) evaluateBadgeCriteria(badgeID int, ctx *evaluationContext) (bool, map[string]interface{}, error) {
+	re.Logger.Debug("Evaluating badge criteria for badge ID %d and user %s", badgeID, ctx.userID)
 
 	// Get badge with criteria
 	badgeWithCriteria, err := re.DB.GetBadgeWithCriteria(badgeID)
@@ -61,13 +76,16 @@ func (re *RuleEngine) EvaluateBadgeCriteria(badgeID int, userID string) (bool, m
 
 	re.Logger.Debug("Retrieved badge criteria for badge ID: %d", badgeID)
 
-	// Extract the criteria flow definition
-	flowDefinition := badgeWithCriteria.Criteria.FlowDefinition
+	return re.evaluateBadgeFlow(badgeID, criteriaFlow(badgeWithCriteria.Criteria), ctx)
+}
 
+// evaluateBadgeFlow evaluates one of a badge's flow definitions, either its criteria or one of its tiers
+func (re *RuleEngine) evaluateBadgeFlow(badgeID int, flowDefinition models.JSONB, ctx *evaluationContext) (bool, map[string]interface{}, error) {
 	// Evaluate the criteria
 	metadata := make(map[string]interface{})
 	re.Logger.Debug("Starting flow evaluation for badge %d", badgeID)
-	result, err := re.evaluateFlow(flowDefinition, userID, metadata)
+	re.beginFlow(ctx, flowDefinition)
+	result, err := re.evaluateFlow(flowDefinition, ctx, metadata)
 	if err != nil {
 		re.Logger.Error("Criteria evaluation failed: %v", err)
 		return false, nil, fmt.Errorf("criteria evaluation failed: %w", err)
@@ -79,14 +97,35 @@ func (re *RuleEngine) EvaluateBadgeCriteria(badgeID int, userID string) (bool, m
 	return result, metadata, nil
 }
 
-// evaluateFlow recursively evaluates a badge criteria flow definition
-func (re *RuleEngine) evaluateFlow(flow models.JSONB, userID string, metadata map[string]interface{}) (bool, error) {
+// evaluateFlow recursively evaluates a badge criteria flow definition,
+// recording a trace node for it when the context has tracing enabled
+func (re *RuleEngine) evaluateFlow(flow models.JSONB, ctx *evaluationContext, metadata map[string]interface{}) (bool, error) {
+	if !ctx.tracing() {
+		return re.evaluateFlowNode(flow, ctx, metadata)
+	}
+
+	// Evaluate into a node-local metadata map so the values computed by this
+	// node can be attached to its trace, then merge them into the parent
+	node, parent := ctx.beginTrace(flow)
+	nodeMetadata := make(map[string]interface{})
+	result, err := re.evaluateFlowNode(flow, ctx, nodeMetadata)
+	for k, v := range nodeMetadata {
+		metadata[k] = v
+	}
+	ctx.endTrace(node, parent, result, err, nodeMetadata)
+	return result, err
+}
+
+// evaluateFlowNode evaluates a single node of a flow definition
+func (re *RuleEngine) evaluateFlowNode(flow models.JSONB, ctx *evaluationContext, metadata map[string]interface{}) (bool, error) {
+	userID := ctx.userID
+
 	// Check if this is an event-based criterion
 	if eventType, hasEventType := flow["event"].(string); hasEventType {
 		re.Logger.Debug("Evaluating event-based criterion for event type: %s", eventType)
 
 		// Get the event type ID
-		eventTypeObj, err := re.DB.GetEventTypeByName(eventType)
+		eventTypeObj, err := re.eventTypeByName(ctx, eventType)
 		if err != nil {
 			re.Logger.Error("Event type '%s' not found: %v", eventType, err)
 			return false, fmt.Errorf("event type '%s' not found: %w", eventType, err)
@@ -102,14 +141,22 @@ func (re *RuleEngine) evaluateFlow(flow models.JSONB, userID string, metadata ma
 		// Get events for this user and event type
 		re.Logger.Debug("Retrieving events for user %s and event type %s (ID: %d)",
 			userID, eventType, eventTypeObj.ID)
-		events, err := re.DB.GetUserEventsByType(userID, eventTypeObj.ID)
+		events, err := re.userEventsByType(ctx, eventTypeObj.ID)
 		if err != nil {
 			re.Logger.Error("Failed to get user events: %v", err)
 			return false, fmt.Errorf("failed to get user events: %w", err)
 		}
 
 		re.Logger.Debug("Found %d events of type '%s' for user %s", len(events), eventType, userID)
-		return re.evaluateEventCriteria(criteria, events, metadata)
+		if ctx.tracing() {
+			// $eventCount counts every event of the type; other criteria count the events that match
+			if _, hasEventCount := criteria["$eventCount"]; hasEventCount {
+				ctx.recordEvents(events)
+			} else if matched, err := re.filterEvents(criteria, events, ctx.timeVars); err == nil {
+				ctx.recordEvents(matched)
+			}
+		}
+		return re.evaluateEventCriteria(criteria, events, ctx.timeVars, metadata)
 	}
 
 	// Handle logical operators
@@ -119,13 +166,13 @@ func (re *RuleEngine) evaluateFlow(flow models.JSONB, userID string, metadata ma
 		switch operator {
 		case "$and":
 			re.Logger.Debug("Evaluating $and operator")
-			return re.evaluateAndOperator(value, userID, metadata)
+			return re.evaluateAndOperator(value, ctx, metadata)
 		case "$or":
 			re.Logger.Debug("Evaluating $or operator")
-			return re.evaluateOrOperator(value, userID, metadata)
+			return re.evaluateOrOperator(value, ctx, metadata)
 		case "$not":
 			re.Logger.Debug("Evaluating $not operator")
-			return re.evaluateNotOperator(value, userID, metadata)
+			return re.evaluateNotOperator(value, ctx, metadata)
 		// Time-based operators
 		case "$timePeriod":
 			re.Logger.Debug("Evaluating $timePeriod operator")
@@ -136,12 +183,13 @@ func (re *RuleEngine) evaluateFlow(flow models.JSONB, userID string, metadata ma
 			}
 			// Get all events for the user (across all event types)
 			re.Logger.Debug("Retrieving all events for user %s for time period evaluation", userID)
-			events, err := re.DB.GetUserEvents(userID)
+			events, err := re.userEvents(ctx)
 			if err != nil {
 				re.Logger.Error("Failed to get user events: %v", err)
 				return false, fmt.Errorf("failed to get user events: %w", err)
 			}
 			re.Logger.Debug("Found %d total events for user %s", len(events), userID)
+			ctx.recordEvents(events)
 			return re.evaluateTimePeriodCriteria(criteria, events, metadata)
 		case "$pattern":
 			re.Logger.Debug("Evaluating $pattern operator")
@@ -150,13 +198,22 @@ func (re *RuleEngine) evaluateFlow(flow models.JSONB, userID string, metadata ma
 				re.Logger.Error("$pattern requires a criteria object")
 				return false, fmt.Errorf("$pattern requires a criteria object")
 			}
-			events, err := re.DB.GetUserEvents(userID)
+			events, err := re.userEvents(ctx)
 			if err != nil {
 				re.Logger.Error("Failed to get user events: %v", err)
 				return false, fmt.Errorf("failed to get user events: %w", err)
 			}
 			re.Logger.Debug("Found %d total events for user %s", len(events), userID)
+			ctx.recordEvents(events)
 			return re.evaluatePatternCriteria(criteria, events, metadata)
+		case "$streak":
+			re.Logger.Debug("Evaluating $streak operator")
+			criteria, ok := value.(map[string]interface{})
+			if !ok {
+				re.Logger.Error("$streak requires a criteria object")
+				return false, fmt.Errorf("$streak requires a criteria object")
+			}
+			return re.evaluateStreakCriteria(criteria, ctx, metadata)
 		case "$sequence":
 			re.Logger.Debug("Evaluating $sequence operator")
 			criteria, ok := value.(map[string]interface{})
@@ -164,7 +221,7 @@ func (re *RuleEngine) evaluateFlow(flow models.JSONB, userID string, metadata ma
 				re.Logger.Error("$sequence requires a criteria object")
 				return false, fmt.Errorf("$sequence requires a criteria object")
 			}
-			return re.evaluateSequenceCriteria(criteria, userID, metadata)
+			return re.evaluateSequenceCriteria(criteria, ctx, metadata)
 		case "$gap":
 			re.Logger.Debug("Evaluating $gap operator")
 			criteria, ok := value.(map[string]interface{})
@@ -172,13 +229,14 @@ func (re *RuleEngine) evaluateFlow(flow models.JSONB, userID string, metadata ma
 				re.Logger.Error("$gap requires a criteria object")
 				return false, fmt.Errorf("$gap requires a criteria object")
 			}
-			events, err := re.DB.GetUserEvents(userID)
+			events, err := re.userEvents(ctx)
 			if err != nil {
 				re.Logger.Error("Failed to get user events: %v", err)
 				return false, fmt.Errorf("failed to get user events: %w", err)
 			}
 			re.Logger.Debug("Found %d total events for user %s", len(events), userID)
-			return re.evaluateGapCriteria(criteria, events, metadata)
+			ctx.recordEvents(events)
+			return re.evaluateGapCriteria(criteria, events, ctx.timeVars, metadata)
 		case "$duration":
 			re.Logger.Debug("Evaluating $duration operator")
 			criteria, ok := value.(map[string]interface{})
@@ -186,13 +244,14 @@ func (re *RuleEngine) evaluateFlow(flow models.JSONB, userID string, metadata ma
 				re.Logger.Error("$duration requires a criteria object")
 				return false, fmt.Errorf("$duration requires a criteria object")
 			}
-			events, err := re.DB.GetUserEvents(userID)
+			events, err := re.userEvents(ctx)
 			if err != nil {
 				re.Logger.Error("Failed to get user events: %v", err)
 				return false, fmt.Errorf("failed to get user events: %w", err)
 			}
 			re.Logger.Debug("Found %d total events for user %s", len(events), userID)
-			return re.evaluateDurationCriteria(criteria, events, metadata)
+			ctx.recordEvents(events)
+			return re.evaluateDurationCriteria(criteria, events, ctx.timeVars, metadata)
 		case "$aggregate":
 			re.Logger.Debug("Evaluating $aggregate operator")
 			criteria, ok := value.(map[string]interface{})
@@ -200,13 +259,32 @@ func (re *RuleEngine) evaluateFlow(flow models.JSONB, userID string, metadata ma
 				re.Logger.Error("$aggregate requires a criteria object")
 				return false, fmt.Errorf("$aggregate requires a criteria object")
 			}
-			events, err := re.DB.GetUserEvents(userID)
+			events, err := re.userEvents(ctx)
 			if err != nil {
 				re.Logger.Error("Failed to get user events: %v", err)
 				return false, fmt.Errorf("failed to get user events: %w", err)
 			}
 			re.Logger.Debug("Found %d total events for user %s", len(events), userID)
-			return re.evaluateAggregationCriteria(criteria, events, metadata)
+			ctx.recordEvents(events)
+			return re.evaluateAggregationCriteria(criteria, events, ctx.timeVars, metadata)
+		// Badge-based operators
+		case "$hasBadge":
+			re.Logger.Debug("Evaluating $hasBadge operator")
+			return re.evaluateHasBadgeCriteria(value, ctx, metadata)
+		case "$badgeCount":
+			re.Logger.Debug("Evaluating $badgeCount operator")
+			criteria, ok := value.(map[string]interface{})
+			if !ok {
+				re.Logger.Error("$badgeCount requires a criteria object")
+				return false, fmt.Errorf("$badgeCount requires a criteria object")
+			}
+			return re.evaluateBadgeCountCriteria(criteria, ctx, metadata)
+		case "$expression":
+			re.Logger.Debug("Evaluating $expression operator")
+			return re.evaluateExpressionCriteria(value, ctx, metadata)
+		case "$condition":
+			re.Logger.Debug("Evaluating $condition operator")
+			return re.evaluateConditionCriteria(value, ctx, metadata)
 		case "$timeWindow":
 			re.Logger.Debug("Evaluating $timeWindow operator")
 			criteria, ok := value.(map[string]interface{})
@@ -221,7 +299,7 @@ func (re *RuleEngine) evaluateFlow(flow models.JSONB, userID string, metadata ma
 			}
 
 			// Parse the time window
-			windowStart, windowEnd, err := parseTimeWindow(criteria, re.TimeVarCache)
+			windowStart, windowEnd, err := parseTimeWindow(criteria, ctx.timeVars)
 			if err != nil {
 				re.Logger.Error("Failed to parse time window: %v", err)
 				return false, err
@@ -233,10 +311,14 @@ func (re *RuleEngine) evaluateFlow(flow models.JSONB, userID string, metadata ma
 			// Create a sub-metadata map to capture results within the time window
 			windowMetadata := make(map[string]interface{})
 
-			// Evaluate the sub-flow with time window constraints
-			tempUserID := fmt.Sprintf("%s|%s|%s", userID, windowStart.Format(time.RFC3339), windowEnd.Format(time.RFC3339))
-			re.Logger.Debug("Evaluating subflow with time window constraints using temp user ID: %s", tempUserID)
-			result, err := re.evaluateFlow(models.JSONB(subFlow), tempUserID, windowMetadata)
+			// Evaluate the sub-flow so that it only sees events inside the window
+			windowCtx, err := re.windowContext(ctx, criteria, windowStart, windowEnd)
+			if err != nil {
+				re.Logger.Error("Failed to load holidays for time window: %v", err)
+				return false, err
+			}
+			re.Logger.Debug("Evaluating subflow for user %s within time window", userID)
+			result, err := re.evaluateFlow(models.JSONB(subFlow), windowCtx, windowMetadata)
 			if err != nil {
 				re.Logger.Error("Error evaluating time window subflow: %v", err)
 				return false, err
@@ -259,7 +341,7 @@ func (re *RuleEngine) evaluateFlow(flow models.JSONB, userID string, metadata ma
 }
 
 // evaluateAndOperator handles the $and operator
-func (re *RuleEngine) evaluateAndOperator(conditions interface{}, userID string, metadata map[string]interface{}) (bool, error) {
+func (re *RuleEngine) evaluateAndOperator(conditions interface{}, ctx *evaluationContext, metadata map[string]interface{}) (bool, error) {
 	conditionsArray, ok := conditions.([]interface{})
 	if !ok {
 		re.Logger.Error("$and operator requires an array of conditions")
@@ -277,7 +359,7 @@ func (re *RuleEngine) evaluateAndOperator(conditions interface{}, userID string,
 			return false, errors.New("each condition in $and must be an object")
 		}
 
-		result, err := re.evaluateFlow(models.JSONB(conditionMap), userID, metadata)
+		result, err := re.evaluateFlow(models.JSONB(conditionMap), ctx, metadata)
 		if err != nil {
 			re.Logger.Error("Error evaluating condition %d in $and: %v", i+1, err)
 			return false, err
@@ -296,7 +378,7 @@ func (re *RuleEngine) evaluateAndOperator(conditions interface{}, userID string,
 }
 
 // evaluateOrOperator handles the $or operator
-func (re *RuleEngine) evaluateOrOperator(conditions interface{}, userID string, metadata map[string]interface{}) (bool, error) {
+func (re *RuleEngine) evaluateOrOperator(conditions interface{}, ctx *evaluationContext, metadata map[string]interface{}) (bool, error) {
 	conditionsArray, ok := conditions.([]interface{})
 	if !ok {
 		re.Logger.Error("$or operator requires an array of conditions")
@@ -314,7 +396,7 @@ func (re *RuleEngine) evaluateOrOperator(conditions interface{}, userID string,
 			return false, errors.New("each condition in $or must be an object")
 		}
 
-		result, err := re.evaluateFlow(models.JSONB(conditionMap), userID, metadata)
+		result, err := re.evaluateFlow(models.JSONB(conditionMap), ctx, metadata)
 		if err != nil {
 			re.Logger.Error("Error evaluating condition %d in $or: %v", i+1, err)
 			return false, err
@@ -333,7 +415,7 @@ func (re *RuleEngine) evaluateOrOperator(conditions interface{}, userID string,
 }
 
 // evaluateNotOperator handles the $not operator
-func (re *RuleEngine) evaluateNotOperator(condition interface{}, userID string, metadata map[string]interface{}) (bool, error) {
+func (re *RuleEngine) evaluateNotOperator(condition interface{}, ctx *evaluationContext, metadata map[string]interface{}) (bool, error) {
 	conditionMap, ok := condition.(map[string]interface{})
 	if !ok {
 		re.Logger.Error("$not operator requires a condition object")
@@ -342,7 +424,7 @@ func (re *RuleEngine) evaluateNotOperator(condition interface{}, userID string,
 
 	re.Logger.Debug("Evaluating $not operator")
 
-	result, err := re.evaluateFlow(models.JSONB(conditionMap), userID, metadata)
+	result, err := re.evaluateFlow(models.JSONB(conditionMap), ctx, metadata)
 	if err != nil {
 		re.Logger.Error("Error evaluating condition in $not: %v", err)
 		return false, err
@@ -353,18 +435,18 @@ func (re *RuleEngine) evaluateNotOperator(condition interface{}, userID string,
 }
 
 // evaluateEventCriteria evaluates criteria against a set of events
-func (re *RuleEngine) evaluateEventCriteria(criteria map[string]interface{}, events []models.Event, metadata map[string]interface{}) (bool, error) {
+func (re *RuleEngine) evaluateEventCriteria(criteria map[string]interface{}, events []models.Event, timeVars *TimeVariableCache, metadata map[string]interface{}) (bool, error) {
 	re.Logger.Debug("Evaluating event criteria against %d events", len(events))
 
 	// Handle event count criteria
 	if eventCountCriteria, hasEventCount := criteria["$eventCount"].(map[string]interface{}); hasEventCount {
 		re.Logger.Debug("Detected $eventCount criteria, evaluating")
-		return re.evaluateEventCountCriteria(eventCountCriteria, events, metadata)
+		return re.evaluateEventCountCriteria(eventCountCriteria, events, timeVars, metadata)
 	}
 
 	// Filter events based on criteria
 	re.Logger.Debug("Filtering %d events based on criteria", len(events))
-	filteredEvents, err := re.filterEvents(criteria, events)
+	filteredEvents, err := re.filterEvents(criteria, events, timeVars)
 	if err != nil {
 		re.Logger.Error("Error filtering events: %v", err)
 		return false, err
@@ -388,12 +470,12 @@ func (re *RuleEngine) evaluateEventCriteria(criteria map[string]interface{}, eve
 }
 
 // filterEvents filters events based on criteria
-func (re *RuleEngine) filterEvents(criteria map[string]interface{}, events []models.Event) ([]models.Event, error) {
+func (re *RuleEngine) filterEvents(criteria map[string]interface{}, events []models.Event, timeVars *TimeVariableCache) ([]models.Event, error) {
 	var filteredEvents []models.Event
 
 	re.Logger.Trace("Starting to filter %d events", len(events))
 	for _, event := range events {
-		passes, err := re.eventMatchesCriteria(event, criteria)
+		passes, err := re.eventMatchesCriteria(event, criteria, timeVars)
 		if err != nil {
 			re.Logger.Error("Error matching event %d against criteria: %v", event.ID, err)
 			return nil, err
@@ -409,10 +491,35 @@ func (re *RuleEngine) filterEvents(criteria map[string]interface{}, events []mod
 }
 
 // eventMatchesCriteria checks if an event matches the given criteria
-func (re *RuleEngine) eventMatchesCriteria(event models.Event, criteria map[string]interface{}) (bool, error) {
+func (re *RuleEngine) eventMatchesCriteria(event models.Event, criteria map[string]interface{}, timeVars *TimeVariableCache) (bool, error) {
+	// Times of day and weekdays are those of the criteria's timezone when it has one
+	location, err := criteriaTimezone(criteria, "$timezone")
+	if err != nil {
+		re.Logger.Error("Invalid $timezone condition: %v", err)
+		return false, err
+	}
+	if location != nil {
+		event.OccurredAt = event.OccurredAt.In(location)
+	}
+
 	for field, conditionValue := range criteria {
-		// Skip the event count field as it's handled separately
-		if field == "$eventCount" {
+		// Skip the event count and timezone fields as they're handled separately
+		if field == "$eventCount" || field == "$timezone" {
+			continue
+		}
+
+		// Compare the local time of day or weekday the event occurred
+		if field == "$timeOfDay" || field == "$dayOfWeek" {
+			local := map[string]interface{}{"value": localTimeValue(event.OccurredAt, field)}
+			matches, err := re.fieldMatches(local, "value", conditionValue)
+			if err != nil {
+				re.Logger.Error("Error evaluating %s condition: %v", field, err)
+				return false, err
+			}
+			if !matches {
+				re.Logger.Trace("Event ID %d %s did not match condition", event.ID, field)
+				return false, nil
+			}
 			continue
 		}
 
@@ -423,7 +530,7 @@ func (re *RuleEngine) eventMatchesCriteria(event models.Event, criteria map[stri
 				re.Logger.Error("Timestamp condition must be an object")
 				return false, errors.New("timestamp condition must be an object")
 			}
-			matches, err := re.evaluateTimestampCondition(event.OccurredAt, conditionMap)
+			matches, err := re.evaluateTimestampCondition(event.OccurredAt, conditionMap, timeVars)
 			if err != nil {
 				re.Logger.Error("Error evaluating timestamp condition: %v", err)
 				return false, err
@@ -435,50 +542,117 @@ func (re *RuleEngine) eventMatchesCriteria(event models.Event, criteria map[stri
 			continue
 		}
 
-		// For other fields, check in the payload
-		if event.Payload == nil {
-			re.Logger.Trace("Event ID %d has no payload, criteria not met", event.ID)
-			return false, nil
-		}
-
-		// Get the field value from the event payload
-		fieldValue, exists := event.Payload[field]
-		if !exists {
-			re.Logger.Trace("Event ID %d payload does not contain field '%s'", event.ID, field)
-			return false, nil
-		}
-
-		// If conditionValue is a comparison operator object
-		if conditionMap, ok := conditionValue.(map[string]interface{}); ok {
-			matches, err := re.evaluateComparison(fieldValue, conditionMap)
+		// Expressions compare computed values of the payload
+		if field == "$expr" {
+			expression, ok := conditionValue.(map[string]interface{})
+			if !ok {
+				re.Logger.Error("$expr condition must be an object")
+				return false, errors.New("$expr condition must be an object")
+			}
+			matches, err := re.evaluateExpr(event.Payload, expression)
 			if err != nil {
-				re.Logger.Error("Error evaluating comparison for field '%s': %v", field, err)
+				re.Logger.Error("Error evaluating $expr condition: %v", err)
 				return false, err
 			}
 			if !matches {
-				re.Logger.Trace("Event ID %d field '%s' did not match comparison", event.ID, field)
-				return false, nil
-			}
-		} else {
-			// Direct equality comparison
-			if !reflect.DeepEqual(fieldValue, conditionValue) {
-				re.Logger.Trace("Event ID %d field '%s' did not match direct equality", event.ID, field)
+				re.Logger.Trace("Event ID %d did not match $expr condition", event.ID)
 				return false, nil
 			}
+			continue
+		}
+
+		// For other fields, check in the payload
+		matches, err := re.fieldMatches(event.Payload, field, conditionValue)
+		if err != nil {
+			re.Logger.Error("Error evaluating condition for field '%s': %v", field, err)
+			return false, err
+		}
+		if !matches {
+			re.Logger.Trace("Event ID %d field '%s' did not match condition", event.ID, field)
+			return false, nil
 		}
 	}
 
 	return true, nil
 }
 
+// fieldMatches checks a field of an event payload or nested object against a condition.
+// The field may be a path such as "project.owner.team" or "items[0].sku", and the condition
+// is either an object of comparison operators or a value the field must equal.
+func (re *RuleEngine) fieldMatches(document map[string]interface{}, field string, conditionValue interface{}) (bool, error) {
+	fieldValue, exists, err := lookupField(document, field)
+	if err != nil {
+		return false, err
+	}
+
+	conditionMap, isOperators := conditionValue.(map[string]interface{})
+	if !exists {
+		// A missing field only matches {"$exists": false}
+		if isOperators && matchesMissingField(conditionMap) {
+			return true, nil
+		}
+		re.Logger.Trace("Field '%s' not found", field)
+		return false, nil
+	}
+
+	if isOperators {
+		return re.evaluateComparison(document, fieldValue, conditionMap)
+	}
+
+	// Direct equality comparison
+	return reflect.DeepEqual(fieldValue, conditionValue), nil
+}
+
+// evaluateExpr evaluates comparisons between two computed operands,
+// such as {"$lt": [{"$field": "actual_hours"}, {"$field": "estimated_hours"}]}
+func (re *RuleEngine) evaluateExpr(document map[string]interface{}, expression map[string]interface{}) (bool, error) {
+	for operator, arguments := range expression {
+		operands, ok := arguments.([]interface{})
+		if !ok || len(operands) != 2 {
+			return false, fmt.Errorf("%s in $expr requires exactly two operands", operator)
+		}
+		if !resolvesOperands[operator] {
+			return false, fmt.Errorf("unsupported $expr operator: %s", operator)
+		}
+
+		left, err := resolveOperand(document, operands[0])
+		if errors.Is(err, errUndefinedOperand) {
+			re.Logger.Trace("$expr operand undefined: %v", err)
+			return false, nil
+		}
+		if err != nil {
+			return false, err
+		}
+
+		matches, err := re.evaluateComparison(document, left, map[string]interface{}{operator: operands[1]})
+		if err != nil || !matches {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+// matchesMissingField checks whether conditions only require a field to be absent
+func matchesMissingField(conditions map[string]interface{}) bool {
+	if len(conditions) == 0 {
+		return false
+	}
+	for operator, value := range conditions {
+		if exists, ok := value.(bool); operator != "$exists" || !ok || exists {
+			return false
+		}
+	}
+	return true
+}
+
 // evaluateTimestampCondition evaluates timestamp-specific conditions
-func (re *RuleEngine) evaluateTimestampCondition(timestamp time.Time, conditions map[string]interface{}) (bool, error) {
+func (re *RuleEngine) evaluateTimestampCondition(timestamp time.Time, conditions map[string]interface{}, timeVars *TimeVariableCache) (bool, error) {
 	for operator, value := range conditions {
 		re.Logger.Trace("Evaluating timestamp operator %s against %v", operator, timestamp)
 
 		switch operator {
 		case "$gte":
-			compareTime, err := re.parseTimeValueWithCache(value)
+			compareTime, err := re.parseTimeValueWithCache(value, timeVars)
 			if err != nil {
 				re.Logger.Error("Error parsing time value for $gte: %v", err)
 				return false, err
@@ -488,7 +662,7 @@ func (re *RuleEngine) evaluateTimestampCondition(timestamp time.Time, conditions
 				return false, nil
 			}
 		case "$gt":
-			compareTime, err := re.parseTimeValueWithCache(value)
+			compareTime, err := re.parseTimeValueWithCache(value, timeVars)
 			if err != nil {
 				re.Logger.Error("Error parsing time value for $gt: %v", err)
 				return false, err
@@ -498,7 +672,7 @@ func (re *RuleEngine) evaluateTimestampCondition(timestamp time.Time, conditions
 				return false, nil
 			}
 		case "$lte":
-			compareTime, err := re.parseTimeValueWithCache(value)
+			compareTime, err := re.parseTimeValueWithCache(value, timeVars)
 			if err != nil {
 				re.Logger.Error("Error parsing time value for $lte: %v", err)
 				return false, err
@@ -508,7 +682,7 @@ func (re *RuleEngine) evaluateTimestampCondition(timestamp time.Time, conditions
 				return false, nil
 			}
 		case "$lt":
-			compareTime, err := re.parseTimeValueWithCache(value)
+			compareTime, err := re.parseTimeValueWithCache(value, timeVars)
 			if err != nil {
 				re.Logger.Error("Error parsing time value for $lt: %v", err)
 				return false, err
@@ -518,7 +692,7 @@ func (re *RuleEngine) evaluateTimestampCondition(timestamp time.Time, conditions
 				return false, nil
 			}
 		case "$eq":
-			compareTime, err := re.parseTimeValueWithCache(value)
+			compareTime, err := re.parseTimeValueWithCache(value, timeVars)
 			if err != nil {
 				re.Logger.Error("Error parsing time value for $eq: %v", err)
 				return false, err
@@ -528,7 +702,7 @@ func (re *RuleEngine) evaluateTimestampCondition(timestamp time.Time, conditions
 				return false, nil
 			}
 		case "$ne":
-			compareTime, err := re.parseTimeValueWithCache(value)
+			compareTime, err := re.parseTimeValueWithCache(value, timeVars)
 			if err != nil {
 				re.Logger.Error("Error parsing time value for $ne: %v", err)
 				return false, err
@@ -546,11 +720,11 @@ func (re *RuleEngine) evaluateTimestampCondition(timestamp time.Time, conditions
 }
 
 // parseTimeValueWithCache converts a string or RFC3339 time value to time.Time using the TimeVariableCache
-func (re *RuleEngine) parseTimeValueWithCache(value interface{}) (time.Time, error) {
+func (re *RuleEngine) parseTimeValueWithCache(value interface{}, timeVars *TimeVariableCache) (time.Time, error) {
 	if timeStr, ok := value.(string); ok {
 		// Check if this is a dynamic time variable
 		if IsDynamicTimeVariable(timeStr) {
-			return ParseDynamicTimeVariable(timeStr, re.TimeVarCache)
+			return ParseDynamicTimeVariable(timeStr, timeVars)
 		}
 
 		// Otherwise parse as normal RFC3339 time
@@ -575,11 +749,26 @@ func parseTimeValue(value interface{}) (time.Time, error) {
 	return time.Time{}, errors.New("timestamp value must be a string in RFC3339 format or dynamic time variable")
 }
 
-// evaluateComparison evaluates comparison operators on values
-func (re *RuleEngine) evaluateComparison(fieldValue interface{}, conditions map[string]interface{}) (bool, error) {
+// evaluateComparison evaluates comparison operators on values.
+// Compared values may be operands computed from the document the value belongs to,
+// such as {"$gt": {"$field": "estimated_hours"}}.
+func (re *RuleEngine) evaluateComparison(document map[string]interface{}, fieldValue interface{}, conditions map[string]interface{}) (bool, error) {
 	for operator, compareValue := range conditions {
 		re.Logger.Trace("Evaluating comparison operator %s", operator)
 
+		if resolvesOperands[operator] {
+			resolved, err := resolveOperand(document, compareValue)
+			if errors.Is(err, errUndefinedOperand) {
+				re.Logger.Trace("Operand of %s is undefined: %v", operator, err)
+				return false, nil
+			}
+			if err != nil {
+				re.Logger.Error("Error resolving operand of %s: %v", operator, err)
+				return false, err
+			}
+			compareValue = resolved
+		}
+
 		switch operator {
 		case "$eq":
 			if !reflect.DeepEqual(fieldValue, compareValue) {
@@ -641,9 +830,89 @@ func (re *RuleEngine) evaluateComparison(fieldValue interface{}, conditions map[
 				re.Logger.Trace("Value %v is in array %v (should not be)", fieldValue, compareValue)
 				return false, nil
 			}
+		case "$exists":
+			// Missing fields are handled by fieldMatches, so the field exists here
+			shouldExist, ok := compareValue.(bool)
+			if !ok {
+				re.Logger.Error("Invalid $exists value: %v", compareValue)
+				return false, errors.New("$exists value must be a boolean")
+			}
+			if !shouldExist {
+				re.Logger.Trace("Value %v exists (should not)", fieldValue)
+				return false, nil
+			}
+		case "$size":
+			array, ok := asArray(fieldValue)
+			if !ok {
+				re.Logger.Trace("Value %v is not an array", fieldValue)
+				return false, nil
+			}
+			var result bool
+			if sizeCriteria, ok := compareValue.(map[string]interface{}); ok {
+				var err error
+				if result, err = re.evaluateNumericCriteria(float64(len(array)), sizeCriteria); err != nil {
+					re.Logger.Error("Error in $size comparison: %v", err)
+					return false, err
+				}
+			} else {
+				size, err := toFloat64(compareValue)
+				if err != nil {
+					re.Logger.Error("Invalid $size value: %v", err)
+					return false, fmt.Errorf("invalid $size value: %w", err)
+				}
+				result = float64(len(array)) == size
+			}
+			if !result {
+				re.Logger.Trace("Array size %d does not match %v", len(array), compareValue)
+				return false, nil
+			}
+		case "$all":
+			required, ok := asArray(compareValue)
+			if !ok {
+				re.Logger.Error("Invalid $all value: %v", compareValue)
+				return false, errors.New("$all value must be an array")
+			}
+			values, ok := asArray(fieldValue)
+			if !ok {
+				values = []interface{}{fieldValue}
+			}
+			for _, value := range required {
+				if !isInArray(value, values) {
+					re.Logger.Trace("Array %v does not contain %v", fieldValue, value)
+					return false, nil
+				}
+			}
+		case "$elemMatch":
+			elementConditions, ok := compareValue.(map[string]interface{})
+			if !ok {
+				re.Logger.Error("Invalid $elemMatch value: %v", compareValue)
+				return false, errors.New("$elemMatch value must be an object")
+			}
+			matched, err := re.anyElementMatches(document, fieldValue, elementConditions)
+			if err != nil {
+				re.Logger.Error("Error in $elemMatch comparison: %v", err)
+				return false, err
+			}
+			if !matched {
+				re.Logger.Trace("No element of %v matches %v", fieldValue, elementConditions)
+				return false, nil
+			}
 		case "$regex":
-			re.Logger.Warning("$regex operator not implemented yet")
-			return false, errors.New("$regex operator not implemented yet")
+			pattern, ok := compareValue.(string)
+			if !ok {
+				re.Logger.Error("Invalid $regex value: %v", compareValue)
+				return false, errors.New("$regex value must be a string")
+			}
+			regex, err := regexp.Compile(pattern)
+			if err != nil {
+				re.Logger.Error("Invalid $regex pattern: %v", err)
+				return false, fmt.Errorf("invalid $regex pattern: %w", err)
+			}
+			str, ok := fieldValue.(string)
+			if !ok || !regex.MatchString(str) {
+				re.Logger.Trace("Value %v does not match pattern %s", fieldValue, pattern)
+				return false, nil
+			}
 		default:
 			re.Logger.Error("Unsupported operator: %s", operator)
 			return false, fmt.Errorf("unsupported operator: %s", operator)
@@ -715,12 +984,77 @@ func isInArray(value interface{}, array interface{}) bool {
 	return false
 }
 
+// asArray returns a value's elements if it is an array
+func asArray(value interface{}) ([]interface{}, bool) {
+	arrayValue := reflect.ValueOf(value)
+	if arrayValue.Kind() != reflect.Slice && arrayValue.Kind() != reflect.Array {
+		return nil, false
+	}
+
+	elements := make([]interface{}, arrayValue.Len())
+	for i := range elements {
+		elements[i] = arrayValue.Index(i).Interface()
+	}
+	return elements, true
+}
+
+// anyElementMatches checks whether any element of an array matches the $elemMatch conditions.
+// Conditions made of operators apply to the elements themselves; otherwise they are
+// field conditions applied to elements that are objects, whose $field operands refer to the element.
+func (re *RuleEngine) anyElementMatches(document map[string]interface{}, value interface{}, conditions map[string]interface{}) (bool, error) {
+	elements, ok := asArray(value)
+	if !ok {
+		return false, nil
+	}
+
+	operatorsOnly := true
+	for key := range conditions {
+		if !strings.HasPrefix(key, "$") {
+			operatorsOnly = false
+			break
+		}
+	}
+
+	for _, element := range elements {
+		if operatorsOnly {
+			matches, err := re.evaluateComparison(document, element, conditions)
+			if err != nil {
+				return false, err
+			}
+			if matches {
+				return true, nil
+			}
+			continue
+		}
+
+		object, ok := asObject(element)
+		if !ok {
+			continue
+		}
+		matches := true
+		for field, condition := range conditions {
+			fieldMatches, err := re.fieldMatches(object, field, condition)
+			if err != nil {
+				return false, err
+			}
+			if !fieldMatches {
+				matches = false
+				break
+			}
+		}
+		if matches {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
 // evaluateEventCountCriteria checks if the number of events meets the count criteria
-func (re *RuleEngine) evaluateEventCountCriteria(eventCountCriteria map[string]interface{}, events []models.Event, metadata map[string]interface{}) (bool, error) {
+func (re *RuleEngine) evaluateEventCountCriteria(eventCountCriteria map[string]interface{}, events []models.Event, timeVars *TimeVariableCache, metadata map[string]interface{}) (bool, error) {
 	re.Logger.Debug("Evaluating event count criteria against %d events", len(events))
 
 	// First, filter events based on other criteria in the parent object
-	filteredEvents, err := re.filterEvents(map[string]interface{}{}, events)
+	filteredEvents, err := re.filterEvents(map[string]interface{}{}, events, timeVars)
 	if err != nil {
 		re.Logger.Error("Error filtering events for event count criteria: %v", err)
 		return false, err
@@ -783,84 +1117,195 @@ func (re *RuleEngine) evaluateEventCountCriteria(eventCountCriteria map[string]i
 	return true, nil
 }
 
-// ProcessEvents processes a batch of events and awards badges if criteria are met
-func (re *RuleEngine) ProcessEvents(userID string) error {
+// ProcessEvents evaluates every active badge for a user and awards those whose criteria are met
+func (re *RuleEngine) ProcessEvents(userID string) (*ProcessResult, error) {
 	re.Logger.Info("Processing events for user %s", userID)
 
 	// Get all active badges
 	badges, err := re.DB.GetActiveBadges()
 	if err != nil {
 		re.Logger.Error("Failed to retrieve active badges: %v", err)
-		return fmt.Errorf("failed to retrieve active badges: %w", err)
+		return nil, fmt.Errorf("failed to retrieve active badges: %w", err)
 	}
 	re.Logger.Debug("Retrieved %d active badges", len(badges))
 
+	return re.processBadges(userID, badges)
+}
+
+// ProcessBadges evaluates only the given badges for a user and awards those whose criteria are
+// met. Unlike when events are processed, the badges that depend on the awards made are not
+// re-evaluated. Badges whose evaluation fails are reported in the result.
+func (re *RuleEngine) ProcessBadges(userID string, badges []models.Badge) (*ProcessResult, error) {
+	ctx := newEvaluationContext(userID)
+
+	result := newProcessResult(userID)
+	evaluated := make(map[int]bool)
+	if _, err := re.processBadgePass(ctx, badges, result, evaluated); err != nil {
+		return nil, err
+	}
+	result.Evaluated = len(evaluated)
+	return result, nil
+}
+
+// maxDependentPasses bounds how many times badges that depend on other badges are
+// re-evaluated after awards in a single pass, guarding against chains that never settle
+const maxDependentPasses = 10
+
+// processBadges evaluates the given badges for a user and awards those whose criteria are met.
+// Awards then re-evaluate the badges whose criteria reference the awarded badges, until no
+// further badge is awarded, so chains such as "Gold requires Silver" resolve immediately.
+// Badges whose evaluation fails are reported in the result and do not stop the others.
+func (re *RuleEngine) processBadges(userID string, badges []models.Badge) (*ProcessResult, error) {
+	// All badges are evaluated against the same snapshot of the user's events
+	ctx := newEvaluationContext(userID)
+
+	result := newProcessResult(userID)
+	evaluated := make(map[int]bool)
+	for pass := 0; len(badges) > 0; pass++ {
+		if pass > maxDependentPasses {
+			re.Logger.Warning("Badge dependencies for user %s did not settle after %d passes", userID, maxDependentPasses)
+			break
+		}
+
+		awardedIDs, err := re.processBadgePass(ctx, badges, result, evaluated)
+		if err != nil {
+			return nil, err
+		}
+		if len(awardedIDs) == 0 {
+			break
+		}
+
+		// The new awards must be visible to the badges that depend on them
+		ctx.snapshot.awardsLoaded = false
+		if badges, err = re.dependentBadges(awardedIDs); err != nil {
+			re.Logger.Error("Failed to find badges depending on awards for user %s: %v", userID, err)
+			break
+		}
+	}
+	result.Evaluated = len(evaluated)
+
+	re.Logger.Info("Badge processing complete for user %s - %d new badges awarded", userID, len(result.AwardedBadgeIDs()))
+	return result, nil
+}
+
+// processBadgePass evaluates badges once for a user, adding the awards made and the badges that
+// failed to the result, and returning the IDs of the badges awarded
+func (re *RuleEngine) processBadgePass(ctx *evaluationContext, badges []models.Badge, result *ProcessResult, evaluated map[int]bool) ([]int, error) {
+	userID := ctx.userID
+
 	// Get user's existing badges
 	userBadges, err := re.DB.GetUserBadges(userID)
 	if err != nil {
 		re.Logger.Error("Failed to retrieve user badges: %v", err)
-		return fmt.Errorf("failed to retrieve user badges: %w", err)
+		return nil, fmt.Errorf("failed to retrieve user badges: %w", err)
 	}
 	re.Logger.Debug("User %s already has %d badges", userID, len(userBadges))
 
-	// Create a map for fast lookup of existing badges
-	userBadgeMap := make(map[int]bool)
+	// Group the user's existing awards by badge
+	userAwards := make(map[int][]models.UserBadge)
 	for _, badge := range userBadges {
-		userBadgeMap[badge.BadgeID] = true
+		userAwards[badge.BadgeID] = append(userAwards[badge.BadgeID], badge)
 		re.Logger.Trace("User already has badge ID %d", badge.BadgeID)
 	}
 
 	// Process each badge
-	var awarded int = 0
+	var awarded []int
 	for _, badge := range badges {
 		re.Logger.Debug("Evaluating badge ID %d: %s", badge.ID, badge.Name)
 
-		// Skip badges the user already has
-		if userBadgeMap[badge.ID] {
+		// Skip badges an administrator revoked from the user
+		awards := userAwards[badge.ID]
+		if isManuallyRevoked(awards) {
+			re.Logger.Debug("Badge ID %d was revoked from user %s, skipping", badge.ID, userID)
+			continue
+		}
+
+		// Skip badges the user already has, unless they are tiered or repeatable
+		if held := activeAwards(awards, time.Now()); len(held) > 0 && !isRepeatable(badge, held) {
 			re.Logger.Debug("Badge ID %d already awarded to user %s, skipping", badge.ID, userID)
 			continue
 		}
 
-		// Evaluate badge criteria
-		re.Logger.Debug("Evaluating criteria for badge ID %d", badge.ID)
-		result, metadata, err := re.EvaluateBadgeCriteria(badge.ID, userID)
+		// Evaluate badge criteria and award the badge, its next tiers or its next occurrence.
+		// Tiers reached before an error are still awarded.
+		evaluated[badge.ID] = true
+		newAwards, err := re.processBadge(ctx, badge.ID, awards)
 		if err != nil {
-			re.Logger.Error("Error evaluating criteria for badge ID %d: %v", badge.ID, err)
-			continue
+			re.Logger.Error("Error processing badge ID %d for user %s: %v", badge.ID, userID, err)
+			result.Errors = append(result.Errors, BadgeError{BadgeID: badge.ID, BadgeName: badge.Name, Error: err.Error()})
+		}
+		if len(newAwards) > 0 {
+			result.addAwards(badge, newAwards)
+			awarded = append(awarded, badge.ID)
+			re.publishAwards(newAwards)
 		}
+	}
 
-		// Award badge if criteria are met
-		if result {
-			re.Logger.Info("Badge criteria met for badge ID %d (%s) for user %s",
-				badge.ID, badge.Name, userID)
+	return awarded, nil
+}
 
-			userBadge := &models.UserBadge{
-				UserID:   userID,
-				BadgeID:  badge.ID,
-				Metadata: models.JSONB(metadata),
-			}
-			err = re.DB.AwardBadgeToUser(userBadge)
-			if err != nil {
-				re.Logger.Error("Failed to award badge ID %d to user %s: %v",
-					badge.ID, userID, err)
-				continue
-			}
-			awarded++
-			re.Logger.Info("Badge ID %d (%s) awarded to user %s", badge.ID, badge.Name, userID)
-		} else {
-			re.Logger.Debug("Badge criteria not met for badge ID %d for user %s", badge.ID, userID)
+// publishAwards tells the clients streaming badge notifications about new awards
+func (re *RuleEngine) publishAwards(awards []models.UserBadge) {
+	if re.Notifications == nil {
+		return
+	}
+	for _, award := range awards {
+		if award.Notification != nil {
+			re.Notifications.Publish(notify.FromOutbox(*award.Notification))
 		}
 	}
+}
+
+// dependentBadges returns the active badges whose criteria reference any of the given badges
+func (re *RuleEngine) dependentBadges(badgeIDs []int) ([]models.Badge, error) {
+	dependents, err := re.Dependencies.dependentBadges(re.DB, badgeIDs)
+	if err != nil || len(dependents) == 0 {
+		return nil, err
+	}
 
-	re.Logger.Info("Badge processing complete for user %s - %d new badges awarded", userID, awarded)
-	return nil
+	badges, err := re.DB.GetActiveBadges()
+	if err != nil {
+		return nil, fmt.Errorf("failed to retrieve active badges: %w", err)
+	}
+
+	var filtered []models.Badge
+	for _, badge := range badges {
+		if dependents[badge.ID] {
+			filtered = append(filtered, badge)
+		}
+	}
+	re.Logger.Debug("Awards of badges %v re-evaluate %d dependent badges", badgeIDs, len(filtered))
+	return filtered, nil
 }
 
-// ProcessEvent processes a single event and checks if it triggers any badge awards
-func (re *RuleEngine) ProcessEvent(event *models.Event) error {
+// ProcessEvent processes a single event and checks if it triggers any badge awards.
+// Only the badges whose criteria could be affected by the event's type are evaluated.
+func (re *RuleEngine) ProcessEvent(event *models.Event) (*ProcessResult, error) {
 	re.Logger.Debug("Processing event ID %d of type %d for user %s",
 		event.ID, event.EventTypeID, event.UserID)
 
+	badges, err := re.badgesAffectedByEvent(event)
+	if err != nil {
+		return nil, err
+	}
+
 	// Process badges for the user who triggered the event
-	return re.ProcessEvents(event.UserID)
+	return re.processBadges(event.UserID, badges)
+}
+
+// ProcessUserEvents processes several new events of the same user at once. Each badge that
+// could be affected by any of the events is evaluated a single time.
+func (re *RuleEngine) ProcessUserEvents(userID string, events []models.Event) (*ProcessResult, error) {
+	re.Logger.Debug("Processing %d events for user %s", len(events), userID)
+
+	eventTypeIDs := make([]int, 0, len(events))
+	for _, event := range events {
+		eventTypeIDs = append(eventTypeIDs, event.EventTypeID)
+	}
+	badges, err := re.badgesAffectedByEventTypes(eventTypeIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	return re.processBadges(userID, badges)
 }
@@ -5,9 +5,11 @@ import (
 	"time"
 
 	"github.com/badge-assignment-system/internal/models"
+	"github.com/badge-assignment-system/internal/notify"
 	"github.com/badge-assignment-system/internal/testutil"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
 )
 
 // We need to adapt our test to match the actual RuleEngine implementation
@@ -42,8 +44,8 @@ func TestEvaluateBadgeCriteria(t *testing.T) {
 	}
 	mockDB.On("GetEventTypeByName", "test_event").Return(mockEventType, nil)
 
-	// Mock GetUserEventsByType to return empty events
-	mockDB.On("GetUserEventsByType", "test-user", mockEventType.ID).Return([]models.Event{}, nil)
+	// Mock GetUserEvents to return empty events
+	mockDB.On("GetUserEvents", "test-user").Return([]models.Event{}, nil)
 
 	// Create an instance of the rule engine with the mock
 	engine := NewRuleEngine(mockDB)
@@ -137,29 +139,27 @@ func TestProcessEvents(t *testing.T) {
 		},
 	}
 
-	// Mock GetUserEventsByType to return our test event
-	mockDB.On("GetUserEventsByType", "test-user", mockEventType1.ID).Return([]models.Event{testEvent}, nil)
+	// Mock GetUserEvents to return our test event; the user's events are loaded once for both badges
+	mockDB.On("GetUserEvents", "test-user").Return([]models.Event{testEvent}, nil).Once()
 
 	// For badge 2, set up mocks for the event type
 	mockEventType2 := models.EventType{
 		ID:   2,
 		Name: "test_event_2",
 	}
+	// The second badge finds no events of its type (criteria not met)
 	mockDB.On("GetEventTypeByName", "test_event_2").Return(mockEventType2, nil)
 
-	// Mock GetUserEventsByType to return empty events for the second badge (criteria not met)
-	mockDB.On("GetUserEventsByType", "test-user", mockEventType2.ID).Return([]models.Event{}, nil)
-
 	// Mock AwardBadgeToUser for the first badge which will meet the criteria
 	mockDB.On("AwardBadgeToUser", mock.MatchedBy(func(badge *models.UserBadge) bool {
 		return badge.BadgeID == 1 && badge.UserID == "test-user"
-	})).Return(nil)
+	})).Return(true, nil)
 
 	// Create an instance of the rule engine with the mock
 	engine := NewRuleEngine(mockDB)
 
 	// Call the method under test
-	err := engine.ProcessEvents("test-user")
+	_, err := engine.ProcessEvents("test-user")
 
 	// Verify the result
 	assert.NoError(t, err)
@@ -168,6 +168,69 @@ func TestProcessEvents(t *testing.T) {
 	mockDB.AssertExpectations(t)
 }
 
+// TestProcessEventsReportsBadgeErrors checks that a badge failing to evaluate is reported without stopping the others
+func TestProcessEventsReportsBadgeErrors(t *testing.T) {
+	db := &awardingDB{
+		badges: []models.BadgeWithCriteria{
+			badgeWithFlow(1, "Broken", map[string]interface{}{"$expression": "count(events) >="}),
+			badgeWithFlow(2, "Early Bird", checkInCountFlow(1)),
+		},
+		events: checkIns("user-1", time.Now()),
+	}
+
+	result, err := NewRuleEngine(db).ProcessEvents("user-1")
+	require.NoError(t, err)
+
+	assert.Equal(t, "user-1", result.UserID)
+	assert.Equal(t, 2, result.Evaluated)
+	require.Len(t, result.Awarded, 1)
+	assert.Equal(t, "Early Bird", result.Awarded[0].BadgeName)
+	assert.Equal(t, 1, result.Awarded[0].Occurrence)
+	assert.Equal(t, 1, result.Awarded[0].Metadata["event_count"])
+	require.Len(t, result.Errors, 1)
+	assert.Equal(t, 1, result.Errors[0].BadgeID)
+	assert.NotEmpty(t, result.Errors[0].Error)
+	assert.ErrorContains(t, result.Err(), "badge 1 (Broken)")
+}
+
+// TestProcessEventsPublishesAwards checks that every award recorded is published, each tier separately
+func TestProcessEventsPublishesAwards(t *testing.T) {
+	tiered := badgeWithFlow(1, "Regular", checkInCountFlow(1))
+	tiered.Tiers = []models.BadgeTier{
+		{BadgeID: 1, Level: 1, Name: "Bronze", FlowDefinition: models.JSONB(checkInCountFlow(1))},
+		{BadgeID: 1, Level: 2, Name: "Silver", FlowDefinition: models.JSONB(checkInCountFlow(2))},
+	}
+	db := &awardingDB{
+		badges: []models.BadgeWithCriteria{tiered, badgeWithFlow(2, "Early Bird", checkInCountFlow(1))},
+		events: checkIns("user-1", time.Now(), time.Now()),
+	}
+	hub := notify.NewHub()
+	subscription := hub.Subscribe("user-1")
+	engine := NewRuleEngine(db)
+	engine.Notifications = hub
+
+	result, err := engine.ProcessEvents("user-1")
+	require.NoError(t, err)
+	require.Len(t, result.Awarded, 3)
+
+	for _, award := range db.awards {
+		notification := <-subscription.Notifications()
+		assert.Equal(t, award.ID, notification.ID)
+		assert.Equal(t, models.WebhookEventBadgeAwarded, notification.Event)
+		assert.Equal(t, award.BadgeID, notification.BadgeID)
+	}
+
+	engine.DryRun = true
+	db.awards = nil
+	_, err = engine.ProcessEvents("user-1")
+	require.NoError(t, err)
+	select {
+	case notification := <-subscription.Notifications():
+		t.Errorf("dry runs publish nothing, got %+v", notification)
+	default:
+	}
+}
+
 // Here's a demonstration of table-driven tests for a hypothetical method
 func TestHypotheticalEvaluationMethod(t *testing.T) {
 	t.Skip("This is a placeholder test demonstrating test patterns")
@@ -272,8 +335,8 @@ func BenchmarkRuleEvaluation(b *testing.B) {
 		},
 	}
 
-	// Mock GetUserEventsByType to return our test events
-	mockDB.On("GetUserEventsByType", "bench-user", mockEventType.ID).Return(testEvents, nil)
+	// Mock GetUserEvents to return our test events
+	mockDB.On("GetUserEvents", "bench-user").Return(testEvents, nil)
 
 	// Create an instance of the rule engine with the mock
 	engine := NewRuleEngine(mockDB)
@@ -0,0 +1,121 @@
+package engine
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/badge-assignment-system/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestComputeStreaks(t *testing.T) {
+	tests := []struct {
+		name        string
+		timeline    string // One character per period, oldest first: x active, . missed
+		freezes     int
+		current     int
+		longest     int
+		freezesUsed int
+	}{
+		{"empty", "", 0, 0, 0, 0},
+		{"unbroken", "xxxx", 0, 4, 4, 0},
+		{"current period in progress", "xxx.", 0, 3, 3, 0},
+		{"broken", "xxx..x", 0, 1, 3, 0},
+		{"lapsed", "xx..", 0, 0, 2, 0},
+		{"frozen", "xxx.xx", 1, 5, 5, 1},
+		{"not enough freezes", "xxx..xx", 1, 2, 3, 0},
+		{"freezes only bridge periods within a run", "..xx.x.", 2, 3, 3, 1},
+		{"longest run in the past", "xxxxx.x.x", 1, 2, 6, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			timeline := make([]bool, len(tt.timeline))
+			for i, period := range tt.timeline {
+				timeline[i] = period == 'x'
+			}
+
+			current, longest, freezesUsed := computeStreaks(timeline, tt.freezes)
+			assert.Equal(t, tt.current, current, "current")
+			assert.Equal(t, tt.longest, longest, "longest")
+			assert.Equal(t, tt.freezesUsed, freezesUsed, "freezes used")
+		})
+	}
+}
+
+// streakCheckIns are early check-ins from Monday 13 to Monday 20 May 2024, except for a
+// late one on Thursday and none at the weekend
+func streakCheckIns(t *testing.T) []models.Event {
+	var events []models.Event
+	for i, at := range []string{
+		"2024-05-13T08:00:00Z", "2024-05-14T08:00:00Z", "2024-05-15T08:00:00Z",
+		"2024-05-16T10:00:00Z", "2024-05-17T08:00:00Z", "2024-05-20T08:00:00Z",
+	} {
+		occurredAt, err := time.Parse(time.RFC3339, at)
+		require.NoError(t, err)
+		events = append(events, models.Event{ID: i + 1, EventTypeID: 1, UserID: "user-1", OccurredAt: occurredAt, Payload: models.JSONB{}})
+	}
+	return events
+}
+
+// streakUntil measures a streak as of the end of 20 May 2024
+func streakUntil(streak string) string {
+	return fmt.Sprintf(`{"$timeWindow": {"start": "2024-05-01T00:00:00Z", "end": "2024-05-20T23:59:59Z", "flow": {"$streak": %s}}}`, streak)
+}
+
+func TestStreakCriteria(t *testing.T) {
+	engine := NewRuleEngine(&awardingDB{events: streakCheckIns(t)})
+
+	tests := []struct {
+		name     string
+		streak   string
+		current  int
+		longest  int
+		expected bool
+	}{
+		{"any check-in", `{"periodType": "day", "event": "check-in", "current": {"$gte": 5}}`, 1, 5, false},
+		{"early check-ins", `{"periodType": "day", "event": "check-in", "criteria": {"$timeOfDay": {"$lt": "09:00:00"}}, "longest": {"$gte": 3}}`, 1, 3, true},
+		{"weekdays", `{"periodType": "day", "criteria": {"$timeOfDay": {"$lt": "09:00:00"}}, "excludeWeekends": true}`, 2, 3, true},
+		{"frozen", `{"periodType": "day", "criteria": {"$timeOfDay": {"$lt": "09:00:00"}}, "excludeWeekends": true, "freezes": 1, "current": {"$gte": 5}}`, 5, 5, true},
+		{"holiday", `{"periodType": "day", "criteria": {"$timeOfDay": {"$lt": "09:00:00"}}, "excludeWeekends": true, "excludeHolidays": true, "holidays": ["2024-05-16"], "current": {"$gte": 5}}`, 5, 5, true},
+		{"weekly", `{"periodType": "week", "current": {"$gte": 2}}`, 2, 2, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := engine.ExplainFlow(decodeJSONB(t, streakUntil(tt.streak)), "user-1")
+			require.Empty(t, result.Error)
+			assert.Equal(t, tt.expected, result.Result)
+			assert.Equal(t, tt.current, result.Metadata["window_current_streak"], "current")
+			assert.Equal(t, tt.longest, result.Metadata["window_longest_streak"], "longest")
+		})
+	}
+}
+
+// TestStreakToday checks that a streak is still going before the user is active today
+func TestStreakToday(t *testing.T) {
+	now := time.Now().UTC()
+	engine := NewRuleEngine(&awardingDB{events: checkIns("user-1", now.AddDate(0, 0, -2), now.AddDate(0, 0, -1))})
+
+	result := engine.ExplainFlow(models.JSONB{"$streak": map[string]interface{}{"periodType": "day"}}, "user-1")
+	require.Empty(t, result.Error)
+	assert.True(t, result.Result)
+	assert.Equal(t, 2, result.Metadata["current_streak"])
+}
+
+func TestStreakProgress(t *testing.T) {
+	engine := NewRuleEngine(&awardingDB{events: streakCheckIns(t)})
+
+	flow := decodeJSONB(t, streakUntil(`{"periodType": "day", "excludeWeekends": true, "freezes": 2, "current": {"$gte": 10}}`))
+	progress, err := engine.evaluateFlowProgress(flow, newEvaluationContext("user-1"))
+	require.NoError(t, err)
+
+	require.Len(t, progress.Conditions, 1)
+	streak := progress.Conditions[0]
+	assert.Equal(t, "$streak", streak.Operator)
+	assert.Equal(t, "days", streak.Unit)
+	assert.Equal(t, 60.0, streak.Percentage)
+	assert.Equal(t, &StreakProgress{Current: 6, Longest: 6, FreezesUsed: 0, FreezesLeft: 2}, streak.Streak)
+}
@@ -3,6 +3,7 @@ package engine
 import (
 	"fmt"
 	"sort"
+	"time"
 
 	"github.com/badge-assignment-system/internal/models"
 )
@@ -46,6 +47,33 @@ func (re *RuleEngine) evaluateTimePeriodCriteria(criteria map[string]interface{}
 		re.Logger.Debug("Holidays to exclude: %v", timePeriodCriteria.Holidays)
 	}
 
+	if holidayCalendar, ok := criteria["holidayCalendar"].(string); ok {
+		timePeriodCriteria.HolidayCalendar = holidayCalendar
+		re.Logger.Debug("Holiday calendar: %s", holidayCalendar)
+	}
+
+	if timezone, ok := criteria["timezone"].(string); ok {
+		timePeriodCriteria.Timezone = timezone
+		re.Logger.Debug("Timezone: %s", timezone)
+	}
+
+	var holidays *holidaySet
+	if timePeriodCriteria.ExcludeHolidays {
+		var err error
+		if holidays, err = re.holidays(timePeriodCriteria.Holidays, timePeriodCriteria.HolidayCalendar); err != nil {
+			re.Logger.Error("Failed to load holidays: %v", err)
+			return false, err
+		}
+	}
+
+	// Weekends, holidays and periods are those of the criterion's timezone when it has one,
+	// and otherwise of the timezone each event was sent from
+	events, err := inTimezone(criteria, "timezone", events)
+	if err != nil {
+		re.Logger.Error("Invalid timezone in timePeriod criteria: %v", err)
+		return false, err
+	}
+
 	// Filter events based on exclusions
 	var filteredEvents []models.Event
 	for _, event := range events {
@@ -56,7 +84,7 @@ func (re *RuleEngine) evaluateTimePeriodCriteria(criteria map[string]interface{}
 		}
 
 		// Check holiday exclusion
-		if timePeriodCriteria.ExcludeHolidays && isHoliday(event.OccurredAt, timePeriodCriteria.Holidays) {
+		if timePeriodCriteria.ExcludeHolidays && isHoliday(event.OccurredAt, holidays) {
 			re.Logger.Trace("Excluding event ID %d (holiday: %s)", event.ID, event.OccurredAt.Format("2006-01-02"))
 			continue
 		}
@@ -157,6 +185,17 @@ func (re *RuleEngine) evaluatePatternCriteria(criteria map[string]interface{}, e
 		re.Logger.Debug("Using default maximum deviation: %.2f", patternCriteria.MaxDeviation)
 	}
 
+	if timezone, ok := criteria["timezone"].(string); ok {
+		patternCriteria.Timezone = timezone
+		re.Logger.Debug("Timezone: %s", timezone)
+	}
+
+	events, err := inTimezone(criteria, "timezone", events)
+	if err != nil {
+		re.Logger.Error("Invalid timezone in pattern criteria: %v", err)
+		return false, err
+	}
+
 	// Group events by period
 	periodCounts, periods, err := groupEventsByPeriod(events, patternCriteria.PeriodType)
 	if err != nil {
@@ -219,8 +258,201 @@ func (re *RuleEngine) evaluatePatternCriteria(criteria map[string]interface{}, e
 	return result, nil
 }
 
+// evaluateStreakCriteria measures the user's current and longest runs of consecutive periods
+// with matching events. Weekends and holidays can be skipped, and a number of missed periods
+// can be forgiven within a run.
+func (re *RuleEngine) evaluateStreakCriteria(criteria map[string]interface{}, ctx *evaluationContext, metadata map[string]interface{}) (bool, error) {
+	re.Logger.Debug("Evaluating streak criteria")
+
+	// Parse and validate criteria
+	var streakCriteria models.StreakCriteria
+
+	if periodType, ok := criteria["periodType"].(string); ok {
+		streakCriteria.PeriodType = periodType
+		re.Logger.Debug("Streak period type: %s", periodType)
+	} else {
+		re.Logger.Error("Missing or invalid periodType in streak criteria")
+		return false, fmt.Errorf("missing or invalid periodType in streak criteria")
+	}
+
+	if eventType, ok := criteria["event"].(string); ok {
+		streakCriteria.Event = eventType
+		re.Logger.Debug("Streak event type: %s", eventType)
+	}
+
+	if eventCriteria, ok := criteria["criteria"].(map[string]interface{}); ok {
+		streakCriteria.Criteria = eventCriteria
+		re.Logger.Debug("Streak event criteria: %v", eventCriteria)
+	}
+
+	if current, ok := criteria["current"].(map[string]interface{}); ok {
+		streakCriteria.Current = current
+		re.Logger.Debug("Current streak criteria: %v", current)
+	}
+
+	if longest, ok := criteria["longest"].(map[string]interface{}); ok {
+		streakCriteria.Longest = longest
+		re.Logger.Debug("Longest streak criteria: %v", longest)
+	}
+
+	if freezes, ok := criteria["freezes"].(float64); ok {
+		streakCriteria.Freezes = int(freezes)
+		re.Logger.Debug("Streak freezes: %d", streakCriteria.Freezes)
+	}
+
+	if excludeWeekends, ok := criteria["excludeWeekends"].(bool); ok {
+		streakCriteria.ExcludeWeekends = excludeWeekends
+		re.Logger.Debug("Exclude weekends: %v", excludeWeekends)
+	}
+
+	if excludeHolidays, ok := criteria["excludeHolidays"].(bool); ok {
+		streakCriteria.ExcludeHolidays = excludeHolidays
+		re.Logger.Debug("Exclude holidays: %v", excludeHolidays)
+	}
+
+	if holidays, ok := criteria["holidays"].([]interface{}); ok {
+		for _, holiday := range holidays {
+			if holidayStr, ok := holiday.(string); ok {
+				streakCriteria.Holidays = append(streakCriteria.Holidays, holidayStr)
+			}
+		}
+		re.Logger.Debug("Holidays to skip: %v", streakCriteria.Holidays)
+	}
+
+	if holidayCalendar, ok := criteria["holidayCalendar"].(string); ok {
+		streakCriteria.HolidayCalendar = holidayCalendar
+		re.Logger.Debug("Holiday calendar: %s", holidayCalendar)
+	}
+
+	if timezone, ok := criteria["timezone"].(string); ok {
+		streakCriteria.Timezone = timezone
+		re.Logger.Debug("Timezone: %s", timezone)
+	}
+
+	// Get the events that keep the streak going
+	var events []models.Event
+	if streakCriteria.Event != "" {
+		eventType, err := re.eventTypeByName(ctx, streakCriteria.Event)
+		if err != nil {
+			re.Logger.Error("Event type '%s' not found: %v", streakCriteria.Event, err)
+			return false, fmt.Errorf("event type '%s' not found: %w", streakCriteria.Event, err)
+		}
+		if events, err = re.userEventsByType(ctx, eventType.ID); err != nil {
+			re.Logger.Error("Failed to get user events: %v", err)
+			return false, fmt.Errorf("failed to get user events: %w", err)
+		}
+	} else {
+		var err error
+		if events, err = re.userEvents(ctx); err != nil {
+			re.Logger.Error("Failed to get user events: %v", err)
+			return false, fmt.Errorf("failed to get user events: %w", err)
+		}
+	}
+	if streakCriteria.Criteria != nil {
+		var err error
+		if events, err = re.filterEvents(streakCriteria.Criteria, events, ctx.timeVars); err != nil {
+			re.Logger.Error("Error filtering events for streak: %v", err)
+			return false, err
+		}
+	}
+	ctx.recordEvents(events)
+	re.Logger.Debug("Found %d events for streak", len(events))
+
+	// Periods are those of the criterion's timezone when it has one, and otherwise of the
+	// timezone each event was sent from, up to the current period in the user's timezone
+	location, err := criteriaTimezone(criteria, "timezone")
+	if err != nil {
+		re.Logger.Error("Invalid timezone in streak criteria: %v", err)
+		return false, err
+	}
+	if location != nil {
+		events, _ = inTimezone(criteria, "timezone", events)
+	} else if location, err = re.userLocation(ctx); err != nil {
+		re.Logger.Error("Failed to get user timezone: %v", err)
+		return false, fmt.Errorf("failed to get user timezone: %w", err)
+	}
+
+	var holidays *holidaySet
+	if streakCriteria.ExcludeHolidays {
+		if holidays, err = re.holidays(streakCriteria.Holidays, streakCriteria.HolidayCalendar); err != nil {
+			re.Logger.Error("Failed to load holidays: %v", err)
+			return false, err
+		}
+	}
+
+	// Skipped days neither break nor extend a streak
+	skip := func(t time.Time) bool {
+		if streakCriteria.PeriodType != "day" {
+			return false
+		}
+		return (streakCriteria.ExcludeWeekends && isWeekend(t)) ||
+			(streakCriteria.ExcludeHolidays && isHoliday(t, holidays))
+	}
+
+	active := make(map[string]bool)
+	var first time.Time
+	for _, event := range events {
+		if skip(event.OccurredAt) {
+			re.Logger.Trace("Skipping event ID %d on %s", event.ID, event.OccurredAt.Format("2006-01-02"))
+			continue
+		}
+		periodKey, err := getPeriodKey(event.OccurredAt, streakCriteria.PeriodType)
+		if err != nil {
+			re.Logger.Error("Failed to get period key: %v", err)
+			return false, err
+		}
+		active[periodKey] = true
+		if first.IsZero() || event.OccurredAt.Before(first) {
+			first = event.OccurredAt
+		}
+	}
+
+	// Inside a time window that has ended, the streak is measured at the end of the window
+	now := ctx.timeVars.now
+	if ctx.window != nil && ctx.window.end.Before(now) {
+		now = ctx.window.end
+	}
+	timeline, err := periodTimeline(first, now.In(location), streakCriteria.PeriodType, active, skip)
+	if err != nil {
+		re.Logger.Error("Failed to build streak timeline: %v", err)
+		return false, err
+	}
+
+	current, longest, freezesUsed := computeStreaks(timeline, streakCriteria.Freezes)
+	metadata["current_streak"] = current
+	metadata["longest_streak"] = longest
+	metadata["streak_freezes_used"] = freezesUsed
+	re.Logger.Debug("Current streak: %d, longest streak: %d, freezes used: %d", current, longest, freezesUsed)
+
+	// Without a comparison, a streak that is still going meets the criterion
+	if len(streakCriteria.Current) == 0 && len(streakCriteria.Longest) == 0 {
+		result := current > 0
+		re.Logger.Debug("Streak criteria evaluation result: %v", result)
+		return result, nil
+	}
+
+	if len(streakCriteria.Current) > 0 {
+		result, err := re.evaluateNumericCriteria(float64(current), streakCriteria.Current)
+		if err != nil || !result {
+			re.Logger.Debug("Current streak criteria not met: %v", err)
+			return false, err
+		}
+	}
+	if len(streakCriteria.Longest) > 0 {
+		result, err := re.evaluateNumericCriteria(float64(longest), streakCriteria.Longest)
+		if err != nil || !result {
+			re.Logger.Debug("Longest streak criteria not met: %v", err)
+			return false, err
+		}
+	}
+
+	re.Logger.Debug("Streak criteria evaluation result: true")
+	return true, nil
+}
+
 // evaluateSequenceCriteria checks if events occur in a specific sequence
-func (re *RuleEngine) evaluateSequenceCriteria(criteria map[string]interface{}, userID string, metadata map[string]interface{}) (bool, error) {
+func (re *RuleEngine) evaluateSequenceCriteria(criteria map[string]interface{}, ctx *evaluationContext, metadata map[string]interface{}) (bool, error) {
+	userID := ctx.userID
 	re.Logger.Debug("Evaluating sequence criteria for user %s", userID)
 
 	// Parse and validate criteria
@@ -261,13 +493,13 @@ func (re *RuleEngine) evaluateSequenceCriteria(criteria map[string]interface{},
 	sequenceEvents := make([][]models.Event, len(sequenceCriteria.Sequence))
 
 	for i, eventType := range sequenceCriteria.Sequence {
-		eventTypeObj, err := re.DB.GetEventTypeByName(eventType)
+		eventTypeObj, err := re.eventTypeByName(ctx, eventType)
 		if err != nil {
 			re.Logger.Error("Event type '%s' not found: %v", eventType, err)
 			return false, fmt.Errorf("event type '%s' not found: %w", eventType, err)
 		}
 
-		events, err := re.DB.GetUserEventsByType(userID, eventTypeObj.ID)
+		events, err := re.userEventsByType(ctx, eventTypeObj.ID)
 		if err != nil {
 			re.Logger.Error("Failed to get events for type '%s': %v", eventType, err)
 			return false, fmt.Errorf("failed to get events for type '%s': %w", eventType, err)
@@ -304,7 +536,7 @@ func (re *RuleEngine) evaluateSequenceCriteria(criteria map[string]interface{},
 }
 
 // evaluateGapCriteria checks for gaps in event occurrence
-func (re *RuleEngine) evaluateGapCriteria(criteria map[string]interface{}, events []models.Event, metadata map[string]interface{}) (bool, error) {
+func (re *RuleEngine) evaluateGapCriteria(criteria map[string]interface{}, events []models.Event, timeVars *TimeVariableCache, metadata map[string]interface{}) (bool, error) {
 	re.Logger.Debug("Evaluating gap criteria with %d events", len(events))
 
 	// Parse and validate criteria
@@ -331,6 +563,21 @@ func (re *RuleEngine) evaluateGapCriteria(criteria map[string]interface{}, event
 		re.Logger.Debug("Using default period type: all")
 	}
 
+	if holidayCalendar, ok := criteria["holidayCalendar"].(string); ok {
+		gapCriteria.HolidayCalendar = holidayCalendar
+		re.Logger.Debug("Holiday calendar: %s", holidayCalendar)
+	}
+
+	// In business-days mode, only the time on weekdays that are not holidays counts towards gaps
+	var holidays *holidaySet
+	if gapCriteria.PeriodType == "business-days" {
+		var err error
+		if holidays, err = re.holidays(nil, gapCriteria.HolidayCalendar); err != nil {
+			re.Logger.Error("Failed to load holidays: %v", err)
+			return false, err
+		}
+	}
+
 	if excludeConditions, ok := criteria["excludeConditions"].(map[string]interface{}); ok {
 		gapCriteria.ExcludeConditions = excludeConditions
 		re.Logger.Debug("Exclude conditions: %v", excludeConditions)
@@ -341,7 +588,7 @@ func (re *RuleEngine) evaluateGapCriteria(criteria map[string]interface{}, event
 	if len(gapCriteria.ExcludeConditions) > 0 {
 		re.Logger.Debug("Filtering events based on exclusion conditions")
 		var err error
-		filteredEvents, err = re.filterEvents(gapCriteria.ExcludeConditions, events)
+		filteredEvents, err = re.filterEvents(gapCriteria.ExcludeConditions, events, timeVars)
 		if err != nil {
 			re.Logger.Error("Error filtering events: %v", err)
 			return false, err
@@ -369,6 +616,9 @@ func (re *RuleEngine) evaluateGapCriteria(criteria map[string]interface{}, event
 	re.Logger.Debug("Analyzing gaps between events")
 	for i := 1; i < len(filteredEvents); i++ {
 		gapHours := filteredEvents[i].OccurredAt.Sub(filteredEvents[i-1].OccurredAt).Hours()
+		if holidays != nil {
+			gapHours = businessHoursBetween(filteredEvents[i-1].OccurredAt, filteredEvents[i].OccurredAt, holidays)
+		}
 		re.Logger.Trace("Gap between events %d and %d: %.2f hours",
 			filteredEvents[i-1].ID, filteredEvents[i].ID, gapHours)
 
@@ -409,7 +659,7 @@ func (re *RuleEngine) evaluateGapCriteria(criteria map[string]interface{}, event
 }
 
 // evaluateDurationCriteria assesses time duration between related events
-func (re *RuleEngine) evaluateDurationCriteria(criteria map[string]interface{}, events []models.Event, metadata map[string]interface{}) (bool, error) {
+func (re *RuleEngine) evaluateDurationCriteria(criteria map[string]interface{}, events []models.Event, timeVars *TimeVariableCache, metadata map[string]interface{}) (bool, error) {
 	re.Logger.Debug("Evaluating duration criteria with %d events", len(events))
 
 	// Parse and validate criteria
@@ -446,7 +696,7 @@ func (re *RuleEngine) evaluateDurationCriteria(criteria map[string]interface{},
 
 	// Filter events to find start and end events
 	re.Logger.Debug("Filtering events to find start events")
-	startEvents, err := re.filterEvents(durationCriteria.StartEvent, events)
+	startEvents, err := re.filterEvents(durationCriteria.StartEvent, events, timeVars)
 	if err != nil {
 		re.Logger.Error("Error filtering start events: %v", err)
 		return false, err
@@ -460,7 +710,7 @@ func (re *RuleEngine) evaluateDurationCriteria(criteria map[string]interface{},
 	re.Logger.Debug("Found %d matching start events", len(startEvents))
 
 	re.Logger.Debug("Filtering events to find end events")
-	endEvents, err := re.filterEvents(durationCriteria.EndEvent, events)
+	endEvents, err := re.filterEvents(durationCriteria.EndEvent, events, timeVars)
 	if err != nil {
 		re.Logger.Error("Error filtering end events: %v", err)
 		return false, err
@@ -567,7 +817,7 @@ func (re *RuleEngine) evaluateDurationCriteria(criteria map[string]interface{},
 }
 
 // evaluateAggregationCriteria handles min, max, avg calculations
-func (re *RuleEngine) evaluateAggregationCriteria(criteria map[string]interface{}, events []models.Event, metadata map[string]interface{}) (bool, error) {
+func (re *RuleEngine) evaluateAggregationCriteria(criteria map[string]interface{}, events []models.Event, timeVars *TimeVariableCache, metadata map[string]interface{}) (bool, error) {
 	re.Logger.Debug("Evaluating aggregation criteria with %d events", len(events))
 
 	// Parse and validate criteria
@@ -600,12 +850,22 @@ func (re *RuleEngine) evaluateAggregationCriteria(criteria map[string]interface{
 
 		// Filter events by time window if specified
 		re.Logger.Debug("Filtering events by time window")
-		filteredEvents, err := filterEventsByTimeWindowWithCache(events, timeWindow, re.TimeVarCache)
+		filteredEvents, err := filterEventsByTimeWindowWithCache(events, timeWindow, timeVars)
 		if err != nil {
 			re.Logger.Error("Error filtering events by time window: %v", err)
 			return false, err
 		}
 		events = filteredEvents
+
+		if businessDaysOnly, _ := timeWindow["businessDaysOnly"].(bool); businessDaysOnly {
+			calendar, _ := timeWindow["holidayCalendar"].(string)
+			holidays, err := re.holidays(nil, calendar)
+			if err != nil {
+				re.Logger.Error("Failed to load holidays: %v", err)
+				return false, err
+			}
+			events = filterBusinessDays(events, holidays)
+		}
 		re.Logger.Debug("After time window filtering: %d events remain", len(events))
 	}
 
@@ -618,7 +878,11 @@ func (re *RuleEngine) evaluateAggregationCriteria(criteria map[string]interface{
 			continue
 		}
 
-		fieldValue, exists := event.Payload[aggregationCriteria.Field]
+		fieldValue, exists, err := lookupField(event.Payload, aggregationCriteria.Field)
+		if err != nil {
+			re.Logger.Error("Invalid aggregation field: %v", err)
+			return false, err
+		}
 		if !exists {
 			re.Logger.Trace("Event ID %d does not have field '%s', skipping",
 				event.ID, aggregationCriteria.Field)
@@ -131,7 +131,7 @@ func TestGapCriteria(t *testing.T) {
 	}
 
 	metadata := make(map[string]interface{})
-	result, err := re.evaluateGapCriteria(criteria, events, metadata)
+	result, err := re.evaluateGapCriteria(criteria, events, NewTimeVariableCache(), metadata)
 
 	if err != nil {
 		t.Errorf("Error evaluating gap criteria: %v", err)
@@ -173,7 +173,7 @@ func TestDurationCriteria(t *testing.T) {
 	}
 
 	metadata := make(map[string]interface{})
-	result, err := re.evaluateDurationCriteria(criteria, events, metadata)
+	result, err := re.evaluateDurationCriteria(criteria, events, NewTimeVariableCache(), metadata)
 
 	if err != nil {
 		t.Errorf("Error evaluating duration criteria: %v", err)
@@ -209,7 +209,7 @@ func TestAggregationCriteria(t *testing.T) {
 	}
 
 	metadata := make(map[string]interface{})
-	result, err := re.evaluateAggregationCriteria(criteria, events, metadata)
+	result, err := re.evaluateAggregationCriteria(criteria, events, NewTimeVariableCache(), metadata)
 
 	if err != nil {
 		t.Errorf("Error evaluating aggregation criteria: %v", err)
@@ -17,15 +17,45 @@ func isWeekend(t time.Time) bool {
 	return weekday == time.Saturday || weekday == time.Sunday
 }
 
-// isHoliday checks if a given date is in the list of holidays
-func isHoliday(t time.Time, holidays []string) bool {
-	dateStr := t.Format("2006-01-02")
-	for _, holiday := range holidays {
-		if holiday == dateStr {
-			return true
+// isHoliday checks if a given date is one of the holidays
+func isHoliday(t time.Time, holidays *holidaySet) bool {
+	return holidays.contains(t)
+}
+
+// isBusinessDay checks if a given date is a weekday that is not a holiday
+func isBusinessDay(t time.Time, holidays *holidaySet) bool {
+	return !isWeekend(t) && !isHoliday(t, holidays)
+}
+
+// filterBusinessDays returns the events that occurred on business days
+func filterBusinessDays(events []models.Event, holidays *holidaySet) []models.Event {
+	var filtered []models.Event
+	for _, event := range events {
+		if isBusinessDay(event.OccurredAt, holidays) {
+			filtered = append(filtered, event)
 		}
 	}
-	return false
+	return filtered
+}
+
+// businessHoursBetween returns the hours between two times that fall on business days,
+// taking days in the timezone of start
+func businessHoursBetween(start, end time.Time, holidays *holidaySet) float64 {
+	var hours float64
+	for day := time.Date(start.Year(), start.Month(), start.Day(), 0, 0, 0, 0, start.Location()); day.Before(end); day = day.AddDate(0, 0, 1) {
+		if !isBusinessDay(day, holidays) {
+			continue
+		}
+		from, to := day, day.AddDate(0, 0, 1)
+		if start.After(from) {
+			from = start
+		}
+		if end.Before(to) {
+			to = end
+		}
+		hours += to.Sub(from).Hours()
+	}
+	return hours
 }
 
 // getPeriodKey returns a string key for grouping events by time period
@@ -48,6 +78,36 @@ func getPeriodKey(t time.Time, periodType string) (string, error) {
 	}
 }
 
+// getPeriodBounds returns the first and last instant of the period containing t
+func getPeriodBounds(t time.Time, periodType string) (time.Time, time.Time, error) {
+	day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+
+	var start, next time.Time
+	switch periodType {
+	case "day":
+		start, next = day, day.AddDate(0, 0, 1)
+	case "week":
+		// ISO weeks start on Monday
+		offset := (int(t.Weekday()) + 6) % 7
+		start = day.AddDate(0, 0, -offset)
+		next = start.AddDate(0, 0, 7)
+	case "month":
+		start = time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, t.Location())
+		next = start.AddDate(0, 1, 0)
+	case "quarter":
+		firstMonth := time.Month((int(t.Month())-1)/3*3 + 1)
+		start = time.Date(t.Year(), firstMonth, 1, 0, 0, 0, 0, t.Location())
+		next = start.AddDate(0, 3, 0)
+	case "year":
+		start = time.Date(t.Year(), time.January, 1, 0, 0, 0, 0, t.Location())
+		next = start.AddDate(1, 0, 0)
+	default:
+		return time.Time{}, time.Time{}, fmt.Errorf("unsupported period type: %s", periodType)
+	}
+
+	return start, next.Add(-time.Nanosecond), nil
+}
+
 // groupEventsByPeriod groups events by time period and returns a map of period keys to event counts
 func groupEventsByPeriod(events []models.Event, periodType string) (map[string]int, []string, error) {
 	periodCounts := make(map[string]int)
@@ -71,6 +131,76 @@ func groupEventsByPeriod(events []models.Event, periodType string) (map[string]i
 	return periodCounts, periods, nil
 }
 
+// periodTimeline lists, for each period from the one containing first up to the one containing
+// now, whether it had activity, leaving out the periods skip reports. Periods are those of now's
+// timezone and are matched by key, so an event counts towards the day it occurred on locally.
+func periodTimeline(first, now time.Time, periodType string, active map[string]bool, skip func(time.Time) bool) ([]bool, error) {
+	if first.IsZero() {
+		return nil, nil
+	}
+
+	start, _, err := getPeriodBounds(time.Date(first.Year(), first.Month(), first.Day(), 0, 0, 0, 0, now.Location()), periodType)
+	if err != nil {
+		return nil, err
+	}
+
+	var timeline []bool
+	for period := start; !period.After(now); {
+		if !skip(period) {
+			key, _ := getPeriodKey(period, periodType)
+			timeline = append(timeline, active[key])
+		}
+		_, end, _ := getPeriodBounds(period, periodType)
+		period = end.Add(time.Nanosecond)
+	}
+	return timeline, nil
+}
+
+// computeStreaks measures runs of active periods in a timeline ending with the current period.
+// Up to freezes missed periods are forgiven within a run, and the current period does not break
+// the run while it has no activity yet. It returns the length of the run that is still going,
+// the longest run, and the freezes the current run used.
+func computeStreaks(timeline []bool, freezes int) (current, longest, freezesUsed int) {
+	// The current period only counts once it has activity
+	end := len(timeline)
+	if end > 0 && !timeline[end-1] {
+		end--
+	}
+
+	// Longest run: the most active periods in a stretch with at most freezes missed ones
+	start, missed := 0, 0
+	for i := 0; i < end; i++ {
+		if !timeline[i] {
+			missed++
+		}
+		for missed > freezes {
+			if !timeline[start] {
+				missed--
+			}
+			start++
+		}
+		if run := i - start + 1 - missed; run > longest {
+			longest = run
+		}
+	}
+
+	// Current run: walk back from the latest period until a miss cannot be forgiven
+	used := 0
+	for i := end - 1; i >= 0; i-- {
+		if timeline[i] {
+			current++
+			freezesUsed = used
+			continue
+		}
+		if used == freezes {
+			break
+		}
+		used++
+	}
+
+	return current, longest, freezesUsed
+}
+
 // evaluateConsistentPattern checks if events occur with consistent frequency across periods
 func evaluateConsistentPattern(periodCounts []int, criteria map[string]interface{}, metadata map[string]interface{}) bool {
 	// Store the raw counts for analysis
@@ -782,6 +912,9 @@ func findValidSequence(sequenceEvents [][]models.Event, maxGapSeconds int, requi
 	return false, nil
 }
 
+// lastDurationRegex matches the "last" duration of a time window, e.g. "30d", "2w" or "1m"
+var lastDurationRegex = regexp.MustCompile(`^(\d+)([dwmqy])$`)
+
 // parseTimeWindow parses time window criteria and returns start and end time
 func parseTimeWindow(criteria map[string]interface{}, timeVarCache *TimeVariableCache) (time.Time, time.Time, error) {
 	var startTime, endTime time.Time
@@ -824,8 +957,7 @@ func parseTimeWindow(criteria map[string]interface{}, timeVarCache *TimeVariable
 		}
 
 		// Parse duration (e.g., "30d", "2w", "1m")
-		re := regexp.MustCompile(`^(\d+)([dwmqy])$`)
-		matches := re.FindStringSubmatch(lastStr)
+		matches := lastDurationRegex.FindStringSubmatch(lastStr)
 
 		if len(matches) != 3 {
 			return startTime, endTime, fmt.Errorf("invalid duration format: %s", lastStr)
@@ -81,19 +81,19 @@ func TestTimeValueInBadgeCriteria(t *testing.T) {
 		},
 	}
 
-	// Create a rule engine with a fixed time for testing
+	// Create a rule engine and a fixed time for testing
 	re := &RuleEngine{
-		TimeVarCache: &TimeVariableCache{
-			now: time.Date(2023, 12, 15, 12, 0, 0, 0, time.UTC),
-		},
 		Logger: logging.NewLogger("TEST", logging.LogLevelInfo),
 	}
+	timeVars := &TimeVariableCache{
+		now: time.Date(2023, 12, 15, 12, 0, 0, 0, time.UTC),
+	}
 
 	// Create a test event with a timestamp 15 days ago (should match)
-	eventTime := re.TimeVarCache.now.AddDate(0, 0, -15)
+	eventTime := timeVars.now.AddDate(0, 0, -15)
 
 	// Manually test the timestamp condition
-	result, err := re.evaluateTimestampCondition(eventTime, criteria["timestamp"].(map[string]interface{}))
+	result, err := re.evaluateTimestampCondition(eventTime, criteria["timestamp"].(map[string]interface{}), timeVars)
 
 	if err != nil {
 		t.Errorf("evaluateTimestampCondition unexpected error: %v", err)
@@ -104,9 +104,9 @@ func TestTimeValueInBadgeCriteria(t *testing.T) {
 	}
 
 	// Create a test event with a timestamp 45 days ago (should not match)
-	oldEventTime := re.TimeVarCache.now.AddDate(0, 0, -45)
+	oldEventTime := timeVars.now.AddDate(0, 0, -45)
 
-	result, err = re.evaluateTimestampCondition(oldEventTime, criteria["timestamp"].(map[string]interface{}))
+	result, err = re.evaluateTimestampCondition(oldEventTime, criteria["timestamp"].(map[string]interface{}), timeVars)
 
 	if err != nil {
 		t.Errorf("evaluateTimestampCondition unexpected error: %v", err)
@@ -118,14 +118,12 @@ func TestTimeValueInBadgeCriteria(t *testing.T) {
 }
 
 func TestComplexTimeVariableCriteria(t *testing.T) {
-	// Create a rule engine with a fixed time for testing
+	// Create a rule engine and a fixed time for testing
 	fixedTime := time.Date(2023, 12, 15, 12, 0, 0, 0, time.UTC)
 	re := &RuleEngine{
-		TimeVarCache: &TimeVariableCache{
-			now: fixedTime,
-		},
 		Logger: logging.NewLogger("TEST", logging.LogLevelInfo),
 	}
+	timeVars := &TimeVariableCache{now: fixedTime}
 
 	// Create a mock complex criteria with multiple time variables
 	// Similar to the "Loyal Active Customer" example in the proposal
@@ -150,7 +148,7 @@ func TestComplexTimeVariableCriteria(t *testing.T) {
 
 	// Test user.created_at condition with account 2 years old (should match)
 	userCreatedAt := fixedTime.AddDate(-2, 0, 0)
-	result, err := re.parseTimeValueWithCache(criteria["user"].(map[string]interface{})["created_at"].(map[string]interface{})["$lte"])
+	result, err := re.parseTimeValueWithCache(criteria["user"].(map[string]interface{})["created_at"].(map[string]interface{})["$lte"], timeVars)
 	if err != nil {
 		t.Errorf("parseTimeValueWithCache unexpected error: %v", err)
 	}
@@ -160,7 +158,7 @@ func TestComplexTimeVariableCriteria(t *testing.T) {
 
 	// Test user.subscription.expires_at condition with unexpired subscription (should match)
 	subExpiresAt := fixedTime.AddDate(0, 1, 0) // Expires in 1 month
-	result, err = re.parseTimeValueWithCache(criteria["user"].(map[string]interface{})["subscription"].(map[string]interface{})["expires_at"].(map[string]interface{})["$gte"])
+	result, err = re.parseTimeValueWithCache(criteria["user"].(map[string]interface{})["subscription"].(map[string]interface{})["expires_at"].(map[string]interface{})["$gte"], timeVars)
 	if err != nil {
 		t.Errorf("parseTimeValueWithCache unexpected error: %v", err)
 	}
@@ -170,7 +168,7 @@ func TestComplexTimeVariableCriteria(t *testing.T) {
 
 	// Test last_purchase condition with purchase 60 days ago (should match)
 	lastPurchase := fixedTime.AddDate(0, 0, -60)
-	result, err = re.parseTimeValueWithCache(criteria["last_purchase"].(map[string]interface{})["$gte"])
+	result, err = re.parseTimeValueWithCache(criteria["last_purchase"].(map[string]interface{})["$gte"], timeVars)
 	if err != nil {
 		t.Errorf("parseTimeValueWithCache unexpected error: %v", err)
 	}
@@ -180,7 +178,7 @@ func TestComplexTimeVariableCriteria(t *testing.T) {
 
 	// Test recent_activity condition with activity 45 days ago (should not match)
 	recentActivity := fixedTime.AddDate(0, 0, -45)
-	result, err = re.parseTimeValueWithCache(criteria["recent_activity"].(map[string]interface{})["$gte"])
+	result, err = re.parseTimeValueWithCache(criteria["recent_activity"].(map[string]interface{})["$gte"], timeVars)
 	if err != nil {
 		t.Errorf("parseTimeValueWithCache unexpected error: %v", err)
 	}
@@ -6,6 +6,9 @@ import (
 
 	"github.com/badge-assignment-system/internal/logging"
 	"github.com/badge-assignment-system/internal/models"
+	"github.com/badge-assignment-system/internal/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 // TestTimeWindowCriteria tests the time window criteria evaluation
@@ -54,3 +57,79 @@ func TestTimeWindowCriteria(t *testing.T) {
 	// We can't fully test this without mocking more DB queries,
 	// but we can at least test that the criteria format is valid
 }
+
+// TestTimeWindowRestrictsSubFlowEvents checks that windowed sub-flows only see events inside the window,
+// that nested windows intersect, and that the events are loaded with one range-bounded query
+func TestTimeWindowRestrictsSubFlowEvents(t *testing.T) {
+	mockDB := testutil.NewMockDB()
+
+	start := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+	end := start.AddDate(0, 0, 10)
+	flow := map[string]interface{}{
+		"$timeWindow": map[string]interface{}{
+			"start": start.Format(time.RFC3339),
+			"end":   end.Format(time.RFC3339),
+			"flow": map[string]interface{}{
+				"$and": []interface{}{
+					map[string]interface{}{
+						"event":    "check-in",
+						"criteria": map[string]interface{}{"$eventCount": map[string]interface{}{"$eq": float64(3)}},
+					},
+					map[string]interface{}{
+						"$timeWindow": map[string]interface{}{
+							"start": start.AddDate(0, 0, 5).Format(time.RFC3339),
+							"end":   start.AddDate(0, 0, 20).Format(time.RFC3339),
+							"flow": map[string]interface{}{
+								"event":    "check-in",
+								"criteria": map[string]interface{}{"$eventCount": map[string]interface{}{"$eq": float64(1)}},
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+	mockDB.On("GetBadgeWithCriteria", 1).Return(testutil.CreateTestBadgeWithCriteria(1, "January Regular", flow), nil)
+	mockDB.On("GetEventTypeByName", "check-in").Return(models.EventType{ID: 1, Name: "check-in"}, nil)
+
+	// The database returns what falls in the outer window; the engine applies the inner ones
+	mockDB.On("GetUserEventsInRange", "user-1", start, end).Return([]models.Event{
+		{ID: 3, EventTypeID: 1, UserID: "user-1", OccurredAt: start.AddDate(0, 0, 7)},
+		{ID: 2, EventTypeID: 1, UserID: "user-1", OccurredAt: start.AddDate(0, 0, 3)},
+		{ID: 1, EventTypeID: 1, UserID: "user-1", OccurredAt: start.AddDate(0, 0, 1)},
+	}, nil).Once()
+
+	engine := NewRuleEngine(mockDB)
+
+	result, metadata, err := engine.EvaluateBadgeCriteria(1, "user-1")
+	require.NoError(t, err)
+	assert.True(t, result)
+	assert.Equal(t, 1, metadata["window_window_event_count"])
+	mockDB.AssertNotCalled(t, "GetUserEvents", "user-1")
+	mockDB.AssertExpectations(t)
+}
+
+// TestFlowScopeIsUnboundedOutsideWindows checks that flows reading events outside any window load everything
+func TestFlowScopeIsUnboundedOutsideWindows(t *testing.T) {
+	engine := NewRuleEngine(testutil.NewMockDB())
+
+	windowed := map[string]interface{}{
+		"$timeWindow": map[string]interface{}{
+			"last": "30d",
+			"flow": map[string]interface{}{"event": "check-in", "criteria": map[string]interface{}{}},
+		},
+	}
+	timeVars := NewTimeVariableCache()
+	scope := engine.flowScope(windowed, nil, timeVars)
+	require.NotNil(t, scope)
+	assert.Equal(t, timeVars.now, scope.end)
+	assert.Equal(t, timeVars.now.AddDate(0, 0, -30), scope.start)
+
+	mixed := map[string]interface{}{
+		"$or": []interface{}{
+			windowed,
+			map[string]interface{}{"$gap": map[string]interface{}{"maxGapHours": float64(24)}},
+		},
+	}
+	assert.Nil(t, engine.flowScope(mixed, nil, timeVars))
+}
@@ -0,0 +1,126 @@
+package engine
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+	_ "time/tzdata" // Timezones do not depend on the host's zoneinfo
+
+	"github.com/badge-assignment-system/internal/models"
+)
+
+// locations caches loaded timezones by name
+var locations sync.Map
+
+// LoadTimezone loads an IANA timezone such as "America/New_York". "UTC" is accepted;
+// the server's own "Local" zone and the empty name are not.
+func LoadTimezone(name string) (*time.Location, error) {
+	if cached, ok := locations.Load(name); ok {
+		return cached.(*time.Location), nil
+	}
+	if name == "" || name == "Local" {
+		return nil, fmt.Errorf("unknown timezone '%s'", name)
+	}
+
+	location, err := time.LoadLocation(name)
+	if err != nil {
+		return nil, fmt.Errorf("unknown timezone '%s'", name)
+	}
+	locations.Store(name, location)
+	return location, nil
+}
+
+// localizeEvents moves each event's time into the timezone it was sent from, so that days,
+// weeks and times of day are those the user saw. Events without a timezone are in UTC.
+func (re *RuleEngine) localizeEvents(events []models.Event) {
+	for i := range events {
+		location := time.UTC
+		if events[i].Timezone != nil {
+			var err error
+			location, err = LoadTimezone(*events[i].Timezone)
+			if err != nil {
+				re.Logger.Warning("Event ID %d has %v, using UTC", events[i].ID, err)
+				location = time.UTC
+			}
+		}
+		events[i].OccurredAt = events[i].OccurredAt.In(location)
+	}
+}
+
+// criteriaTimezone returns the timezone named by a criterion's option, or nil when the
+// option is not set and events keep their own timezones
+func criteriaTimezone(criteria map[string]interface{}, option string) (*time.Location, error) {
+	value, ok := criteria[option]
+	if !ok {
+		return nil, nil
+	}
+	name, ok := value.(string)
+	if !ok {
+		return nil, fmt.Errorf("%s must be a string", option)
+	}
+	return LoadTimezone(name)
+}
+
+// inTimezone returns copies of events moved into a criterion's timezone option, or the
+// events unchanged when the option is not set
+func inTimezone(criteria map[string]interface{}, option string, events []models.Event) ([]models.Event, error) {
+	location, err := criteriaTimezone(criteria, option)
+	if err != nil || location == nil {
+		return events, err
+	}
+
+	localized := make([]models.Event, len(events))
+	for i, event := range events {
+		event.OccurredAt = event.OccurredAt.In(location)
+		localized[i] = event
+	}
+	return localized, nil
+}
+
+// localTimeValue returns the value of the $timeOfDay or $dayOfWeek pseudo-field for the time
+// an event occurred: an "HH:MM:SS" time, or a lowercase weekday name such as "monday"
+func localTimeValue(t time.Time, field string) string {
+	if field == "$dayOfWeek" {
+		return strings.ToLower(t.Weekday().String())
+	}
+	return t.Format("15:04:05")
+}
+
+// isTimeOfDay reports whether a value can be compared with $timeOfDay
+func isTimeOfDay(value string) bool {
+	_, err := time.Parse("15:04:05", value)
+	return err == nil
+}
+
+// isDayOfWeek reports whether a value can be compared with $dayOfWeek
+func isDayOfWeek(value string) bool {
+	for day := time.Sunday; day <= time.Saturday; day++ {
+		if value == strings.ToLower(day.String()) {
+			return true
+		}
+	}
+	return false
+}
+
+// userLocation returns the user's timezone, loading it on first use. It is UTC when the
+// user never gave one.
+func (re *RuleEngine) userLocation(ctx *evaluationContext) (*time.Location, error) {
+	if ctx.snapshot.location != nil {
+		return ctx.snapshot.location, nil
+	}
+
+	name, err := re.DB.GetUserTimezone(ctx.userID)
+	if err != nil {
+		return nil, err
+	}
+	location := time.UTC
+	if name != "" {
+		if location, err = LoadTimezone(name); err != nil {
+			re.Logger.Warning("User %s has %v, using UTC", ctx.userID, err)
+			location = time.UTC
+		}
+	}
+	ctx.snapshot.location = location
+	return location, nil
+}
@@ -0,0 +1,94 @@
+package engine
+
+import (
+	"testing"
+	"time"
+
+	"github.com/badge-assignment-system/internal/models"
+	"github.com/badge-assignment-system/internal/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+// zonedCheckIn creates a check-in event sent from a timezone
+func zonedCheckIn(t *testing.T, id int, occurredAt, timezone string) models.Event {
+	at, err := time.Parse(time.RFC3339, occurredAt)
+	require.NoError(t, err)
+	return models.Event{ID: id, EventTypeID: 1, UserID: "user-1", OccurredAt: at, Timezone: &timezone, Payload: models.JSONB{}}
+}
+
+// TestEventsAreEvaluatedInTheirTimezone checks that days, weekdays and times of day are those
+// of the timezone each event was sent from, unless the criteria name another timezone
+func TestEventsAreEvaluatedInTheirTimezone(t *testing.T) {
+	db := &awardingDB{events: []models.Event{
+		zonedCheckIn(t, 1, "2024-05-13T02:00:00Z", "America/New_York"), // Sunday 22:00 in New York
+		zonedCheckIn(t, 2, "2024-05-11T02:30:00Z", "America/New_York"), // Friday 22:30
+		zonedCheckIn(t, 3, "2024-05-10T13:00:00Z", "America/New_York"), // Friday 09:00
+		zonedCheckIn(t, 4, "2024-05-09T12:15:00Z", "America/New_York"), // Thursday 08:15
+	}}
+	engine := NewRuleEngine(db)
+
+	tests := []struct {
+		name     string
+		flow     string
+		expected bool
+	}{
+		{"local days", `{"$timePeriod": {"periodType": "day", "periodCount": {"$eq": 3}}}`, true},
+		{"days in criterion timezone", `{"$timePeriod": {"periodType": "day", "periodCount": {"$eq": 3}, "timezone": "UTC"}}`, false},
+		{"local weekends", `{"$timePeriod": {"periodType": "day", "excludeWeekends": true, "periodCount": {"$eq": 2}}}`, true},
+		{"weekends in criterion timezone", `{"$timePeriod": {"periodType": "day", "excludeWeekends": true, "periodCount": {"$eq": 2}, "timezone": "UTC"}}`, false},
+		{"local weekday", `{"event": "check-in", "criteria": {"$dayOfWeek": "sunday"}}`, true},
+		{"weekday in criteria timezone", `{"event": "check-in", "criteria": {"$dayOfWeek": "sunday", "$timezone": "UTC"}}`, false},
+		{"local time of day", `{"event": "check-in", "criteria": {"$timeOfDay": {"$lt": "09:00:00"}}}`, true},
+		{"time of day in criteria timezone", `{"event": "check-in", "criteria": {"$timeOfDay": {"$lt": "09:00:00"}, "$timezone": "Asia/Tokyo"}}`, false},
+		{"local days in expressions", `{"$expression": "distinctDays(events) == 3"}`, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := engine.ExplainFlow(decodeJSONB(t, tt.flow), "user-1")
+			require.Empty(t, result.Error)
+			assert.Equal(t, tt.expected, result.Result)
+		})
+	}
+}
+
+// TestPerPeriodBadgeUsesUserTimezone checks that a per-period badge's periods start at midnight in the user's timezone
+func TestPerPeriodBadgeUsesUserTimezone(t *testing.T) {
+	mockDB := testutil.NewMockDB()
+
+	badge := testutil.CreateTestBadgeWithCriteria(1, "Daily Regular", checkInCountFlow(1))
+	badge.Badge.RepeatPolicy = &models.RepeatPolicy{Type: models.RepeatPerPeriod, Period: "day"}
+
+	tokyo, err := LoadTimezone("Asia/Tokyo")
+	require.NoError(t, err)
+	engine := NewRuleEngine(mockDB)
+	now := time.Now().In(tokyo)
+
+	start, end, err := getPeriodBounds(now, "day")
+	require.NoError(t, err)
+	mockDB.On("GetUserTimezone", "user-1").Return("Asia/Tokyo", nil)
+	mockDB.On("GetBadgeWithCriteria", 1).Return(badge, nil)
+	mockDB.On("GetEventTypeByName", "check-in").Return(models.EventType{ID: 1, Name: "check-in"}, nil)
+	mockDB.On("GetUserEventsInRange", "user-1", start, end).Return(checkIns("user-1", now), nil)
+	mockDB.On("AwardBadgeToUser", mock.Anything).Return(true, nil)
+
+	_, err = engine.processBadge(newEvaluationContext("user-1"), 1, nil)
+	require.NoError(t, err)
+
+	awards := recordedAwards(mockDB)
+	require.Len(t, awards, 1)
+	assert.Equal(t, now.Format("2006-01-02"), *awards[0].PeriodKey)
+}
+
+func TestLoadTimezone(t *testing.T) {
+	location, err := LoadTimezone("Europe/Paris")
+	require.NoError(t, err)
+	assert.Equal(t, "Europe/Paris", location.String())
+
+	for _, name := range []string{"", "Local", "Mars/Olympus"} {
+		_, err := LoadTimezone(name)
+		assert.ErrorContains(t, err, "unknown timezone", name)
+	}
+}
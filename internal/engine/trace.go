@@ -0,0 +1,156 @@
+package engine
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/badge-assignment-system/internal/models"
+)
+
+// TraceNode records how a single node of a flow definition was evaluated
+type TraceNode struct {
+	Operator        string                 `json:"operator"`
+	EventType       string                 `json:"event_type,omitempty"`
+	Input           interface{}            `json:"input,omitempty"`
+	MatchedEventIDs []int                  `json:"matched_event_ids,omitempty"`
+	Values          map[string]interface{} `json:"values,omitempty"`
+	Result          bool                   `json:"result"`
+	Error           string                 `json:"error,omitempty"`
+	Children        []*TraceNode           `json:"children,omitempty"`
+}
+
+// EvaluationResult is the outcome of a dry-run evaluation, including the full trace
+type EvaluationResult struct {
+	BadgeID     int                    `json:"badge_id,omitempty"`
+	UserID      string                 `json:"user_id"`
+	Result      bool                   `json:"result"`
+	Error       string                 `json:"error,omitempty"`
+	Metadata    map[string]interface{} `json:"metadata"`
+	Trace       *TraceNode             `json:"trace"`
+	EvaluatedAt time.Time              `json:"evaluated_at"`
+}
+
+// evaluationTracer builds the trace tree while a flow is evaluated
+type evaluationTracer struct {
+	root    *TraceNode
+	current *TraceNode
+}
+
+// withTracing enables trace recording for the context
+func (ctx *evaluationContext) withTracing() *evaluationContext {
+	ctx.tracer = &evaluationTracer{}
+	return ctx
+}
+
+// tracing reports whether the context records a trace
+func (ctx *evaluationContext) tracing() bool {
+	return ctx.tracer != nil
+}
+
+// beginTrace opens a trace node for a flow node; it returns nil when tracing is disabled
+func (ctx *evaluationContext) beginTrace(flow models.JSONB) (node, parent *TraceNode) {
+	if ctx.tracer == nil {
+		return nil, nil
+	}
+
+	node = &TraceNode{}
+	if eventType, ok := flow["event"].(string); ok {
+		node.Operator = "event"
+		node.EventType = eventType
+		node.Input = flow["criteria"]
+	} else {
+		for operator, value := range flow {
+			node.Operator = operator
+			switch operator {
+			case "$and", "$or", "$not":
+				// Children are traced individually
+			case "$timeWindow":
+				if criteria, ok := value.(map[string]interface{}); ok {
+					input := make(map[string]interface{}, len(criteria))
+					for k, v := range criteria {
+						if k != "flow" {
+							input[k] = v
+						}
+					}
+					node.Input = input
+				}
+			default:
+				node.Input = value
+			}
+			break
+		}
+	}
+
+	parent = ctx.tracer.current
+	if parent == nil {
+		ctx.tracer.root = node
+	} else {
+		parent.Children = append(parent.Children, node)
+	}
+	ctx.tracer.current = node
+	return node, parent
+}
+
+// endTrace records the outcome of a trace node and makes its parent current again
+func (ctx *evaluationContext) endTrace(node, parent *TraceNode, result bool, err error, values map[string]interface{}) {
+	if node == nil {
+		return
+	}
+
+	node.Result = result
+	if err != nil {
+		node.Error = err.Error()
+	}
+	if len(node.Children) == 0 && len(values) > 0 {
+		node.Values = values
+	}
+	ctx.tracer.current = parent
+}
+
+// recordEvents records the IDs of the events that matched the current trace node
+func (ctx *evaluationContext) recordEvents(events []models.Event) {
+	if ctx.tracer == nil || ctx.tracer.current == nil {
+		return
+	}
+
+	ids := make([]int, len(events))
+	for i, event := range events {
+		ids[i] = event.ID
+	}
+	ctx.tracer.current.MatchedEventIDs = ids
+}
+
+// ExplainBadgeCriteria evaluates a badge for a user without awarding it and returns the full trace
+func (re *RuleEngine) ExplainBadgeCriteria(badgeID int, userID string) (*EvaluationResult, error) {
+	badgeWithCriteria, err := re.DB.GetBadgeWithCriteria(badgeID)
+	if err != nil {
+		re.Logger.Error("Failed to get badge criteria: %v", err)
+		return nil, fmt.Errorf("failed to get badge criteria: %w", err)
+	}
+
+	result := re.ExplainFlow(criteriaFlow(badgeWithCriteria.Criteria), userID)
+	result.BadgeID = badgeID
+	return result, nil
+}
+
+// ExplainFlow evaluates a (possibly unsaved) flow definition for a user and returns the full trace
+func (re *RuleEngine) ExplainFlow(flow models.JSONB, userID string) *EvaluationResult {
+	re.Logger.Debug("Explaining flow evaluation for user %s", userID)
+
+	ctx := newEvaluationContext(userID).withTracing()
+	re.beginFlow(ctx, flow)
+	metadata := make(map[string]interface{})
+	result, err := re.evaluateFlow(flow, ctx, metadata)
+
+	evaluation := &EvaluationResult{
+		UserID:      userID,
+		Result:      result && err == nil,
+		Metadata:    metadata,
+		Trace:       ctx.tracer.root,
+		EvaluatedAt: ctx.timeVars.now,
+	}
+	if err != nil {
+		evaluation.Error = err.Error()
+	}
+	return evaluation
+}
@@ -0,0 +1,116 @@
+package engine
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/badge-assignment-system/internal/models"
+	"github.com/badge-assignment-system/internal/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestExplainBadgeCriteria checks that the trace mirrors the flow and explains why each node passed or failed
+func TestExplainBadgeCriteria(t *testing.T) {
+	mockDB := testutil.NewMockDB()
+
+	flow := map[string]interface{}{
+		"$and": []interface{}{
+			map[string]interface{}{
+				"event":    "task-completion",
+				"criteria": map[string]interface{}{"priority": "high"},
+			},
+			map[string]interface{}{
+				"$not": map[string]interface{}{
+					"event":    "bug-report",
+					"criteria": map[string]interface{}{"severity": "critical"},
+				},
+			},
+		},
+	}
+	mockDB.On("GetBadgeWithCriteria", 3).Return(testutil.CreateTestBadgeWithCriteria(3, "Careful Finisher", flow), nil)
+
+	now := time.Now()
+	mockDB.On("GetEventTypeByName", "task-completion").Return(models.EventType{ID: 1, Name: "task-completion"}, nil)
+	mockDB.On("GetEventTypeByName", "bug-report").Return(models.EventType{ID: 2, Name: "bug-report"}, nil)
+	mockDB.On("GetUserEvents", "user-1").Return([]models.Event{
+		{ID: 10, EventTypeID: 1, UserID: "user-1", OccurredAt: now, Payload: models.JSONB{"priority": "low"}},
+		{ID: 11, EventTypeID: 1, UserID: "user-1", OccurredAt: now, Payload: models.JSONB{"priority": "high"}},
+		{ID: 20, EventTypeID: 2, UserID: "user-1", OccurredAt: now, Payload: models.JSONB{"severity": "critical"}},
+	}, nil)
+
+	engine := NewRuleEngine(mockDB)
+
+	result, err := engine.ExplainBadgeCriteria(3, "user-1")
+	require.NoError(t, err)
+
+	assert.Equal(t, 3, result.BadgeID)
+	assert.False(t, result.Result)
+	require.NotNil(t, result.Trace)
+	assert.Equal(t, "$and", result.Trace.Operator)
+	assert.False(t, result.Trace.Result)
+	require.Len(t, result.Trace.Children, 2)
+
+	tasks := result.Trace.Children[0]
+	assert.Equal(t, "event", tasks.Operator)
+	assert.Equal(t, "task-completion", tasks.EventType)
+	assert.True(t, tasks.Result)
+	assert.Equal(t, []int{11}, tasks.MatchedEventIDs)
+	assert.Equal(t, 1, tasks.Values["filtered_event_count"])
+
+	not := result.Trace.Children[1]
+	assert.Equal(t, "$not", not.Operator)
+	assert.False(t, not.Result)
+	require.Len(t, not.Children, 1)
+	assert.True(t, not.Children[0].Result)
+	assert.Equal(t, []int{20}, not.Children[0].MatchedEventIDs)
+
+	// A dry run never awards anything
+	mockDB.AssertNotCalled(t, "AwardBadgeToUser")
+}
+
+// TestExplainFlowReportsErrors checks that evaluation errors are attached to the failing node
+func TestExplainFlowReportsErrors(t *testing.T) {
+	mockDB := testutil.NewMockDB()
+	engine := NewRuleEngine(mockDB)
+
+	result := engine.ExplainFlow(models.JSONB{"$or": "not-an-array"}, "user-1")
+
+	assert.False(t, result.Result)
+	assert.Contains(t, result.Error, "$or operator requires an array of conditions")
+	require.NotNil(t, result.Trace)
+	assert.Equal(t, result.Error, result.Trace.Error)
+}
+
+// TestConcurrentEvaluationsShareEngine checks that evaluations running at once on one engine each
+// resolve time variables against their own time
+func TestConcurrentEvaluationsShareEngine(t *testing.T) {
+	now := time.Now()
+	db := &awardingDB{
+		badges: []models.BadgeWithCriteria{badgeWithFlow(1, "Regular", checkInCountFlow(2))},
+		events: checkIns("user-1", now.AddDate(0, 0, -2), now.AddDate(0, 0, -1)),
+	}
+	engine := NewRuleEngine(db)
+	flow := models.JSONB{
+		"event":    "check-in",
+		"criteria": map[string]interface{}{"timestamp": map[string]interface{}{"$gte": "$NOW(-7d)"}},
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			result := engine.ExplainFlow(flow, "user-1")
+			assert.True(t, result.Result)
+		}()
+		go func() {
+			defer wg.Done()
+			progress, err := engine.EvaluateBadgeProgress(1, "user-1")
+			assert.NoError(t, err)
+			assert.False(t, progress.EvaluatedAt.IsZero())
+		}()
+	}
+	wg.Wait()
+}
@@ -0,0 +1,830 @@
+package engine
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/badge-assignment-system/internal/expr"
+	"github.com/badge-assignment-system/internal/models"
+	"github.com/badge-assignment-system/internal/schema"
+)
+
+// Accepted values of the enumerated settings of time-based operators
+var (
+	periodTypes        = []string{"day", "week", "month", "quarter", "year"}
+	patternTypes       = []string{"consistent", "increasing", "decreasing"}
+	gapPeriodTypes     = []string{"all", "business-days"}
+	durationUnits      = []string{"seconds", "minutes", "hours", "days"}
+	aggregationTypes   = []string{"min", "max", "avg", "sum", "count"}
+	numericOperators   = []string{"$eq", "$ne", "$gt", "$gte", "$lt", "$lte"}
+	timestampOperators = numericOperators
+)
+
+// flowValidator statically checks a flow definition, collecting every problem it finds
+type flowValidator struct {
+	db               DBInterface
+	eventTypes       map[string]bool // Event types already looked up, by whether they exist
+	holidayCalendars map[string]bool // Holiday calendars already looked up, by whether they exist
+	violations       []schema.Violation
+}
+
+// ValidateFlow checks a flow definition without evaluating it: operator names, the shape of
+// their arguments, referenced event types and condition types, time variables and regular
+// expressions. Every problem is reported with a JSON pointer relative to the flow.
+func ValidateFlow(db DBInterface, flow map[string]interface{}) []schema.Violation {
+	v := &flowValidator{db: db, eventTypes: make(map[string]bool), holidayCalendars: make(map[string]bool)}
+	v.flow(flow, "")
+	return v.violations
+}
+
+// add records a violation at a path. The keyword is the operator or field being checked.
+func (v *flowValidator) add(path, keyword, format string, args ...interface{}) {
+	v.violations = append(v.violations, schema.Violation{
+		Path:    path,
+		Keyword: keyword,
+		Message: fmt.Sprintf(format, args...),
+	})
+}
+
+// pointer appends a reference token to a JSON pointer
+func pointer(path string, token interface{}) string {
+	return path + "/" + schema.EscapePointer(fmt.Sprint(token))
+}
+
+// sortedKeys returns the keys of an object in a stable order, so violations are reported deterministically
+func sortedKeys(object map[string]interface{}) []string {
+	keys := make([]string, 0, len(object))
+	for key := range object {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// object returns a value as an object, reporting it otherwise
+func (v *flowValidator) object(value interface{}, path, keyword string) (map[string]interface{}, bool) {
+	object, ok := value.(map[string]interface{})
+	if !ok {
+		v.add(path, keyword, "%s requires an object, got %s", keyword, jsonKind(value))
+	}
+	return object, ok
+}
+
+// flow checks a node of a flow definition: an event criterion or a single operator
+func (v *flowValidator) flow(value interface{}, path string) {
+	node, ok := value.(map[string]interface{})
+	if !ok {
+		v.add(path, "flow", "a flow node must be an object, got %s", jsonKind(value))
+		return
+	}
+	if len(node) == 0 {
+		v.add(path, "flow", "a flow node must not be empty")
+		return
+	}
+
+	if eventValue, isEvent := node["event"]; isEvent {
+		v.eventNode(node, eventValue, path)
+		return
+	}
+
+	var operators []string
+	for _, operator := range sortedKeys(node) {
+		value, operatorPath := node[operator], pointer(path, operator)
+		switch operator {
+		case "$and", "$or":
+			conditions, ok := value.([]interface{})
+			if !ok {
+				v.add(operatorPath, operator, "%s requires an array of conditions", operator)
+				break
+			}
+			for i, condition := range conditions {
+				v.flow(condition, pointer(operatorPath, i))
+			}
+		case "$not":
+			if _, ok := v.object(value, operatorPath, operator); ok {
+				v.flow(value, operatorPath)
+			}
+		case "$timePeriod":
+			v.timePeriod(value, operatorPath)
+		case "$pattern":
+			v.pattern(value, operatorPath)
+		case "$streak":
+			v.streak(value, operatorPath)
+		case "$sequence":
+			v.sequence(value, operatorPath)
+		case "$gap":
+			v.gap(value, operatorPath)
+		case "$duration":
+			v.duration(value, operatorPath)
+		case "$aggregate":
+			v.aggregate(value, operatorPath)
+		case "$timeWindow":
+			v.timeWindow(value, operatorPath)
+		case "$hasBadge":
+			v.hasBadge(value, operatorPath)
+		case "$badgeCount":
+			v.badgeCount(value, operatorPath)
+		case "$condition":
+			v.condition(value, operatorPath)
+		case "$expression":
+			v.expression(value, operatorPath)
+		default:
+			v.add(operatorPath, operator, "unknown operator '%s'", operator)
+			continue
+		}
+		operators = append(operators, operator)
+	}
+
+	if len(operators) > 1 {
+		v.add(path, "flow", "a flow node must have a single operator, found %s", strings.Join(operators, ", "))
+	}
+}
+
+// eventNode checks an event criterion such as {"event": "check-in", "criteria": {...}}
+func (v *flowValidator) eventNode(node map[string]interface{}, eventValue interface{}, path string) {
+	if eventType, ok := eventValue.(string); ok {
+		v.eventType(eventType, pointer(path, "event"))
+	} else {
+		v.add(pointer(path, "event"), "event", "event must be an event type name, got %s", jsonKind(eventValue))
+	}
+
+	if criteria, ok := node["criteria"]; !ok {
+		v.add(path, "criteria", "event criterion is missing 'criteria'")
+	} else if criteriaObject, ok := v.object(criteria, pointer(path, "criteria"), "criteria"); ok {
+		v.eventCriteria(criteriaObject, pointer(path, "criteria"))
+	}
+
+	for _, key := range sortedKeys(node) {
+		if key != "event" && key != "criteria" {
+			v.add(pointer(path, key), key, "unknown field '%s' in event criterion", key)
+		}
+	}
+}
+
+// eventType checks that an event type exists
+func (v *flowValidator) eventType(name, path string) {
+	exists, checked := v.eventTypes[name]
+	if !checked {
+		_, err := v.db.GetEventTypeByName(name)
+		exists = err == nil
+		v.eventTypes[name] = exists
+	}
+	if !exists {
+		v.add(path, "event", "event type '%s' not found", name)
+	}
+}
+
+// eventCriteria checks the criteria events are filtered by: payload field conditions and the
+// special "timestamp", "$expr", "$eventCount", "$timeOfDay", "$dayOfWeek" and "$timezone" criteria
+func (v *flowValidator) eventCriteria(criteria map[string]interface{}, path string) {
+	for _, field := range sortedKeys(criteria) {
+		value, fieldPath := criteria[field], pointer(path, field)
+		switch {
+		case field == "$eventCount":
+			v.numericCriteria(value, fieldPath, field)
+		case field == "timestamp":
+			conditions, ok := v.object(value, fieldPath, field)
+			if !ok {
+				break
+			}
+			for _, operator := range sortedKeys(conditions) {
+				if !contains(timestampOperators, operator) {
+					v.add(pointer(fieldPath, operator), operator, "unknown timestamp operator '%s'", operator)
+					continue
+				}
+				v.timeValue(conditions[operator], pointer(fieldPath, operator), operator)
+			}
+		case field == "$expr":
+			v.exprCriteria(value, fieldPath)
+		case field == "$timeOfDay" || field == "$dayOfWeek":
+			v.localTimeCondition(field, value, fieldPath)
+		case field == "$timezone":
+			v.timezone(value, fieldPath, field)
+		case strings.HasPrefix(field, "$"):
+			v.add(fieldPath, field, "unknown operator '%s'", field)
+		default:
+			v.fieldCondition(field, value, fieldPath)
+		}
+	}
+}
+
+// fieldCondition checks the condition on a payload field: a value it must equal or an object of comparison operators
+func (v *flowValidator) fieldCondition(field string, value interface{}, path string) {
+	if _, err := parseFieldPath(field); err != nil {
+		v.add(path, "field", "%v", err)
+	}
+	if conditions, ok := value.(map[string]interface{}); ok {
+		v.comparison(conditions, path)
+	}
+}
+
+// localTimeCondition checks a condition on the local time of day or weekday of events,
+// whose values must be "HH:MM:SS" times or lowercase weekday names
+func (v *flowValidator) localTimeCondition(field string, value interface{}, path string) {
+	valid, expected := isTimeOfDay, "an HH:MM:SS time"
+	if field == "$dayOfWeek" {
+		valid, expected = isDayOfWeek, "a weekday name such as 'monday'"
+	}
+	check := func(value interface{}, path string) {
+		if str, ok := value.(string); ok && !valid(str) {
+			v.add(path, field, "'%s' is not %s", str, expected)
+		}
+	}
+
+	conditions, ok := value.(map[string]interface{})
+	if !ok {
+		check(value, path)
+		return
+	}
+	v.comparison(conditions, path)
+	for _, operator := range sortedKeys(conditions) {
+		operatorPath := pointer(path, operator)
+		if values, ok := conditions[operator].([]interface{}); ok {
+			for i, element := range values {
+				check(element, pointer(operatorPath, i))
+			}
+			continue
+		}
+		check(conditions[operator], operatorPath)
+	}
+}
+
+// timezone checks an IANA timezone name such as "Europe/Paris"
+func (v *flowValidator) timezone(value interface{}, path, keyword string) {
+	name, ok := value.(string)
+	if !ok {
+		v.add(path, keyword, "%s must be a string, got %s", keyword, jsonKind(value))
+		return
+	}
+	if _, err := LoadTimezone(name); err != nil {
+		v.add(path, keyword, "%v", err)
+	}
+}
+
+// comparison checks an object of comparison operators
+func (v *flowValidator) comparison(conditions map[string]interface{}, path string) {
+	for _, operator := range sortedKeys(conditions) {
+		value, operatorPath := conditions[operator], pointer(path, operator)
+		switch operator {
+		case "$eq", "$ne", "$gt", "$gte", "$lt", "$lte":
+			v.operand(value, operatorPath)
+		case "$in", "$nin", "$all":
+			if _, _, isOperand := operandExpression(value); !isOperand {
+				if _, ok := value.([]interface{}); !ok {
+					v.add(operatorPath, operator, "%s requires an array, got %s", operator, jsonKind(value))
+					break
+				}
+			}
+			v.operand(value, operatorPath)
+		case "$exists":
+			if _, ok := value.(bool); !ok {
+				v.add(operatorPath, operator, "$exists requires a boolean, got %s", jsonKind(value))
+			}
+		case "$size":
+			if sizeCriteria, ok := value.(map[string]interface{}); ok {
+				v.numericCriteria(sizeCriteria, operatorPath, operator)
+			} else if jsonKind(value) != "number" {
+				v.add(operatorPath, operator, "$size requires a number or a comparison object, got %s", jsonKind(value))
+			}
+		case "$elemMatch":
+			elementConditions, ok := v.object(value, operatorPath, operator)
+			if !ok {
+				break
+			}
+			operatorsOnly := true
+			for key := range elementConditions {
+				operatorsOnly = operatorsOnly && strings.HasPrefix(key, "$")
+			}
+			if operatorsOnly {
+				v.comparison(elementConditions, operatorPath)
+				break
+			}
+			for _, field := range sortedKeys(elementConditions) {
+				v.fieldCondition(field, elementConditions[field], pointer(operatorPath, field))
+			}
+		case "$regex":
+			pattern, ok := value.(string)
+			if !ok {
+				v.add(operatorPath, operator, "$regex requires a string, got %s", jsonKind(value))
+			} else if _, err := regexp.Compile(pattern); err != nil {
+				v.add(operatorPath, operator, "invalid regular expression: %v", err)
+			}
+		default:
+			v.add(operatorPath, operator, "unknown comparison operator '%s'", operator)
+		}
+	}
+}
+
+// exprCriteria checks a $expr criterion such as {"$lt": [{"$field": "a"}, {"$field": "b"}]}
+func (v *flowValidator) exprCriteria(value interface{}, path string) {
+	expression, ok := v.object(value, path, "$expr")
+	if !ok {
+		return
+	}
+	for _, operator := range sortedKeys(expression) {
+		operatorPath := pointer(path, operator)
+		if !resolvesOperands[operator] {
+			v.add(operatorPath, operator, "unsupported $expr operator '%s'", operator)
+			continue
+		}
+		operands, ok := expression[operator].([]interface{})
+		if !ok || len(operands) != 2 {
+			v.add(operatorPath, operator, "%s in $expr requires exactly two operands", operator)
+			continue
+		}
+		v.operand(operands, operatorPath)
+	}
+}
+
+// operand checks a compared value, which may compute a value from the event such as {"$field": "estimated_hours"}
+func (v *flowValidator) operand(value interface{}, path string) {
+	if array, ok := value.([]interface{}); ok {
+		for i, element := range array {
+			v.operand(element, pointer(path, i))
+		}
+		return
+	}
+
+	operator, argument, ok := operandExpression(value)
+	if !ok {
+		// A single unknown $-prefixed key is almost certainly a misspelt operand rather than a literal
+		if object, isObject := value.(map[string]interface{}); isObject && len(object) == 1 {
+			for key := range object {
+				if strings.HasPrefix(key, "$") {
+					v.add(pointer(path, key), key, "unknown operand operator '%s'", key)
+				}
+			}
+		}
+		return
+	}
+
+	argumentPath := pointer(path, operator)
+	switch operator {
+	case "$field":
+		field, ok := argument.(string)
+		if !ok {
+			v.add(argumentPath, operator, "$field requires a field name, got %s", jsonKind(argument))
+		} else if _, err := parseFieldPath(field); err != nil {
+			v.add(argumentPath, operator, "%v", err)
+		}
+	case "$add", "$mul", "$sub", "$div":
+		operands, ok := argument.([]interface{})
+		switch {
+		case !ok:
+			v.add(argumentPath, operator, "%s requires an array of operands, got %s", operator, jsonKind(argument))
+		case (operator == "$add" || operator == "$mul") && len(operands) < 2:
+			v.add(argumentPath, operator, "%s requires at least two operands", operator)
+		case (operator == "$sub" || operator == "$div") && len(operands) != 2:
+			v.add(argumentPath, operator, "%s requires exactly two operands", operator)
+		default:
+			v.operand(operands, argumentPath)
+		}
+	default: // $lower, $len
+		v.operand(argument, argumentPath)
+	}
+}
+
+// numericCriteria checks an object comparing a computed number, such as {"$gte": 5}
+func (v *flowValidator) numericCriteria(value interface{}, path, keyword string) {
+	criteria, ok := v.object(value, path, keyword)
+	if !ok {
+		return
+	}
+	for _, operator := range sortedKeys(criteria) {
+		operatorPath := pointer(path, operator)
+		if !contains(numericOperators, operator) {
+			v.add(operatorPath, operator, "unknown numeric operator '%s'", operator)
+			continue
+		}
+		if _, err := toFloat64(criteria[operator]); err != nil {
+			v.add(operatorPath, operator, "%s requires a number, got %s", operator, jsonKind(criteria[operator]))
+		}
+	}
+}
+
+// timeValue checks a time given as an RFC3339 timestamp or a time variable such as "$NOW(-7d)"
+func (v *flowValidator) timeValue(value interface{}, path, keyword string) {
+	str, ok := value.(string)
+	if !ok {
+		v.add(path, keyword, "time must be an RFC3339 timestamp or a $NOW variable, got %s", jsonKind(value))
+		return
+	}
+	if IsDynamicTimeVariable(str) {
+		if _, err := ParseDynamicTimeVariable(str, NewTimeVariableCache()); err != nil {
+			v.add(path, "$NOW", "%v", err)
+		}
+		return
+	}
+	if _, err := time.Parse(time.RFC3339, str); err != nil {
+		v.add(path, keyword, "time '%s' is neither an RFC3339 timestamp nor a $NOW variable", str)
+	}
+}
+
+// enum checks that a setting is one of its accepted values
+func (v *flowValidator) enum(criteria map[string]interface{}, field, path string, values []string) {
+	value, ok := criteria[field].(string)
+	if ok && !contains(values, value) {
+		v.add(pointer(path, field), field, "%s must be one of %s, got '%s'", field, strings.Join(values, ", "), value)
+	}
+}
+
+// required reports the fields an operator needs that its criteria lack
+func (v *flowValidator) required(criteria map[string]interface{}, path, operator string, fields ...string) {
+	for _, field := range fields {
+		if _, ok := criteria[field]; !ok {
+			v.add(path, field, "%s requires '%s'", operator, field)
+		}
+	}
+}
+
+// fields checks the fields of an operator's criteria against the struct in models describing them:
+// fields the struct does not declare, other than the extra ones, and values of the wrong JSON type
+func (v *flowValidator) fields(criteria map[string]interface{}, path, operator string, shape interface{}, extra ...string) {
+	declared := make(map[string]reflect.Type)
+	shapeType := reflect.TypeOf(shape)
+	for i := 0; i < shapeType.NumField(); i++ {
+		name := strings.Split(shapeType.Field(i).Tag.Get("json"), ",")[0]
+		declared[name] = shapeType.Field(i).Type
+	}
+
+	for _, field := range sortedKeys(criteria) {
+		fieldType, ok := declared[field]
+		if !ok {
+			if !contains(extra, field) {
+				v.add(pointer(path, field), field, "unknown field '%s' in %s", field, operator)
+			}
+			continue
+		}
+		if expected := jsonKindOf(fieldType); expected != jsonKind(criteria[field]) {
+			v.add(pointer(path, field), field, "%s must be %s, got %s", field, withArticle(expected), jsonKind(criteria[field]))
+			continue
+		}
+
+		// Lists such as a sequence of event types or holidays hold strings
+		if elements, ok := criteria[field].([]interface{}); ok && fieldType.Elem().Kind() == reflect.String {
+			for i, element := range elements {
+				if _, ok := element.(string); !ok {
+					v.add(pointer(pointer(path, field), i), field, "%s must hold strings, got %s", field, jsonKind(element))
+				}
+			}
+		}
+	}
+}
+
+// timePeriod checks a $timePeriod operator
+func (v *flowValidator) timePeriod(value interface{}, path string) {
+	criteria, ok := v.object(value, path, "$timePeriod")
+	if !ok {
+		return
+	}
+	v.fields(criteria, path, "$timePeriod", models.TimePeriodCriteria{})
+	v.required(criteria, path, "$timePeriod", "periodType")
+	v.enum(criteria, "periodType", path, periodTypes)
+	if periodCount, ok := criteria["periodCount"].(map[string]interface{}); ok {
+		v.numericCriteria(periodCount, pointer(path, "periodCount"), "periodCount")
+	}
+	v.holidays(criteria, path)
+	if timezone, ok := criteria["timezone"].(string); ok {
+		v.timezone(timezone, pointer(path, "timezone"), "timezone")
+	}
+}
+
+// holidays checks that the holidays of a time-based operator are YYYY-MM-DD dates and that
+// the holiday calendar it names exists
+func (v *flowValidator) holidays(criteria map[string]interface{}, path string) {
+	holidays, _ := criteria["holidays"].([]interface{})
+	for i, holiday := range holidays {
+		if day, ok := holiday.(string); ok {
+			if _, err := time.Parse("2006-01-02", day); err != nil {
+				v.add(pointer(pointer(path, "holidays"), i), "holidays", "holiday '%s' is not a YYYY-MM-DD date", day)
+			}
+		}
+	}
+	excludeHolidays, _ := criteria["excludeHolidays"].(bool)
+	v.holidayCalendar(criteria, path, excludeHolidays, "excludeHolidays")
+}
+
+// holidayCalendar checks that the holiday calendar named by a time-based operator exists and
+// that the operator's setting named by requirement, which makes it skip holidays, is enabled
+func (v *flowValidator) holidayCalendar(criteria map[string]interface{}, path string, enabled bool, requirement string) {
+	name, ok := criteria["holidayCalendar"].(string)
+	if !ok {
+		return
+	}
+	path = pointer(path, "holidayCalendar")
+
+	exists, checked := v.holidayCalendars[name]
+	if !checked {
+		_, err := v.db.GetHolidayCalendarByName(name)
+		exists = err == nil
+		v.holidayCalendars[name] = exists
+	}
+	if !exists {
+		v.add(path, "holidayCalendar", "holiday calendar '%s' not found", name)
+	}
+	if !enabled {
+		v.add(path, "holidayCalendar", "holidayCalendar only applies with %s", requirement)
+	}
+}
+
+// pattern checks a $pattern operator
+func (v *flowValidator) pattern(value interface{}, path string) {
+	criteria, ok := v.object(value, path, "$pattern")
+	if !ok {
+		return
+	}
+	v.fields(criteria, path, "$pattern", models.PatternCriteria{})
+	v.required(criteria, path, "$pattern", "pattern", "periodType")
+	v.enum(criteria, "pattern", path, patternTypes)
+	v.enum(criteria, "periodType", path, periodTypes)
+	if timezone, ok := criteria["timezone"].(string); ok {
+		v.timezone(timezone, pointer(path, "timezone"), "timezone")
+	}
+}
+
+// streak checks a $streak operator
+func (v *flowValidator) streak(value interface{}, path string) {
+	criteria, ok := v.object(value, path, "$streak")
+	if !ok {
+		return
+	}
+	v.fields(criteria, path, "$streak", models.StreakCriteria{})
+	v.required(criteria, path, "$streak", "periodType")
+	v.enum(criteria, "periodType", path, periodTypes)
+	if eventType, ok := criteria["event"].(string); ok {
+		v.eventType(eventType, pointer(path, "event"))
+	}
+	if eventCriteria, ok := criteria["criteria"].(map[string]interface{}); ok {
+		v.eventCriteria(eventCriteria, pointer(path, "criteria"))
+	}
+	for _, field := range []string{"current", "longest"} {
+		if comparison, ok := criteria[field].(map[string]interface{}); ok {
+			v.numericCriteria(comparison, pointer(path, field), field)
+		}
+	}
+	if freezes, ok := criteria["freezes"].(float64); ok && (freezes < 0 || freezes != math.Trunc(freezes)) {
+		v.add(pointer(path, "freezes"), "freezes", "freezes must be a whole number of periods, got %v", freezes)
+	}
+	if periodType, _ := criteria["periodType"].(string); periodType != "day" {
+		for _, field := range []string{"excludeWeekends", "excludeHolidays"} {
+			if exclude, _ := criteria[field].(bool); exclude {
+				v.add(pointer(path, field), field, "%s only applies to daily streaks", field)
+			}
+		}
+	}
+	v.holidays(criteria, path)
+	if timezone, ok := criteria["timezone"].(string); ok {
+		v.timezone(timezone, pointer(path, "timezone"), "timezone")
+	}
+}
+
+// sequence checks a $sequence operator
+func (v *flowValidator) sequence(value interface{}, path string) {
+	criteria, ok := v.object(value, path, "$sequence")
+	if !ok {
+		return
+	}
+	v.fields(criteria, path, "$sequence", models.SequenceCriteria{})
+	v.required(criteria, path, "$sequence", "sequence")
+	sequence, ok := criteria["sequence"].([]interface{})
+	if !ok {
+		return
+	}
+	if len(sequence) == 0 {
+		v.add(pointer(path, "sequence"), "sequence", "sequence must not be empty")
+	}
+	for i, item := range sequence {
+		if eventType, ok := item.(string); ok {
+			v.eventType(eventType, pointer(pointer(path, "sequence"), i))
+		}
+	}
+}
+
+// gap checks a $gap operator
+func (v *flowValidator) gap(value interface{}, path string) {
+	criteria, ok := v.object(value, path, "$gap")
+	if !ok {
+		return
+	}
+	v.fields(criteria, path, "$gap", models.GapCriteria{})
+	v.required(criteria, path, "$gap", "maxGapHours")
+	v.enum(criteria, "periodType", path, gapPeriodTypes)
+	periodType, _ := criteria["periodType"].(string)
+	v.holidayCalendar(criteria, path, periodType == "business-days", "periodType 'business-days'")
+	if excludeConditions, ok := criteria["excludeConditions"].(map[string]interface{}); ok {
+		v.eventCriteria(excludeConditions, pointer(path, "excludeConditions"))
+	}
+}
+
+// duration checks a $duration operator
+func (v *flowValidator) duration(value interface{}, path string) {
+	criteria, ok := v.object(value, path, "$duration")
+	if !ok {
+		return
+	}
+	v.fields(criteria, path, "$duration", models.DurationCriteria{})
+	v.required(criteria, path, "$duration", "startEvent", "endEvent")
+	v.enum(criteria, "unit", path, durationUnits)
+	for _, field := range []string{"startEvent", "endEvent"} {
+		if eventCriteria, ok := criteria[field].(map[string]interface{}); ok {
+			v.eventCriteria(eventCriteria, pointer(path, field))
+		}
+	}
+	if duration, ok := criteria["duration"].(map[string]interface{}); ok {
+		v.numericCriteria(duration, pointer(path, "duration"), "duration")
+	}
+}
+
+// aggregate checks an $aggregate operator
+func (v *flowValidator) aggregate(value interface{}, path string) {
+	criteria, ok := v.object(value, path, "$aggregate")
+	if !ok {
+		return
+	}
+	v.fields(criteria, path, "$aggregate", models.AggregationCriteria{})
+	v.required(criteria, path, "$aggregate", "type", "field")
+	v.enum(criteria, "type", path, aggregationTypes)
+	if field, ok := criteria["field"].(string); ok {
+		if _, err := parseFieldPath(field); err != nil {
+			v.add(pointer(path, "field"), "field", "%v", err)
+		}
+	}
+	if aggregateValue, ok := criteria["value"].(map[string]interface{}); ok {
+		v.numericCriteria(aggregateValue, pointer(path, "value"), "value")
+	}
+	if window, ok := criteria["timeWindow"].(map[string]interface{}); ok {
+		windowPath := pointer(path, "timeWindow")
+		v.fields(window, windowPath, "timeWindow", models.TimeWindowCriteria{})
+		v.windowBounds(window, windowPath)
+		businessDaysOnly, _ := window["businessDaysOnly"].(bool)
+		v.holidayCalendar(window, windowPath, businessDaysOnly, "businessDaysOnly")
+	}
+}
+
+// timeWindow checks a $timeWindow operator and the flow it applies to
+func (v *flowValidator) timeWindow(value interface{}, path string) {
+	criteria, ok := v.object(value, path, "$timeWindow")
+	if !ok {
+		return
+	}
+	v.fields(criteria, path, "$timeWindow", models.TimeWindowCriteria{}, "flow")
+	v.windowBounds(criteria, path)
+	businessDaysOnly, _ := criteria["businessDaysOnly"].(bool)
+	v.holidayCalendar(criteria, path, businessDaysOnly, "businessDaysOnly")
+	if flow, ok := criteria["flow"]; !ok {
+		v.add(path, "flow", "$timeWindow requires a 'flow'")
+	} else if _, ok := v.object(flow, pointer(path, "flow"), "flow"); ok {
+		v.flow(flow, pointer(path, "flow"))
+	}
+}
+
+// windowBounds checks the start, end and last settings of a time window
+func (v *flowValidator) windowBounds(window map[string]interface{}, path string) {
+	for _, field := range []string{"start", "end"} {
+		if bound, ok := window[field].(string); ok {
+			v.timeValue(bound, pointer(path, field), field)
+		}
+	}
+	if last, ok := window["last"].(string); ok && !lastDurationRegex.MatchString(last) {
+		v.add(pointer(path, "last"), "last", "invalid duration '%s', expected a number followed by d, w, m, q or y", last)
+	}
+}
+
+// hasBadge checks a $hasBadge operator: a badge reference or {"badge": ..., "tier": 2, "within": "30d"}
+func (v *flowValidator) hasBadge(value interface{}, path string) {
+	badge := value
+	if criteria, ok := value.(map[string]interface{}); ok {
+		badge = criteria["badge"]
+		v.awardFilter(criteria, path, "$hasBadge", "badge")
+		path = pointer(path, "badge")
+	}
+	if _, err := parseBadgeRef(badge); err != nil {
+		v.add(path, "$hasBadge", "%v", err)
+	}
+}
+
+// badgeCount checks a $badgeCount operator
+func (v *flowValidator) badgeCount(value interface{}, path string) {
+	criteria, ok := v.object(value, path, "$badgeCount")
+	if !ok {
+		return
+	}
+	v.awardFilter(criteria, path, "$badgeCount", "badges", "count")
+	v.required(criteria, path, "$badgeCount", "badges", "count")
+
+	if badges, ok := criteria["badges"]; ok {
+		list, ok := badges.([]interface{})
+		if !ok || len(list) == 0 {
+			v.add(pointer(path, "badges"), "badges", "$badgeCount requires a non-empty 'badges' array")
+		}
+		for i, badge := range list {
+			if _, err := parseBadgeRef(badge); err != nil {
+				v.add(pointer(pointer(path, "badges"), i), "badges", "%v", err)
+			}
+		}
+	}
+	if count, ok := criteria["count"]; ok {
+		v.numericCriteria(count, pointer(path, "count"), "count")
+	}
+}
+
+// awardFilter checks the "tier" and "within" settings of a badge operator and reports unknown fields
+func (v *flowValidator) awardFilter(criteria map[string]interface{}, path, operator string, fields ...string) {
+	for _, field := range sortedKeys(criteria) {
+		if field == "tier" || field == "within" || contains(fields, field) {
+			continue
+		}
+		v.add(pointer(path, field), field, "unknown field '%s' in %s", field, operator)
+	}
+	for _, field := range []string{"tier", "within"} {
+		if setting, ok := criteria[field]; ok {
+			if _, err := parseAwardFilter(map[string]interface{}{field: setting}); err != nil {
+				v.add(pointer(path, field), field, "%v", err)
+			}
+		}
+	}
+}
+
+// condition checks a $condition call against the parameters its condition type declares
+func (v *flowValidator) condition(value interface{}, path string) {
+	name, params, err := parseConditionCall(value)
+	if err != nil {
+		v.add(path, "$condition", "%v", err)
+		return
+	}
+	for _, field := range sortedKeys(value.(map[string]interface{})) {
+		if field != "name" && field != "params" {
+			v.add(pointer(path, field), field, "unknown field '%s' in $condition", field)
+		}
+	}
+
+	conditionType, err := v.db.GetConditionTypeByName(name)
+	if err != nil {
+		v.add(pointer(path, "name"), "$condition", "condition type '%s' not found", name)
+		return
+	}
+	if _, err := bindConditionParams(conditionType, params); err != nil {
+		v.add(pointer(path, "params"), "$condition", "%v", err)
+	}
+}
+
+// expression checks that an $expression compiles
+func (v *flowValidator) expression(value interface{}, path string) {
+	source, ok := value.(string)
+	if !ok {
+		v.add(path, "$expression", "$expression requires an expression string, got %s", jsonKind(value))
+		return
+	}
+	if _, err := expr.Compile(source); err != nil {
+		v.add(path, "$expression", "%v", err)
+	}
+}
+
+// jsonKind returns the JSON type of a decoded value
+func jsonKind(value interface{}) string {
+	switch value.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case string:
+		return "string"
+	case map[string]interface{}:
+		return "object"
+	case []interface{}:
+		return "array"
+	}
+	if _, err := toFloat64(value); err == nil {
+		return "number"
+	}
+	return fmt.Sprintf("%T", value)
+}
+
+// jsonKindOf returns the JSON type a Go struct field is decoded from
+func jsonKindOf(fieldType reflect.Type) string {
+	switch fieldType.Kind() {
+	case reflect.String:
+		return "string"
+	case reflect.Bool:
+		return "boolean"
+	case reflect.Map, reflect.Struct:
+		return "object"
+	case reflect.Slice, reflect.Array:
+		return "array"
+	default:
+		return "number"
+	}
+}
+
+// withArticle prefixes a JSON type name with an indefinite article
+func withArticle(kind string) string {
+	if strings.IndexAny(kind[:1], "aeiou") == 0 {
+		return "an " + kind
+	}
+	return "a " + kind
+}
@@ -0,0 +1,140 @@
+package engine
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/badge-assignment-system/internal/models"
+	"github.com/stretchr/testify/assert"
+)
+
+// knownEventsDB only knows the check-in and check-out event types
+type knownEventsDB struct {
+	awardingDB
+}
+
+func (db *knownEventsDB) GetEventTypeByName(name string) (models.EventType, error) {
+	if name != "check-in" && name != "check-out" {
+		return models.EventType{}, fmt.Errorf("event type %s not found", name)
+	}
+	return models.EventType{ID: 1, Name: name}, nil
+}
+
+func TestValidateFlowAcceptsValidFlows(t *testing.T) {
+	db := &knownEventsDB{awardingDB{conditions: []models.ConditionType{earlyCheckIn(t)}, calendars: []models.HolidayCalendar{{Name: "us-federal"}}}}
+
+	flows := []string{
+		`{"event": "check-in", "criteria": {"$eventCount": {"$gte": 5}}}`,
+		`{"event": "check-in", "criteria": {
+			"time": {"$lt": "09:00:00"},
+			"project.tags": {"$all": ["urgent"], "$size": {"$gte": 1}},
+			"items": {"$elemMatch": {"sku": {"$regex": "^A-[0-9]+$"}, "qty": {"$gt": {"$field": "minimum"}}}},
+			"timestamp": {"$gte": "$NOW(-30d)", "$lt": "2030-01-01T00:00:00Z"},
+			"$expr": {"$lt": [{"$field": "actual_hours"}, {"$mul": [{"$field": "estimate"}, 1.5]}]}
+		}}`,
+		`{"$and": [
+			{"$timePeriod": {"periodType": "week", "periodCount": {"$gte": 4}, "excludeWeekends": true, "holidays": ["2024-12-25"]}},
+			{"$not": {"$pattern": {"pattern": "decreasing", "periodType": "month", "maxDecreasePct": 10}}},
+			{"$or": [
+				{"$sequence": {"sequence": ["check-in", "check-out"], "maxGapSeconds": 3600}},
+				{"$gap": {"maxGapHours": 48, "periodType": "business-days", "excludeConditions": {"remote": true}}},
+				{"$duration": {"startEvent": {"kind": "start"}, "endEvent": {"kind": "end"}, "duration": {"$lte": 8}, "unit": "hours"}}
+			]}
+		]}`,
+		`{"$and": [
+			{"event": "check-in", "criteria": {"$timeOfDay": {"$lt": "09:00:00"}, "$dayOfWeek": {"$nin": ["saturday", "sunday"]}, "$timezone": "Europe/Paris"}},
+			{"$timePeriod": {"periodType": "day", "periodCount": {"$gte": 5}, "timezone": "America/New_York"}},
+			{"$pattern": {"pattern": "consistent", "periodType": "week", "timezone": "UTC"}}
+		]}`,
+		`{"$streak": {"periodType": "day", "event": "check-in", "criteria": {"$timeOfDay": {"$lt": "09:00:00"}}, "current": {"$gte": 5},
+			"longest": {"$gte": 10}, "freezes": 1, "excludeWeekends": true, "excludeHolidays": true, "holidays": ["2024-12-25"]}}`,
+		`{"$timeWindow": {"last": "30d", "businessDaysOnly": true, "holidayCalendar": "us-federal", "flow": {"$and": [
+			{"$timePeriod": {"periodType": "day", "excludeHolidays": true, "holidayCalendar": "us-federal"}},
+			{"$gap": {"maxGapHours": 24, "periodType": "business-days", "holidayCalendar": "us-federal"}}
+		]}}}`,
+		`{"$timeWindow": {"last": "2w", "flow": {"$aggregate": {"type": "avg", "field": "hours", "value": {"$gte": 6}, "timeWindow": {"start": "$NOW(-1y)"}}}}}`,
+		`{"$or": [
+			{"$hasBadge": {"badge": "Early Bird", "tier": 2, "within": "30d"}},
+			{"$badgeCount": {"badges": ["Night Owl", 4], "count": {"$gte": 2}}},
+			{"$condition": {"name": "early-checkin", "params": {"before": "09:00:00"}}},
+			{"$expression": "count(events) > 10"}
+		]}`,
+	}
+
+	for _, flow := range flows {
+		assert.Empty(t, ValidateFlow(db, decodeJSONB(t, flow)), flow)
+	}
+}
+
+func TestValidateFlowReportsProblems(t *testing.T) {
+	db := &knownEventsDB{awardingDB{conditions: []models.ConditionType{earlyCheckIn(t)}, calendars: []models.HolidayCalendar{{Name: "us-federal"}}}}
+
+	tests := []struct {
+		name    string
+		flow    string
+		path    string
+		message string
+	}{
+		{"misspelt count operator", `{"event": "check-in", "criteria": {"$evntCount": {"$gte": 5}}}`, "/criteria/$evntCount", "unknown operator '$evntCount'"},
+		{"unknown event type", `{"event": "check_in", "criteria": {}}`, "/event", "event type 'check_in' not found"},
+		{"missing criteria", `{"event": "check-in"}`, "", "missing 'criteria'"},
+		{"unknown period type", `{"$timePeriod": {"periodType": "fortnight"}}`, "/$timePeriod/periodType", "periodType must be one of day, week, month, quarter, year"},
+		{"unknown field", `{"$timePeriod": {"periodType": "day", "excludeWeekend": true}}`, "/$timePeriod/excludeWeekend", "unknown field 'excludeWeekend'"},
+		{"wrong field type", `{"$gap": {"maxGapHours": "48"}}`, "/$gap/maxGapHours", "maxGapHours must be a number, got string"},
+		{"missing required field", `{"$pattern": {"pattern": "consistent"}}`, "/$pattern", "$pattern requires 'periodType'"},
+		{"unknown sequence event", `{"$sequence": {"sequence": ["check-in", "lunch"]}}`, "/$sequence/sequence/1", "event type 'lunch' not found"},
+		{"invalid time variable", `{"event": "check-in", "criteria": {"timestamp": {"$gte": "$NOW(-30days)"}}}`, "/criteria/timestamp/$gte", "invalid $NOW syntax"},
+		{"invalid timestamp", `{"$timeWindow": {"start": "yesterday", "flow": {"event": "check-in", "criteria": {}}}}`, "/$timeWindow/start", "neither an RFC3339 timestamp nor a $NOW variable"},
+		{"invalid last duration", `{"$timeWindow": {"last": "30 days", "flow": {"event": "check-in", "criteria": {}}}}`, "/$timeWindow/last", "invalid duration '30 days'"},
+		{"invalid regex", `{"event": "check-in", "criteria": {"sku": {"$regex": "A-[0-9"}}}`, "/criteria/sku/$regex", "invalid regular expression"},
+		{"unknown comparison", `{"event": "check-in", "criteria": {"hours": {"$gtr": 5}}}`, "/criteria/hours/$gtr", "unknown comparison operator '$gtr'"},
+		{"misspelt operand", `{"event": "check-in", "criteria": {"hours": {"$gt": {"$feild": "minimum"}}}}`, "/criteria/hours/$gt/$feild", "unknown operand operator '$feild'"},
+		{"nested problem", `{"$and": [{"event": "check-in", "criteria": {}}, {"$or": [{"$nto": {}}]}]}`, "/$and/1/$or/0/$nto", "unknown operator '$nto'"},
+		{"two operators", `{"$and": [], "$or": []}`, "", "a flow node must have a single operator, found $and, $or"},
+		{"invalid badge reference", `{"$badgeCount": {"badges": ["Early Bird", 0], "count": {"$gte": 1}}}`, "/$badgeCount/badges/1", "invalid badge reference"},
+		{"invalid condition call", `{"$condition": {"name": "early-checkin", "params": {"days": 3}}}`, "/$condition/params", "missing required parameter 'before'"},
+		{"invalid expression", `{"$expression": "count(events) >"}`, "/$expression", "invalid expression"},
+		{"unknown timezone", `{"$timePeriod": {"periodType": "day", "timezone": "Mars/Olympus"}}`, "/$timePeriod/timezone", "unknown timezone 'Mars/Olympus'"},
+		{"unknown criteria timezone", `{"event": "check-in", "criteria": {"$timezone": "EST5"}}`, "/criteria/$timezone", "unknown timezone 'EST5'"},
+		{"invalid time of day", `{"event": "check-in", "criteria": {"$timeOfDay": {"$lt": "9am"}}}`, "/criteria/$timeOfDay/$lt", "'9am' is not an HH:MM:SS time"},
+		{"invalid weekday", `{"event": "check-in", "criteria": {"$dayOfWeek": {"$in": ["monday", "funday"]}}}`, "/criteria/$dayOfWeek/$in/1", "'funday' is not a weekday name"},
+		{"unknown streak event", `{"$streak": {"periodType": "day", "event": "check_in"}}`, "/$streak/event", "event type 'check_in' not found"},
+		{"negative freezes", `{"$streak": {"periodType": "day", "freezes": -1}}`, "/$streak/freezes", "freezes must be a whole number"},
+		{"weekly streak without weekends", `{"$streak": {"periodType": "week", "excludeWeekends": true}}`, "/$streak/excludeWeekends", "excludeWeekends only applies to daily streaks"},
+		{"unknown holiday calendar", `{"$timePeriod": {"periodType": "day", "excludeHolidays": true, "holidayCalendar": "uk-bank"}}`, "/$timePeriod/holidayCalendar", "holiday calendar 'uk-bank' not found"},
+		{"holiday calendar without exclusion", `{"$streak": {"periodType": "day", "holidayCalendar": "us-federal"}}`, "/$streak/holidayCalendar", "holidayCalendar only applies with excludeHolidays"},
+		{"holiday calendar on calendar-time gaps", `{"$gap": {"maxGapHours": 24, "holidayCalendar": "us-federal"}}`, "/$gap/holidayCalendar", "holidayCalendar only applies with periodType 'business-days'"},
+		{"escaped pointer", `{"event": "check-in", "criteria": {"a/b": {"$in": "x"}}}`, "/criteria/a~1b/$in", "$in requires an array"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			violations := ValidateFlow(db, decodeJSONB(t, tt.flow))
+			if assert.Len(t, violations, 1) {
+				assert.Equal(t, tt.path, violations[0].Path)
+				assert.Contains(t, violations[0].Message, tt.message)
+			}
+		})
+	}
+}
+
+func TestValidateFlowReportsEveryProblem(t *testing.T) {
+	db := &knownEventsDB{}
+
+	violations := ValidateFlow(db, decodeJSONB(t, `{"$and": [
+		{"event": "check-in", "criteria": {"$evntCount": {"$gte": 5}}},
+		{"$timePeriod": {"periodType": "fortnight"}},
+		{"event": "bug-report", "criteria": {"timestamp": {"$gte": "$NOW(30d)"}}}
+	]}`))
+
+	var paths []string
+	for _, violation := range violations {
+		paths = append(paths, violation.Path)
+	}
+	assert.Equal(t, []string{
+		"/$and/0/criteria/$evntCount",
+		"/$and/1/$timePeriod/periodType",
+		"/$and/2/event",
+		"/$and/2/criteria/timestamp/$gte",
+	}, paths)
+}
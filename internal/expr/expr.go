@@ -0,0 +1,342 @@
+// Package expr evaluates badge criteria written in CEL, the Common Expression Language,
+// as a more readable alternative to JSON flow definitions. Expressions are type-checked
+// when compiled and evaluated with a cost limit, so a bad rule cannot stall event processing.
+//
+// An expression sees the user's events and the evaluation time:
+//
+//	events    list of {"id", "type", "occurred_at", "payload"} maps, oldest first
+//	now       the evaluation time
+//	user_id   the user being evaluated
+//
+// and can use these helpers besides the CEL standard library:
+//
+//	count(list) int                    number of elements
+//	distinctDays(events) int           number of distinct days with an event
+//	sum(list) double                   sum of a list of numbers
+//	within(events, start) list         events at or after a time variable, e.g. "$NOW(-7d)"
+//	within(events, start, end) list    events between two time variables
+//
+// For example: count(within(events.filter(e, e.type == "check-in"), "$NOW(-30d)")) >= 20
+package expr
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/google/cel-go/cel"
+	"github.com/google/cel-go/common/functions"
+	"github.com/google/cel-go/common/types"
+	"github.com/google/cel-go/common/types/ref"
+	"github.com/google/cel-go/common/types/traits"
+)
+
+// DefaultCostLimit bounds the work an expression may do in one evaluation. Each event
+// visited by a macro such as filter or exists costs a few units.
+const DefaultCostLimit uint64 = 1000000
+
+// maxCachedPrograms bounds the number of compiled expressions kept in memory
+const maxCachedPrograms = 1024
+
+// Overload IDs of the helper functions; their implementations are bound per evaluation
+const (
+	countOverload        = "count_list"
+	distinctDaysOverload = "distinctDays_list"
+	sumOverload          = "sum_list"
+	withinOverload       = "within_list_string"
+	withinRangeOverload  = "within_list_string_string"
+)
+
+var (
+	envOnce sync.Once
+	env     *cel.Env
+	envErr  error
+
+	cacheMu sync.Mutex
+	cache   = make(map[string]*Program)
+)
+
+// Event is an event as seen by expressions
+type Event struct {
+	ID         int
+	Type       string
+	OccurredAt time.Time
+	Payload    map[string]interface{}
+}
+
+// Input is what an expression is evaluated against
+type Input struct {
+	UserID string
+	Now    time.Time
+	Events []Event
+	// ResolveTime resolves time variables such as "$NOW(-7d)" for within()
+	ResolveTime func(value string) (time.Time, error)
+	// CostLimit overrides DefaultCostLimit when set
+	CostLimit uint64
+}
+
+// Result is the outcome of evaluating an expression
+type Result struct {
+	Matched bool
+	Cost    uint64 // Cost of the evaluation, comparable to the cost limit
+}
+
+// Program is a compiled, type-checked expression
+type Program struct {
+	source string
+	ast    *cel.Ast
+}
+
+// Source returns the expression the program was compiled from
+func (p *Program) Source() string {
+	return p.source
+}
+
+// environment returns the CEL environment shared by all expressions
+func environment() (*cel.Env, error) {
+	envOnce.Do(func() {
+		listType := cel.ListType(cel.DynType)
+		eventsType := cel.ListType(cel.MapType(cel.StringType, cel.DynType))
+		env, envErr = cel.NewEnv(
+			cel.Variable("events", eventsType),
+			cel.Variable("now", cel.TimestampType),
+			cel.Variable("user_id", cel.StringType),
+			cel.Function("count", cel.Overload(countOverload, []*cel.Type{listType}, cel.IntType)),
+			cel.Function("distinctDays", cel.Overload(distinctDaysOverload, []*cel.Type{listType}, cel.IntType)),
+			cel.Function("sum", cel.Overload(sumOverload, []*cel.Type{listType}, cel.DoubleType)),
+			cel.Function("within",
+				cel.Overload(withinOverload, []*cel.Type{eventsType, cel.StringType}, eventsType),
+				cel.Overload(withinRangeOverload, []*cel.Type{eventsType, cel.StringType, cel.StringType}, eventsType)),
+		)
+	})
+	return env, envErr
+}
+
+// Compile parses and type-checks an expression, which must evaluate to a boolean.
+// Compiled expressions are cached, so compiling the same expression again is cheap.
+func Compile(source string) (*Program, error) {
+	cacheMu.Lock()
+	program, ok := cache[source]
+	cacheMu.Unlock()
+	if ok {
+		return program, nil
+	}
+
+	if source == "" {
+		return nil, errors.New("expression is empty")
+	}
+
+	celEnv, err := environment()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create expression environment: %w", err)
+	}
+
+	ast, issues := celEnv.Compile(source)
+	if issues != nil && issues.Err() != nil {
+		return nil, fmt.Errorf("invalid expression: %w", issues.Err())
+	}
+	if !ast.OutputType().IsExactType(cel.BoolType) {
+		return nil, fmt.Errorf("expression must evaluate to a bool, not %s", ast.OutputType())
+	}
+
+	program = &Program{source: source, ast: ast}
+	cacheMu.Lock()
+	if len(cache) >= maxCachedPrograms {
+		cache = make(map[string]*Program)
+	}
+	cache[source] = program
+	cacheMu.Unlock()
+	return program, nil
+}
+
+// Eval evaluates the expression against the input
+func (p *Program) Eval(input Input) (Result, error) {
+	celEnv, err := environment()
+	if err != nil {
+		return Result{}, fmt.Errorf("failed to create expression environment: %w", err)
+	}
+
+	costLimit := input.CostLimit
+	if costLimit == 0 {
+		costLimit = DefaultCostLimit
+	}
+
+	prg, err := celEnv.Program(p.ast, cel.CostLimit(costLimit), cel.Functions(helpers(input)...))
+	if err != nil {
+		return Result{}, fmt.Errorf("failed to prepare expression: %w", err)
+	}
+
+	events := make([]map[string]interface{}, len(input.Events))
+	for i, event := range input.Events {
+		payload := event.Payload
+		if payload == nil {
+			payload = map[string]interface{}{}
+		}
+		events[i] = map[string]interface{}{
+			"id":          event.ID,
+			"type":        event.Type,
+			"occurred_at": event.OccurredAt,
+			"payload":     payload,
+		}
+	}
+
+	out, details, err := prg.Eval(map[string]interface{}{
+		"events":  events,
+		"now":     input.Now,
+		"user_id": input.UserID,
+	})
+
+	var result Result
+	if details != nil && details.ActualCost() != nil {
+		result.Cost = *details.ActualCost()
+	}
+	if err != nil {
+		return result, fmt.Errorf("expression evaluation failed: %w", err)
+	}
+
+	matched, ok := out.Value().(bool)
+	if !ok {
+		return result, fmt.Errorf("expression returned %v instead of a bool", out.Value())
+	}
+	result.Matched = matched
+	return result, nil
+}
+
+// helpers binds the helper functions to an evaluation's input
+func helpers(input Input) []*functions.Overload {
+	resolve := func(value ref.Val) (time.Time, error) {
+		str, ok := value.Value().(string)
+		if !ok {
+			return time.Time{}, fmt.Errorf("time variable must be a string, got %v", value.Value())
+		}
+		if input.ResolveTime == nil {
+			return time.Time{}, errors.New("time variables are not available")
+		}
+		return input.ResolveTime(str)
+	}
+
+	return []*functions.Overload{
+		{
+			Operator: countOverload,
+			Unary: func(value ref.Val) ref.Val {
+				return value.(traits.Sizer).Size()
+			},
+		},
+		{
+			Operator: distinctDaysOverload,
+			Unary: func(value ref.Val) ref.Val {
+				days := make(map[string]bool)
+				err := eachElement(value, func(element ref.Val) error {
+					occurredAt, err := occurredAt(element)
+					if err != nil {
+						return err
+					}
+					days[occurredAt.Format("2006-01-02")] = true
+					return nil
+				})
+				if err != nil {
+					return types.NewErr("distinctDays: %v", err)
+				}
+				return types.Int(len(days))
+			},
+		},
+		{
+			Operator: sumOverload,
+			Unary: func(value ref.Val) ref.Val {
+				var total float64
+				err := eachElement(value, func(element ref.Val) error {
+					switch number := element.Value().(type) {
+					case float64:
+						total += number
+					case int64:
+						total += float64(number)
+					case uint64:
+						total += float64(number)
+					default:
+						return fmt.Errorf("cannot add %v", element.Value())
+					}
+					return nil
+				})
+				if err != nil {
+					return types.NewErr("sum: %v", err)
+				}
+				return types.Double(total)
+			},
+		},
+		{
+			Operator: withinOverload,
+			Binary: func(list, start ref.Val) ref.Val {
+				from, err := resolve(start)
+				if err != nil {
+					return types.NewErr("within: %v", err)
+				}
+				return filterByTime(list, from, time.Time{})
+			},
+		},
+		{
+			Operator: withinRangeOverload,
+			Function: func(args ...ref.Val) ref.Val {
+				from, err := resolve(args[1])
+				if err != nil {
+					return types.NewErr("within: %v", err)
+				}
+				to, err := resolve(args[2])
+				if err != nil {
+					return types.NewErr("within: %v", err)
+				}
+				return filterByTime(args[0], from, to)
+			},
+		},
+	}
+}
+
+// eachElement calls fn for every element of a CEL list
+func eachElement(list ref.Val, fn func(element ref.Val) error) error {
+	lister, ok := list.(traits.Lister)
+	if !ok {
+		return fmt.Errorf("expected a list, got %s", list.Type())
+	}
+	for it := lister.Iterator(); it.HasNext() == types.True; {
+		if err := fn(it.Next()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// occurredAt returns the time of an event element
+func occurredAt(element ref.Val) (time.Time, error) {
+	mapper, ok := element.(traits.Mapper)
+	if !ok {
+		return time.Time{}, fmt.Errorf("expected an event, got %s", element.Type())
+	}
+	value, found := mapper.Find(types.String("occurred_at"))
+	if !found {
+		return time.Time{}, errors.New("event has no occurred_at")
+	}
+	timestamp, ok := value.(types.Timestamp)
+	if !ok {
+		return time.Time{}, fmt.Errorf("occurred_at is not a timestamp: %v", value.Value())
+	}
+	return timestamp.Time, nil
+}
+
+// filterByTime returns the events of a list that occurred in [from, to]; a zero to has no upper bound
+func filterByTime(list ref.Val, from, to time.Time) ref.Val {
+	var matched []ref.Val
+	err := eachElement(list, func(element ref.Val) error {
+		at, err := occurredAt(element)
+		if err != nil {
+			return err
+		}
+		if !at.Before(from) && (to.IsZero() || !at.After(to)) {
+			matched = append(matched, element)
+		}
+		return nil
+	})
+	if err != nil {
+		return types.NewErr("within: %v", err)
+	}
+	return types.NewRefValList(types.DefaultTypeAdapter, matched)
+}
@@ -0,0 +1,129 @@
+package expr
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testInput returns one check-in per day for the last five days and one task completion today
+func testInput(now time.Time) Input {
+	var events []Event
+	for i := 5; i >= 1; i-- {
+		events = append(events, Event{
+			ID:         len(events) + 1,
+			Type:       "check-in",
+			OccurredAt: now.AddDate(0, 0, -i+1).Add(-time.Hour),
+			Payload:    map[string]interface{}{"hours": float64(i)},
+		})
+	}
+	events = append(events, Event{
+		ID:         len(events) + 1,
+		Type:       "task-completion",
+		OccurredAt: now.Add(-time.Minute),
+		Payload:    map[string]interface{}{"priority": "high", "estimate": map[string]interface{}{"hours": float64(3)}},
+	})
+
+	return Input{
+		UserID: "user-1",
+		Now:    now,
+		Events: events,
+		ResolveTime: func(value string) (time.Time, error) {
+			switch value {
+			case "$NOW":
+				return now, nil
+			case "$NOW(-2d)":
+				return now.AddDate(0, 0, -2), nil
+			case "$NOW(-4d)":
+				return now.AddDate(0, 0, -4), nil
+			}
+			return time.Time{}, fmt.Errorf("invalid time variable: %s", value)
+		},
+	}
+}
+
+func TestEval(t *testing.T) {
+	now := time.Date(2024, 5, 10, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		expression string
+		expected   bool
+	}{
+		{`count(events) == 6`, true},
+		{`count(events.filter(e, e.type == "check-in")) >= 5`, true},
+		{`distinctDays(events) == 5`, true},
+		{`sum(events.filter(e, e.type == "check-in").map(e, e.payload.hours)) == 15.0`, true},
+		{`count(within(events, "$NOW(-2d)")) == 3`, true},
+		{`count(within(events, "$NOW(-4d)", "$NOW(-2d)")) == 2`, true},
+		{`events.exists(e, e.type == "task-completion" && e.payload.priority == "high")`, true},
+		{`events.exists(e, e.type == "task-completion" && e.payload.estimate.hours > 5.0)`, false},
+		{`events.exists(e, has(e.payload.priority) && e.payload.priority == "low")`, false},
+		{`events.all(e, e.occurred_at < now)`, true},
+		{`user_id == "user-1"`, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.expression, func(t *testing.T) {
+			program, err := Compile(tt.expression)
+			require.NoError(t, err)
+
+			result, err := program.Eval(testInput(now))
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, result.Matched)
+			assert.NotZero(t, result.Cost)
+		})
+	}
+}
+
+func TestCompileRejectsInvalidExpressions(t *testing.T) {
+	for _, expression := range []string{
+		``,
+		`count(events) >=`,
+		`count(events)`,
+		`count(tasks) > 1`,
+		`within(events, 7) == []`,
+		`distinctDays(events) > "5"`,
+	} {
+		_, err := Compile(expression)
+		assert.Error(t, err, expression)
+	}
+}
+
+func TestEvalErrors(t *testing.T) {
+	now := time.Now()
+
+	program, err := Compile(`count(within(events, "last week")) > 0`)
+	require.NoError(t, err)
+	_, err = program.Eval(testInput(now))
+	assert.ErrorContains(t, err, "invalid time variable")
+
+	// A payload field that is missing is an evaluation error rather than false
+	program, err = Compile(`events.all(e, e.payload.hours > 0.0)`)
+	require.NoError(t, err)
+	_, err = program.Eval(testInput(now))
+	assert.Error(t, err)
+}
+
+func TestEvalCostLimit(t *testing.T) {
+	input := testInput(time.Now())
+	for i := 0; i < 200; i++ {
+		input.Events = append(input.Events, input.Events[0])
+	}
+
+	// A nested comprehension is quadratic in the number of events
+	program, err := Compile(`events.all(a, events.exists(b, b.id == a.id))`)
+	require.NoError(t, err)
+
+	result, err := program.Eval(input)
+	require.NoError(t, err)
+	assert.True(t, result.Matched)
+
+	input.CostLimit = result.Cost / 2
+	_, err = program.Eval(input)
+	require.Error(t, err)
+	assert.True(t, strings.Contains(err.Error(), "cost limit"), err.Error())
+}
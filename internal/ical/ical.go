@@ -0,0 +1,261 @@
+// Package ical reads holidays from iCalendar (RFC 5545) files, such as the public holiday
+// calendars published by calendar applications.
+package ical
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/badge-assignment-system/internal/models"
+)
+
+// dateLayout is the layout of iCalendar DATE values
+const dateLayout = "20060102"
+
+// durationRegex matches the whole-day durations of all-day events, e.g. "P1D" or "P2W"
+var durationRegex = regexp.MustCompile(`^P(\d+)([DW])$`)
+
+// textUnescaper decodes escaped characters in TEXT values
+var textUnescaper = strings.NewReplacer(`\\`, `\`, `\,`, `,`, `\;`, `;`, `\n`, " ", `\N`, " ")
+
+// line is an unfolded content line and the line number it starts on
+type line struct {
+	number int
+	text   string
+}
+
+// event holds the properties of a VEVENT that describe a holiday
+type event struct {
+	line      int
+	start     time.Time
+	end       time.Time // Exclusive; zero when the event has no DTEND
+	days      int       // From DURATION; 0 when the event has none
+	summary   string
+	rule      string
+	ruleLine  int
+	cancelled bool
+}
+
+// ParseHolidays reads the events of an iCalendar file as holidays. An event spanning several
+// days gives a holiday for each day, and an event repeated every year on the same date
+// (RRULE:FREQ=YEARLY, optionally with UNTIL or COUNT) gives yearly holidays. Events with
+// times are taken as holidays on the date they start. Cancelled events are left out.
+func ParseHolidays(r io.Reader) (models.Holidays, error) {
+	lines, err := unfold(r)
+	if err != nil {
+		return nil, err
+	}
+
+	holidays := models.Holidays{}
+	var current *event
+	nested, events := 0, 0
+	for _, l := range lines {
+		name, value, err := parseProperty(l)
+		if err != nil {
+			return nil, err
+		}
+
+		// Components nested in an event, such as alarms, do not describe the holiday
+		if current != nil && nested > 0 {
+			if name == "BEGIN" {
+				nested++
+			} else if name == "END" {
+				nested--
+			}
+			continue
+		}
+
+		switch {
+		case name == "BEGIN" && strings.EqualFold(value, "VEVENT"):
+			current = &event{line: l.number}
+		case name == "BEGIN" && current != nil:
+			nested++
+		case name == "END" && strings.EqualFold(value, "VEVENT"):
+			if current == nil {
+				return nil, fmt.Errorf("line %d: END:VEVENT without BEGIN:VEVENT", l.number)
+			}
+			eventHolidays, err := current.holidays()
+			if err != nil {
+				return nil, err
+			}
+			holidays = append(holidays, eventHolidays...)
+			current = nil
+			events++
+		case current == nil:
+			// Calendar properties and other components are not needed
+		case name == "DTSTART":
+			if current.start, err = parseDate(value); err != nil {
+				return nil, fmt.Errorf("line %d: invalid DTSTART '%s'", l.number, value)
+			}
+		case name == "DTEND":
+			if current.end, err = parseDate(value); err != nil {
+				return nil, fmt.Errorf("line %d: invalid DTEND '%s'", l.number, value)
+			}
+		case name == "DURATION":
+			matches := durationRegex.FindStringSubmatch(value)
+			if matches == nil {
+				return nil, fmt.Errorf("line %d: unsupported DURATION '%s', expected whole days or weeks", l.number, value)
+			}
+			current.days, _ = strconv.Atoi(matches[1])
+			if matches[2] == "W" {
+				current.days *= 7
+			}
+		case name == "SUMMARY":
+			current.summary = strings.TrimSpace(textUnescaper.Replace(value))
+		case name == "RRULE":
+			current.rule, current.ruleLine = value, l.number
+		case name == "STATUS":
+			current.cancelled = strings.EqualFold(value, "CANCELLED")
+		}
+	}
+
+	if current != nil {
+		return nil, fmt.Errorf("line %d: event is missing END:VEVENT", current.line)
+	}
+	if events == 0 {
+		return nil, errors.New("no events found in calendar")
+	}
+	return holidays, nil
+}
+
+// unfold reads the content lines of a file, joining lines folded onto the next ones
+func unfold(r io.Reader) ([]line, error) {
+	var lines []line
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for number := 1; scanner.Scan(); number++ {
+		text := strings.TrimRight(scanner.Text(), "\r")
+		if (strings.HasPrefix(text, " ") || strings.HasPrefix(text, "\t")) && len(lines) > 0 {
+			lines[len(lines)-1].text += text[1:]
+			continue
+		}
+		if text != "" {
+			lines = append(lines, line{number: number, text: text})
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read calendar: %w", err)
+	}
+	return lines, nil
+}
+
+// parseProperty splits a content line into its upper-case property name and its value,
+// ignoring the property's parameters
+func parseProperty(l line) (string, string, error) {
+	quoted := false
+	for i, c := range l.text {
+		switch {
+		case c == '"':
+			quoted = !quoted
+		case c == ':' && !quoted:
+			name := l.text[:i]
+			if semicolon := strings.IndexByte(name, ';'); semicolon >= 0 {
+				name = name[:semicolon]
+			}
+			return strings.ToUpper(name), l.text[i+1:], nil
+		}
+	}
+	return "", "", fmt.Errorf("line %d: invalid content line '%s'", l.number, l.text)
+}
+
+// parseDate parses a DATE value, or the date of a DATE-TIME value
+func parseDate(value string) (time.Time, error) {
+	if len(value) > len(dateLayout) && value[len(dateLayout)] == 'T' {
+		value = value[:len(dateLayout)]
+	}
+	return time.Parse(dateLayout, value)
+}
+
+// holidays returns the holidays an event stands for
+func (e *event) holidays() (models.Holidays, error) {
+	if e.cancelled {
+		return nil, nil
+	}
+	if e.start.IsZero() {
+		return nil, fmt.Errorf("line %d: event has no DTSTART", e.line)
+	}
+
+	days := 1
+	if !e.end.IsZero() {
+		if span := int(e.end.Sub(e.start).Hours() / 24); span > 1 {
+			days = span
+		}
+	} else if e.days > 0 {
+		days = e.days
+	}
+
+	var yearly bool
+	var until string
+	if e.rule != "" {
+		var err error
+		if until, err = e.yearlyUntil(days); err != nil {
+			return nil, err
+		}
+		yearly = true
+	}
+
+	holidays := make(models.Holidays, 0, days)
+	for i := 0; i < days; i++ {
+		holidays = append(holidays, models.Holiday{
+			Date:   e.start.AddDate(0, 0, i).Format("2006-01-02"),
+			Name:   e.summary,
+			Yearly: yearly,
+			Until:  until,
+		})
+	}
+	return holidays, nil
+}
+
+// yearlyUntil checks that an event's recurrence rule repeats it every year on the same date,
+// and returns the last day it repeats on, or "" when it repeats forever
+func (e *event) yearlyUntil(days int) (string, error) {
+	unsupported := fmt.Errorf("line %d: unsupported recurrence rule '%s', only yearly rules on a fixed date are supported", e.ruleLine, e.rule)
+
+	var until string
+	frequency := ""
+	for _, part := range strings.Split(e.rule, ";") {
+		key, value, _ := strings.Cut(part, "=")
+		switch strings.ToUpper(key) {
+		case "FREQ":
+			frequency = strings.ToUpper(value)
+		case "INTERVAL":
+			if value != "1" {
+				return "", unsupported
+			}
+		case "BYMONTH":
+			if value != strconv.Itoa(int(e.start.Month())) {
+				return "", unsupported
+			}
+		case "BYMONTHDAY":
+			if value != strconv.Itoa(e.start.Day()) {
+				return "", unsupported
+			}
+		case "UNTIL":
+			date, err := parseDate(value)
+			if err != nil {
+				return "", fmt.Errorf("line %d: invalid UNTIL '%s'", e.ruleLine, value)
+			}
+			until = date.AddDate(0, 0, days-1).Format("2006-01-02")
+		case "COUNT":
+			count, err := strconv.Atoi(value)
+			if err != nil || count < 1 {
+				return "", fmt.Errorf("line %d: invalid COUNT '%s'", e.ruleLine, value)
+			}
+			until = e.start.AddDate(count-1, 0, days-1).Format("2006-01-02")
+		case "WKST":
+			// The start of the week does not affect yearly rules on a fixed date
+		default:
+			return "", unsupported
+		}
+	}
+	if frequency != "YEARLY" {
+		return "", unsupported
+	}
+	return until, nil
+}
@@ -0,0 +1,65 @@
+package ical
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/badge-assignment-system/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// calendar wraps events in a VCALENDAR with CRLF line endings
+func calendar(events ...string) string {
+	lines := []string{"BEGIN:VCALENDAR", "VERSION:2.0", "PRODID:-//Example//Holidays//EN"}
+	for _, event := range events {
+		lines = append(lines, "BEGIN:VEVENT")
+		lines = append(lines, strings.Split(event, "\n")...)
+		lines = append(lines, "END:VEVENT")
+	}
+	lines = append(lines, "END:VCALENDAR")
+	return strings.Join(lines, "\r\n") + "\r\n"
+}
+
+func TestParseHolidays(t *testing.T) {
+	ics := calendar(
+		"DTSTART;VALUE=DATE:20241225\nDTEND;VALUE=DATE:20241226\nSUMMARY:Christmas Day\nRRULE:FREQ=YEARLY;BYMONTH=12;BYMONTHDAY=25",
+		"DTSTART;VALUE=DATE:20241128\nSUMMARY:Thanksgiving Day",
+		"DTSTART;VALUE=DATE:20240701\nDURATION:P2D\nSUMMARY:Summer\\, long weekend\nBEGIN:VALARM\nTRIGGER:-P1D\nDURATION:P1W\nEND:VALARM",
+		"DTSTART;TZID=\"America/New_York\":20240101T000000\nSUMMARY:New Year's\n  Day\nRRULE:FREQ=YEARLY;COUNT=3",
+		"DTSTART;VALUE=DATE:20240704\nSUMMARY:Cancelled\nSTATUS:CANCELLED",
+	)
+
+	holidays, err := ParseHolidays(strings.NewReader(ics))
+	require.NoError(t, err)
+	assert.Equal(t, models.Holidays{
+		{Date: "2024-12-25", Name: "Christmas Day", Yearly: true},
+		{Date: "2024-11-28", Name: "Thanksgiving Day"},
+		{Date: "2024-07-01", Name: "Summer, long weekend"},
+		{Date: "2024-07-02", Name: "Summer, long weekend"},
+		{Date: "2024-01-01", Name: "New Year's Day", Yearly: true, Until: "2026-01-01"},
+	}, holidays)
+}
+
+func TestParseHolidaysErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		ics   string
+		error string
+	}{
+		{"no events", calendar(), "no events found"},
+		{"missing start", calendar("SUMMARY:Someday"), "event has no DTSTART"},
+		{"invalid start", calendar("DTSTART:tomorrow"), "line 5: invalid DTSTART 'tomorrow'"},
+		{"weekday rule", calendar("DTSTART;VALUE=DATE:20241128\nRRULE:FREQ=YEARLY;BYMONTH=11;BYDAY=4TH"), "line 6: unsupported recurrence rule"},
+		{"monthly rule", calendar("DTSTART;VALUE=DATE:20240101\nRRULE:FREQ=MONTHLY"), "unsupported recurrence rule"},
+		{"unclosed event", "BEGIN:VCALENDAR\r\nBEGIN:VEVENT\r\nDTSTART:20240101\r\n", "line 2: event is missing END:VEVENT"},
+		{"not a calendar", "Hello, world", "line 1: invalid content line"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseHolidays(strings.NewReader(tt.ics))
+			assert.ErrorContains(t, err, tt.error)
+		})
+	}
+}
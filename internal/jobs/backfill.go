@@ -0,0 +1,298 @@
+package jobs
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/badge-assignment-system/internal/engine"
+	"github.com/badge-assignment-system/internal/logging"
+	"github.com/badge-assignment-system/internal/models"
+)
+
+// BackfillStore defines the database operations needed to run backfill jobs
+type BackfillStore interface {
+	ClaimBackfillJob(lease time.Duration) (*models.BackfillJob, error)
+	RecordBackfillProgress(job *models.BackfillJob, lease time.Duration) error
+	RenewBackfillLease(id int, lease time.Duration) error
+	FinishBackfillJob(id int, status string, lastError *string) error
+	GetEventUserIDs(after string, limit int) ([]string, error)
+	GetBadgeByID(id int) (models.Badge, error)
+}
+
+// BadgeProcessor evaluates badges for a user and awards those whose criteria are met, and only
+// those badges. A processor is used by a single worker and does not need to be safe for
+// concurrent use.
+type BadgeProcessor interface {
+	ProcessBadges(userID string, badges []models.Badge) (*engine.ProcessResult, error)
+}
+
+// BackfillConfig controls how backfill jobs are run
+type BackfillConfig struct {
+	Concurrency  int           // Users evaluated at the same time
+	BatchSize    int           // Users evaluated between progress updates
+	PollInterval time.Duration // How long the runner waits before looking for jobs again when idle
+	Lease        time.Duration // How long a running job stays locked to this runner; renewed while it runs
+}
+
+// DefaultBackfillConfig returns the default backfill configuration
+func DefaultBackfillConfig() BackfillConfig {
+	return BackfillConfig{
+		Concurrency:  4,
+		BatchSize:    100,
+		PollInterval: 10 * time.Second,
+		Lease:        2 * time.Minute,
+	}
+}
+
+// BackfillRunner runs backfill jobs one at a time, evaluating their badges for every
+// user who has sent events. Users are processed in batches, in order of user ID, and
+// progress is saved after each batch so a job interrupted by a restart resumes after
+// the last completed batch once its lease expires. The lease is renewed while a batch
+// runs, so a slow batch doesn't let another runner claim the job.
+type BackfillRunner struct {
+	store        BackfillStore
+	newProcessor func(dryRun bool) BadgeProcessor
+	config       BackfillConfig
+	logger       *logging.Logger
+	wake         chan struct{}
+	stop         chan struct{}
+	wg           sync.WaitGroup
+}
+
+// NewBackfillRunner creates a backfill runner; newProcessor is called once per worker of each
+// job, and must return a processor that only counts awards when dryRun is set
+func NewBackfillRunner(store BackfillStore, newProcessor func(dryRun bool) BadgeProcessor, config BackfillConfig) *BackfillRunner {
+	defaults := DefaultBackfillConfig()
+	if config.Concurrency <= 0 {
+		config.Concurrency = defaults.Concurrency
+	}
+	if config.BatchSize <= 0 {
+		config.BatchSize = defaults.BatchSize
+	}
+	if config.PollInterval <= 0 {
+		config.PollInterval = defaults.PollInterval
+	}
+	if config.Lease <= 0 {
+		config.Lease = defaults.Lease
+	}
+
+	return &BackfillRunner{
+		store:        store,
+		newProcessor: newProcessor,
+		config:       config,
+		logger:       logging.NewLogger("BACKFILL", logging.LogLevelInfo),
+		wake:         make(chan struct{}, 1),
+		stop:         make(chan struct{}),
+	}
+}
+
+// Start runs the runner in the background
+func (r *BackfillRunner) Start() {
+	r.logger.Info("Starting backfill runner with %d workers", r.config.Concurrency)
+	r.wg.Add(1)
+	go func() {
+		defer r.wg.Done()
+		for {
+			select {
+			case <-r.stop:
+				return
+			default:
+			}
+
+			if r.RunOnce() {
+				// Look for the next job straight away
+				continue
+			}
+
+			select {
+			case <-r.stop:
+				return
+			case <-r.wake:
+			case <-time.After(r.config.PollInterval):
+			}
+		}
+	}()
+}
+
+// Stop signals the runner to exit and waits for the batch in progress to finish.
+// The interrupted job's lease is released, so the next runner to claim it resumes it at once.
+func (r *BackfillRunner) Stop() {
+	close(r.stop)
+	r.wg.Wait()
+	r.logger.Info("Backfill runner stopped")
+}
+
+// Notify wakes the runner so a new job is started without waiting for the next poll
+func (r *BackfillRunner) Notify() {
+	select {
+	case r.wake <- struct{}{}:
+	default:
+	}
+}
+
+// RunOnce claims a job and runs it until it finishes or the runner is stopped,
+// returning whether a job was claimed
+func (r *BackfillRunner) RunOnce() bool {
+	job, err := r.store.ClaimBackfillJob(r.config.Lease)
+	if err != nil {
+		r.logger.Error("Failed to claim backfill job: %v", err)
+		return false
+	}
+	if job == nil {
+		return false
+	}
+
+	r.run(job)
+	return true
+}
+
+// run evaluates a job's badges for the users after its last completed batch
+func (r *BackfillRunner) run(job *models.BackfillJob) {
+	if job.LastUserID == "" {
+		r.logger.Info("Starting backfill job %d of badges %v (dry run: %t)", job.ID, job.BadgeIDs, job.DryRun)
+	} else {
+		r.logger.Info("Resuming backfill job %d after user %s", job.ID, job.LastUserID)
+	}
+
+	badges, err := r.badges(job)
+	if err != nil {
+		r.finish(job, models.BackfillFailed, err)
+		return
+	}
+
+	processors := make([]BadgeProcessor, r.config.Concurrency)
+	for i := range processors {
+		processors[i] = r.newProcessor(job.DryRun)
+	}
+
+	for {
+		select {
+		case <-r.stop:
+			r.logger.Info("Backfill job %d interrupted after user %s", job.ID, job.LastUserID)
+			if err := r.store.RenewBackfillLease(job.ID, 0); err != nil {
+				r.logger.Error("Failed to release the lease of backfill job %d: %v", job.ID, err)
+			}
+			return
+		default:
+		}
+
+		userIDs, err := r.store.GetEventUserIDs(job.LastUserID, r.config.BatchSize)
+		if err != nil {
+			// Leave the job to be resumed once its lease expires
+			r.logger.Error("Failed to retrieve users for backfill job %d: %v", job.ID, err)
+			return
+		}
+		if len(userIDs) == 0 {
+			r.finish(job, models.BackfillCompleted, nil)
+			return
+		}
+
+		r.processBatch(job, processors, badges, userIDs)
+
+		job.LastUserID = userIDs[len(userIDs)-1]
+		if err := r.store.RecordBackfillProgress(job, r.config.Lease); err != nil {
+			r.logger.Error("Failed to record progress of backfill job %d: %v", job.ID, err)
+			return
+		}
+		r.logger.Debug("Backfill job %d processed %d of %d users", job.ID, job.ProcessedUsers, job.TotalUsers)
+	}
+}
+
+// badges loads the badges evaluated by a job
+func (r *BackfillRunner) badges(job *models.BackfillJob) ([]models.Badge, error) {
+	badges := make([]models.Badge, 0, len(job.BadgeIDs))
+	for _, id := range job.BadgeIDs {
+		badge, err := r.store.GetBadgeByID(int(id))
+		if err != nil {
+			return nil, fmt.Errorf("badge ID %d not found: %w", id, err)
+		}
+		badges = append(badges, badge)
+	}
+	return badges, nil
+}
+
+// processBatch evaluates the badges for a batch of users, spreading the users over the
+// processors, and adds the outcome to the job's counts. Users for whom any badge failed to
+// evaluate are counted as failed.
+func (r *BackfillRunner) processBatch(job *models.BackfillJob, processors []BadgeProcessor, badges []models.Badge, userIDs []string) {
+	done := make(chan struct{})
+	defer close(done)
+	go r.renewLease(job.ID, done)
+
+	userIDsCh := make(chan string)
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+
+	for _, processor := range processors {
+		wg.Add(1)
+		go func(processor BadgeProcessor) {
+			defer wg.Done()
+			for userID := range userIDsCh {
+				result, err := processor.ProcessBadges(userID, badges)
+
+				mu.Lock()
+				job.ProcessedUsers++
+				if err == nil {
+					job.Awarded += len(result.AwardedBadgeIDs())
+				}
+				if err != nil || len(result.Errors) > 0 {
+					job.FailedUsers++
+				}
+				mu.Unlock()
+
+				if err != nil {
+					r.logger.Error("Backfill job %d failed to evaluate user %s: %v", job.ID, userID, err)
+					continue
+				}
+				for _, badgeErr := range result.Errors {
+					r.logger.Error("Backfill job %d failed to evaluate badge ID %d for user %s: %s",
+						job.ID, badgeErr.BadgeID, userID, badgeErr.Error)
+				}
+			}
+		}(processor)
+	}
+
+	for _, userID := range userIDs {
+		userIDsCh <- userID
+	}
+	close(userIDsCh)
+	wg.Wait()
+}
+
+// renewLease renews the lease of a job every third of the lease until done is closed
+func (r *BackfillRunner) renewLease(jobID int, done <-chan struct{}) {
+	ticker := time.NewTicker(r.config.Lease / 3)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+			if err := r.store.RenewBackfillLease(jobID, r.config.Lease); err != nil {
+				r.logger.Error("Failed to renew the lease of backfill job %d: %v", jobID, err)
+			}
+		}
+	}
+}
+
+// finish records the final status of a job
+func (r *BackfillRunner) finish(job *models.BackfillJob, status string, cause error) {
+	var lastError *string
+	if cause != nil {
+		message := cause.Error()
+		lastError = &message
+		r.logger.Error("Backfill job %d failed: %v", job.ID, cause)
+	} else {
+		r.logger.Info("Backfill job %d complete - %d users processed, %d failed, %d awards (dry run: %t)",
+			job.ID, job.ProcessedUsers, job.FailedUsers, job.Awarded, job.DryRun)
+	}
+
+	if err := r.store.FinishBackfillJob(job.ID, status, lastError); err != nil {
+		r.logger.Error("Failed to record completion of backfill job %d: %v", job.ID, err)
+		return
+	}
+	job.Status = status
+	job.LastError = lastError
+}
@@ -0,0 +1,276 @@
+package jobs
+
+import (
+	"errors"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/badge-assignment-system/internal/engine"
+	"github.com/badge-assignment-system/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeBackfillStore holds a single backfill job and the users who sent events in memory
+type fakeBackfillStore struct {
+	job            *models.BackfillJob
+	claimed        bool
+	users          []string
+	badges         map[int]models.Badge
+	progress       []string // Last user ID recorded after each batch
+	failUsersAfter string
+	mu             sync.Mutex
+	renewals       int
+	released       bool // The lease was given up
+}
+
+func (s *fakeBackfillStore) ClaimBackfillJob(lease time.Duration) (*models.BackfillJob, error) {
+	if s.claimed || s.job.Status == models.BackfillCompleted || s.job.Status == models.BackfillFailed {
+		return nil, nil
+	}
+	s.claimed = true
+	s.job.Status = models.BackfillRunning
+	job := *s.job
+	return &job, nil
+}
+
+func (s *fakeBackfillStore) RecordBackfillProgress(job *models.BackfillJob, lease time.Duration) error {
+	saved := *job
+	s.job = &saved
+	s.progress = append(s.progress, job.LastUserID)
+	return nil
+}
+
+func (s *fakeBackfillStore) RenewBackfillLease(id int, lease time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if lease == 0 {
+		s.released = true
+		return nil
+	}
+	s.renewals++
+	return nil
+}
+
+func (s *fakeBackfillStore) FinishBackfillJob(id int, status string, lastError *string) error {
+	s.job.Status = status
+	s.job.LastError = lastError
+	return nil
+}
+
+func (s *fakeBackfillStore) GetEventUserIDs(after string, limit int) ([]string, error) {
+	if s.failUsersAfter != "" && after == s.failUsersAfter {
+		return nil, errors.New("database unavailable")
+	}
+	var userIDs []string
+	for _, userID := range s.users {
+		if userID > after && len(userIDs) < limit {
+			userIDs = append(userIDs, userID)
+		}
+	}
+	return userIDs, nil
+}
+
+func (s *fakeBackfillStore) GetBadgeByID(id int) (models.Badge, error) {
+	badge, ok := s.badges[id]
+	if !ok {
+		return models.Badge{}, errors.New("no rows in result set")
+	}
+	return badge, nil
+}
+
+// fakeBadgeProcessor awards the badges to the users who qualify
+type fakeBadgeProcessor struct {
+	mu          *sync.Mutex
+	qualifies   map[string]bool
+	failures    map[string]bool
+	badgeErrors map[string]bool // Users for whom the first badge fails to evaluate
+	dryRun      bool
+	awarded     *[]string
+	delay       time.Duration
+}
+
+func (p *fakeBadgeProcessor) ProcessBadges(userID string, badges []models.Badge) (*engine.ProcessResult, error) {
+	time.Sleep(p.delay)
+	if p.failures[userID] {
+		return nil, errors.New("evaluation failed")
+	}
+
+	result := &engine.ProcessResult{UserID: userID}
+	if p.badgeErrors[userID] {
+		result.Errors = append(result.Errors, engine.BadgeError{BadgeID: badges[0].ID, Error: "criteria evaluation failed"})
+	}
+	if !p.qualifies[userID] {
+		return result, nil
+	}
+	if !p.dryRun {
+		p.mu.Lock()
+		*p.awarded = append(*p.awarded, userID)
+		p.mu.Unlock()
+	}
+	for _, badge := range badges {
+		result.Awarded = append(result.Awarded, engine.AwardedBadge{BadgeID: badge.ID, BadgeName: badge.Name})
+	}
+	return result, nil
+}
+
+func newTestBackfillRunner(store *fakeBackfillStore, qualifies, failures map[string]bool, awarded *[]string) *BackfillRunner {
+	var mu sync.Mutex
+	return NewBackfillRunner(store, func(dryRun bool) BadgeProcessor {
+		return &fakeBadgeProcessor{mu: &mu, qualifies: qualifies, failures: failures, dryRun: dryRun, awarded: awarded}
+	}, BackfillConfig{Concurrency: 3, BatchSize: 2})
+}
+
+func TestBackfillRunnerRun(t *testing.T) {
+	store := &fakeBackfillStore{
+		job:    &models.BackfillJob{ID: 1, BadgeIDs: []int64{7}, Status: models.BackfillPending, TotalUsers: 5},
+		users:  []string{"alice", "bob", "carol", "dave", "erin"},
+		badges: map[int]models.Badge{7: {ID: 7, Name: "Early Bird"}},
+	}
+	var awarded []string
+	runner := newTestBackfillRunner(store,
+		map[string]bool{"alice": true, "carol": true, "erin": true},
+		map[string]bool{"dave": true},
+		&awarded)
+
+	assert.True(t, runner.RunOnce())
+
+	assert.Equal(t, models.BackfillCompleted, store.job.Status)
+	assert.Equal(t, 5, store.job.ProcessedUsers)
+	assert.Equal(t, 1, store.job.FailedUsers)
+	assert.Equal(t, 3, store.job.Awarded)
+	assert.Equal(t, []string{"bob", "dave", "erin"}, store.progress)
+	sort.Strings(awarded)
+	assert.Equal(t, []string{"alice", "carol", "erin"}, awarded)
+
+	// There is nothing left to run
+	assert.False(t, runner.RunOnce())
+}
+
+func TestBackfillRunnerDryRun(t *testing.T) {
+	store := &fakeBackfillStore{
+		job:    &models.BackfillJob{ID: 1, BadgeIDs: []int64{7}, DryRun: true, Status: models.BackfillPending},
+		users:  []string{"alice", "bob", "carol"},
+		badges: map[int]models.Badge{7: {ID: 7, Name: "Early Bird"}},
+	}
+	var awarded []string
+	runner := newTestBackfillRunner(store, map[string]bool{"alice": true, "bob": true}, nil, &awarded)
+
+	runner.RunOnce()
+
+	assert.Equal(t, models.BackfillCompleted, store.job.Status)
+	assert.Equal(t, 2, store.job.Awarded)
+	assert.Empty(t, awarded)
+}
+
+func TestBackfillRunnerResumes(t *testing.T) {
+	store := &fakeBackfillStore{
+		job:            &models.BackfillJob{ID: 1, BadgeIDs: []int64{7}, Status: models.BackfillPending},
+		users:          []string{"alice", "bob", "carol", "dave", "erin"},
+		badges:         map[int]models.Badge{7: {ID: 7, Name: "Early Bird"}},
+		failUsersAfter: "bob",
+	}
+	var awarded []string
+	qualifies := map[string]bool{"alice": true, "dave": true}
+	runner := newTestBackfillRunner(store, qualifies, nil, &awarded)
+
+	// The job is interrupted after its first batch and keeps its progress
+	runner.RunOnce()
+	assert.Equal(t, models.BackfillRunning, store.job.Status)
+	assert.Equal(t, "bob", store.job.LastUserID)
+	assert.Equal(t, 2, store.job.ProcessedUsers)
+
+	// Once its lease expires, it is resumed after the last completed batch
+	store.claimed = false
+	store.failUsersAfter = ""
+	runner = newTestBackfillRunner(store, qualifies, nil, &awarded)
+	require.True(t, runner.RunOnce())
+
+	assert.Equal(t, models.BackfillCompleted, store.job.Status)
+	assert.Equal(t, 5, store.job.ProcessedUsers)
+	assert.Equal(t, 2, store.job.Awarded)
+	assert.Equal(t, []string{"alice", "dave"}, awarded)
+}
+
+func TestBackfillRunnerCountsBadgeErrors(t *testing.T) {
+	store := &fakeBackfillStore{
+		job:    &models.BackfillJob{ID: 1, BadgeIDs: []int64{7}, Status: models.BackfillPending},
+		users:  []string{"alice", "bob"},
+		badges: map[int]models.Badge{7: {ID: 7, Name: "Early Bird"}},
+	}
+	var mu sync.Mutex
+	var awarded []string
+	runner := NewBackfillRunner(store, func(dryRun bool) BadgeProcessor {
+		return &fakeBadgeProcessor{mu: &mu, qualifies: map[string]bool{"alice": true}, badgeErrors: map[string]bool{"bob": true}, awarded: &awarded}
+	}, BackfillConfig{Concurrency: 2, BatchSize: 2})
+
+	runner.RunOnce()
+
+	assert.Equal(t, models.BackfillCompleted, store.job.Status)
+	assert.Equal(t, 2, store.job.ProcessedUsers)
+	assert.Equal(t, 1, store.job.FailedUsers)
+	assert.Equal(t, 1, store.job.Awarded)
+}
+
+func TestBackfillRunnerRenewsLeaseDuringBatch(t *testing.T) {
+	store := &fakeBackfillStore{
+		job:    &models.BackfillJob{ID: 1, BadgeIDs: []int64{7}, Status: models.BackfillPending},
+		users:  []string{"alice", "bob"},
+		badges: map[int]models.Badge{7: {ID: 7, Name: "Early Bird"}},
+	}
+	var mu sync.Mutex
+	var awarded []string
+	runner := NewBackfillRunner(store, func(dryRun bool) BadgeProcessor {
+		return &fakeBadgeProcessor{mu: &mu, awarded: &awarded, delay: 100 * time.Millisecond}
+	}, BackfillConfig{Concurrency: 1, BatchSize: 2, Lease: 60 * time.Millisecond})
+
+	runner.RunOnce()
+
+	// The batch of two slow users outlasts the lease, which is renewed meanwhile
+	assert.Equal(t, models.BackfillCompleted, store.job.Status)
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	assert.GreaterOrEqual(t, store.renewals, 2)
+}
+
+func TestBackfillRunnerReleasesLeaseWhenStopped(t *testing.T) {
+	store := &fakeBackfillStore{
+		job:    &models.BackfillJob{ID: 1, BadgeIDs: []int64{7}, Status: models.BackfillPending},
+		users:  []string{"alice", "bob", "carol", "dave"},
+		badges: map[int]models.Badge{7: {ID: 7, Name: "Early Bird"}},
+	}
+	var mu sync.Mutex
+	var awarded []string
+	runner := NewBackfillRunner(store, func(dryRun bool) BadgeProcessor {
+		return &fakeBadgeProcessor{mu: &mu, awarded: &awarded, delay: 50 * time.Millisecond}
+	}, BackfillConfig{Concurrency: 1, BatchSize: 1})
+
+	claimed := make(chan bool)
+	go func() { claimed <- runner.RunOnce() }()
+	time.Sleep(20 * time.Millisecond)
+	runner.Stop()
+	require.True(t, <-claimed)
+
+	// The batch in progress is finished, and the job left for another runner to resume at once
+	assert.Equal(t, models.BackfillRunning, store.job.Status)
+	assert.Equal(t, "alice", store.job.LastUserID)
+	assert.True(t, store.released)
+}
+
+func TestBackfillRunnerMissingBadge(t *testing.T) {
+	store := &fakeBackfillStore{
+		job:   &models.BackfillJob{ID: 1, BadgeIDs: []int64{7}, Status: models.BackfillPending},
+		users: []string{"alice"},
+	}
+	var awarded []string
+	runner := newTestBackfillRunner(store, map[string]bool{"alice": true}, nil, &awarded)
+
+	runner.RunOnce()
+
+	assert.Equal(t, models.BackfillFailed, store.job.Status)
+	require.NotNil(t, store.job.LastError)
+	assert.Contains(t, *store.job.LastError, "badge ID 7 not found")
+	assert.Empty(t, awarded)
+}
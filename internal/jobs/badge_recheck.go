@@ -0,0 +1,170 @@
+package jobs
+
+import (
+	"sync"
+	"time"
+
+	"github.com/badge-assignment-system/internal/engine"
+	"github.com/badge-assignment-system/internal/logging"
+	"github.com/badge-assignment-system/internal/models"
+	"github.com/badge-assignment-system/internal/notify"
+)
+
+// RecheckStore defines the database operations needed to expire and re-check awarded badges
+type RecheckStore interface {
+	GetActiveBadges() ([]models.Badge, error)
+	ExpireUserBadges() ([]models.WebhookOutbox, error)
+	GetBadgeHoldersDueForRecheck(badgeID int, checkedBefore time.Time) ([]string, error)
+	MarkUserBadgeChecked(userID string, badgeID int) error
+	ExpireUserBadgeAwards(ids []int, reason string) ([]models.WebhookOutbox, error)
+}
+
+// Evaluator finds the awards of a badge whose criteria a user no longer meets
+type Evaluator interface {
+	LapsedAwards(badgeID int, userID string) ([]models.UserBadge, error)
+}
+
+// RecheckResult summarizes a single run of the recheck job
+type RecheckResult struct {
+	Expired int // Awards whose validity period ended
+	Checked int // Holders re-evaluated
+	Lapsed  int // Holders who no longer qualified for some of their awards
+}
+
+// BadgeRecheckJob periodically expires awards whose validity period has ended and
+// re-evaluates the holders of badges with a recheck policy, expiring the awards, or the
+// tiers, whose criteria they no longer meet
+type BadgeRecheckJob struct {
+	Notifications notify.Publisher // Told about the awards expired; may be nil
+
+	store     RecheckStore
+	evaluator Evaluator
+	interval  time.Duration
+	logger    *logging.Logger
+	stop      chan struct{}
+	wg        sync.WaitGroup
+	now       func() time.Time
+}
+
+// NewBadgeRecheckJob creates a recheck job that runs every interval.
+// The evaluator is only used by the job and does not need to be safe for concurrent use.
+func NewBadgeRecheckJob(store RecheckStore, evaluator Evaluator, interval time.Duration) *BadgeRecheckJob {
+	return &BadgeRecheckJob{
+		store:     store,
+		evaluator: evaluator,
+		interval:  interval,
+		logger:    logging.NewLogger("RECHECK", logging.LogLevelInfo),
+		stop:      make(chan struct{}),
+		now:       time.Now,
+	}
+}
+
+// Start runs the job in the background, once immediately and then every interval
+func (j *BadgeRecheckJob) Start() {
+	j.logger.Info("Starting badge recheck job every %s", j.interval)
+	j.wg.Add(1)
+	go func() {
+		defer j.wg.Done()
+		for {
+			j.Run()
+
+			select {
+			case <-j.stop:
+				return
+			case <-time.After(j.interval):
+			}
+		}
+	}()
+}
+
+// Stop signals the job to exit and waits for a run in progress to finish
+func (j *BadgeRecheckJob) Stop() {
+	close(j.stop)
+	j.wg.Wait()
+	j.logger.Info("Badge recheck job stopped")
+}
+
+// Run expires lapsed awards and re-checks the holders that are due, once
+func (j *BadgeRecheckJob) Run() RecheckResult {
+	var result RecheckResult
+
+	expired, err := j.store.ExpireUserBadges()
+	if err != nil {
+		j.logger.Error("Failed to expire user badges: %v", err)
+	}
+	result.Expired = len(expired)
+	j.publish(expired)
+
+	badges, err := j.store.GetActiveBadges()
+	if err != nil {
+		j.logger.Error("Failed to retrieve active badges: %v", err)
+		return result
+	}
+
+	for _, badge := range badges {
+		if badge.ExpiryPolicy == nil || badge.ExpiryPolicy.Recheck == "" {
+			continue
+		}
+		j.recheckBadge(badge, &result)
+	}
+
+	j.logger.Info("Badge recheck complete - %d expired, %d checked, %d lapsed",
+		result.Expired, result.Checked, result.Lapsed)
+	return result
+}
+
+// recheckBadge re-evaluates the holders of a badge whose last check is older than its recheck interval
+func (j *BadgeRecheckJob) recheckBadge(badge models.Badge, result *RecheckResult) {
+	interval, err := engine.PolicyDuration(badge.ExpiryPolicy.Recheck)
+	if err != nil {
+		j.logger.Error("Invalid recheck interval for badge ID %d: %v", badge.ID, err)
+		return
+	}
+
+	userIDs, err := j.store.GetBadgeHoldersDueForRecheck(badge.ID, j.now().Add(-interval))
+	if err != nil {
+		j.logger.Error("Failed to retrieve holders of badge ID %d: %v", badge.ID, err)
+		return
+	}
+
+	for _, userID := range userIDs {
+		awards, err := j.evaluator.LapsedAwards(badge.ID, userID)
+		if err != nil {
+			// Leave the awards alone and retry on the next run
+			j.logger.Error("Failed to re-evaluate badge ID %d for user %s: %v", badge.ID, userID, err)
+			continue
+		}
+		result.Checked++
+
+		if len(awards) > 0 {
+			ids := make([]int, len(awards))
+			for i, award := range awards {
+				ids[i] = award.ID
+			}
+			lapsed, err := j.store.ExpireUserBadgeAwards(ids, "criteria no longer met")
+			if err != nil {
+				j.logger.Error("Failed to expire badge ID %d for user %s: %v", badge.ID, userID, err)
+				continue
+			}
+			j.publish(lapsed)
+			result.Lapsed++
+			j.logger.Info("%d awards of badge ID %d (%s) expired for user %s: criteria no longer met",
+				len(lapsed), badge.ID, badge.Name, userID)
+		}
+
+		// The awards the user still qualifies for are checked again after the interval
+		if err := j.store.MarkUserBadgeChecked(userID, badge.ID); err != nil {
+			j.logger.Error("Failed to record recheck of badge ID %d for user %s: %v", badge.ID, userID, err)
+		}
+	}
+}
+
+// publish tells the clients streaming badge notifications about expired awards
+func (j *BadgeRecheckJob) publish(notifications []models.WebhookOutbox) {
+	if j.Notifications == nil {
+		return
+	}
+	for _, notification := range notifications {
+		j.Notifications.Publish(notify.FromOutbox(notification))
+	}
+}
@@ -0,0 +1,113 @@
+package jobs
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/badge-assignment-system/internal/models"
+	"github.com/badge-assignment-system/internal/notify"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeRecheckStore holds the active holders of each badge in memory
+type fakeRecheckStore struct {
+	badges        []models.Badge
+	holders       map[int][]string
+	expired       []models.WebhookOutbox
+	checkedBefore map[int]time.Time
+	checked       []string
+	revoked       []int
+}
+
+func (s *fakeRecheckStore) GetActiveBadges() ([]models.Badge, error) {
+	return s.badges, nil
+}
+
+func (s *fakeRecheckStore) ExpireUserBadges() ([]models.WebhookOutbox, error) {
+	return s.expired, nil
+}
+
+func (s *fakeRecheckStore) GetBadgeHoldersDueForRecheck(badgeID int, checkedBefore time.Time) ([]string, error) {
+	s.checkedBefore[badgeID] = checkedBefore
+	return s.holders[badgeID], nil
+}
+
+func (s *fakeRecheckStore) MarkUserBadgeChecked(userID string, badgeID int) error {
+	s.checked = append(s.checked, userID)
+	return nil
+}
+
+func (s *fakeRecheckStore) ExpireUserBadgeAwards(ids []int, reason string) ([]models.WebhookOutbox, error) {
+	if reason == "" {
+		return nil, errors.New("unexpected expiry")
+	}
+	var notifications []models.WebhookOutbox
+	for _, id := range ids {
+		s.revoked = append(s.revoked, id)
+		notifications = append(notifications, models.WebhookOutbox{ID: 10 + id, EventType: models.WebhookEventBadgeRevoked})
+	}
+	return notifications, nil
+}
+
+// fakeEvaluator reports fixed lapsed awards per user
+type fakeEvaluator struct {
+	lapsed   map[string][]models.UserBadge
+	failures map[string]error
+}
+
+func (e *fakeEvaluator) LapsedAwards(badgeID int, userID string) ([]models.UserBadge, error) {
+	if err := e.failures[userID]; err != nil {
+		return nil, err
+	}
+	return e.lapsed[userID], nil
+}
+
+func TestBadgeRecheckJobRun(t *testing.T) {
+	store := &fakeRecheckStore{
+		badges: []models.Badge{
+			{ID: 1, Name: "Consistency King", ExpiryPolicy: &models.ExpiryPolicy{Recheck: "1d"}},
+			{ID: 2, Name: "First Steps"},
+			{ID: 3, Name: "Seasonal", ExpiryPolicy: &models.ExpiryPolicy{ValidFor: "90d"}},
+		},
+		holders: map[int][]string{
+			1: {"still-consistent", "stopped", "slowed-down", "unreachable"},
+			2: {"anyone"},
+			3: {"anyone"},
+		},
+		expired: []models.WebhookOutbox{
+			{ID: 1, EventType: models.WebhookEventBadgeRevoked, UserID: "anyone", BadgeID: 3},
+			{ID: 2, EventType: models.WebhookEventBadgeRevoked, UserID: "someone", BadgeID: 3},
+		},
+		checkedBefore: make(map[int]time.Time),
+	}
+	gold := 3
+	evaluator := &fakeEvaluator{
+		lapsed: map[string][]models.UserBadge{
+			"stopped":     {{ID: 1, UserID: "stopped", BadgeID: 1}},
+			"slowed-down": {{ID: 2, UserID: "slowed-down", BadgeID: 1, Tier: &gold}},
+		},
+		failures: map[string]error{"unreachable": errors.New("database unavailable")},
+	}
+
+	now := time.Date(2024, time.May, 15, 12, 0, 0, 0, time.UTC)
+	job := NewBadgeRecheckJob(store, evaluator, time.Hour)
+	job.now = func() time.Time { return now }
+	hub := notify.NewHub()
+	subscription := hub.Subscribe("")
+	job.Notifications = hub
+
+	result := job.Run()
+
+	assert.Equal(t, RecheckResult{Expired: 2, Checked: 3, Lapsed: 2}, result)
+	assert.Equal(t, []string{"still-consistent", "stopped", "slowed-down"}, store.checked)
+	assert.Equal(t, []int{1, 2}, store.revoked)
+
+	// Every expired award is published
+	for _, id := range []int{1, 2, 11, 12} {
+		assert.Equal(t, id, (<-subscription.Notifications()).ID)
+	}
+
+	// Only badges with a recheck policy are re-evaluated, and only holders not checked within the interval
+	assert.Equal(t, map[int]time.Time{1: now.Add(-24 * time.Hour)}, store.checkedBefore)
+}
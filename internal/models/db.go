@@ -1,12 +1,16 @@
 package models
 
 import (
+	"database/sql"
+	"errors"
 	"fmt"
 	"log"
 	"os"
+	"strconv"
+	"time"
 
 	"github.com/jmoiron/sqlx"
-	_ "github.com/lib/pq" // PostgreSQL driver
+	"github.com/lib/pq" // PostgreSQL driver
 )
 
 // DB is the database connection
@@ -14,9 +18,8 @@ type DB struct {
 	*sqlx.DB
 }
 
-// NewDB creates a new database connection
-func NewDB() (*DB, error) {
-	// Get database connection details from environment variables
+// ConnectionString returns the database connection string, built from environment variables
+func ConnectionString() string {
 	host := getEnv("DB_HOST", "localhost")
 	port := getEnv("DB_PORT", "5432")
 	user := getEnv("DB_USER", "postgres")
@@ -24,12 +27,14 @@ func NewDB() (*DB, error) {
 	dbname := getEnv("DB_NAME", "badge_system")
 	sslmode := getEnv("DB_SSLMODE", "disable")
 
-	// Create connection string
-	connStr := fmt.Sprintf("host=%s port=%s user=%s password=%s dbname=%s sslmode=%s",
+	return fmt.Sprintf("host=%s port=%s user=%s password=%s dbname=%s sslmode=%s",
 		host, port, user, password, dbname, sslmode)
+}
 
+// NewDB creates a new database connection
+func NewDB() (*DB, error) {
 	// Open database connection
-	db, err := sqlx.Connect("postgres", connStr)
+	db, err := sqlx.Connect("postgres", ConnectionString())
 	if err != nil {
 		return nil, fmt.Errorf("failed to connect to database: %w", err)
 	}
@@ -138,11 +143,47 @@ func (db *DB) GetBadgeWithCriteria(id int) (BadgeWithCriteria, error) {
 	}
 	result.Criteria = criteria
 
+	// Get the tiers, if any
+	tiers, err := db.GetBadgeTiers(id)
+	if err != nil {
+		return result, err
+	}
+	result.Tiers = tiers
+
 	return result, nil
 }
 
+// GetBadgeTiers retrieves the tiers of a badge ordered by level
+func (db *DB) GetBadgeTiers(badgeID int) ([]BadgeTier, error) {
+	var tiers []BadgeTier
+	err := db.Select(&tiers, "SELECT * FROM badge_tiers WHERE badge_id = $1 ORDER BY level", badgeID)
+	return tiers, err
+}
+
+// insertBadgeTiers inserts the tiers of a badge within a transaction
+func insertBadgeTiers(tx *sqlx.Tx, badgeID int, tiers []BadgeTier) error {
+	query := `
+		INSERT INTO badge_tiers (badge_id, level, name, flow_definition)
+		VALUES ($1, $2, $3, $4)
+		RETURNING id, created_at, updated_at`
+	for i := range tiers {
+		tiers[i].BadgeID = badgeID
+		err := tx.QueryRow(query, badgeID, tiers[i].Level, tiers[i].Name, tiers[i].FlowDefinition).
+			Scan(&tiers[i].ID, &tiers[i].CreatedAt, &tiers[i].UpdatedAt)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 // CreateBadge creates a new badge and its criteria
 func (db *DB) CreateBadge(badge *Badge, criteria *BadgeCriteria) error {
+	return db.CreateBadgeWithTiers(badge, criteria, nil)
+}
+
+// CreateBadgeWithTiers creates a new badge with its criteria and tiers
+func (db *DB) CreateBadgeWithTiers(badge *Badge, criteria *BadgeCriteria, tiers []BadgeTier) error {
 	// Start a transaction
 	tx, err := db.Beginx()
 	if err != nil {
@@ -156,10 +197,11 @@ func (db *DB) CreateBadge(badge *Badge, criteria *BadgeCriteria) error {
 
 	// Insert badge
 	query := `
-		INSERT INTO badges (name, description, image_url, active)
-		VALUES ($1, $2, $3, $4)
+		INSERT INTO badges (name, description, image_url, active, points, repeat_policy, expiry_policy)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
 		RETURNING id, created_at, updated_at`
-	err = tx.QueryRow(query, badge.Name, badge.Description, badge.ImageURL, badge.Active).
+	err = tx.QueryRow(query, badge.Name, badge.Description, badge.ImageURL, badge.Active, badge.Points,
+		badge.RepeatPolicy, badge.ExpiryPolicy).
 		Scan(&badge.ID, &badge.CreatedAt, &badge.UpdatedAt)
 	if err != nil {
 		return err
@@ -170,21 +212,33 @@ func (db *DB) CreateBadge(badge *Badge, criteria *BadgeCriteria) error {
 
 	// Insert criteria
 	query = `
-		INSERT INTO badge_criteria (badge_id, flow_definition)
-		VALUES ($1, $2)
+		INSERT INTO badge_criteria (badge_id, flow_definition, expression)
+		VALUES ($1, $2, $3)
 		RETURNING id, created_at, updated_at`
-	err = tx.QueryRow(query, criteria.BadgeID, criteria.FlowDefinition).
+	err = tx.QueryRow(query, criteria.BadgeID, criteria.FlowDefinition, criteria.Expression).
 		Scan(&criteria.ID, &criteria.CreatedAt, &criteria.UpdatedAt)
 	if err != nil {
 		return err
 	}
 
+	// Insert tiers
+	err = insertBadgeTiers(tx, badge.ID, tiers)
+	if err != nil {
+		return err
+	}
+
 	// Commit transaction
 	return tx.Commit()
 }
 
 // UpdateBadge updates an existing badge and its criteria
 func (db *DB) UpdateBadge(badge *Badge, criteria *BadgeCriteria) error {
+	return db.UpdateBadgeWithTiers(badge, criteria, nil)
+}
+
+// UpdateBadgeWithTiers updates an existing badge and its criteria. When tiers is not nil,
+// it replaces all of the badge's tiers; an empty slice removes them.
+func (db *DB) UpdateBadgeWithTiers(badge *Badge, criteria *BadgeCriteria, tiers []BadgeTier) error {
 	// Start a transaction
 	tx, err := db.Beginx()
 	if err != nil {
@@ -196,20 +250,43 @@ func (db *DB) UpdateBadge(badge *Badge, criteria *BadgeCriteria) error {
 		}
 	}()
 
+	// Lock the badge until the update commits. Awards and revocations read its points under a
+	// share lock, so they either commit first and are re-scored below, or wait and score the new points.
+	var points int
+	err = tx.Get(&points, "SELECT points FROM badges WHERE id = $1 FOR UPDATE", badge.ID)
+	if err != nil {
+		return err
+	}
+
 	// Update badge
 	badgeQuery := `
 		UPDATE badges
-		SET name = $1, description = $2, image_url = $3, active = $4, updated_at = NOW()
-		WHERE id = $5
+		SET name = $1, description = $2, image_url = $3, active = $4, points = $5, repeat_policy = $6,
+			expiry_policy = $7, updated_at = NOW()
+		WHERE id = $8
 		RETURNING updated_at`
-	err = tx.QueryRow(badgeQuery, badge.Name, badge.Description, badge.ImageURL, badge.Active, badge.ID).
+	err = tx.QueryRow(badgeQuery, badge.Name, badge.Description, badge.ImageURL, badge.Active, badge.Points,
+		badge.RepeatPolicy, badge.ExpiryPolicy, badge.ID).
 		Scan(&badge.UpdatedAt)
 	if err != nil {
 		return err
 	}
 
+	// Awards already made score the new points on leaderboards
+	if badge.Points != points {
+		_, err = tx.Exec(`
+			WITH held AS (
+				SELECT * FROM user_badges WHERE badge_id = $1 AND status = $2
+			)`+leaderboardUpdateSQL("held", 0, strconv.Itoa(badge.Points-points))+`
+			SELECT 1`,
+			badge.ID, UserBadgeStatusActive)
+		if err != nil {
+			return err
+		}
+	}
+
 	// If criteria update is requested
-	if criteria != nil && criteria.FlowDefinition != nil {
+	if criteria != nil && (criteria.FlowDefinition != nil || criteria.Expression != "") {
 		// Check if criteria exists
 		var count int
 		err = tx.Get(&count, "SELECT COUNT(*) FROM badge_criteria WHERE badge_id = $1", badge.ID)
@@ -221,18 +298,18 @@ func (db *DB) UpdateBadge(badge *Badge, criteria *BadgeCriteria) error {
 			// Update existing criteria
 			criteriaQuery := `
 				UPDATE badge_criteria
-				SET flow_definition = $1, updated_at = NOW()
-				WHERE badge_id = $2
+				SET flow_definition = $1, expression = $2, updated_at = NOW()
+				WHERE badge_id = $3
 				RETURNING id, updated_at`
-			err = tx.QueryRow(criteriaQuery, criteria.FlowDefinition, badge.ID).
+			err = tx.QueryRow(criteriaQuery, criteria.FlowDefinition, criteria.Expression, badge.ID).
 				Scan(&criteria.ID, &criteria.UpdatedAt)
 		} else {
 			// Insert new criteria
 			criteriaQuery := `
-				INSERT INTO badge_criteria (badge_id, flow_definition)
-				VALUES ($1, $2)
+				INSERT INTO badge_criteria (badge_id, flow_definition, expression)
+				VALUES ($1, $2, $3)
 				RETURNING id, created_at, updated_at`
-			err = tx.QueryRow(criteriaQuery, badge.ID, criteria.FlowDefinition).
+			err = tx.QueryRow(criteriaQuery, badge.ID, criteria.FlowDefinition, criteria.Expression).
 				Scan(&criteria.ID, &criteria.CreatedAt, &criteria.UpdatedAt)
 		}
 		if err != nil {
@@ -240,41 +317,269 @@ func (db *DB) UpdateBadge(badge *Badge, criteria *BadgeCriteria) error {
 		}
 	}
 
+	// Replace tiers if requested
+	if tiers != nil {
+		_, err = tx.Exec("DELETE FROM badge_tiers WHERE badge_id = $1", badge.ID)
+		if err != nil {
+			return err
+		}
+		err = insertBadgeTiers(tx, badge.ID, tiers)
+		if err != nil {
+			return err
+		}
+	}
+
 	// Commit transaction
 	return tx.Commit()
 }
 
 // DeleteBadge deletes a badge and its criteria
 func (db *DB) DeleteBadge(id int) error {
-	_, err := db.Exec("DELETE FROM badges WHERE id = $1", id)
+	// The badge's awards are deleted with it, and no longer count on leaderboards
+	_, err := db.Exec(`
+		WITH held AS (
+			SELECT * FROM user_badges WHERE badge_id = $1 AND status = $2
+		)`+leaderboardUpdateSQL("held", -1, "-badges.points")+`
+		DELETE FROM badges WHERE id = $1`,
+		id, UserBadgeStatusActive)
 	return err
 }
 
-// CreateEvent creates a new event
+// insertEventSQL inserts an event unless the user already has one with the same idempotency key,
+// in which case no row is returned
+const insertEventSQL = `
+	INSERT INTO events (event_type_id, user_id, payload, occurred_at, timezone, processing_status, idempotency_key)
+	VALUES ($1, $2, $3, $4, $5, $6, $7)
+	ON CONFLICT (user_id, idempotency_key) WHERE idempotency_key IS NOT NULL DO NOTHING
+	RETURNING id`
+
+// eventInserter is a query runner events are saved with: the database or a transaction
+type eventInserter interface {
+	QueryRow(query string, args ...interface{}) *sql.Row
+	Get(dest interface{}, query string, args ...interface{}) error
+}
+
+// CreateEvent creates a new event. When the user already has an event with the same
+// idempotency key, nothing is inserted: the event is replaced by the original one and
+// marked as replayed.
 func (db *DB) CreateEvent(event *Event) error {
+	return insertEvent(db, event)
+}
+
+// CreateEvents creates several events in a single transaction, so that either all of them are
+// saved or none is. Events repeating the idempotency key of an existing event, or of an
+// earlier event of the batch, are replaced by the original as in CreateEvent.
+func (db *DB) CreateEvents(events []*Event) error {
+	// Start a transaction
+	tx, err := db.Beginx()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	for _, event := range events {
+		if err = insertEvent(tx, event); err != nil {
+			return err
+		}
+	}
+
+	// Commit transaction
+	err = tx.Commit()
+	return err
+}
+
+// insertEvent inserts an event, or loads the original when its idempotency key was already used.
+// Events are queued as pending unless they are given another status.
+func insertEvent(q eventInserter, event *Event) error {
+	if event.ProcessingStatus == "" {
+		event.ProcessingStatus = EventStatusPending
+	}
+
+	err := q.QueryRow(insertEventSQL, event.EventTypeID, event.UserID, event.Payload, event.OccurredAt,
+		event.Timezone, event.ProcessingStatus, event.IdempotencyKey).Scan(&event.ID)
+	if !errors.Is(err, sql.ErrNoRows) || event.IdempotencyKey == nil {
+		return err
+	}
+
+	var original Event
+	if err := q.Get(&original, "SELECT * FROM events WHERE user_id = $1 AND idempotency_key = $2",
+		event.UserID, *event.IdempotencyKey); err != nil {
+		return fmt.Errorf("failed to load event with idempotency key '%s': %w", *event.IdempotencyKey, err)
+	}
+	*event = original
+	event.Replayed = true
+	return nil
+}
+
+// GetEventByID retrieves an event by ID
+func (db *DB) GetEventByID(id int) (Event, error) {
+	var event Event
+	err := db.Get(&event, "SELECT * FROM events WHERE id = $1", id)
+	return event, err
+}
+
+// ClaimPendingEvents locks up to limit events that are due for processing and marks them as
+// processing. Claimed events are leased for the given duration; if the worker dies before
+// finishing, the event becomes claimable again once the lease expires.
+func (db *DB) ClaimPendingEvents(limit int, lease time.Duration) ([]Event, error) {
 	query := `
-		INSERT INTO events (event_type_id, user_id, payload, occurred_at)
-		VALUES ($1, $2, $3, $4)
-		RETURNING id`
-	return db.QueryRow(query, event.EventTypeID, event.UserID, event.Payload, event.OccurredAt).
-		Scan(&event.ID)
+		UPDATE events
+		SET processing_status = $1, attempts = attempts + 1, next_attempt_at = NOW() + make_interval(secs => $2)
+		WHERE id IN (
+			SELECT id FROM events
+			WHERE processing_status IN ($3, $1) AND next_attempt_at <= NOW()
+			ORDER BY next_attempt_at, id
+			LIMIT $4
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING *`
+	var events []Event
+	err := db.Select(&events, query, EventStatusProcessing, lease.Seconds(), EventStatusPending, limit)
+	return events, err
 }
 
-// GetUserEvents retrieves all events for a specific user
+// MarkEventProcessed records that an event has been evaluated successfully
+func (db *DB) MarkEventProcessed(id int) error {
+	_, err := db.Exec(`
+		UPDATE events
+		SET processing_status = $1, processed_at = NOW(), last_error = NULL
+		WHERE id = $2`, EventStatusProcessed, id)
+	return err
+}
+
+// MarkEventsProcessed records that several events have been evaluated successfully
+func (db *DB) MarkEventsProcessed(ids []int) error {
+	eventIDs := make([]int64, len(ids))
+	for i, id := range ids {
+		eventIDs[i] = int64(id)
+	}
+
+	_, err := db.Exec(`
+		UPDATE events
+		SET processing_status = $1, processed_at = NOW(), last_error = NULL
+		WHERE id = ANY($2)`, EventStatusProcessed, pq.Array(eventIDs))
+	return err
+}
+
+// MarkEventFailed records that the evaluation of an event failed when it was received
+func (db *DB) MarkEventFailed(id int, lastError string) error {
+	return db.MarkEventsFailed([]int{id}, lastError)
+}
+
+// MarkEventsFailed records that the evaluation of several events failed when they were received
+func (db *DB) MarkEventsFailed(ids []int, lastError string) error {
+	eventIDs := make([]int64, len(ids))
+	for i, id := range ids {
+		eventIDs[i] = int64(id)
+	}
+
+	_, err := db.Exec(`
+		UPDATE events
+		SET processing_status = $1, last_error = $2
+		WHERE id = ANY($3)`, EventStatusFailed, lastError, pq.Array(eventIDs))
+	return err
+}
+
+// ScheduleEventRetry puts a failed event back in the queue to be retried at the given time
+func (db *DB) ScheduleEventRetry(id int, nextAttemptAt time.Time, lastError string) error {
+	_, err := db.Exec(`
+		UPDATE events
+		SET processing_status = $1, next_attempt_at = $2, last_error = $3
+		WHERE id = $4`, EventStatusPending, nextAttemptAt, lastError, id)
+	return err
+}
+
+// DeadLetterEvent moves an event that kept failing to the dead-letter table
+func (db *DB) DeadLetterEvent(event Event, lastError string) error {
+	// Start a transaction
+	tx, err := db.Beginx()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	_, err = tx.Exec(`
+		UPDATE events
+		SET processing_status = $1, last_error = $2
+		WHERE id = $3`, EventStatusDead, lastError, event.ID)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`
+		INSERT INTO event_dead_letters (event_id, user_id, attempts, last_error)
+		VALUES ($1, $2, $3, $4)`, event.ID, event.UserID, event.Attempts, lastError)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// GetEventDeadLetters retrieves the most recent dead-lettered events
+func (db *DB) GetEventDeadLetters(limit int) ([]EventDeadLetter, error) {
+	var deadLetters []EventDeadLetter
+	err := db.Select(&deadLetters, "SELECT * FROM event_dead_letters ORDER BY failed_at DESC LIMIT $1", limit)
+	return deadLetters, err
+}
+
+// userTimezoneSQL selects the timezone of user $1: the one on their profile, or else the
+// one sent with their latest event. It is NULL when the user never gave one.
+const userTimezoneSQL = `
+	SELECT COALESCE(
+		(SELECT timezone FROM user_profiles WHERE user_id = $1),
+		(SELECT timezone FROM events WHERE user_id = $1 AND timezone IS NOT NULL ORDER BY occurred_at DESC, id DESC LIMIT 1)
+	) AS timezone`
+
+// userEventsSQL selects the events of user $1 for evaluation. Events sent without a
+// timezone take the user's timezone.
+const userEventsSQL = `
+	WITH user_timezone AS (` + userTimezoneSQL + `)
+	SELECT e.id, e.event_type_id, e.user_id, e.payload, e.occurred_at, e.processing_status, e.attempts,
+		e.next_attempt_at, e.last_error, e.processed_at, COALESCE(e.timezone, u.timezone) AS timezone
+	FROM events e CROSS JOIN user_timezone u
+	WHERE e.user_id = $1`
+
+// GetUserEvents retrieves all events for a user
 func (db *DB) GetUserEvents(userID string) ([]Event, error) {
 	var events []Event
-	err := db.Select(&events, "SELECT * FROM events WHERE user_id = $1 ORDER BY occurred_at DESC", userID)
+	err := db.Select(&events, userEventsSQL+" ORDER BY e.occurred_at DESC", userID)
+	return events, err
+}
+
+// GetUserEventsInRange retrieves a user's events that occurred within [start, end]
+func (db *DB) GetUserEventsInRange(userID string, start, end time.Time) ([]Event, error) {
+	var events []Event
+	err := db.Select(&events, userEventsSQL+`
+		AND e.occurred_at >= $2 AND e.occurred_at <= $3
+		ORDER BY e.occurred_at DESC`,
+		userID, start, end)
 	return events, err
 }
 
 // GetUserEventsByType retrieves events of a specific type for a user
 func (db *DB) GetUserEventsByType(userID string, eventTypeID int) ([]Event, error) {
 	var events []Event
-	err := db.Select(&events, "SELECT * FROM events WHERE user_id = $1 AND event_type_id = $2 ORDER BY occurred_at DESC",
+	err := db.Select(&events, userEventsSQL+" AND e.event_type_id = $2 ORDER BY e.occurred_at DESC",
 		userID, eventTypeID)
 	return events, err
 }
 
+// GetUserTimezone retrieves the timezone of a user, or an empty string when they never gave one
+func (db *DB) GetUserTimezone(userID string) (string, error) {
+	var timezone sql.NullString
+	err := db.Get(&timezone, userTimezoneSQL, userID)
+	return timezone.String, err
+}
+
 // GetUserBadges retrieves all badges awarded to a user
 func (db *DB) GetUserBadges(userID string) ([]UserBadge, error) {
 	var userBadges []UserBadge
@@ -282,53 +587,375 @@ func (db *DB) GetUserBadges(userID string) ([]UserBadge, error) {
 	return userBadges, err
 }
 
-// AwardBadgeToUser awards a badge to a user
-func (db *DB) AwardBadgeToUser(userBadge *UserBadge) error {
-	// Check if user already has this badge
-	var count int
-	err := db.Get(&count, "SELECT COUNT(*) FROM user_badges WHERE user_id = $1 AND badge_id = $2",
-		userBadge.UserID, userBadge.BadgeID)
+// AwardBadgeToUser awards a badge to a user and reports whether the award was recorded.
+// Tiered and repeatable badges may be awarded several times; an award with the same tier and
+// occurrence is never recorded twice, even by evaluations of the same user running at once.
+func (db *DB) AwardBadgeToUser(userBadge *UserBadge) (bool, error) {
+	if userBadge.Occurrence == 0 {
+		userBadge.Occurrence = 1
+	}
+	if userBadge.Status == "" {
+		userBadge.Status = UserBadgeStatusActive
+	}
+
+	// Award the badge and queue its webhook notification in the same statement,
+	// so the notification is written if and only if the award is. An award already
+	// recorded inserts nothing, and no row is returned.
+	query := `
+		WITH awarded AS (
+			INSERT INTO user_badges (user_id, badge_id, metadata, tier, occurrence, period_key, status, expires_at)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+			ON CONFLICT (user_id, badge_id, COALESCE(tier, 0), occurrence) DO NOTHING
+			RETURNING *
+		), outbox AS (
+			INSERT INTO webhook_outbox (event_type, user_id, badge_id, payload)
+			SELECT $9, user_id, badge_id, ` + userBadgeWebhookPayload + ` FROM awarded
+			RETURNING *
+		)` + leaderboardUpdateSQL("awarded", 1, "badges.points") + `
+		SELECT awarded.id, awarded.awarded_at,
+			outbox.id, outbox.event_type, outbox.user_id, outbox.badge_id, outbox.payload, outbox.created_at
+		FROM awarded, outbox`
+	notification := &WebhookOutbox{}
+	err := db.QueryRow(query, userBadge.UserID, userBadge.BadgeID, userBadge.Metadata,
+		userBadge.Tier, userBadge.Occurrence, userBadge.PeriodKey, userBadge.Status, userBadge.ExpiresAt,
+		WebhookEventBadgeAwarded).
+		Scan(&userBadge.ID, &userBadge.AwardedAt,
+			&notification.ID, &notification.EventType, &notification.UserID, &notification.BadgeID,
+			&notification.Payload, &notification.CreatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
 	if err != nil {
-		return err
+		return false, err
 	}
+	userBadge.Notification = notification
+	return true, nil
+}
 
-	// If user already has the badge, don't award it again
-	if count > 0 {
-		return nil
+// userBadgeWebhookPayload builds the webhook payload of an award from a user_badges row
+const userBadgeWebhookPayload = `jsonb_build_object(
+	'user_badge_id', id, 'user_id', user_id, 'badge_id', badge_id,
+	'badge_name', (SELECT name FROM badges WHERE badges.id = badge_id),
+	'tier', tier, 'occurrence', occurrence, 'period_key', period_key, 'status', status,
+	'awarded_at', awarded_at, 'expires_at', expires_at,
+	'revoked_at', revoked_at, 'revocation_reason', revocation_reason, 'metadata', metadata)`
+
+// leaderboardUpdateSQL returns CTEs, to follow the CTE named source, that add to the leaderboards
+// count and points for each award source returns. Awards count on the day they were made, in UTC.
+// The points expression may refer to the badge of the award as badges. Badges are read under a
+// share lock, so that a change of their points waits for the statement's transaction, and the
+// points it scores are the ones the change re-scores.
+//
+// A positive count also adds the awards to their badge's earners; a negative one removes them,
+// finding when the remaining active awards were first made.
+func leaderboardUpdateSQL(source string, count int, points string) string {
+	ctes := fmt.Sprintf(`, %[1]s_badges AS (
+			SELECT id, points FROM badges WHERE id IN (SELECT badge_id FROM %[1]s) FOR SHARE
+		), %[1]s_scores AS (
+			SELECT %[1]s.user_id, (%[1]s.awarded_at AT TIME ZONE 'UTC')::date AS day,
+				%[2]d * COUNT(*) AS badge_count, SUM(%[3]s) AS points
+			FROM %[1]s JOIN %[1]s_badges AS badges ON badges.id = %[1]s.badge_id
+			GROUP BY 1, 2
+		), %[1]s_daily AS (
+			INSERT INTO leaderboard_daily AS daily (user_id, day, badge_count, points)
+			SELECT user_id, day, badge_count, points FROM %[1]s_scores
+			ON CONFLICT (user_id, day) DO UPDATE
+			SET badge_count = daily.badge_count + EXCLUDED.badge_count, points = daily.points + EXCLUDED.points
+		), %[1]s_totals AS (
+			INSERT INTO leaderboard_totals AS totals (user_id, badge_count, points)
+			SELECT user_id, SUM(badge_count), SUM(points) FROM %[1]s_scores GROUP BY user_id
+			ON CONFLICT (user_id) DO UPDATE
+			SET badge_count = totals.badge_count + EXCLUDED.badge_count, points = totals.points + EXCLUDED.points
+		)`, source, count, points)
+
+	switch {
+	case count > 0:
+		// A row whose count dropped to zero keeps the time of its last awards, which is replaced
+		ctes += fmt.Sprintf(`, %[1]s_earners AS (
+			SELECT badge_id, user_id, (awarded_at AT TIME ZONE 'UTC')::date AS day,
+				%[2]d * COUNT(*) AS badge_count, MIN(awarded_at) AS first_awarded_at
+			FROM %[1]s GROUP BY 1, 2, 3
+		), %[1]s_badge_daily AS (
+			INSERT INTO leaderboard_badge_daily AS daily (badge_id, user_id, day, badge_count, first_awarded_at)
+			SELECT badge_id, user_id, day, badge_count, first_awarded_at FROM %[1]s_earners
+			ON CONFLICT (badge_id, user_id, day) DO UPDATE
+			SET badge_count = daily.badge_count + EXCLUDED.badge_count,
+				first_awarded_at = CASE WHEN daily.badge_count > 0
+					THEN LEAST(daily.first_awarded_at, EXCLUDED.first_awarded_at)
+					ELSE EXCLUDED.first_awarded_at END
+		), %[1]s_badge_totals AS (
+			INSERT INTO leaderboard_badge_totals AS totals (badge_id, user_id, badge_count, first_awarded_at)
+			SELECT badge_id, user_id, SUM(badge_count), MIN(first_awarded_at) FROM %[1]s_earners GROUP BY 1, 2
+			ON CONFLICT (badge_id, user_id) DO UPDATE
+			SET badge_count = totals.badge_count + EXCLUDED.badge_count,
+				first_awarded_at = CASE WHEN totals.badge_count > 0
+					THEN LEAST(totals.first_awarded_at, EXCLUDED.first_awarded_at)
+					ELSE EXCLUDED.first_awarded_at END
+		)`, source, count)
+	case count < 0:
+		// The statement still sees the awards of source as active, so they are left out when
+		// finding the first of the remaining ones
+		ctes += fmt.Sprintf(`, %[1]s_earners AS (
+			SELECT badge_id, user_id, (awarded_at AT TIME ZONE 'UTC')::date AS day, %[2]d * COUNT(*) AS badge_count
+			FROM %[1]s GROUP BY 1, 2, 3
+		), %[1]s_badge_daily AS (
+			UPDATE leaderboard_badge_daily AS daily
+			SET badge_count = daily.badge_count + earners.badge_count,
+				first_awarded_at = COALESCE((
+					SELECT MIN(ub.awarded_at) FROM user_badges ub
+					WHERE ub.badge_id = daily.badge_id AND ub.user_id = daily.user_id AND ub.status = '%[3]s'
+						AND (ub.awarded_at AT TIME ZONE 'UTC')::date = daily.day
+						AND ub.id NOT IN (SELECT id FROM %[1]s)
+				), daily.first_awarded_at)
+			FROM %[1]s_earners earners
+			WHERE daily.badge_id = earners.badge_id AND daily.user_id = earners.user_id AND daily.day = earners.day
+		), %[1]s_badge_totals AS (
+			UPDATE leaderboard_badge_totals AS totals
+			SET badge_count = totals.badge_count + earners.badge_count,
+				first_awarded_at = COALESCE((
+					SELECT MIN(ub.awarded_at) FROM user_badges ub
+					WHERE ub.badge_id = totals.badge_id AND ub.user_id = totals.user_id AND ub.status = '%[3]s'
+						AND ub.id NOT IN (SELECT id FROM %[1]s)
+				), totals.first_awarded_at)
+			FROM (SELECT badge_id, user_id, SUM(badge_count) AS badge_count FROM %[1]s_earners GROUP BY 1, 2) earners
+			WHERE totals.badge_id = earners.badge_id AND totals.user_id = earners.user_id
+		)`, source, count, UserBadgeStatusActive)
 	}
+	return ctes + "\n\t\t"
+}
 
-	// Award the badge
-	query := `
-		INSERT INTO user_badges (user_id, badge_id, metadata)
-		VALUES ($1, $2, $3)
-		RETURNING id, awarded_at`
-	return db.QueryRow(query, userBadge.UserID, userBadge.BadgeID, userBadge.Metadata).
-		Scan(&userBadge.ID, &userBadge.AwardedAt)
+// RevokeUserBadge revokes or expires all of a user's active awards of a badge, recording the
+// reason and time instead of deleting them, and queues a webhook notification for each.
+// It returns the notifications queued, one per award affected.
+func (db *DB) RevokeUserBadge(userID string, badgeID int, status, reason string) ([]WebhookOutbox, error) {
+	var notifications []WebhookOutbox
+	err := db.Select(&notifications, `
+		WITH revoked AS (
+			UPDATE user_badges
+			SET status = $1, revoked_at = NOW(), revocation_reason = $2
+			WHERE user_id = $3 AND badge_id = $4 AND status = $5
+			RETURNING *
+		)`+leaderboardUpdateSQL("revoked", -1, "-badges.points")+`
+		INSERT INTO webhook_outbox (event_type, user_id, badge_id, payload)
+		SELECT $6, user_id, badge_id, `+userBadgeWebhookPayload+` FROM revoked
+		RETURNING *`,
+		status, reason, userID, badgeID, UserBadgeStatusActive, WebhookEventBadgeRevoked)
+	return notifications, err
+}
+
+// ExpireUserBadges marks the active awards whose validity period has ended as expired,
+// queueing a webhook notification for each. It returns the notifications queued.
+func (db *DB) ExpireUserBadges() ([]WebhookOutbox, error) {
+	var notifications []WebhookOutbox
+	err := db.Select(&notifications, `
+		WITH expired AS (
+			UPDATE user_badges
+			SET status = $1, revoked_at = expires_at, revocation_reason = 'validity period ended'
+			WHERE status = $2 AND expires_at <= NOW()
+			RETURNING *
+		)`+leaderboardUpdateSQL("expired", -1, "-badges.points")+`
+		INSERT INTO webhook_outbox (event_type, user_id, badge_id, payload)
+		SELECT $3, user_id, badge_id, `+userBadgeWebhookPayload+` FROM expired
+		RETURNING *`,
+		UserBadgeStatusExpired, UserBadgeStatusActive, WebhookEventBadgeRevoked)
+	return notifications, err
+}
+
+// ExpireUserBadgeAwards marks the given active awards as expired with the reason, queueing a
+// webhook notification for each. It returns the notifications queued.
+func (db *DB) ExpireUserBadgeAwards(ids []int, reason string) ([]WebhookOutbox, error) {
+	awardIDs := make([]int64, len(ids))
+	for i, id := range ids {
+		awardIDs[i] = int64(id)
+	}
+
+	var notifications []WebhookOutbox
+	err := db.Select(&notifications, `
+		WITH expired AS (
+			UPDATE user_badges
+			SET status = $1, revoked_at = NOW(), revocation_reason = $2
+			WHERE id = ANY($3) AND status = $4
+			RETURNING *
+		)`+leaderboardUpdateSQL("expired", -1, "-badges.points")+`
+		INSERT INTO webhook_outbox (event_type, user_id, badge_id, payload)
+		SELECT $5, user_id, badge_id, `+userBadgeWebhookPayload+` FROM expired
+		RETURNING *`,
+		UserBadgeStatusExpired, reason, pq.Array(awardIDs), UserBadgeStatusActive, WebhookEventBadgeRevoked)
+	return notifications, err
+}
+
+// GetBadgeHoldersDueForRecheck retrieves the users holding a badge whose awards were
+// not re-evaluated since the given time
+func (db *DB) GetBadgeHoldersDueForRecheck(badgeID int, checkedBefore time.Time) ([]string, error) {
+	var userIDs []string
+	err := db.Select(&userIDs, `
+		SELECT DISTINCT user_id FROM user_badges
+		WHERE badge_id = $1 AND status = $2
+			AND (expires_at IS NULL OR expires_at > NOW())
+			AND (last_checked_at IS NULL OR last_checked_at < $3)
+		ORDER BY user_id`,
+		badgeID, UserBadgeStatusActive, checkedBefore)
+	return userIDs, err
+}
+
+// MarkUserBadgeChecked records that a user's active awards of a badge were re-evaluated
+func (db *DB) MarkUserBadgeChecked(userID string, badgeID int) error {
+	_, err := db.Exec(`
+		UPDATE user_badges
+		SET last_checked_at = NOW()
+		WHERE user_id = $1 AND badge_id = $2 AND status = $3`,
+		userID, badgeID, UserBadgeStatusActive)
+	return err
+}
+
+// GetLeaderboard retrieves a page of a leaderboard and the number of users on it. Rankings are
+// read from the leaderboard tables, the whole time or by day when a range of days is given.
+func (db *DB) GetLeaderboard(query LeaderboardQuery) ([]LeaderboardEntry, int, error) {
+	var ranked string
+	var args []interface{}
+	switch {
+	case query.By == LeaderboardByBadge && query.From == "" && query.To == "":
+		ranked = `
+			SELECT ROW_NUMBER() OVER (ORDER BY e.first_awarded_at, e.user_id) AS rank, e.user_id,
+				e.badge_count, e.badge_count * b.points AS points, e.first_awarded_at
+			FROM leaderboard_badge_totals e JOIN badges b ON b.id = e.badge_id
+			WHERE e.badge_id = $1 AND e.badge_count > 0`
+		args = []interface{}{query.BadgeID}
+	case query.By == LeaderboardByBadge:
+		ranked = `
+			SELECT ROW_NUMBER() OVER (ORDER BY MIN(e.first_awarded_at), e.user_id) AS rank, e.user_id,
+				SUM(e.badge_count) AS badge_count, SUM(e.badge_count) * b.points AS points,
+				MIN(e.first_awarded_at) AS first_awarded_at
+			FROM leaderboard_badge_daily e JOIN badges b ON b.id = e.badge_id
+			WHERE e.badge_id = $1 AND e.badge_count > 0
+				AND ($2::date IS NULL OR e.day >= $2::date) AND ($3::date IS NULL OR e.day <= $3::date)
+			GROUP BY e.user_id, b.points`
+		args = []interface{}{query.BadgeID, nullableDate(query.From), nullableDate(query.To)}
+	case query.From == "" && query.To == "":
+		ranked = fmt.Sprintf(`
+			SELECT RANK() OVER (ORDER BY %[1]s DESC) AS rank, user_id, badge_count, points
+			FROM leaderboard_totals
+			WHERE %[1]s > 0`, leaderboardColumn(query.By))
+	default:
+		ranked = fmt.Sprintf(`
+			SELECT RANK() OVER (ORDER BY SUM(%[1]s) DESC) AS rank, user_id,
+				SUM(badge_count) AS badge_count, SUM(points) AS points
+			FROM leaderboard_daily
+			WHERE ($1::date IS NULL OR day >= $1::date) AND ($2::date IS NULL OR day <= $2::date)
+			GROUP BY user_id
+			HAVING SUM(%[1]s) > 0`, leaderboardColumn(query.By))
+		args = []interface{}{nullableDate(query.From), nullableDate(query.To)}
+	}
+
+	var total int
+	if err := db.Get(&total, "SELECT COUNT(*) FROM ("+ranked+") ranked", args...); err != nil {
+		return nil, 0, err
+	}
+
+	entries := []LeaderboardEntry{}
+	page := fmt.Sprintf(" ORDER BY rank, user_id LIMIT $%d OFFSET $%d", len(args)+1, len(args)+2)
+	err := db.Select(&entries, "SELECT * FROM ("+ranked+") ranked"+page, append(args, query.Limit, query.Offset)...)
+	return entries, total, err
+}
+
+// leaderboardColumn returns the column of the leaderboard tables users are ranked by
+func leaderboardColumn(by string) string {
+	if by == LeaderboardByPoints {
+		return "points"
+	}
+	return "badge_count"
+}
+
+// nullableDate returns a YYYY-MM-DD date as a query argument, or NULL when it is empty
+func nullableDate(date string) interface{} {
+	if date == "" {
+		return nil
+	}
+	return date
 }
 
-// GetUserBadgeDetails retrieves details of badges awarded to a user
-func (db *DB) GetUserBadgeDetails(userID string) ([]map[string]interface{}, error) {
+// GetUserBadgeDetails retrieves the badges a user holds, one entry per badge with its current
+// tier and the full award history, including revoked and expired awards, most recent first
+func (db *DB) GetUserBadgeDetails(userID string) ([]UserBadgeSummary, error) {
 	query := `
-		SELECT b.id, b.name, b.description, b.image_url, ub.awarded_at, ub.metadata
+		SELECT ub.*, b.name AS badge_name, b.description AS badge_description,
+			b.image_url AS badge_image_url, bt.name AS tier_name
 		FROM user_badges ub
 		JOIN badges b ON ub.badge_id = b.id
+		LEFT JOIN badge_tiers bt ON bt.badge_id = ub.badge_id AND bt.level = ub.tier
 		WHERE ub.user_id = $1
-		ORDER BY ub.awarded_at DESC`
+		ORDER BY ub.awarded_at DESC, ub.id DESC`
 
-	rows, err := db.Queryx(query, userID)
-	if err != nil {
+	var rows []struct {
+		UserBadge
+		BadgeName        string  `db:"badge_name"`
+		BadgeDescription *string `db:"badge_description"`
+		BadgeImageURL    *string `db:"badge_image_url"`
+		TierName         *string `db:"tier_name"`
+	}
+	if err := db.Select(&rows, query, userID); err != nil {
 		return nil, err
 	}
-	defer rows.Close()
 
-	var result []map[string]interface{}
-	for rows.Next() {
-		row := make(map[string]interface{})
-		err := rows.MapScan(row)
-		if err != nil {
-			return nil, err
+	now := time.Now()
+	summaries := make(map[int]*UserBadgeSummary)
+	var order []int
+	for _, row := range rows {
+		award := UserBadgeAward{
+			Tier:             row.Tier,
+			Occurrence:       row.Occurrence,
+			PeriodKey:        row.PeriodKey,
+			AwardedAt:        row.AwardedAt,
+			Metadata:         row.Metadata,
+			Status:           row.Status,
+			ExpiresAt:        row.ExpiresAt,
+			RevokedAt:        row.RevokedAt,
+			RevocationReason: row.RevocationReason,
+		}
+		if row.TierName != nil {
+			award.TierName = *row.TierName
+		}
+		if award.Status == UserBadgeStatusActive && !row.IsActive(now) {
+			// Lapsed, but not yet marked by the expiry job
+			award.Status = UserBadgeStatusExpired
+		}
+
+		summary, seen := summaries[row.BadgeID]
+		if !seen {
+			summary = &UserBadgeSummary{ID: row.BadgeID, Name: row.BadgeName}
+			if row.BadgeDescription != nil {
+				summary.Description = *row.BadgeDescription
+			}
+			if row.BadgeImageURL != nil {
+				summary.ImageURL = *row.BadgeImageURL
+			}
+			summaries[row.BadgeID] = summary
+			order = append(order, row.BadgeID)
+		}
+		summary.History = append(summary.History, award)
+
+		if award.Status != UserBadgeStatusActive {
+			continue
+		}
+
+		// Rows are newest first, so the first active row of a badge is its latest award
+		if summary.AwardCount == 0 {
+			summary.AwardedAt = award.AwardedAt
+			summary.Metadata = award.Metadata
+		}
+		summary.AwardCount++
+		if award.Tier != nil && (summary.CurrentTier == nil || *award.Tier > *summary.CurrentTier) {
+			summary.CurrentTier = award.Tier
+			summary.CurrentTierName = award.TierName
+		}
+	}
+
+	// Only badges with an active award are still held
+	result := []UserBadgeSummary{}
+	for _, badgeID := range order {
+		if summaries[badgeID].AwardCount > 0 {
+			result = append(result, *summaries[badgeID])
 		}
-		result = append(result, row)
 	}
 
 	return result, nil
@@ -348,13 +975,20 @@ func (db *DB) GetConditionTypeByID(id int) (ConditionType, error) {
 	return conditionType, err
 }
 
+// GetConditionTypeByName retrieves a condition type by name
+func (db *DB) GetConditionTypeByName(name string) (ConditionType, error) {
+	var conditionType ConditionType
+	err := db.Get(&conditionType, "SELECT * FROM condition_types WHERE name = $1", name)
+	return conditionType, err
+}
+
 // CreateConditionType creates a new condition type
 func (db *DB) CreateConditionType(ct *ConditionType) error {
 	query := `
-		INSERT INTO condition_types (name, description, evaluation_logic)
-		VALUES ($1, $2, $3)
+		INSERT INTO condition_types (name, description, evaluation_logic, parameters, flow_template)
+		VALUES ($1, $2, $3, $4, $5)
 		RETURNING id, created_at, updated_at`
-	return db.QueryRow(query, ct.Name, ct.Description, ct.EvaluationLogic).
+	return db.QueryRow(query, ct.Name, ct.Description, ct.EvaluationLogic, ct.Parameters, ct.FlowTemplate).
 		Scan(&ct.ID, &ct.CreatedAt, &ct.UpdatedAt)
 }
 
@@ -362,10 +996,11 @@ func (db *DB) CreateConditionType(ct *ConditionType) error {
 func (db *DB) UpdateConditionType(ct *ConditionType) error {
 	query := `
 		UPDATE condition_types
-		SET name = $1, description = $2, evaluation_logic = $3, updated_at = NOW()
-		WHERE id = $4
+		SET name = $1, description = $2, evaluation_logic = $3, parameters = $4,
+			flow_template = $5, updated_at = NOW()
+		WHERE id = $6
 		RETURNING updated_at`
-	return db.QueryRow(query, ct.Name, ct.Description, ct.EvaluationLogic, ct.ID).
+	return db.QueryRow(query, ct.Name, ct.Description, ct.EvaluationLogic, ct.Parameters, ct.FlowTemplate, ct.ID).
 		Scan(&ct.UpdatedAt)
 }
 
@@ -374,3 +1009,395 @@ func (db *DB) DeleteConditionType(id int) error {
 	_, err := db.Exec("DELETE FROM condition_types WHERE id = $1", id)
 	return err
 }
+
+// GetAllHolidayCalendars retrieves all holiday calendars
+func (db *DB) GetAllHolidayCalendars() ([]HolidayCalendar, error) {
+	var calendars []HolidayCalendar
+	err := db.Select(&calendars, "SELECT * FROM holiday_calendars ORDER BY name")
+	return calendars, err
+}
+
+// GetHolidayCalendarByID retrieves a holiday calendar by ID
+func (db *DB) GetHolidayCalendarByID(id int) (HolidayCalendar, error) {
+	var calendar HolidayCalendar
+	err := db.Get(&calendar, "SELECT * FROM holiday_calendars WHERE id = $1", id)
+	return calendar, err
+}
+
+// GetHolidayCalendarByName retrieves a holiday calendar by name
+func (db *DB) GetHolidayCalendarByName(name string) (HolidayCalendar, error) {
+	var calendar HolidayCalendar
+	err := db.Get(&calendar, "SELECT * FROM holiday_calendars WHERE name = $1", name)
+	return calendar, err
+}
+
+// CreateHolidayCalendar creates a new holiday calendar
+func (db *DB) CreateHolidayCalendar(calendar *HolidayCalendar) error {
+	query := `
+		INSERT INTO holiday_calendars (name, description, holidays)
+		VALUES ($1, $2, $3)
+		RETURNING id, created_at, updated_at`
+	return db.QueryRow(query, calendar.Name, calendar.Description, calendar.Holidays).
+		Scan(&calendar.ID, &calendar.CreatedAt, &calendar.UpdatedAt)
+}
+
+// UpdateHolidayCalendar updates an existing holiday calendar
+func (db *DB) UpdateHolidayCalendar(calendar *HolidayCalendar) error {
+	query := `
+		UPDATE holiday_calendars
+		SET name = $1, description = $2, holidays = $3, updated_at = NOW()
+		WHERE id = $4
+		RETURNING updated_at`
+	return db.QueryRow(query, calendar.Name, calendar.Description, calendar.Holidays, calendar.ID).
+		Scan(&calendar.UpdatedAt)
+}
+
+// DeleteHolidayCalendar deletes a holiday calendar
+func (db *DB) DeleteHolidayCalendar(id int) error {
+	_, err := db.Exec("DELETE FROM holiday_calendars WHERE id = $1", id)
+	return err
+}
+
+// GetWebhookSubscriptions retrieves all webhook subscriptions
+func (db *DB) GetWebhookSubscriptions() ([]WebhookSubscription, error) {
+	var subscriptions []WebhookSubscription
+	err := db.Select(&subscriptions, "SELECT * FROM webhook_subscriptions ORDER BY id")
+	return subscriptions, err
+}
+
+// GetActiveWebhookSubscriptions retrieves the webhook subscriptions that receive notifications
+func (db *DB) GetActiveWebhookSubscriptions() ([]WebhookSubscription, error) {
+	var subscriptions []WebhookSubscription
+	err := db.Select(&subscriptions, "SELECT * FROM webhook_subscriptions WHERE active = true ORDER BY id")
+	return subscriptions, err
+}
+
+// GetWebhookSubscriptionByID retrieves a webhook subscription by ID
+func (db *DB) GetWebhookSubscriptionByID(id int) (WebhookSubscription, error) {
+	var subscription WebhookSubscription
+	err := db.Get(&subscription, "SELECT * FROM webhook_subscriptions WHERE id = $1", id)
+	return subscription, err
+}
+
+// CreateWebhookSubscription creates a new webhook subscription
+func (db *DB) CreateWebhookSubscription(subscription *WebhookSubscription) error {
+	query := `
+		INSERT INTO webhook_subscriptions (url, secret, filter, active)
+		VALUES ($1, $2, $3, $4)
+		RETURNING id, created_at, updated_at`
+	return db.QueryRow(query, subscription.URL, subscription.Secret, subscription.Filter, subscription.Active).
+		Scan(&subscription.ID, &subscription.CreatedAt, &subscription.UpdatedAt)
+}
+
+// UpdateWebhookSubscription updates an existing webhook subscription
+func (db *DB) UpdateWebhookSubscription(subscription *WebhookSubscription) error {
+	query := `
+		UPDATE webhook_subscriptions
+		SET url = $1, secret = $2, filter = $3, active = $4, updated_at = NOW()
+		WHERE id = $5
+		RETURNING updated_at`
+	return db.QueryRow(query, subscription.URL, subscription.Secret, subscription.Filter, subscription.Active, subscription.ID).
+		Scan(&subscription.UpdatedAt)
+}
+
+// DeleteWebhookSubscription deletes a webhook subscription and its deliveries
+func (db *DB) DeleteWebhookSubscription(id int) error {
+	_, err := db.Exec("DELETE FROM webhook_subscriptions WHERE id = $1", id)
+	return err
+}
+
+// GetUndispatchedWebhookOutbox retrieves the oldest notifications not yet turned into deliveries
+func (db *DB) GetUndispatchedWebhookOutbox(limit int) ([]WebhookOutbox, error) {
+	var entries []WebhookOutbox
+	err := db.Select(&entries, "SELECT * FROM webhook_outbox WHERE dispatched_at IS NULL ORDER BY id LIMIT $1", limit)
+	return entries, err
+}
+
+// GetWebhookOutboxEntry retrieves a notification by ID
+func (db *DB) GetWebhookOutboxEntry(id int) (WebhookOutbox, error) {
+	var entry WebhookOutbox
+	err := db.Get(&entry, "SELECT * FROM webhook_outbox WHERE id = $1", id)
+	return entry, err
+}
+
+// GetWebhookOutboxAfter retrieves up to limit notifications of a user queued after the
+// notification with the given ID, oldest first. An empty user ID matches every user.
+// IDs are assigned when a notification is inserted, not when its transaction commits, so a
+// notification committed after one with a higher ID was read is not returned.
+func (db *DB) GetWebhookOutboxAfter(userID string, afterID int, limit int) ([]WebhookOutbox, error) {
+	var entries []WebhookOutbox
+	err := db.Select(&entries, `
+		SELECT * FROM webhook_outbox
+		WHERE id > $1 AND ($2 = '' OR user_id = $2)
+		ORDER BY id LIMIT $3`,
+		afterID, userID, limit)
+	return entries, err
+}
+
+// NotifyChannel sends a Postgres notification to the sessions listening on a channel
+func (db *DB) NotifyChannel(channel, payload string) error {
+	_, err := db.Exec("SELECT pg_notify($1, $2)", channel, payload)
+	return err
+}
+
+// DispatchWebhookOutbox creates a delivery of a notification for each of the given subscriptions
+// and marks it as dispatched, in a single transaction. A notification already dispatched by
+// another server is left untouched.
+func (db *DB) DispatchWebhookOutbox(outboxID int, subscriptionIDs []int) error {
+	// Start a transaction
+	tx, err := db.Beginx()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	result, err := tx.Exec("UPDATE webhook_outbox SET dispatched_at = NOW() WHERE id = $1 AND dispatched_at IS NULL", outboxID)
+	if err != nil {
+		return err
+	}
+	dispatched, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if dispatched == 0 {
+		return tx.Rollback()
+	}
+
+	for _, subscriptionID := range subscriptionIDs {
+		_, err = tx.Exec("INSERT INTO webhook_deliveries (subscription_id, outbox_id) VALUES ($1, $2)",
+			subscriptionID, outboxID)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// ClaimWebhookDeliveries locks up to limit deliveries that are due and marks them as delivering.
+// Claimed deliveries are leased for the given duration, after which they can be claimed again.
+func (db *DB) ClaimWebhookDeliveries(limit int, lease time.Duration) ([]PendingWebhookDelivery, error) {
+	query := `
+		WITH claimed AS (
+			UPDATE webhook_deliveries
+			SET status = $1, attempts = attempts + 1, next_attempt_at = NOW() + make_interval(secs => $2)
+			WHERE id IN (
+				SELECT id FROM webhook_deliveries
+				WHERE status IN ($3, $1) AND next_attempt_at <= NOW()
+				ORDER BY next_attempt_at, id
+				LIMIT $4
+				FOR UPDATE SKIP LOCKED
+			)
+			RETURNING *
+		)
+		SELECT claimed.*, s.url, s.secret, o.event_type, o.payload, o.created_at AS outbox_created_at
+		FROM claimed
+		JOIN webhook_subscriptions s ON s.id = claimed.subscription_id
+		JOIN webhook_outbox o ON o.id = claimed.outbox_id`
+	var deliveries []PendingWebhookDelivery
+	err := db.Select(&deliveries, query, WebhookDeliveryDelivering, lease.Seconds(), WebhookDeliveryPending, limit)
+	return deliveries, err
+}
+
+// RecordWebhookAttempt records an attempt to send a delivery and updates the delivery's status.
+// nextAttemptAt is only used when the delivery is rescheduled as pending.
+func (db *DB) RecordWebhookAttempt(attempt *WebhookDeliveryAttempt, status string, nextAttemptAt time.Time) error {
+	// Start a transaction
+	tx, err := db.Beginx()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	err = tx.QueryRow(`
+		INSERT INTO webhook_delivery_attempts (delivery_id, response_status, error, duration_ms)
+		VALUES ($1, $2, $3, $4)
+		RETURNING id, attempted_at`,
+		attempt.DeliveryID, attempt.ResponseStatus, attempt.Error, attempt.DurationMs).
+		Scan(&attempt.ID, &attempt.AttemptedAt)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`
+		UPDATE webhook_deliveries
+		SET status = $1::VARCHAR, last_error = $2,
+			next_attempt_at = CASE WHEN $1 = $3 THEN $4 ELSE next_attempt_at END,
+			delivered_at = CASE WHEN $1 = $5 THEN NOW() ELSE delivered_at END
+		WHERE id = $6`,
+		status, attempt.Error, WebhookDeliveryPending, nextAttemptAt, WebhookDeliveryDelivered, attempt.DeliveryID)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// GetWebhookDeliveries retrieves the most recent deliveries of a subscription with their attempts
+func (db *DB) GetWebhookDeliveries(subscriptionID int, limit int) ([]WebhookDelivery, error) {
+	var deliveries []WebhookDelivery
+	err := db.Select(&deliveries, `
+		SELECT * FROM webhook_deliveries
+		WHERE subscription_id = $1
+		ORDER BY created_at DESC, id DESC
+		LIMIT $2`, subscriptionID, limit)
+	if err != nil || len(deliveries) == 0 {
+		return deliveries, err
+	}
+
+	ids := make([]int64, len(deliveries))
+	index := make(map[int]int, len(deliveries))
+	for i, delivery := range deliveries {
+		ids[i] = int64(delivery.ID)
+		index[delivery.ID] = i
+	}
+
+	var attempts []WebhookDeliveryAttempt
+	err = db.Select(&attempts, `
+		SELECT * FROM webhook_delivery_attempts
+		WHERE delivery_id = ANY($1)
+		ORDER BY attempted_at, id`, pq.Array(ids))
+	if err != nil {
+		return nil, err
+	}
+	for _, attempt := range attempts {
+		i := index[attempt.DeliveryID]
+		deliveries[i].AttemptLog = append(deliveries[i].AttemptLog, attempt)
+	}
+
+	return deliveries, nil
+}
+
+// CountEventUsers counts the distinct users who have sent events
+func (db *DB) CountEventUsers() (int, error) {
+	var count int
+	err := db.Get(&count, "SELECT COUNT(DISTINCT user_id) FROM events")
+	return count, err
+}
+
+// GetEventUserIDs retrieves up to limit distinct IDs of users who have sent events,
+// in order, starting after the given user ID
+func (db *DB) GetEventUserIDs(after string, limit int) ([]string, error) {
+	var userIDs []string
+	err := db.Select(&userIDs, `
+		SELECT DISTINCT user_id FROM events
+		WHERE user_id > $1
+		ORDER BY user_id
+		LIMIT $2`, after, limit)
+	return userIDs, err
+}
+
+// CreateBackfillJob creates a new pending backfill job
+func (db *DB) CreateBackfillJob(job *BackfillJob) error {
+	query := `
+		INSERT INTO backfill_jobs (badge_ids, dry_run, status, total_users)
+		VALUES ($1, $2, $3, $4)
+		RETURNING id, created_at, updated_at`
+	job.Status = BackfillPending
+	return db.QueryRow(query, job.BadgeIDs, job.DryRun, job.Status, job.TotalUsers).
+		Scan(&job.ID, &job.CreatedAt, &job.UpdatedAt)
+}
+
+// GetBackfillJobByID retrieves a backfill job by ID
+func (db *DB) GetBackfillJobByID(id int) (BackfillJob, error) {
+	var job BackfillJob
+	err := db.Get(&job, "SELECT * FROM backfill_jobs WHERE id = $1", id)
+	return job, err
+}
+
+// GetBackfillJobs retrieves the most recent backfill jobs
+func (db *DB) GetBackfillJobs(limit int) ([]BackfillJob, error) {
+	var jobs []BackfillJob
+	err := db.Select(&jobs, "SELECT * FROM backfill_jobs ORDER BY id DESC LIMIT $1", limit)
+	return jobs, err
+}
+
+// ClaimBackfillJob locks the oldest pending backfill job, or a running one whose lease expired
+// because the server running it stopped, and marks it as running. The claimed job is leased for
+// the given duration and must record progress before the lease expires to keep it.
+// It returns nil when there is no job to run.
+func (db *DB) ClaimBackfillJob(lease time.Duration) (*BackfillJob, error) {
+	query := `
+		UPDATE backfill_jobs
+		SET status = $1, lease_expires_at = NOW() + make_interval(secs => $2),
+			started_at = COALESCE(started_at, NOW()), updated_at = NOW()
+		WHERE id = (
+			SELECT id FROM backfill_jobs
+			WHERE status = $3 OR (status = $1 AND lease_expires_at <= NOW())
+			ORDER BY id
+			LIMIT 1
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING *`
+	var job BackfillJob
+	err := db.Get(&job, query, BackfillRunning, lease.Seconds(), BackfillPending)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
+
+// RecordBackfillProgress saves the progress of a running backfill job and renews its lease
+func (db *DB) RecordBackfillProgress(job *BackfillJob, lease time.Duration) error {
+	query := `
+		UPDATE backfill_jobs
+		SET last_user_id = $1, processed_users = $2, failed_users = $3, awarded = $4,
+			lease_expires_at = NOW() + make_interval(secs => $5), updated_at = NOW()
+		WHERE id = $6
+		RETURNING updated_at`
+	return db.QueryRow(query, job.LastUserID, job.ProcessedUsers, job.FailedUsers, job.Awarded, lease.Seconds(), job.ID).
+		Scan(&job.UpdatedAt)
+}
+
+// RenewBackfillLease extends the lease of a running backfill job without recording progress.
+// A zero lease releases the job, so that another server may claim it at once.
+func (db *DB) RenewBackfillLease(id int, lease time.Duration) error {
+	result, err := db.Exec(`
+		UPDATE backfill_jobs
+		SET lease_expires_at = NOW() + make_interval(secs => $1), updated_at = NOW()
+		WHERE id = $2 AND status = $3`, lease.Seconds(), id, BackfillRunning)
+	if err != nil {
+		return err
+	}
+	if rows, err := result.RowsAffected(); err == nil && rows == 0 {
+		return fmt.Errorf("backfill job %d is no longer running", id)
+	}
+	return nil
+}
+
+// FinishBackfillJob marks a backfill job as completed or failed
+func (db *DB) FinishBackfillJob(id int, status string, lastError *string) error {
+	_, err := db.Exec(`
+		UPDATE backfill_jobs
+		SET status = $1, last_error = $2, lease_expires_at = NULL, updated_at = NOW(), completed_at = NOW()
+		WHERE id = $3`, status, lastError, id)
+	return err
+}
+
+// GetUserProfile retrieves a user's profile
+func (db *DB) GetUserProfile(userID string) (UserProfile, error) {
+	var profile UserProfile
+	err := db.Get(&profile, "SELECT * FROM user_profiles WHERE user_id = $1", userID)
+	return profile, err
+}
+
+// UpsertUserProfile creates a user's profile or replaces the existing one
+func (db *DB) UpsertUserProfile(profile *UserProfile) error {
+	query := `
+		INSERT INTO user_profiles (user_id, timezone)
+		VALUES ($1, $2)
+		ON CONFLICT (user_id) DO UPDATE SET timezone = EXCLUDED.timezone, updated_at = NOW()
+		RETURNING created_at, updated_at`
+	return db.QueryRow(query, profile.UserID, profile.Timezone).Scan(&profile.CreatedAt, &profile.UpdatedAt)
+}
@@ -5,6 +5,9 @@ import (
 	"encoding/json"
 	"errors"
 	"time"
+
+	"github.com/badge-assignment-system/internal/schema"
+	"github.com/lib/pq"
 )
 
 // JSONB is a type for handling PostgreSQL JSONB data
@@ -41,29 +44,133 @@ type EventType struct {
 	UpdatedAt   time.Time `db:"updated_at" json:"updated_at"`
 }
 
-// ConditionType represents the condition_types table
-// WARNING: This feature is not fully implemented in the current system.
-// The database schema and API endpoints exist, but there is no JavaScript engine
-// to execute the evaluation_logic field. Badge criteria use the direct JSON-based
-// approach with operators instead.
+// ConditionType represents the condition_types table. A condition type is a reusable
+// flow definition template with declared parameters, invoked from badge flows with
+// {"$condition": {"name": ..., "params": {...}}}.
 type ConditionType struct {
-	ID              int       `db:"id" json:"id"`
-	Name            string    `db:"name" json:"name"`
-	Description     string    `db:"description" json:"description"`
-	EvaluationLogic string    `db:"evaluation_logic" json:"evaluation_logic"`
-	CreatedAt       time.Time `db:"created_at" json:"created_at"`
-	UpdatedAt       time.Time `db:"updated_at" json:"updated_at"`
+	ID              int                 `db:"id" json:"id"`
+	Name            string              `db:"name" json:"name"`
+	Description     string              `db:"description" json:"description"`
+	EvaluationLogic string              `db:"evaluation_logic" json:"evaluation_logic,omitempty"` // Deprecated: never executed, use FlowTemplate
+	Parameters      ConditionParameters `db:"parameters" json:"parameters"`
+	FlowTemplate    JSONB               `db:"flow_template" json:"flow_template"` // Flow definition with {"$param": name} placeholders
+	CreatedAt       time.Time           `db:"created_at" json:"created_at"`
+	UpdatedAt       time.Time           `db:"updated_at" json:"updated_at"`
+}
+
+// Condition parameter types
+const (
+	ConditionParamString   = "string"
+	ConditionParamNumber   = "number"
+	ConditionParamBoolean  = "boolean"
+	ConditionParamDuration = "duration" // A duration such as "12h" or "30d"
+	ConditionParamArray    = "array"
+	ConditionParamObject   = "object"
+)
+
+// ConditionParameter declares a parameter of a condition type
+type ConditionParameter struct {
+	Name        string      `json:"name"`
+	Type        string      `json:"type,omitempty"`    // One of the condition parameter types; empty accepts any value
+	Default     interface{} `json:"default,omitempty"` // Parameters without a default are required
+	Description string      `json:"description,omitempty"`
+}
+
+// ConditionParameters is the list of parameters declared by a condition type
+type ConditionParameters []ConditionParameter
+
+// Value implements the driver.Valuer interface for ConditionParameters
+func (p ConditionParameters) Value() (driver.Value, error) {
+	if p == nil {
+		return []byte("[]"), nil
+	}
+	return json.Marshal(p)
+}
+
+// Scan implements the sql.Scanner interface for ConditionParameters
+func (p *ConditionParameters) Scan(value interface{}) error {
+	if value == nil {
+		*p = nil
+		return nil
+	}
+	bytes, ok := value.([]byte)
+	if !ok {
+		return errors.New("type assertion to []byte failed")
+	}
+	return json.Unmarshal(bytes, p)
 }
 
 // Badge represents the badges table
 type Badge struct {
-	ID          int       `db:"id" json:"id"`
-	Name        string    `db:"name" json:"name"`
-	Description string    `db:"description" json:"description"`
-	ImageURL    string    `db:"image_url" json:"image_url"`
-	Active      bool      `db:"active" json:"active"`
-	CreatedAt   time.Time `db:"created_at" json:"created_at"`
-	UpdatedAt   time.Time `db:"updated_at" json:"updated_at"`
+	ID           int           `db:"id" json:"id"`
+	Name         string        `db:"name" json:"name"`
+	Description  string        `db:"description" json:"description"`
+	ImageURL     string        `db:"image_url" json:"image_url"`
+	Active       bool          `db:"active" json:"active"`
+	Points       int           `db:"points" json:"points"` // Scored by each award on weighted leaderboards
+	RepeatPolicy *RepeatPolicy `db:"repeat_policy" json:"repeat_policy,omitempty"`
+	ExpiryPolicy *ExpiryPolicy `db:"expiry_policy" json:"expiry_policy,omitempty"`
+	CreatedAt    time.Time     `db:"created_at" json:"created_at"`
+	UpdatedAt    time.Time     `db:"updated_at" json:"updated_at"`
+}
+
+// Badge repeat policy types
+const (
+	RepeatOnce      = "once"
+	RepeatPerPeriod = "per_period"
+	RepeatUnlimited = "unlimited"
+)
+
+// RepeatPolicy controls whether a badge can be awarded to the same user more than once
+type RepeatPolicy struct {
+	Type     string `json:"type"`
+	Period   string `json:"period,omitempty"`   // day, week, month, quarter or year, for per_period badges
+	Cooldown string `json:"cooldown,omitempty"` // Minimum time between awards of unlimited badges, e.g. "12h" or "7d"
+}
+
+// Value implements the driver.Valuer interface for RepeatPolicy
+func (p RepeatPolicy) Value() (driver.Value, error) {
+	return json.Marshal(p)
+}
+
+// Scan implements the sql.Scanner interface for RepeatPolicy
+func (p *RepeatPolicy) Scan(value interface{}) error {
+	bytes, ok := value.([]byte)
+	if !ok {
+		return errors.New("type assertion to []byte failed")
+	}
+	return json.Unmarshal(bytes, p)
+}
+
+// ExpiryPolicy controls how long awards of a badge remain valid
+type ExpiryPolicy struct {
+	ValidFor string `json:"valid_for,omitempty"` // Awards expire this long after being awarded, e.g. "90d"
+	Recheck  string `json:"recheck,omitempty"`   // Holders are re-evaluated this often and revoked once they no longer qualify, e.g. "24h"
+}
+
+// Value implements the driver.Valuer interface for ExpiryPolicy
+func (p ExpiryPolicy) Value() (driver.Value, error) {
+	return json.Marshal(p)
+}
+
+// Scan implements the sql.Scanner interface for ExpiryPolicy
+func (p *ExpiryPolicy) Scan(value interface{}) error {
+	bytes, ok := value.([]byte)
+	if !ok {
+		return errors.New("type assertion to []byte failed")
+	}
+	return json.Unmarshal(bytes, p)
+}
+
+// BadgeTier represents the badge_tiers table
+type BadgeTier struct {
+	ID             int       `db:"id" json:"id"`
+	BadgeID        int       `db:"badge_id" json:"badge_id"`
+	Level          int       `db:"level" json:"level"`
+	Name           string    `db:"name" json:"name"`
+	FlowDefinition JSONB     `db:"flow_definition" json:"flow_definition"`
+	CreatedAt      time.Time `db:"created_at" json:"created_at"`
+	UpdatedAt      time.Time `db:"updated_at" json:"updated_at"`
 }
 
 // BadgeCriteria represents the badge_criteria table
@@ -71,32 +178,362 @@ type BadgeCriteria struct {
 	ID             int       `db:"id" json:"id"`
 	BadgeID        int       `db:"badge_id" json:"badge_id"`
 	FlowDefinition JSONB     `db:"flow_definition" json:"flow_definition"`
+	Expression     string    `db:"expression" json:"expression,omitempty"` // CEL expression used instead of the flow definition
 	CreatedAt      time.Time `db:"created_at" json:"created_at"`
 	UpdatedAt      time.Time `db:"updated_at" json:"updated_at"`
 }
 
 // UserBadge represents the user_badges table
 type UserBadge struct {
-	ID        int       `db:"id" json:"id"`
-	UserID    string    `db:"user_id" json:"user_id"`
-	BadgeID   int       `db:"badge_id" json:"badge_id"`
-	AwardedAt time.Time `db:"awarded_at" json:"awarded_at"`
-	Metadata  JSONB     `db:"metadata" json:"metadata"`
+	ID         int       `db:"id" json:"id"`
+	UserID     string    `db:"user_id" json:"user_id"`
+	BadgeID    int       `db:"badge_id" json:"badge_id"`
+	AwardedAt  time.Time `db:"awarded_at" json:"awarded_at"`
+	Metadata   JSONB     `db:"metadata" json:"metadata"`
+	Tier       *int      `db:"tier" json:"tier,omitempty"`
+	Occurrence int       `db:"occurrence" json:"occurrence"`
+	PeriodKey  *string   `db:"period_key" json:"period_key,omitempty"`
+
+	Status           string     `db:"status" json:"status"`
+	ExpiresAt        *time.Time `db:"expires_at" json:"expires_at,omitempty"`
+	RevokedAt        *time.Time `db:"revoked_at" json:"revoked_at,omitempty"`
+	RevocationReason *string    `db:"revocation_reason" json:"revocation_reason,omitempty"`
+	LastCheckedAt    *time.Time `db:"last_checked_at" json:"last_checked_at,omitempty"`
+
+	Notification *WebhookOutbox `db:"-" json:"-"` // Notification queued when the badge was awarded
+}
+
+// User badge statuses
+const (
+	UserBadgeStatusActive  = "active"
+	UserBadgeStatusRevoked = "revoked"
+	UserBadgeStatusExpired = "expired"
+)
+
+// IsActive checks whether the award is still held at the given time
+func (ub UserBadge) IsActive(now time.Time) bool {
+	if ub.Status != "" && ub.Status != UserBadgeStatusActive {
+		return false
+	}
+	return ub.ExpiresAt == nil || now.Before(*ub.ExpiresAt)
+}
+
+// UserBadgeSummary describes a badge held by a user, with its current tier and award history
+type UserBadgeSummary struct {
+	ID              int              `json:"id"`
+	Name            string           `json:"name"`
+	Description     string           `json:"description"`
+	ImageURL        string           `json:"image_url"`
+	AwardedAt       time.Time        `json:"awarded_at"` // Time of the most recent active award
+	Metadata        JSONB            `json:"metadata"`
+	CurrentTier     *int             `json:"current_tier,omitempty"`
+	CurrentTierName string           `json:"current_tier_name,omitempty"`
+	AwardCount      int              `json:"award_count"` // Number of active awards
+	History         []UserBadgeAward `json:"history"`     // All awards, including revoked and expired ones
+}
+
+// UserBadgeAward is a single award of a badge to a user
+type UserBadgeAward struct {
+	Tier       *int      `json:"tier,omitempty"`
+	TierName   string    `json:"tier_name,omitempty"`
+	Occurrence int       `json:"occurrence"`
+	PeriodKey  *string   `json:"period_key,omitempty"`
+	AwardedAt  time.Time `json:"awarded_at"`
+	Metadata   JSONB     `json:"metadata"`
+
+	Status           string     `json:"status"`
+	ExpiresAt        *time.Time `json:"expires_at,omitempty"`
+	RevokedAt        *time.Time `json:"revoked_at,omitempty"`
+	RevocationReason *string    `json:"revocation_reason,omitempty"`
+}
+
+// Leaderboard rankings
+const (
+	LeaderboardByBadges = "badges" // Most active awards
+	LeaderboardByPoints = "points" // Most points scored by active awards
+	LeaderboardByBadge  = "badge"  // First earners of a badge
+)
+
+// LeaderboardQuery selects a page of a leaderboard
+type LeaderboardQuery struct {
+	By      string
+	BadgeID int    // Badge whose earners are ranked, for LeaderboardByBadge
+	From    string // First day of the awards counted, as YYYY-MM-DD in UTC; empty for no limit
+	To      string // Last day of the awards counted
+	Limit   int
+	Offset  int
 }
 
+// LeaderboardEntry is a user's place on a leaderboard. Awards of tiered and repeatable badges
+// each count, and score the badge's points.
+type LeaderboardEntry struct {
+	Rank           int        `db:"rank" json:"rank"`
+	UserID         string     `db:"user_id" json:"user_id"`
+	BadgeCount     int        `db:"badge_count" json:"badge_count"` // Active awards counted
+	Points         int        `db:"points" json:"points"`
+	FirstAwardedAt *time.Time `db:"first_awarded_at" json:"first_awarded_at,omitempty"` // For LeaderboardByBadge
+}
+
+// Leaderboard is a page of a leaderboard
+type Leaderboard struct {
+	By      string             `json:"by"`
+	BadgeID int                `json:"badge_id,omitempty"`
+	From    string             `json:"from,omitempty"`
+	To      string             `json:"to,omitempty"`
+	Total   int                `json:"total"` // Users on the leaderboard
+	Limit   int                `json:"limit"`
+	Offset  int                `json:"offset"`
+	Entries []LeaderboardEntry `json:"entries"`
+}
+
+// Event processing statuses. Pending and processing events are queued for the worker pool;
+// evaluating and failed events are evaluated as soon as they are received instead, and are
+// never claimed by workers.
+const (
+	EventStatusPending    = "pending"
+	EventStatusProcessing = "processing"
+	EventStatusProcessed  = "processed"
+	EventStatusDead       = "dead"
+	EventStatusEvaluating = "evaluating"
+	EventStatusFailed     = "failed"
+)
+
 // Event represents the events table
 type Event struct {
+	ID               int        `db:"id" json:"id"`
+	EventTypeID      int        `db:"event_type_id" json:"event_type_id"`
+	UserID           string     `db:"user_id" json:"user_id"`
+	Payload          JSONB      `db:"payload" json:"payload"`
+	OccurredAt       time.Time  `db:"occurred_at" json:"occurred_at"`
+	ProcessingStatus string     `db:"processing_status" json:"processing_status,omitempty"`
+	Attempts         int        `db:"attempts" json:"attempts"`
+	NextAttemptAt    *time.Time `db:"next_attempt_at" json:"next_attempt_at,omitempty"`
+	LastError        *string    `db:"last_error" json:"last_error,omitempty"`
+	ProcessedAt      *time.Time `db:"processed_at" json:"processed_at,omitempty"`
+	// IANA timezone the event was sent from. Events loaded for evaluation carry the user's
+	// timezone when they were sent without one.
+	Timezone *string `db:"timezone" json:"timezone,omitempty"`
+	// Key chosen by the client so that the event is stored once per user however often it is sent
+	IdempotencyKey *string `db:"idempotency_key" json:"idempotency_key,omitempty"`
+	// Set when saving found an event with the same idempotency key; the event then holds the original
+	Replayed bool `db:"-" json:"-"`
+}
+
+// EventDeadLetter represents the event_dead_letters table
+type EventDeadLetter struct {
+	ID        int       `db:"id" json:"id"`
+	EventID   int       `db:"event_id" json:"event_id"`
+	UserID    string    `db:"user_id" json:"user_id"`
+	Attempts  int       `db:"attempts" json:"attempts"`
+	LastError *string   `db:"last_error" json:"last_error,omitempty"`
+	FailedAt  time.Time `db:"failed_at" json:"failed_at"`
+}
+
+// Webhook event types
+const (
+	WebhookEventBadgeAwarded = "badge.awarded"
+	WebhookEventBadgeRevoked = "badge.revoked"
+)
+
+// Webhook delivery statuses
+const (
+	WebhookDeliveryPending    = "pending"
+	WebhookDeliveryDelivering = "delivering"
+	WebhookDeliveryDelivered  = "delivered"
+	WebhookDeliveryFailed     = "failed"
+)
+
+// WebhookFilter selects the notifications sent to a webhook subscription.
+// Empty lists match everything.
+type WebhookFilter struct {
+	Events   []string `json:"events,omitempty"`
+	BadgeIDs []int    `json:"badge_ids,omitempty"`
+}
+
+// Value implements the driver.Valuer interface for WebhookFilter
+func (f WebhookFilter) Value() (driver.Value, error) {
+	return json.Marshal(f)
+}
+
+// Scan implements the sql.Scanner interface for WebhookFilter
+func (f *WebhookFilter) Scan(value interface{}) error {
+	bytes, ok := value.([]byte)
+	if !ok {
+		return errors.New("type assertion to []byte failed")
+	}
+	return json.Unmarshal(bytes, f)
+}
+
+// Matches checks whether a notification passes the filter; a nil filter matches everything
+func (f *WebhookFilter) Matches(eventType string, badgeID int) bool {
+	if f == nil {
+		return true
+	}
+
+	if len(f.Events) > 0 {
+		found := false
+		for _, event := range f.Events {
+			if event == eventType {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+
+	if len(f.BadgeIDs) > 0 {
+		for _, id := range f.BadgeIDs {
+			if id == badgeID {
+				return true
+			}
+		}
+		return false
+	}
+
+	return true
+}
+
+// WebhookSubscription represents the webhook_subscriptions table
+type WebhookSubscription struct {
+	ID        int            `db:"id" json:"id"`
+	URL       string         `db:"url" json:"url"`
+	Secret    string         `db:"secret" json:"secret,omitempty"` // Only returned when the subscription is created
+	Filter    *WebhookFilter `db:"filter" json:"filter,omitempty"`
+	Active    bool           `db:"active" json:"active"`
+	CreatedAt time.Time      `db:"created_at" json:"created_at"`
+	UpdatedAt time.Time      `db:"updated_at" json:"updated_at"`
+}
+
+// WebhookOutbox represents the webhook_outbox table
+type WebhookOutbox struct {
+	ID           int        `db:"id" json:"id"`
+	EventType    string     `db:"event_type" json:"event_type"`
+	UserID       string     `db:"user_id" json:"user_id"`
+	BadgeID      int        `db:"badge_id" json:"badge_id"`
+	Payload      JSONB      `db:"payload" json:"payload"`
+	CreatedAt    time.Time  `db:"created_at" json:"created_at"`
+	DispatchedAt *time.Time `db:"dispatched_at" json:"dispatched_at,omitempty"`
+}
+
+// WebhookDelivery represents the webhook_deliveries table
+type WebhookDelivery struct {
+	ID             int                      `db:"id" json:"id"`
+	SubscriptionID int                      `db:"subscription_id" json:"subscription_id"`
+	OutboxID       int                      `db:"outbox_id" json:"outbox_id"`
+	Status         string                   `db:"status" json:"status"`
+	Attempts       int                      `db:"attempts" json:"attempts"`
+	NextAttemptAt  *time.Time               `db:"next_attempt_at" json:"next_attempt_at,omitempty"`
+	LastError      *string                  `db:"last_error" json:"last_error,omitempty"`
+	CreatedAt      time.Time                `db:"created_at" json:"created_at"`
+	DeliveredAt    *time.Time               `db:"delivered_at" json:"delivered_at,omitempty"`
+	AttemptLog     []WebhookDeliveryAttempt `db:"-" json:"attempt_log,omitempty"`
+}
+
+// WebhookDeliveryAttempt represents the webhook_delivery_attempts table
+type WebhookDeliveryAttempt struct {
+	ID             int       `db:"id" json:"id"`
+	DeliveryID     int       `db:"delivery_id" json:"delivery_id"`
+	ResponseStatus *int      `db:"response_status" json:"response_status,omitempty"`
+	Error          *string   `db:"error" json:"error,omitempty"`
+	DurationMs     int       `db:"duration_ms" json:"duration_ms"`
+	AttemptedAt    time.Time `db:"attempted_at" json:"attempted_at"`
+}
+
+// PendingWebhookDelivery is a claimed delivery together with what is needed to send it
+type PendingWebhookDelivery struct {
+	WebhookDelivery
+	URL             string    `db:"url"`
+	Secret          string    `db:"secret"`
+	EventType       string    `db:"event_type"`
+	Payload         JSONB     `db:"payload"`
+	OutboxCreatedAt time.Time `db:"outbox_created_at"`
+}
+
+// Backfill job statuses
+const (
+	BackfillPending   = "pending"
+	BackfillRunning   = "running"
+	BackfillCompleted = "completed"
+	BackfillFailed    = "failed"
+)
+
+// BackfillJob represents the backfill_jobs table
+type BackfillJob struct {
+	ID             int           `db:"id" json:"id"`
+	BadgeIDs       pq.Int64Array `db:"badge_ids" json:"badge_ids"`
+	DryRun         bool          `db:"dry_run" json:"dry_run"`
+	Status         string        `db:"status" json:"status"`
+	LastUserID     string        `db:"last_user_id" json:"last_user_id,omitempty"`
+	TotalUsers     int           `db:"total_users" json:"total_users"`
+	ProcessedUsers int           `db:"processed_users" json:"processed_users"`
+	FailedUsers    int           `db:"failed_users" json:"failed_users"`
+	Awarded        int           `db:"awarded" json:"awarded"` // Badges awarded, or that would be awarded in a dry run
+	LastError      *string       `db:"last_error" json:"last_error,omitempty"`
+	LeaseExpiresAt *time.Time    `db:"lease_expires_at" json:"-"`
+	CreatedAt      time.Time     `db:"created_at" json:"created_at"`
+	StartedAt      *time.Time    `db:"started_at" json:"started_at,omitempty"`
+	UpdatedAt      time.Time     `db:"updated_at" json:"updated_at"`
+	CompletedAt    *time.Time    `db:"completed_at" json:"completed_at,omitempty"`
+}
+
+// UserProfile represents the user_profiles table
+type UserProfile struct {
+	UserID    string    `db:"user_id" json:"user_id"`
+	Timezone  *string   `db:"timezone" json:"timezone,omitempty"` // IANA name; NULL means the timezone of the user's latest event
+	CreatedAt time.Time `db:"created_at" json:"created_at"`
+	UpdatedAt time.Time `db:"updated_at" json:"updated_at"`
+}
+
+// HolidayCalendar represents the holiday_calendars table. Time-based criteria skip the
+// holidays of a calendar they name with "holidayCalendar".
+type HolidayCalendar struct {
 	ID          int       `db:"id" json:"id"`
-	EventTypeID int       `db:"event_type_id" json:"event_type_id"`
-	UserID      string    `db:"user_id" json:"user_id"`
-	Payload     JSONB     `db:"payload" json:"payload"`
-	OccurredAt  time.Time `db:"occurred_at" json:"occurred_at"`
+	Name        string    `db:"name" json:"name"`
+	Description string    `db:"description" json:"description"`
+	Holidays    Holidays  `db:"holidays" json:"holidays"`
+	CreatedAt   time.Time `db:"created_at" json:"created_at"`
+	UpdatedAt   time.Time `db:"updated_at" json:"updated_at"`
+}
+
+// Holiday is a day of a holiday calendar, either a single date or one repeated every year
+type Holiday struct {
+	Date   string `json:"date"` // YYYY-MM-DD; the first occurrence of a yearly holiday
+	Name   string `json:"name,omitempty"`
+	Yearly bool   `json:"yearly,omitempty"` // Repeats on the same month and day every year from Date
+	Until  string `json:"until,omitempty"`  // YYYY-MM-DD after which a yearly holiday stops; empty repeats forever
+}
+
+// Holidays is the list of holidays of a calendar
+type Holidays []Holiday
+
+// Value implements the driver.Valuer interface for Holidays
+func (h Holidays) Value() (driver.Value, error) {
+	if h == nil {
+		return []byte("[]"), nil
+	}
+	return json.Marshal(h)
+}
+
+// Scan implements the sql.Scanner interface for Holidays
+func (h *Holidays) Scan(value interface{}) error {
+	if value == nil {
+		*h = nil
+		return nil
+	}
+	bytes, ok := value.([]byte)
+	if !ok {
+		return errors.New("type assertion to []byte failed")
+	}
+	return json.Unmarshal(bytes, h)
 }
 
 // BadgeWithCriteria combines Badge and BadgeCriteria for easier handling
 type BadgeWithCriteria struct {
 	Badge    Badge         `json:"badge"`
 	Criteria BadgeCriteria `json:"criteria"`
+	Tiers    []BadgeTier   `json:"tiers,omitempty"` // Ordered by level; empty for untiered badges
 }
 
 // EventTypeWithSchema represents EventType with accessible schema
@@ -111,6 +548,44 @@ type NewEventRequest struct {
 	UserID    string                 `json:"user_id"`
 	Payload   map[string]interface{} `json:"payload"`
 	Timestamp string                 `json:"timestamp,omitempty"`
+	Timezone  string                 `json:"timezone,omitempty"` // IANA name, e.g. "Europe/Paris"
+	// Sending an event again with the same key returns the original event instead of storing a new one
+	IdempotencyKey string `json:"idempotency_key,omitempty"`
+}
+
+// NewEventBatchRequest is used for creating several events at once
+type NewEventBatchRequest struct {
+	Events []NewEventRequest `json:"events"`
+	Atomic bool              `json:"atomic,omitempty"` // Reject the whole batch when any event is invalid
+}
+
+// EventStatusRejected is the batch status of an event that was invalid and not saved
+const EventStatusRejected = "rejected"
+
+// EventBatchItem is the outcome of one event of a batch, in the order of the request
+type EventBatchItem struct {
+	Index      int                `json:"index"`
+	EventID    int                `json:"event_id,omitempty"`
+	Status     string             `json:"status"`             // "processed", "pending", "failed" or "rejected"
+	Replayed   bool               `json:"replayed,omitempty"` // An event with the same idempotency key was already stored
+	Error      string             `json:"error,omitempty"`
+	Violations []schema.Violation `json:"violations,omitempty"`
+}
+
+// EventBatchAward is a badge awarded to a user by the events of a batch
+type EventBatchAward struct {
+	UserID    string `json:"user_id"`
+	BadgeID   int    `json:"badge_id"`
+	BadgeName string `json:"badge_name"`
+}
+
+// EventBatchResult is the outcome of a batch of events
+type EventBatchResult struct {
+	Accepted int               `json:"accepted"`
+	Replayed int               `json:"replayed"`
+	Rejected int               `json:"rejected"`
+	Events   []EventBatchItem  `json:"events"`
+	Awarded  []EventBatchAward `json:"awarded"`
 }
 
 // NewBadgeRequest is used for creating a new badge
@@ -118,7 +593,12 @@ type NewBadgeRequest struct {
 	Name           string                 `json:"name"`
 	Description    string                 `json:"description"`
 	ImageURL       string                 `json:"image_url"`
+	Points         int                    `json:"points,omitempty"`
 	FlowDefinition map[string]interface{} `json:"flow_definition"`
+	Expression     string                 `json:"expression,omitempty"` // CEL expression, as an alternative to flow_definition
+	Tiers          []BadgeTierRequest     `json:"tiers,omitempty"`
+	RepeatPolicy   *RepeatPolicy          `json:"repeat_policy,omitempty"`
+	ExpiryPolicy   *ExpiryPolicy          `json:"expiry_policy,omitempty"`
 }
 
 // UpdateBadgeRequest is used for updating an existing badge
@@ -127,7 +607,63 @@ type UpdateBadgeRequest struct {
 	Description    string                 `json:"description,omitempty"`
 	ImageURL       string                 `json:"image_url,omitempty"`
 	Active         *bool                  `json:"active,omitempty"`
+	Points         *int                   `json:"points,omitempty"`
 	FlowDefinition map[string]interface{} `json:"flow_definition,omitempty"`
+	Expression     string                 `json:"expression,omitempty"` // Replaces the flow definition when set
+	Tiers          []BadgeTierRequest     `json:"tiers,omitempty"`      // Replaces all existing tiers when set
+	RepeatPolicy   *RepeatPolicy          `json:"repeat_policy,omitempty"`
+	ExpiryPolicy   *ExpiryPolicy          `json:"expiry_policy,omitempty"`
+}
+
+// RevokeBadgeRequest is used for manually revoking a badge from a user
+type RevokeBadgeRequest struct {
+	Reason string `json:"reason"`
+}
+
+// BadgeTierRequest describes one tier of a tiered badge
+type BadgeTierRequest struct {
+	Level          int                    `json:"level"`
+	Name           string                 `json:"name"`
+	FlowDefinition map[string]interface{} `json:"flow_definition"`
+}
+
+// EvaluateFlowRequest is used for dry-running an unsaved flow definition
+type EvaluateFlowRequest struct {
+	UserID         string                 `json:"user_id"`
+	FlowDefinition map[string]interface{} `json:"flow_definition"`
+}
+
+// WebhookSubscriptionRequest is used for creating or updating a webhook subscription
+type WebhookSubscriptionRequest struct {
+	URL    string         `json:"url"`
+	Secret string         `json:"secret,omitempty"` // Generated when omitted on creation
+	Filter *WebhookFilter `json:"filter,omitempty"`
+	Active *bool          `json:"active,omitempty"`
+}
+
+// BackfillRequest is used for starting a backfill job
+type BackfillRequest struct {
+	BadgeIDs []int `json:"badge_ids"`
+	DryRun   bool  `json:"dry_run,omitempty"`
+}
+
+// UserProfileRequest is used for creating or replacing a user profile
+type UserProfileRequest struct {
+	Timezone *string `json:"timezone"`
+}
+
+// NewHolidayCalendarRequest is used for creating a new holiday calendar
+type NewHolidayCalendarRequest struct {
+	Name        string   `json:"name"`
+	Description string   `json:"description"`
+	Holidays    Holidays `json:"holidays"`
+}
+
+// UpdateHolidayCalendarRequest is used for updating an existing holiday calendar
+type UpdateHolidayCalendarRequest struct {
+	Name        string   `json:"name,omitempty"`
+	Description *string  `json:"description,omitempty"`
+	Holidays    Holidays `json:"holidays,omitempty"` // Replaces all holidays when provided
 }
 
 // NewEventTypeRequest is used for creating a new event type
@@ -145,17 +681,19 @@ type UpdateEventTypeRequest struct {
 }
 
 // NewConditionTypeRequest is used for creating a new condition type
-// WARNING: This feature is not fully implemented in the current system.
 type NewConditionTypeRequest struct {
-	Name            string `json:"name"`
-	Description     string `json:"description"`
-	EvaluationLogic string `json:"evaluation_logic"`
+	Name            string                 `json:"name"`
+	Description     string                 `json:"description"`
+	EvaluationLogic string                 `json:"evaluation_logic,omitempty"` // Deprecated: never executed
+	Parameters      ConditionParameters    `json:"parameters,omitempty"`
+	FlowTemplate    map[string]interface{} `json:"flow_template"`
 }
 
 // UpdateConditionTypeRequest is used for updating an existing condition type
-// WARNING: This feature is not fully implemented in the current system.
 type UpdateConditionTypeRequest struct {
-	Name            string `json:"name,omitempty"`
-	Description     string `json:"description,omitempty"`
-	EvaluationLogic string `json:"evaluation_logic,omitempty"`
+	Name            string                 `json:"name,omitempty"`
+	Description     string                 `json:"description,omitempty"`
+	EvaluationLogic string                 `json:"evaluation_logic,omitempty"` // Deprecated: never executed
+	Parameters      ConditionParameters    `json:"parameters,omitempty"`       // Replaces all parameters when provided
+	FlowTemplate    map[string]interface{} `json:"flow_template,omitempty"`
 }
@@ -7,6 +7,8 @@ type TimePeriodCriteria struct {
 	ExcludeWeekends bool                   `json:"excludeWeekends,omitempty"`
 	ExcludeHolidays bool                   `json:"excludeHolidays,omitempty"`
 	Holidays        []string               `json:"holidays,omitempty"`
+	HolidayCalendar string                 `json:"holidayCalendar,omitempty"` // Name of a calendar whose holidays are also excluded
+	Timezone        string                 `json:"timezone,omitempty"`        // Overrides the timezone of the events
 }
 
 // PatternCriteria represents criteria for detecting patterns in event frequency
@@ -17,6 +19,22 @@ type PatternCriteria struct {
 	MinIncreasePct float64 `json:"minIncreasePct,omitempty"` // For increasing pattern
 	MaxDecreasePct float64 `json:"maxDecreasePct,omitempty"` // For decreasing pattern
 	MaxDeviation   float64 `json:"maxDeviation,omitempty"`   // For consistent pattern
+	Timezone       string  `json:"timezone,omitempty"`       // Overrides the timezone of the events
+}
+
+// StreakCriteria represents criteria for runs of consecutive periods with activity
+type StreakCriteria struct {
+	PeriodType      string                 `json:"periodType"`         // "day", "week", "month", "quarter", "year"
+	Event           string                 `json:"event,omitempty"`    // Only count events of this type
+	Criteria        map[string]interface{} `json:"criteria,omitempty"` // Only count events matching these criteria
+	Current         map[string]interface{} `json:"current,omitempty"`  // Comparison on the current streak
+	Longest         map[string]interface{} `json:"longest,omitempty"`  // Comparison on the longest streak
+	Freezes         int                    `json:"freezes,omitempty"`  // Missed periods forgiven within a streak
+	ExcludeWeekends bool                   `json:"excludeWeekends,omitempty"`
+	ExcludeHolidays bool                   `json:"excludeHolidays,omitempty"`
+	Holidays        []string               `json:"holidays,omitempty"`
+	HolidayCalendar string                 `json:"holidayCalendar,omitempty"` // Name of a calendar whose holidays are also skipped
+	Timezone        string                 `json:"timezone,omitempty"`        // Overrides the timezone of the events
 }
 
 // SequenceCriteria represents criteria for verifying event sequences
@@ -30,7 +48,8 @@ type SequenceCriteria struct {
 type GapCriteria struct {
 	MaxGapHours       float64                `json:"maxGapHours"`
 	MinGapHours       float64                `json:"minGapHours,omitempty"`
-	PeriodType        string                 `json:"periodType,omitempty"` // "all", "business-days"
+	PeriodType        string                 `json:"periodType,omitempty"`      // "all", "business-days"
+	HolidayCalendar   string                 `json:"holidayCalendar,omitempty"` // Holidays left out of business days
 	ExcludeConditions map[string]interface{} `json:"excludeConditions,omitempty"`
 }
 
@@ -56,4 +75,5 @@ type TimeWindowCriteria struct {
 	End              string `json:"end,omitempty"`
 	Last             string `json:"last,omitempty"` // e.g., "30d", "2w", "1m"
 	BusinessDaysOnly bool   `json:"businessDaysOnly,omitempty"`
+	HolidayCalendar  string `json:"holidayCalendar,omitempty"` // Holidays left out of business days
 }
@@ -0,0 +1,139 @@
+// Package notify delivers badge notifications as they happen to the clients streaming them,
+// such as dashboards connected to the Server-Sent Events endpoints, on every server replica.
+package notify
+
+import (
+	"sync"
+	"time"
+
+	"github.com/badge-assignment-system/internal/models"
+)
+
+// Notification is a badge being awarded to or revoked from a user. Its ID is the ID of the
+// webhook outbox entry written with the award or revocation, so notifications missed by a
+// client can be read back from the outbox.
+type Notification struct {
+	ID        int          `json:"id"`
+	Event     string       `json:"event"` // badge.awarded or badge.revoked
+	UserID    string       `json:"user_id"`
+	BadgeID   int          `json:"badge_id"`
+	CreatedAt time.Time    `json:"created_at"`
+	Data      models.JSONB `json:"data"` // Same as the data of webhook notifications
+}
+
+// FromOutbox creates the notification of a webhook outbox entry
+func FromOutbox(entry models.WebhookOutbox) Notification {
+	return Notification{
+		ID:        entry.ID,
+		Event:     entry.EventType,
+		UserID:    entry.UserID,
+		BadgeID:   entry.BadgeID,
+		CreatedAt: entry.CreatedAt,
+		Data:      entry.Payload,
+	}
+}
+
+// Publisher is told about badges being awarded or revoked
+type Publisher interface {
+	Publish(notifications ...Notification)
+}
+
+// DefaultBufferSize is the number of notifications a subscription holds before it is dropped
+const DefaultBufferSize = 64
+
+// Subscription receives the notifications of a user, or of every user
+type Subscription struct {
+	UserID        string // Empty for every user
+	notifications chan Notification
+}
+
+// Notifications returns the channel notifications are received on. It is closed when the
+// subscription ends, either because it was unsubscribed or because it fell behind.
+func (s *Subscription) Notifications() <-chan Notification {
+	return s.notifications
+}
+
+// Hub delivers the notifications published on this server to its subscriptions, and shares
+// them with the other replicas through a relay when one is set
+type Hub struct {
+	mu            sync.Mutex
+	subscriptions map[*Subscription]bool
+	relay         Publisher
+	bufferSize    int
+}
+
+// NewHub creates a hub with no subscriptions
+func NewHub() *Hub {
+	return &Hub{
+		subscriptions: make(map[*Subscription]bool),
+		bufferSize:    DefaultBufferSize,
+	}
+}
+
+// SetRelay shares the notifications published from now on with other replicas
+func (h *Hub) SetRelay(relay Publisher) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.relay = relay
+}
+
+// Subscribe starts receiving the notifications of a user, or of every user when userID is empty
+func (h *Hub) Subscribe(userID string) *Subscription {
+	subscription := &Subscription{
+		UserID:        userID,
+		notifications: make(chan Notification, h.bufferSize),
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.subscriptions[subscription] = true
+	return subscription
+}
+
+// Unsubscribe stops a subscription and closes its channel
+func (h *Hub) Unsubscribe(subscription *Subscription) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.remove(subscription)
+}
+
+// Publish delivers notifications to the subscriptions of this server and the other replicas
+func (h *Hub) Publish(notifications ...Notification) {
+	h.Deliver(notifications...)
+
+	h.mu.Lock()
+	relay := h.relay
+	h.mu.Unlock()
+	if relay != nil {
+		relay.Publish(notifications...)
+	}
+}
+
+// Deliver delivers notifications to the subscriptions of this server only. Delivery never
+// blocks: a subscription whose buffer is full is dropped, and its client is expected to
+// reconnect and read the notifications it missed from the outbox.
+func (h *Hub) Deliver(notifications ...Notification) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for _, notification := range notifications {
+		for subscription := range h.subscriptions {
+			if subscription.UserID != "" && subscription.UserID != notification.UserID {
+				continue
+			}
+			select {
+			case subscription.notifications <- notification:
+			default:
+				h.remove(subscription)
+			}
+		}
+	}
+}
+
+// remove ends a subscription; the caller must hold the lock
+func (h *Hub) remove(subscription *Subscription) {
+	if h.subscriptions[subscription] {
+		delete(h.subscriptions, subscription)
+		close(subscription.notifications)
+	}
+}
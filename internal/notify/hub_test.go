@@ -0,0 +1,72 @@
+package notify
+
+import (
+	"testing"
+
+	"github.com/badge-assignment-system/internal/models"
+	"github.com/stretchr/testify/assert"
+)
+
+// recordingPublisher records the notifications published to it
+type recordingPublisher struct {
+	published []Notification
+}
+
+func (p *recordingPublisher) Publish(notifications ...Notification) {
+	p.published = append(p.published, notifications...)
+}
+
+// received drains the notifications buffered in a subscription
+func received(subscription *Subscription) []int {
+	var ids []int
+	for {
+		select {
+		case notification, ok := <-subscription.Notifications():
+			if !ok {
+				return ids
+			}
+			ids = append(ids, notification.ID)
+		default:
+			return ids
+		}
+	}
+}
+
+func TestHubDeliversToMatchingSubscriptions(t *testing.T) {
+	hub := NewHub()
+	relay := &recordingPublisher{}
+	hub.SetRelay(relay)
+
+	alice := hub.Subscribe("alice")
+	everyone := hub.Subscribe("")
+
+	hub.Publish(
+		Notification{ID: 1, Event: models.WebhookEventBadgeAwarded, UserID: "alice", BadgeID: 3},
+		Notification{ID: 2, Event: models.WebhookEventBadgeAwarded, UserID: "bob", BadgeID: 3},
+	)
+	hub.Deliver(Notification{ID: 3, Event: models.WebhookEventBadgeRevoked, UserID: "alice", BadgeID: 3})
+
+	assert.Equal(t, []int{1, 3}, received(alice))
+	assert.Equal(t, []int{1, 2, 3}, received(everyone))
+	assert.Len(t, relay.published, 2, "only published notifications are relayed")
+
+	hub.Unsubscribe(alice)
+	hub.Unsubscribe(alice)
+	_, ok := <-alice.Notifications()
+	assert.False(t, ok)
+	hub.Publish(Notification{ID: 4, UserID: "alice"})
+	assert.Equal(t, []int{4}, received(everyone))
+}
+
+func TestHubDropsSubscriptionsThatFallBehind(t *testing.T) {
+	hub := NewHub()
+	hub.bufferSize = 2
+	slow := hub.Subscribe("")
+
+	hub.Publish(Notification{ID: 1}, Notification{ID: 2}, Notification{ID: 3})
+
+	assert.Equal(t, []int{1, 2}, received(slow))
+	_, ok := <-slow.Notifications()
+	assert.False(t, ok, "closed once its buffer was full")
+	hub.Unsubscribe(slow)
+}
@@ -0,0 +1,151 @@
+package notify
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/badge-assignment-system/internal/logging"
+	"github.com/badge-assignment-system/internal/models"
+	"github.com/lib/pq"
+)
+
+// Channel is the Postgres channel notifications are shared on
+const Channel = "badge_notifications"
+
+// maxPayloadSize keeps messages under the 8000 byte limit of Postgres notifications.
+// Larger notifications are sent by ID and read from the outbox by the replicas receiving them.
+const maxPayloadSize = 7900
+
+// Store defines the database operations needed to share notifications between replicas
+type Store interface {
+	NotifyChannel(channel, payload string) error
+	GetWebhookOutboxEntry(id int) (models.WebhookOutbox, error)
+}
+
+// message is the payload of a Postgres notification
+type message struct {
+	Origin       string        `json:"origin"`                 // Replica that published the notification
+	ID           int           `json:"id,omitempty"`           // Set instead of the notification when it is too large
+	Notification *Notification `json:"notification,omitempty"` // The notification itself
+}
+
+// Relay shares the notifications published on this replica with the other replicas through
+// Postgres LISTEN/NOTIFY, and delivers theirs to the hub of this replica
+type Relay struct {
+	hub      *Hub
+	store    Store
+	listener *pq.Listener
+	origin   string
+	logger   *logging.Logger
+	stop     chan struct{}
+	wg       sync.WaitGroup
+}
+
+// NewRelay creates a relay listening on the database at connStr
+func NewRelay(hub *Hub, store Store, connStr string) *Relay {
+	relay := newRelay(hub, store)
+	relay.listener = pq.NewListener(connStr, time.Second, time.Minute, func(event pq.ListenerEventType, err error) {
+		if err != nil {
+			relay.logger.Error("Notification listener error: %v", err)
+		}
+	})
+	return relay
+}
+
+// newRelay creates a relay without a listener
+func newRelay(hub *Hub, store Store) *Relay {
+	origin := make([]byte, 8)
+	rand.Read(origin)
+
+	return &Relay{
+		hub:    hub,
+		store:  store,
+		origin: hex.EncodeToString(origin),
+		logger: logging.NewLogger("NOTIFY", logging.LogLevelInfo),
+		stop:   make(chan struct{}),
+	}
+}
+
+// Start listens for the notifications of other replicas in the background
+func (r *Relay) Start() error {
+	if err := r.listener.Listen(Channel); err != nil {
+		return fmt.Errorf("failed to listen for notifications: %w", err)
+	}
+
+	r.logger.Info("Listening for badge notifications on channel %s", Channel)
+	r.wg.Add(1)
+	go func() {
+		defer r.wg.Done()
+		for {
+			select {
+			case <-r.stop:
+				return
+			case received := <-r.listener.Notify:
+				if received == nil {
+					// Sent after the connection is re-established
+					r.logger.Warning("Notification listener reconnected, notifications sent meanwhile were missed")
+					continue
+				}
+				r.receive(received.Extra)
+			case <-time.After(90 * time.Second):
+				// Check the connection is still alive while it is idle
+				go r.listener.Ping()
+			}
+		}
+	}()
+	return nil
+}
+
+// Stop stops listening
+func (r *Relay) Stop() {
+	close(r.stop)
+	r.wg.Wait()
+	r.listener.Close()
+	r.logger.Info("Notification relay stopped")
+}
+
+// Publish sends notifications to the other replicas
+func (r *Relay) Publish(notifications ...Notification) {
+	for _, notification := range notifications {
+		payload, err := json.Marshal(message{Origin: r.origin, Notification: &notification})
+		if err == nil && len(payload) > maxPayloadSize {
+			payload, err = json.Marshal(message{Origin: r.origin, ID: notification.ID})
+		}
+		if err != nil {
+			r.logger.Error("Failed to encode notification %d: %v", notification.ID, err)
+			continue
+		}
+
+		if err := r.store.NotifyChannel(Channel, string(payload)); err != nil {
+			r.logger.Error("Failed to share notification %d: %v", notification.ID, err)
+		}
+	}
+}
+
+// receive delivers a notification shared by another replica
+func (r *Relay) receive(payload string) {
+	var received message
+	if err := json.Unmarshal([]byte(payload), &received); err != nil {
+		r.logger.Error("Failed to decode notification: %v", err)
+		return
+	}
+	if received.Origin == r.origin {
+		// Already delivered when it was published
+		return
+	}
+
+	if received.Notification == nil {
+		entry, err := r.store.GetWebhookOutboxEntry(received.ID)
+		if err != nil {
+			r.logger.Error("Failed to retrieve notification %d: %v", received.ID, err)
+			return
+		}
+		notification := FromOutbox(entry)
+		received.Notification = &notification
+	}
+	r.hub.Deliver(*received.Notification)
+}
@@ -0,0 +1,65 @@
+package notify
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/badge-assignment-system/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeStore records the payloads sent on the channel and keeps the outbox in memory
+type fakeStore struct {
+	payloads []string
+	outbox   map[int]models.WebhookOutbox
+}
+
+func (s *fakeStore) NotifyChannel(channel, payload string) error {
+	if channel != Channel {
+		return errors.New("unexpected channel")
+	}
+	s.payloads = append(s.payloads, payload)
+	return nil
+}
+
+func (s *fakeStore) GetWebhookOutboxEntry(id int) (models.WebhookOutbox, error) {
+	entry, ok := s.outbox[id]
+	if !ok {
+		return entry, errors.New("not found")
+	}
+	return entry, nil
+}
+
+func TestRelaySharesNotificationsBetweenReplicas(t *testing.T) {
+	large := models.JSONB{"metadata": strings.Repeat("x", maxPayloadSize)}
+	store := &fakeStore{outbox: map[int]models.WebhookOutbox{
+		2: {ID: 2, EventType: models.WebhookEventBadgeAwarded, UserID: "alice", BadgeID: 5, Payload: large},
+	}}
+	sender, receiver := newRelay(NewHub(), store), newRelay(NewHub(), store)
+	subscription := receiver.hub.Subscribe("alice")
+	own := sender.hub.Subscribe("")
+
+	sender.Publish(
+		Notification{ID: 1, Event: models.WebhookEventBadgeAwarded, UserID: "alice", BadgeID: 4, Data: models.JSONB{"badge_name": "Early Bird"}},
+		Notification{ID: 2, Event: models.WebhookEventBadgeAwarded, UserID: "alice", BadgeID: 5, Data: large},
+	)
+	require.Len(t, store.payloads, 2)
+	assert.NotContains(t, store.payloads[1], "xxx", "large notifications are sent by ID")
+
+	for _, payload := range store.payloads {
+		sender.receive(payload)
+		receiver.receive(payload)
+	}
+	receiver.receive("not json")
+
+	first := <-subscription.Notifications()
+	assert.Equal(t, 1, first.ID)
+	assert.Equal(t, "Early Bird", first.Data["badge_name"])
+	second := <-subscription.Notifications()
+	assert.Equal(t, 5, second.BadgeID)
+	assert.Equal(t, large, second.Data)
+	assert.Empty(t, received(subscription))
+	assert.Empty(t, received(own), "a replica ignores its own notifications")
+}
@@ -0,0 +1,199 @@
+package queue
+
+import (
+	"sync"
+	"time"
+
+	"github.com/badge-assignment-system/internal/logging"
+	"github.com/badge-assignment-system/internal/models"
+)
+
+// Store defines the database operations needed to drain the event queue
+type Store interface {
+	ClaimPendingEvents(limit int, lease time.Duration) ([]models.Event, error)
+	MarkEventProcessed(id int) error
+	ScheduleEventRetry(id int, nextAttemptAt time.Time, lastError string) error
+	DeadLetterEvent(event models.Event, lastError string) error
+}
+
+// Processor evaluates badges for a claimed event.
+// A processor is used by a single worker and does not need to be safe for concurrent use.
+type Processor interface {
+	ProcessEvent(event *models.Event) error
+}
+
+// Config controls how the worker pool drains the queue
+type Config struct {
+	Concurrency  int           // Number of workers
+	BatchSize    int           // Events claimed by a worker at a time
+	PollInterval time.Duration // How long an idle worker waits before polling again
+	Lease        time.Duration // How long a claimed event stays locked to its worker
+	MaxAttempts  int           // Attempts before an event is dead-lettered
+	BaseBackoff  time.Duration // Delay before the first retry
+	MaxBackoff   time.Duration // Upper bound on the retry delay
+}
+
+// DefaultConfig returns the default worker pool configuration
+func DefaultConfig() Config {
+	return Config{
+		Concurrency:  4,
+		BatchSize:    10,
+		PollInterval: time.Second,
+		Lease:        5 * time.Minute,
+		MaxAttempts:  5,
+		BaseBackoff:  time.Second,
+		MaxBackoff:   5 * time.Minute,
+	}
+}
+
+// WorkerPool drains the Postgres-backed event queue with a fixed number of workers
+type WorkerPool struct {
+	store        Store
+	newProcessor func() Processor
+	config       Config
+	logger       *logging.Logger
+	wake         chan struct{}
+	stop         chan struct{}
+	wg           sync.WaitGroup
+	now          func() time.Time
+}
+
+// NewWorkerPool creates a worker pool; newProcessor is called once per worker
+func NewWorkerPool(store Store, newProcessor func() Processor, config Config) *WorkerPool {
+	defaults := DefaultConfig()
+	if config.Concurrency <= 0 {
+		config.Concurrency = defaults.Concurrency
+	}
+	if config.BatchSize <= 0 {
+		config.BatchSize = defaults.BatchSize
+	}
+	if config.PollInterval <= 0 {
+		config.PollInterval = defaults.PollInterval
+	}
+	if config.Lease <= 0 {
+		config.Lease = defaults.Lease
+	}
+	if config.MaxAttempts <= 0 {
+		config.MaxAttempts = defaults.MaxAttempts
+	}
+	if config.BaseBackoff <= 0 {
+		config.BaseBackoff = defaults.BaseBackoff
+	}
+	if config.MaxBackoff <= 0 {
+		config.MaxBackoff = defaults.MaxBackoff
+	}
+
+	return &WorkerPool{
+		store:        store,
+		newProcessor: newProcessor,
+		config:       config,
+		logger:       logging.NewLogger("QUEUE", logging.LogLevelInfo),
+		wake:         make(chan struct{}, config.Concurrency),
+		stop:         make(chan struct{}),
+		now:          time.Now,
+	}
+}
+
+// Start launches the workers
+func (p *WorkerPool) Start() {
+	p.logger.Info("Starting %d event workers", p.config.Concurrency)
+	for i := 0; i < p.config.Concurrency; i++ {
+		p.wg.Add(1)
+		go p.run(i, p.newProcessor())
+	}
+}
+
+// Stop signals the workers to exit and waits for in-flight events to finish
+func (p *WorkerPool) Stop() {
+	close(p.stop)
+	p.wg.Wait()
+	p.logger.Info("Event workers stopped")
+}
+
+// Notify wakes an idle worker so a newly enqueued event is picked up without waiting for the next poll
+func (p *WorkerPool) Notify() {
+	select {
+	case p.wake <- struct{}{}:
+	default:
+	}
+}
+
+// run is the main loop of a single worker
+func (p *WorkerPool) run(worker int, processor Processor) {
+	defer p.wg.Done()
+
+	for {
+		select {
+		case <-p.stop:
+			return
+		default:
+		}
+
+		claimed := p.drain(worker, processor)
+		if claimed > 0 {
+			// Keep draining while there is work
+			continue
+		}
+
+		select {
+		case <-p.stop:
+			return
+		case <-p.wake:
+		case <-time.After(p.config.PollInterval):
+		}
+	}
+}
+
+// drain claims one batch of events and processes them, returning the number claimed
+func (p *WorkerPool) drain(worker int, processor Processor) int {
+	events, err := p.store.ClaimPendingEvents(p.config.BatchSize, p.config.Lease)
+	if err != nil {
+		p.logger.Error("Worker %d failed to claim events: %v", worker, err)
+		return 0
+	}
+
+	for i := range events {
+		p.process(worker, processor, events[i])
+	}
+	return len(events)
+}
+
+// process evaluates a single claimed event and records the outcome
+func (p *WorkerPool) process(worker int, processor Processor, event models.Event) {
+	p.logger.Debug("Worker %d processing event ID %d (attempt %d)", worker, event.ID, event.Attempts)
+
+	err := processor.ProcessEvent(&event)
+	if err == nil {
+		if err := p.store.MarkEventProcessed(event.ID); err != nil {
+			p.logger.Error("Failed to mark event ID %d as processed: %v", event.ID, err)
+		}
+		return
+	}
+
+	if event.Attempts >= p.config.MaxAttempts {
+		p.logger.Error("Event ID %d failed after %d attempts, moving to dead letters: %v", event.ID, event.Attempts, err)
+		if err := p.store.DeadLetterEvent(event, err.Error()); err != nil {
+			p.logger.Error("Failed to dead-letter event ID %d: %v", event.ID, err)
+		}
+		return
+	}
+
+	nextAttemptAt := p.now().Add(p.backoff(event.Attempts))
+	p.logger.Warning("Event ID %d failed on attempt %d, retrying at %s: %v",
+		event.ID, event.Attempts, nextAttemptAt.Format(time.RFC3339), err)
+	if err := p.store.ScheduleEventRetry(event.ID, nextAttemptAt, err.Error()); err != nil {
+		p.logger.Error("Failed to schedule retry for event ID %d: %v", event.ID, err)
+	}
+}
+
+// backoff returns the exponential retry delay after the given number of attempts
+func (p *WorkerPool) backoff(attempts int) time.Duration {
+	delay := p.config.BaseBackoff
+	for i := 1; i < attempts; i++ {
+		delay *= 2
+		if delay >= p.config.MaxBackoff {
+			return p.config.MaxBackoff
+		}
+	}
+	return delay
+}
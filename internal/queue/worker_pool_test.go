@@ -0,0 +1,129 @@
+package queue
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/badge-assignment-system/internal/models"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeStore is an in-memory queue that mimics the claim semantics of the events table
+type fakeStore struct {
+	mu          sync.Mutex
+	events      map[int]*models.Event
+	retries     map[int]time.Time
+	deadLetters []int
+	processed   []int
+}
+
+func newFakeStore(events ...models.Event) *fakeStore {
+	store := &fakeStore{events: make(map[int]*models.Event), retries: make(map[int]time.Time)}
+	for i := range events {
+		event := events[i]
+		event.ProcessingStatus = models.EventStatusPending
+		store.events[event.ID] = &event
+	}
+	return store
+}
+
+func (s *fakeStore) ClaimPendingEvents(limit int, lease time.Duration) ([]models.Event, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var claimed []models.Event
+	for _, event := range s.events {
+		if len(claimed) == limit {
+			break
+		}
+		if event.ProcessingStatus != models.EventStatusPending {
+			continue
+		}
+		event.ProcessingStatus = models.EventStatusProcessing
+		event.Attempts++
+		claimed = append(claimed, *event)
+	}
+	return claimed, nil
+}
+
+func (s *fakeStore) MarkEventProcessed(id int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.events[id].ProcessingStatus = models.EventStatusProcessed
+	s.processed = append(s.processed, id)
+	return nil
+}
+
+func (s *fakeStore) ScheduleEventRetry(id int, nextAttemptAt time.Time, lastError string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	// Retries become claimable immediately so the test does not wait for the backoff
+	s.events[id].ProcessingStatus = models.EventStatusPending
+	s.retries[id] = nextAttemptAt
+	return nil
+}
+
+func (s *fakeStore) DeadLetterEvent(event models.Event, lastError string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.events[event.ID].ProcessingStatus = models.EventStatusDead
+	s.deadLetters = append(s.deadLetters, event.ID)
+	return nil
+}
+
+func (s *fakeStore) settled() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, event := range s.events {
+		if event.ProcessingStatus != models.EventStatusProcessed && event.ProcessingStatus != models.EventStatusDead {
+			return false
+		}
+	}
+	return true
+}
+
+// fakeProcessor fails events whose payload asks for it
+type fakeProcessor struct{}
+
+func (fakeProcessor) ProcessEvent(event *models.Event) error {
+	if failUntil, ok := event.Payload["fail_until_attempt"].(int); ok && event.Attempts < failUntil {
+		return errors.New("evaluation failed")
+	}
+	return nil
+}
+
+func TestWorkerPoolRetriesAndDeadLetters(t *testing.T) {
+	store := newFakeStore(
+		models.Event{ID: 1, UserID: "user-1", Payload: models.JSONB{}},
+		models.Event{ID: 2, UserID: "user-2", Payload: models.JSONB{"fail_until_attempt": 2}},
+		models.Event{ID: 3, UserID: "user-3", Payload: models.JSONB{"fail_until_attempt": 100}},
+	)
+
+	pool := NewWorkerPool(store, func() Processor { return fakeProcessor{} }, Config{
+		Concurrency:  2,
+		PollInterval: 10 * time.Millisecond,
+		MaxAttempts:  3,
+	})
+	pool.Start()
+	pool.Notify()
+
+	assert.Eventually(t, store.settled, 2*time.Second, 5*time.Millisecond)
+	pool.Stop()
+
+	assert.ElementsMatch(t, []int{1, 2}, store.processed)
+	assert.Equal(t, []int{3}, store.deadLetters)
+	assert.Equal(t, 2, store.events[2].Attempts)
+	assert.Equal(t, 3, store.events[3].Attempts)
+	assert.Contains(t, store.retries, 2)
+}
+
+func TestWorkerPoolBackoff(t *testing.T) {
+	pool := NewWorkerPool(newFakeStore(), nil, Config{BaseBackoff: time.Second, MaxBackoff: 10 * time.Second})
+
+	assert.Equal(t, time.Second, pool.backoff(1))
+	assert.Equal(t, 2*time.Second, pool.backoff(2))
+	assert.Equal(t, 8*time.Second, pool.backoff(4))
+	assert.Equal(t, 10*time.Second, pool.backoff(5))
+}
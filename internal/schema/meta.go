@@ -0,0 +1,169 @@
+package schema
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+)
+
+// ValidateSchema checks that a schema is itself a well-formed JSON Schema for
+// the subset of keywords supported by Validate. Unknown keywords such as
+// "description" or "title" are accepted as annotations.
+func ValidateSchema(schema map[string]interface{}) []Violation {
+	var violations []Violation
+	checkSchema(schema, "", &violations)
+	return violations
+}
+
+// checkSchema recursively validates a (sub)schema
+func checkSchema(schema map[string]interface{}, path string, violations *[]Violation) {
+	add := func(keyword, format string, args ...interface{}) {
+		*violations = append(*violations, Violation{
+			Path:    path + "/" + keyword,
+			Keyword: keyword,
+			Message: fmt.Sprintf(format, args...),
+		})
+	}
+
+	if typeValue, ok := schema["type"]; ok {
+		switch t := typeValue.(type) {
+		case string:
+			if !knownTypes[t] {
+				add("type", "unknown type '%s'", t)
+			}
+		case []interface{}:
+			if len(t) == 0 {
+				add("type", "type array must not be empty")
+			}
+			for _, item := range t {
+				name, ok := item.(string)
+				if !ok || !knownTypes[name] {
+					add("type", "unknown type '%v'", item)
+				}
+			}
+		default:
+			add("type", "type must be a string or an array of strings")
+		}
+	}
+
+	if propertiesValue, ok := schema["properties"]; ok {
+		properties, ok := propertiesValue.(map[string]interface{})
+		if !ok {
+			add("properties", "properties must be an object")
+		} else {
+			names := make([]string, 0, len(properties))
+			for name := range properties {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+
+			for _, name := range names {
+				childPath := path + "/properties/" + EscapePointer(name)
+				subSchema, ok := properties[name].(map[string]interface{})
+				if !ok {
+					*violations = append(*violations, Violation{
+						Path:    childPath,
+						Keyword: "properties",
+						Message: fmt.Sprintf("schema for property '%s' must be an object", name),
+					})
+					continue
+				}
+				checkSchema(subSchema, childPath, violations)
+			}
+		}
+	}
+
+	if requiredValue, ok := schema["required"]; ok {
+		required, ok := requiredValue.([]interface{})
+		if !ok {
+			add("required", "required must be an array of strings")
+		} else {
+			for i, item := range required {
+				if _, ok := item.(string); !ok {
+					add("required", "required[%d] must be a string", i)
+				}
+			}
+		}
+	}
+
+	if enumValue, ok := schema["enum"]; ok {
+		if enumValues, ok := enumValue.([]interface{}); !ok || len(enumValues) == 0 {
+			add("enum", "enum must be a non-empty array")
+		}
+	}
+
+	if itemsValue, ok := schema["items"]; ok {
+		itemSchema, ok := itemsValue.(map[string]interface{})
+		if !ok {
+			add("items", "items must be a schema object")
+		} else {
+			checkSchema(itemSchema, path+"/items", violations)
+		}
+	}
+
+	if additionalValue, ok := schema["additionalProperties"]; ok {
+		switch additional := additionalValue.(type) {
+		case bool:
+		case map[string]interface{}:
+			checkSchema(additional, path+"/additionalProperties", violations)
+		default:
+			add("additionalProperties", "additionalProperties must be a boolean or a schema object")
+		}
+	}
+
+	for _, keyword := range []string{"minLength", "maxLength", "minItems", "maxItems", "minProperties", "maxProperties"} {
+		if value, ok := schema[keyword]; ok {
+			number, ok := toNumber(value)
+			if !ok || number < 0 || jsonTypeOf(value) != "integer" {
+				add(keyword, "%s must be a non-negative integer", keyword)
+			}
+		}
+	}
+
+	for _, keyword := range []string{"minimum", "maximum", "exclusiveMinimum", "exclusiveMaximum"} {
+		if value, ok := schema[keyword]; ok {
+			if _, ok := toNumber(value); !ok {
+				add(keyword, "%s must be a number", keyword)
+			}
+		}
+	}
+
+	if value, ok := schema["multipleOf"]; ok {
+		if number, ok := toNumber(value); !ok || number <= 0 {
+			add("multipleOf", "multipleOf must be a number greater than 0")
+		}
+	}
+
+	if value, ok := schema["uniqueItems"]; ok {
+		if _, ok := value.(bool); !ok {
+			add("uniqueItems", "uniqueItems must be a boolean")
+		}
+	}
+
+	if value, ok := schema["pattern"]; ok {
+		pattern, ok := value.(string)
+		if !ok {
+			add("pattern", "pattern must be a string")
+		} else if _, err := regexp.Compile(pattern); err != nil {
+			add("pattern", "invalid regular expression: %v", err)
+		}
+	}
+
+	if value, ok := schema["format"]; ok {
+		if _, ok := value.(string); !ok {
+			add("format", "format must be a string")
+		}
+	}
+
+	// Check that defaults and enum members agree with the declared type
+	if types := typeNames(schema["type"]); len(types) > 0 {
+		if enumValues, ok := schema["enum"].([]interface{}); ok {
+			for i, candidate := range enumValues {
+				if !matchesAnyType(candidate, types) {
+					add("enum", "enum[%s] does not match type %v", strconv.Itoa(i), types)
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,351 @@
+package schema
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Violation describes a single schema violation
+type Violation struct {
+	Path    string `json:"path"`    // JSON pointer to the offending value, "" for the root
+	Keyword string `json:"keyword"` // Schema keyword that failed (e.g. "type", "required")
+	Message string `json:"message"`
+}
+
+// ValidationError is returned when a document or schema fails validation
+type ValidationError struct {
+	Message    string      `json:"message"`
+	Violations []Violation `json:"violations"`
+}
+
+// Error implements the error interface
+func (e *ValidationError) Error() string {
+	if len(e.Violations) == 0 {
+		return e.Message
+	}
+	parts := make([]string, len(e.Violations))
+	for i, v := range e.Violations {
+		path := v.Path
+		if path == "" {
+			path = "/"
+		}
+		parts[i] = fmt.Sprintf("%s: %s", path, v.Message)
+	}
+	return fmt.Sprintf("%s: %s", e.Message, strings.Join(parts, "; "))
+}
+
+// knownTypes lists the JSON Schema primitive types
+var knownTypes = map[string]bool{
+	"string":  true,
+	"number":  true,
+	"integer": true,
+	"boolean": true,
+	"object":  true,
+	"array":   true,
+	"null":    true,
+}
+
+// Validate validates a decoded JSON document against a JSON Schema and returns
+// every violation found. An empty or nil schema accepts any document.
+func Validate(schema map[string]interface{}, document interface{}) []Violation {
+	var violations []Violation
+	validateValue(schema, document, "", &violations)
+	return violations
+}
+
+// validateValue validates a single value against a (sub)schema
+func validateValue(schema map[string]interface{}, value interface{}, path string, violations *[]Violation) {
+	if len(schema) == 0 {
+		return
+	}
+
+	add := func(keyword, format string, args ...interface{}) {
+		*violations = append(*violations, Violation{
+			Path:    path,
+			Keyword: keyword,
+			Message: fmt.Sprintf(format, args...),
+		})
+	}
+
+	// Type checks short-circuit the remaining keywords for this value, since
+	// they would only produce noise for a value of the wrong type
+	if typeValue, ok := schema["type"]; ok {
+		types := typeNames(typeValue)
+		if len(types) > 0 && !matchesAnyType(value, types) {
+			add("type", "expected %s, got %s", strings.Join(types, " or "), jsonTypeOf(value))
+			return
+		}
+	}
+
+	if enumValues, ok := schema["enum"].([]interface{}); ok {
+		found := false
+		for _, candidate := range enumValues {
+			if jsonEqual(value, candidate) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			add("enum", "value %v is not one of %v", value, enumValues)
+		}
+	}
+
+	if constValue, ok := schema["const"]; ok && !jsonEqual(value, constValue) {
+		add("const", "value %v does not equal %v", value, constValue)
+	}
+
+	switch v := value.(type) {
+	case string:
+		validateString(schema, v, add)
+	case map[string]interface{}:
+		validateObject(schema, v, path, violations, add)
+	case []interface{}:
+		validateArray(schema, v, path, violations, add)
+	default:
+		if number, ok := toNumber(value); ok {
+			validateNumber(schema, number, add)
+		}
+	}
+}
+
+// validateString applies string keywords
+func validateString(schema map[string]interface{}, value string, add func(string, string, ...interface{})) {
+	length := len([]rune(value))
+	if minLength, ok := toNumber(schema["minLength"]); ok && float64(length) < minLength {
+		add("minLength", "length %d is less than minimum %v", length, minLength)
+	}
+	if maxLength, ok := toNumber(schema["maxLength"]); ok && float64(length) > maxLength {
+		add("maxLength", "length %d is greater than maximum %v", length, maxLength)
+	}
+	if pattern, ok := schema["pattern"].(string); ok {
+		re, err := regexp.Compile(pattern)
+		if err == nil && !re.MatchString(value) {
+			add("pattern", "value %q does not match pattern %q", value, pattern)
+		}
+	}
+	if format, ok := schema["format"].(string); ok && !matchesFormat(format, value) {
+		add("format", "value %q is not a valid %s", value, format)
+	}
+}
+
+// validateNumber applies numeric keywords
+func validateNumber(schema map[string]interface{}, value float64, add func(string, string, ...interface{})) {
+	if minimum, ok := toNumber(schema["minimum"]); ok && value < minimum {
+		add("minimum", "value %v is less than minimum %v", value, minimum)
+	}
+	if maximum, ok := toNumber(schema["maximum"]); ok && value > maximum {
+		add("maximum", "value %v is greater than maximum %v", value, maximum)
+	}
+	if exclusiveMinimum, ok := toNumber(schema["exclusiveMinimum"]); ok && value <= exclusiveMinimum {
+		add("exclusiveMinimum", "value %v must be greater than %v", value, exclusiveMinimum)
+	}
+	if exclusiveMaximum, ok := toNumber(schema["exclusiveMaximum"]); ok && value >= exclusiveMaximum {
+		add("exclusiveMaximum", "value %v must be less than %v", value, exclusiveMaximum)
+	}
+	if multipleOf, ok := toNumber(schema["multipleOf"]); ok && multipleOf > 0 {
+		quotient := value / multipleOf
+		if math.Abs(quotient-math.Round(quotient)) > 1e-9 {
+			add("multipleOf", "value %v is not a multiple of %v", value, multipleOf)
+		}
+	}
+}
+
+// validateObject applies object keywords and recurses into properties
+func validateObject(schema map[string]interface{}, value map[string]interface{}, path string, violations *[]Violation, add func(string, string, ...interface{})) {
+	if required, ok := schema["required"].([]interface{}); ok {
+		for _, name := range required {
+			field, ok := name.(string)
+			if !ok {
+				continue
+			}
+			if _, exists := value[field]; !exists {
+				*violations = append(*violations, Violation{
+					Path:    path + "/" + EscapePointer(field),
+					Keyword: "required",
+					Message: fmt.Sprintf("missing required property '%s'", field),
+				})
+			}
+		}
+	}
+
+	if minProperties, ok := toNumber(schema["minProperties"]); ok && float64(len(value)) < minProperties {
+		add("minProperties", "object has %d properties, minimum is %v", len(value), minProperties)
+	}
+	if maxProperties, ok := toNumber(schema["maxProperties"]); ok && float64(len(value)) > maxProperties {
+		add("maxProperties", "object has %d properties, maximum is %v", len(value), maxProperties)
+	}
+
+	properties, _ := schema["properties"].(map[string]interface{})
+
+	// Iterate in a stable order so violations are reported deterministically
+	keys := make([]string, 0, len(value))
+	for key := range value {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		childPath := path + "/" + EscapePointer(key)
+		if propertySchema, ok := properties[key].(map[string]interface{}); ok {
+			validateValue(propertySchema, value[key], childPath, violations)
+			continue
+		}
+		if _, declared := properties[key]; declared {
+			continue
+		}
+
+		switch additional := schema["additionalProperties"].(type) {
+		case bool:
+			if !additional {
+				*violations = append(*violations, Violation{
+					Path:    childPath,
+					Keyword: "additionalProperties",
+					Message: fmt.Sprintf("property '%s' is not allowed", key),
+				})
+			}
+		case map[string]interface{}:
+			validateValue(additional, value[key], childPath, violations)
+		}
+	}
+}
+
+// validateArray applies array keywords and recurses into items
+func validateArray(schema map[string]interface{}, value []interface{}, path string, violations *[]Violation, add func(string, string, ...interface{})) {
+	if minItems, ok := toNumber(schema["minItems"]); ok && float64(len(value)) < minItems {
+		add("minItems", "array has %d items, minimum is %v", len(value), minItems)
+	}
+	if maxItems, ok := toNumber(schema["maxItems"]); ok && float64(len(value)) > maxItems {
+		add("maxItems", "array has %d items, maximum is %v", len(value), maxItems)
+	}
+	if unique, ok := schema["uniqueItems"].(bool); ok && unique {
+		for i := 0; i < len(value); i++ {
+			for j := i + 1; j < len(value); j++ {
+				if jsonEqual(value[i], value[j]) {
+					add("uniqueItems", "items %d and %d are equal", i, j)
+				}
+			}
+		}
+	}
+	if itemSchema, ok := schema["items"].(map[string]interface{}); ok {
+		for i, item := range value {
+			validateValue(itemSchema, item, path+"/"+strconv.Itoa(i), violations)
+		}
+	}
+}
+
+// typeNames normalizes the "type" keyword into a list of type names
+func typeNames(typeValue interface{}) []string {
+	switch t := typeValue.(type) {
+	case string:
+		return []string{t}
+	case []interface{}:
+		var names []string
+		for _, item := range t {
+			if name, ok := item.(string); ok {
+				names = append(names, name)
+			}
+		}
+		return names
+	}
+	return nil
+}
+
+// matchesAnyType checks a value against a list of JSON Schema types
+func matchesAnyType(value interface{}, types []string) bool {
+	actual := jsonTypeOf(value)
+	for _, expected := range types {
+		if expected == actual {
+			return true
+		}
+		if expected == "number" && actual == "integer" {
+			return true
+		}
+	}
+	return false
+}
+
+// jsonTypeOf returns the JSON Schema type name of a decoded JSON value
+func jsonTypeOf(value interface{}) string {
+	switch value.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case string:
+		return "string"
+	case map[string]interface{}:
+		return "object"
+	case []interface{}:
+		return "array"
+	}
+	if number, ok := toNumber(value); ok {
+		if number == math.Trunc(number) {
+			return "integer"
+		}
+		return "number"
+	}
+	return fmt.Sprintf("%T", value)
+}
+
+// toNumber converts a decoded JSON number to float64
+func toNumber(value interface{}) (float64, bool) {
+	switch v := value.(type) {
+	case float64:
+		return v, true
+	case float32:
+		return float64(v), true
+	case int:
+		return float64(v), true
+	case int64:
+		return float64(v), true
+	case int32:
+		return float64(v), true
+	}
+	return 0, false
+}
+
+// jsonEqual compares two decoded JSON values, treating numbers by value
+func jsonEqual(a, b interface{}) bool {
+	if aNum, ok := toNumber(a); ok {
+		bNum, ok := toNumber(b)
+		return ok && aNum == bNum
+	}
+	return reflect.DeepEqual(a, b)
+}
+
+// partialTimeRegex matches HH:MM:SS with optional fraction and offset
+var partialTimeRegex = regexp.MustCompile(`^([01]\d|2[0-3]):[0-5]\d:([0-5]\d|60)(\.\d+)?(Z|[+-]([01]\d|2[0-3]):[0-5]\d)?$`)
+
+// emailRegex is a deliberately loose e-mail check
+var emailRegex = regexp.MustCompile(`^[^@\s]+@[^@\s]+\.[^@\s]+$`)
+
+// matchesFormat checks the formats used by event type schemas. Unknown
+// formats are treated as annotations and always pass.
+func matchesFormat(format, value string) bool {
+	switch format {
+	case "date-time":
+		_, err := time.Parse(time.RFC3339, value)
+		return err == nil
+	case "date":
+		_, err := time.Parse("2006-01-02", value)
+		return err == nil
+	case "time":
+		return partialTimeRegex.MatchString(value)
+	case "email":
+		return emailRegex.MatchString(value)
+	default:
+		return true
+	}
+}
+
+// EscapePointer escapes a property name or other reference token for use in a JSON pointer
+func EscapePointer(token string) string {
+	token = strings.ReplaceAll(token, "~", "~0")
+	return strings.ReplaceAll(token, "/", "~1")
+}
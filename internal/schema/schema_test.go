@@ -0,0 +1,141 @@
+package schema
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// taskCompletionSchema mirrors examples/event_types/task-completion.json with a nested object
+var taskCompletionSchema = map[string]interface{}{
+	"type": "object",
+	"properties": map[string]interface{}{
+		"task_id":      map[string]interface{}{"type": "string"},
+		"completed_at": map[string]interface{}{"type": "string", "format": "date-time"},
+		"priority": map[string]interface{}{
+			"type": "string",
+			"enum": []interface{}{"low", "medium", "high"},
+		},
+		"hours": map[string]interface{}{"type": "number", "minimum": float64(0)},
+		"project": map[string]interface{}{
+			"type": "object",
+			"properties": map[string]interface{}{
+				"id":   map[string]interface{}{"type": "integer"},
+				"tags": map[string]interface{}{"type": "array", "items": map[string]interface{}{"type": "string"}},
+			},
+			"required": []interface{}{"id"},
+		},
+	},
+	"required": []interface{}{"task_id", "completed_at"},
+}
+
+func TestValidateAcceptsValidPayload(t *testing.T) {
+	payload := map[string]interface{}{
+		"task_id":      "T-1",
+		"completed_at": "2023-06-20T14:30:00Z",
+		"priority":     "high",
+		"hours":        float64(3.5),
+		"project": map[string]interface{}{
+			"id":   float64(42),
+			"tags": []interface{}{"backend", "urgent"},
+		},
+	}
+
+	assert.Empty(t, Validate(taskCompletionSchema, payload))
+}
+
+func TestValidateReportsEveryViolation(t *testing.T) {
+	payload := map[string]interface{}{
+		"completed_at": "yesterday",
+		"priority":     "critical",
+		"hours":        float64(-1),
+		"project": map[string]interface{}{
+			"id":   float64(1.5),
+			"tags": []interface{}{"ok", float64(7)},
+		},
+	}
+
+	violations := Validate(taskCompletionSchema, payload)
+
+	paths := make(map[string]string)
+	for _, v := range violations {
+		paths[v.Path] = v.Keyword
+	}
+
+	assert.Equal(t, "required", paths["/task_id"])
+	assert.Equal(t, "format", paths["/completed_at"])
+	assert.Equal(t, "enum", paths["/priority"])
+	assert.Equal(t, "minimum", paths["/hours"])
+	assert.Equal(t, "type", paths["/project/id"])
+	assert.Equal(t, "type", paths["/project/tags/1"])
+	assert.Len(t, violations, 6)
+}
+
+func TestValidateEmptySchemaAcceptsAnything(t *testing.T) {
+	assert.Empty(t, Validate(nil, map[string]interface{}{"anything": true}))
+}
+
+func TestValidateTimeFormat(t *testing.T) {
+	s := map[string]interface{}{"type": "string", "format": "time"}
+
+	assert.Empty(t, Validate(s, "08:45:00"))
+	assert.Empty(t, Validate(s, "08:45:00Z"))
+	assert.NotEmpty(t, Validate(s, "8:45"))
+}
+
+func TestValidateSchema(t *testing.T) {
+	assert.Empty(t, ValidateSchema(taskCompletionSchema))
+
+	invalid := map[string]interface{}{
+		"type": "objekt",
+		"properties": map[string]interface{}{
+			"name":  "string",
+			"email": map[string]interface{}{"type": "string", "pattern": "("},
+		},
+		"required":  "name",
+		"minLength": float64(-1),
+		"enum":      []interface{}{},
+	}
+
+	violations := ValidateSchema(invalid)
+
+	paths := make(map[string]bool)
+	for _, v := range violations {
+		paths[v.Path] = true
+	}
+
+	assert.True(t, paths["/type"])
+	assert.True(t, paths["/properties/name"])
+	assert.True(t, paths["/properties/email/pattern"])
+	assert.True(t, paths["/required"])
+	assert.True(t, paths["/minLength"])
+	assert.True(t, paths["/enum"])
+}
+
+func TestValidateSchemaReportsPropertiesInOrder(t *testing.T) {
+	invalid := map[string]interface{}{
+		"properties": map[string]interface{}{
+			"zip":     "string",
+			"email":   map[string]interface{}{"type": "text"},
+			"address": "object",
+			"name":    "string",
+		},
+	}
+
+	for i := 0; i < 10; i++ {
+		var paths []string
+		for _, v := range ValidateSchema(invalid) {
+			paths = append(paths, v.Path)
+		}
+		assert.Equal(t, []string{"/properties/address", "/properties/email/type", "/properties/name", "/properties/zip"}, paths)
+	}
+}
+
+func TestValidationErrorMessage(t *testing.T) {
+	err := &ValidationError{
+		Message:    "invalid payload",
+		Violations: []Violation{{Path: "/task_id", Keyword: "required", Message: "missing required property 'task_id'"}},
+	}
+
+	assert.Equal(t, "invalid payload: /task_id: missing required property 'task_id'", err.Error())
+}
@@ -1,28 +1,166 @@
 package service
 
 import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
 	"errors"
 	"fmt"
+	"io"
+	"net/url"
+	"sort"
 	"time"
 
 	"github.com/badge-assignment-system/internal/engine"
+	"github.com/badge-assignment-system/internal/expr"
+	"github.com/badge-assignment-system/internal/ical"
+	"github.com/badge-assignment-system/internal/jobs"
 	"github.com/badge-assignment-system/internal/models"
+	"github.com/badge-assignment-system/internal/notify"
+	"github.com/badge-assignment-system/internal/queue"
+	"github.com/badge-assignment-system/internal/schema"
+	"github.com/badge-assignment-system/internal/webhook"
 )
 
 // Service handles business logic for the badge system
 type Service struct {
-	DB         *models.DB
-	RuleEngine *engine.RuleEngine
+	DB            *models.DB
+	RuleEngine    *engine.RuleEngine
+	Notifications *notify.Hub           // Delivers badge notifications to the streams of this server
+	Workers       *queue.WorkerPool     // Set when events are processed asynchronously
+	Recheck       *jobs.BadgeRecheckJob // Set when awarded badges are periodically re-checked
+	Webhooks      *webhook.Dispatcher   // Set when webhook notifications are delivered
+	Backfills     *jobs.BackfillRunner  // Set when backfill jobs are run
+	Relay         *notify.Relay         // Set when badge notifications are shared with other replicas
 }
 
+// ErrBadgeNotHeld is returned when revoking a badge the user does not hold
+var ErrBadgeNotHeld = errors.New("user does not hold this badge")
+
+// ErrBadgeNotFound is returned when a badge does not exist
+var ErrBadgeNotFound = errors.New("badge not found")
+
+// ErrBackfillsDisabled is returned when starting a backfill job on a server that does not run them
+var ErrBackfillsDisabled = errors.New("backfills are disabled")
+
 // NewService creates a new service
 func NewService(db *models.DB) *Service {
+	notifications := notify.NewHub()
+	ruleEngine := engine.NewRuleEngine(db)
+	ruleEngine.Notifications = notifications
+
 	return &Service{
-		DB:         db,
-		RuleEngine: engine.NewRuleEngine(db),
+		DB:            db,
+		RuleEngine:    ruleEngine,
+		Notifications: notifications,
+	}
+}
+
+// newWorkerEngine creates a rule engine for a background job. It shares the badge dependency index,
+// holiday calendars and notifications of the service's engine, so that the awards it makes
+// re-evaluate dependent badges and reach streaming clients, and invalidation reaches it.
+func (s *Service) newWorkerEngine() *engine.RuleEngine {
+	ruleEngine := engine.NewRuleEngine(s.DB)
+	ruleEngine.Dependencies = s.RuleEngine.Dependencies
+	ruleEngine.HolidayCalendars = s.RuleEngine.HolidayCalendars
+	ruleEngine.Notifications = s.Notifications
+	return ruleEngine
+}
+
+// EnableAsyncProcessing starts a worker pool that evaluates queued events in the background.
+// Once enabled, ProcessEvent only stores the event and returns immediately.
+func (s *Service) EnableAsyncProcessing(config queue.Config) {
+	s.Workers = queue.NewWorkerPool(s.DB, func() queue.Processor {
+		return eventProcessor{ruleEngine: s.newWorkerEngine()}
+	}, config)
+	s.Workers.Start()
+}
+
+// eventProcessor evaluates queued events with a rule engine. Workers only need to know whether
+// evaluation failed, as nobody waits for the result of a queued event. An event any of whose
+// badges failed to evaluate has failed, so that it is retried and eventually dead-lettered.
+type eventProcessor struct {
+	ruleEngine *engine.RuleEngine
+}
+
+// ProcessEvent evaluates the badges affected by a queued event
+func (p eventProcessor) ProcessEvent(event *models.Event) error {
+	result, err := p.ruleEngine.ProcessEvent(event)
+	if err != nil {
+		return err
+	}
+	return result.Err()
+}
+
+// EnableBadgeRecheck starts a background job that expires lapsed awards and
+// re-evaluates the holders of badges with a recheck policy every interval
+func (s *Service) EnableBadgeRecheck(interval time.Duration) {
+	s.Recheck = jobs.NewBadgeRecheckJob(s.DB, s.newWorkerEngine(), interval)
+	s.Recheck.Notifications = s.Notifications
+	s.Recheck.Start()
+}
+
+// EnableWebhookDelivery starts a dispatcher that delivers badge notifications to webhook subscriptions
+func (s *Service) EnableWebhookDelivery(config webhook.Config) {
+	s.Webhooks = webhook.NewDispatcher(s.DB, config)
+	s.Webhooks.Start()
+}
+
+// EnableBackfills starts a runner that evaluates the badges of backfill jobs against every user
+func (s *Service) EnableBackfills(config jobs.BackfillConfig) {
+	s.Backfills = jobs.NewBackfillRunner(s.DB, func(dryRun bool) jobs.BadgeProcessor {
+		ruleEngine := s.newWorkerEngine()
+		ruleEngine.DryRun = dryRun
+		return ruleEngine
+	}, config)
+	s.Backfills.Start()
+}
+
+// EnableNotificationRelay shares badge notifications with the other server replicas through
+// Postgres LISTEN/NOTIFY, so that a client streaming notifications receives those of awards
+// made by any replica
+func (s *Service) EnableNotificationRelay(connStr string) error {
+	relay := notify.NewRelay(s.Notifications, s.DB, connStr)
+	if err := relay.Start(); err != nil {
+		return err
+	}
+	s.Relay = relay
+	s.Notifications.SetRelay(relay)
+	return nil
+}
+
+// Stop stops the background jobs that were enabled, waiting for the work they have in progress.
+// Those that award badges are stopped first, as they publish notifications through the relay.
+func (s *Service) Stop() {
+	if s.Workers != nil {
+		s.Workers.Stop()
+	}
+	if s.Recheck != nil {
+		s.Recheck.Stop()
+	}
+	if s.Backfills != nil {
+		s.Backfills.Stop()
+	}
+	if s.Webhooks != nil {
+		s.Webhooks.Stop()
+	}
+	if s.Relay != nil {
+		s.Relay.Stop()
 	}
 }
 
+// notifyWebhooks wakes the webhook dispatcher, if enabled, after notifications were written to the outbox
+func (s *Service) notifyWebhooks() {
+	if s.Webhooks != nil {
+		s.Webhooks.Notify()
+	}
+}
+
+// AsyncProcessing reports whether events are evaluated in the background
+func (s *Service) AsyncProcessing() bool {
+	return s.Workers != nil
+}
+
 // CreateEventType creates a new event type
 func (s *Service) CreateEventType(req *models.NewEventTypeRequest) (*models.EventType, error) {
 	// Validate request
@@ -30,6 +168,11 @@ func (s *Service) CreateEventType(req *models.NewEventTypeRequest) (*models.Even
 		return nil, errors.New("event type name is required")
 	}
 
+	// Make sure the schema is usable before storing it
+	if err := validateEventTypeSchema(req.Schema); err != nil {
+		return nil, err
+	}
+
 	// Check if event type with same name already exists
 	_, err := s.DB.GetEventTypeByName(req.Name)
 	if err == nil {
@@ -87,6 +230,9 @@ func (s *Service) UpdateEventType(id int, req *models.UpdateEventTypeRequest) (*
 	}
 
 	if req.Schema != nil {
+		if err := validateEventTypeSchema(req.Schema); err != nil {
+			return nil, err
+		}
 		eventType.Schema = models.JSONB(req.Schema)
 	}
 
@@ -103,42 +249,211 @@ func (s *Service) DeleteEventType(id int) error {
 	return s.DB.DeleteEventType(id)
 }
 
+// validateEventTypeSchema checks that an event type schema is a valid JSON Schema
+func validateEventTypeSchema(eventSchema map[string]interface{}) error {
+	if violations := schema.ValidateSchema(eventSchema); len(violations) > 0 {
+		return &schema.ValidationError{
+			Message:    "invalid event type schema",
+			Violations: violations,
+		}
+	}
+	return nil
+}
+
 // CreateBadge creates a new badge with criteria
 func (s *Service) CreateBadge(req *models.NewBadgeRequest) (*models.BadgeWithCriteria, error) {
+	badge, err := s.prepareBadge(req)
+	if err != nil {
+		return nil, err
+	}
+
+	// Save to database
+	if err := s.DB.CreateBadgeWithTiers(&badge.Badge, &badge.Criteria, badge.Tiers); err != nil {
+		return nil, fmt.Errorf("failed to create badge: %w", err)
+	}
+
+	// The new badge's criteria must be picked up by event processing
+	s.RuleEngine.Dependencies.Invalidate()
+
+	return badge, nil
+}
+
+// ValidateBadge makes the checks CreateBadge makes without creating the badge, returning
+// every problem found. Problems that are not tied to a part of the request have an empty path.
+func (s *Service) ValidateBadge(req *models.NewBadgeRequest) ([]schema.Violation, error) {
+	_, err := s.prepareBadge(req)
+	var validationErr *schema.ValidationError
+	if errors.As(err, &validationErr) {
+		return validationErr.Violations, nil
+	}
+	if err != nil {
+		return []schema.Violation{{Message: err.Error()}}, nil
+	}
+	return []schema.Violation{}, nil
+}
+
+// prepareBadge validates a badge request and builds the badge it describes
+func (s *Service) prepareBadge(req *models.NewBadgeRequest) (*models.BadgeWithCriteria, error) {
 	// Validate request
 	if req.Name == "" {
 		return nil, errors.New("badge name is required")
 	}
 
-	if req.FlowDefinition == nil {
-		return nil, errors.New("flow definition is required")
+	tiers, err := buildBadgeTiers(req.Tiers)
+	if err != nil {
+		return nil, err
 	}
 
-	// Create badge
-	badge := &models.Badge{
-		Name:        req.Name,
-		Description: req.Description,
-		ImageURL:    req.ImageURL,
-		Active:      true,
+	if err := validateAwardPolicy(tiers, req.RepeatPolicy); err != nil {
+		return nil, err
 	}
 
-	// Create criteria
-	criteria := &models.BadgeCriteria{
-		FlowDefinition: models.JSONB(req.FlowDefinition),
+	if err := engine.ValidateExpiryPolicy(req.ExpiryPolicy); err != nil {
+		return nil, err
 	}
 
-	// Save to database
-	if err := s.DB.CreateBadge(badge, criteria); err != nil {
-		return nil, fmt.Errorf("failed to create badge: %w", err)
+	if req.Points < 0 {
+		return nil, errors.New("badge points must not be negative")
+	}
+
+	// The first tier of a tiered badge doubles as the badge's criteria
+	flowDefinition := req.FlowDefinition
+	if flowDefinition == nil && req.Expression == "" && len(tiers) > 0 {
+		flowDefinition = tiers[0].FlowDefinition
+	}
+
+	if flowDefinition == nil && req.Expression == "" {
+		return nil, errors.New("flow definition or expression is required")
+	}
+
+	if err := validateCriteria(s.DB, req.FlowDefinition, req.Expression, req.Tiers); err != nil {
+		return nil, err
+	}
+
+	badge := models.Badge{
+		Name:         req.Name,
+		Description:  req.Description,
+		ImageURL:     req.ImageURL,
+		Active:       true,
+		Points:       req.Points,
+		RepeatPolicy: req.RepeatPolicy,
+		ExpiryPolicy: req.ExpiryPolicy,
+	}
+
+	// Condition types must be invoked with their declared parameters, and badges referenced
+	// by $hasBadge and $badgeCount must exist and must not depend on this badge
+	var flows []models.JSONB
+	if flowDefinition != nil {
+		flows = append(flows, models.JSONB(flowDefinition))
+	}
+	for _, tier := range tiers {
+		flows = append(flows, tier.FlowDefinition)
+	}
+	flows, err = expandConditions(s.DB, flows)
+	if err != nil {
+		return nil, err
+	}
+	if err := engine.CheckBadgeReferences(s.DB, badge, flows); err != nil {
+		return nil, err
 	}
 
-	// Return the created badge with criteria
 	return &models.BadgeWithCriteria{
-		Badge:    *badge,
-		Criteria: *criteria,
+		Badge: badge,
+		Criteria: models.BadgeCriteria{
+			FlowDefinition: models.JSONB(flowDefinition),
+			Expression:     req.Expression,
+		},
+		Tiers: tiers,
 	}, nil
 }
 
+// buildBadgeTiers validates the tiers of a badge request and orders them by level.
+// A nil request yields nil tiers, while an empty one yields an empty, non-nil slice.
+func buildBadgeTiers(reqs []models.BadgeTierRequest) ([]models.BadgeTier, error) {
+	if reqs == nil {
+		return nil, nil
+	}
+
+	tiers := make([]models.BadgeTier, 0, len(reqs))
+	levels := make(map[int]bool)
+	for _, req := range reqs {
+		if req.Level < 1 {
+			return nil, fmt.Errorf("tier level must be at least 1, got %d", req.Level)
+		}
+		if levels[req.Level] {
+			return nil, fmt.Errorf("duplicate tier level %d", req.Level)
+		}
+		levels[req.Level] = true
+
+		if req.Name == "" {
+			return nil, fmt.Errorf("tier %d name is required", req.Level)
+		}
+		if req.FlowDefinition == nil {
+			return nil, fmt.Errorf("tier %d flow definition is required", req.Level)
+		}
+
+		tiers = append(tiers, models.BadgeTier{
+			Level:          req.Level,
+			Name:           req.Name,
+			FlowDefinition: models.JSONB(req.FlowDefinition),
+		})
+	}
+
+	sort.Slice(tiers, func(i, j int) bool { return tiers[i].Level < tiers[j].Level })
+	return tiers, nil
+}
+
+// validateCriteria checks that a badge's criteria is given either as a flow definition or as an
+// expression, and statically checks the flow definitions and expression of a badge request,
+// reporting every problem with a JSON pointer into the request
+func validateCriteria(db engine.DBInterface, flowDefinition map[string]interface{}, expression string, tiers []models.BadgeTierRequest) error {
+	if flowDefinition != nil && expression != "" {
+		return errors.New("criteria must be either a flow definition or an expression, not both")
+	}
+
+	var violations []schema.Violation
+	addFlowViolations := func(path string, flow map[string]interface{}) {
+		for _, violation := range engine.ValidateFlow(db, flow) {
+			violation.Path = path + violation.Path
+			violations = append(violations, violation)
+		}
+	}
+
+	if flowDefinition != nil {
+		addFlowViolations("/flow_definition", flowDefinition)
+	}
+	if expression != "" {
+		if _, err := expr.Compile(expression); err != nil {
+			violations = append(violations, schema.Violation{Path: "/expression", Keyword: "expression", Message: err.Error()})
+		}
+	}
+	for i, tier := range tiers {
+		if tier.FlowDefinition != nil {
+			addFlowViolations(fmt.Sprintf("/tiers/%d/flow_definition", i), tier.FlowDefinition)
+		}
+	}
+
+	if len(violations) > 0 {
+		return &schema.ValidationError{
+			Message:    "invalid badge criteria",
+			Violations: violations,
+		}
+	}
+	return nil
+}
+
+// validateAwardPolicy checks a badge's repeat policy and that it is not combined with tiers
+func validateAwardPolicy(tiers []models.BadgeTier, policy *models.RepeatPolicy) error {
+	if err := engine.ValidateRepeatPolicy(policy); err != nil {
+		return err
+	}
+
+	if len(tiers) > 0 && policy != nil && policy.Type != models.RepeatOnce {
+		return errors.New("tiered badges cannot have a repeat policy")
+	}
+	return nil
+}
+
 // GetBadges gets all badges
 func (s *Service) GetBadges() ([]models.Badge, error) {
 	return s.DB.GetBadges()
@@ -192,78 +507,435 @@ func (s *Service) UpdateBadge(id int, req *models.UpdateBadgeRequest) (*models.B
 		badge.Active = *req.Active
 	}
 
-	// Prepare criteria if flow definition is provided
+	if req.Points != nil {
+		if *req.Points < 0 {
+			return nil, errors.New("badge points must not be negative")
+		}
+		badge.Points = *req.Points
+	}
+
+	if req.RepeatPolicy != nil {
+		badge.RepeatPolicy = req.RepeatPolicy
+	}
+
+	if req.ExpiryPolicy != nil {
+		if err := engine.ValidateExpiryPolicy(req.ExpiryPolicy); err != nil {
+			return nil, err
+		}
+		badge.ExpiryPolicy = req.ExpiryPolicy
+	}
+
+	// Validate the tiers and repeat policy the badge will end up with
+	tiers, err := buildBadgeTiers(req.Tiers)
+	if err != nil {
+		return nil, err
+	}
+
+	finalTiers := tiers
+	if finalTiers == nil {
+		finalTiers, err = s.DB.GetBadgeTiers(id)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get badge tiers: %w", err)
+		}
+	}
+
+	if err := validateAwardPolicy(finalTiers, badge.RepeatPolicy); err != nil {
+		return nil, err
+	}
+
+	// Prepare criteria if flow definition is provided; the first of
+	// newly provided tiers doubles as the badge's criteria otherwise
+	flowDefinition := req.FlowDefinition
+	if flowDefinition == nil && req.Expression == "" && len(tiers) > 0 {
+		flowDefinition = tiers[0].FlowDefinition
+	}
+
+	if err := validateCriteria(s.DB, req.FlowDefinition, req.Expression, req.Tiers); err != nil {
+		return nil, err
+	}
+
 	var criteria *models.BadgeCriteria
-	if req.FlowDefinition != nil {
+	if flowDefinition != nil || req.Expression != "" {
 		criteria = &models.BadgeCriteria{
 			BadgeID:        id,
-			FlowDefinition: models.JSONB(req.FlowDefinition),
+			FlowDefinition: models.JSONB(flowDefinition),
+			Expression:     req.Expression,
+		}
+	}
+
+	// Check the condition calls and badge references of the criteria the badge will end up
+	// with. Inactive badges are not evaluated, so their references are checked once they are
+	// activated.
+	finalCriteria := criteria
+	if finalCriteria == nil {
+		existing, err := s.DB.GetBadgeWithCriteria(id)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get badge criteria: %w", err)
+		}
+		finalCriteria = &existing.Criteria
+	}
+	flows := []models.JSONB{}
+	if finalCriteria.FlowDefinition != nil {
+		flows = append(flows, finalCriteria.FlowDefinition)
+	}
+	for _, tier := range finalTiers {
+		flows = append(flows, tier.FlowDefinition)
+	}
+	flows, err = expandConditions(s.DB, flows)
+	if err != nil {
+		return nil, err
+	}
+	if badge.Active {
+		if err := engine.CheckBadgeReferences(s.DB, badge, flows); err != nil {
+			return nil, err
 		}
 	}
 
 	// Update in database
-	if err := s.DB.UpdateBadge(&badge, criteria); err != nil {
+	if err := s.DB.UpdateBadgeWithTiers(&badge, criteria, tiers); err != nil {
 		return nil, fmt.Errorf("failed to update badge: %w", err)
 	}
 
+	// Criteria or active status may have changed
+	s.RuleEngine.Dependencies.Invalidate()
+
 	return &badge, nil
 }
 
+// expandConditions expands the $condition calls of a badge's flows, checking their parameters
+func expandConditions(db *models.DB, flows []models.JSONB) ([]models.JSONB, error) {
+	expanded := make([]models.JSONB, len(flows))
+	for i, flow := range flows {
+		var err error
+		if expanded[i], err = engine.ExpandConditions(db, flow); err != nil {
+			return nil, fmt.Errorf("invalid criteria: %w", err)
+		}
+	}
+	return expanded, nil
+}
+
 // DeleteBadge deletes a badge
 func (s *Service) DeleteBadge(id int) error {
-	return s.DB.DeleteBadge(id)
+	if err := s.DB.DeleteBadge(id); err != nil {
+		return err
+	}
+
+	s.RuleEngine.Dependencies.Invalidate()
+	return nil
 }
 
-// ProcessEvent processes an event and potentially awards badges
-func (s *Service) ProcessEvent(req *models.NewEventRequest) error {
+// MaxEventBatchSize is the largest number of events accepted in a single batch
+const MaxEventBatchSize = 1000
+
+// maxIdempotencyKeyLength is the length of the events.idempotency_key column
+const maxIdempotencyKeyLength = 255
+
+// ProcessEvent stores an event and evaluates it for badges, either immediately or,
+// when async processing is enabled, by queueing it for the worker pool. An event sent again
+// with the idempotency key of one the user already sent is not stored or evaluated again: the
+// original event is returned, marked as replayed. The outcome of the evaluation, with the
+// badges awarded, is only returned when the event is evaluated immediately. An event any of whose
+// badges failed to evaluate is marked as failed, and the outcome reports the badges that failed.
+func (s *Service) ProcessEvent(req *models.NewEventRequest) (*models.Event, *engine.ProcessResult, error) {
+	event, err := s.newEvent(req, make(map[string]models.EventType))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if err := s.DB.CreateEvent(event); err != nil {
+		return nil, nil, fmt.Errorf("failed to save event: %w", err)
+	}
+	if event.Replayed {
+		return event, nil, nil
+	}
+
+	// In async mode the worker pool picks the event up from the queue
+	if s.AsyncProcessing() {
+		s.Workers.Notify()
+		return event, nil, nil
+	}
+
+	// Process the event to check if it triggers any badges
+	result, err := s.RuleEngine.ProcessEvent(event)
+	if err != nil {
+		if markErr := s.DB.MarkEventFailed(event.ID, err.Error()); markErr != nil {
+			return nil, nil, fmt.Errorf("failed to process event for badge evaluation: %w (and failed to mark it as failed: %v)", err, markErr)
+		}
+		return nil, nil, fmt.Errorf("failed to process event for badge evaluation: %w", err)
+	}
+
+	if badgeErr := result.Err(); badgeErr != nil {
+		if err := s.DB.MarkEventFailed(event.ID, badgeErr.Error()); err != nil {
+			return nil, nil, fmt.Errorf("failed to mark event as failed: %w", err)
+		}
+		event.ProcessingStatus = models.EventStatusFailed
+	} else {
+		if err := s.DB.MarkEventProcessed(event.ID); err != nil {
+			return nil, nil, fmt.Errorf("failed to mark event as processed: %w", err)
+		}
+		event.ProcessingStatus = models.EventStatusProcessed
+	}
+	s.notifyWebhooks()
+
+	return event, result, nil
+}
+
+// newEvent validates an event request and builds the event to save. Event types are looked up
+// in eventTypes first, and added to it once read.
+func (s *Service) newEvent(req *models.NewEventRequest, eventTypes map[string]models.EventType) (*models.Event, error) {
 	// Validate request
 	if req.EventType == "" {
-		return errors.New("event type is required")
+		return nil, errors.New("event type is required")
 	}
 
 	if req.UserID == "" {
-		return errors.New("user ID is required")
+		return nil, errors.New("user ID is required")
 	}
 
 	// Get event type
-	eventType, err := s.DB.GetEventTypeByName(req.EventType)
-	if err != nil {
-		return fmt.Errorf("event type '%s' not found: %w", req.EventType, err)
+	eventType, ok := eventTypes[req.EventType]
+	if !ok {
+		var err error
+		eventType, err = s.DB.GetEventTypeByName(req.EventType)
+		if err != nil {
+			return nil, fmt.Errorf("event type '%s' not found: %w", req.EventType, err)
+		}
+		eventTypes[req.EventType] = eventType
+	}
+
+	// Validate the payload against the event type schema
+	if violations := schema.Validate(eventType.Schema, req.Payload); len(violations) > 0 {
+		return nil, &schema.ValidationError{
+			Message:    fmt.Sprintf("payload does not match schema for event type '%s'", req.EventType),
+			Violations: violations,
+		}
 	}
 
 	// Determine the timestamp
 	var occurredAt time.Time
 	if req.Timestamp != "" {
+		var err error
 		occurredAt, err = time.Parse(time.RFC3339, req.Timestamp)
 		if err != nil {
-			return fmt.Errorf("invalid timestamp format: %w", err)
+			return nil, fmt.Errorf("invalid timestamp format: %w", err)
 		}
 	} else {
 		occurredAt = time.Now()
 	}
 
-	// Create and save the event
-	event := &models.Event{
-		EventTypeID: eventType.ID,
-		UserID:      req.UserID,
-		Payload:     models.JSONB(req.Payload),
-		OccurredAt:  occurredAt,
+	// Events sent without a timezone take the user's timezone when they are evaluated
+	var timezone *string
+	if req.Timezone != "" {
+		if _, err := engine.LoadTimezone(req.Timezone); err != nil {
+			return nil, &schema.ValidationError{
+				Message:    "invalid event timezone",
+				Violations: []schema.Violation{{Path: "/timezone", Keyword: "timezone", Message: err.Error()}},
+			}
+		}
+		timezone = &req.Timezone
 	}
 
-	if err := s.DB.CreateEvent(event); err != nil {
-		return fmt.Errorf("failed to save event: %w", err)
+	var idempotencyKey *string
+	if req.IdempotencyKey != "" {
+		if len(req.IdempotencyKey) > maxIdempotencyKeyLength {
+			return nil, &schema.ValidationError{
+				Message: "invalid idempotency key",
+				Violations: []schema.Violation{{Path: "/idempotency_key", Keyword: "maxLength",
+					Message: fmt.Sprintf("idempotency key is longer than %d characters", maxIdempotencyKeyLength)}},
+			}
+		}
+		idempotencyKey = &req.IdempotencyKey
 	}
 
-	// Process the event to check if it triggers any badges
-	if err := s.RuleEngine.ProcessEvent(event); err != nil {
-		return fmt.Errorf("failed to process event for badge evaluation: %w", err)
+	// Events evaluated as soon as they are received are kept out of the worker pool's queue
+	status := models.EventStatusEvaluating
+	if s.AsyncProcessing() {
+		status = models.EventStatusPending
 	}
 
-	return nil
+	return &models.Event{
+		EventTypeID:      eventType.ID,
+		UserID:           req.UserID,
+		Payload:          models.JSONB(req.Payload),
+		OccurredAt:       occurredAt,
+		Timezone:         timezone,
+		ProcessingStatus: status,
+		IdempotencyKey:   idempotencyKey,
+	}, nil
+}
+
+// ProcessEventBatch stores several events in a single transaction and evaluates badges once
+// per user after the whole batch is saved, or queues the events for the worker pool when async
+// processing is enabled. Invalid events are reported and left out, unless the batch is atomic,
+// in which case no event is saved. Events repeating an idempotency key already used by the
+// user, in an earlier request or earlier in the batch, are reported with the original event.
+func (s *Service) ProcessEventBatch(req *models.NewEventBatchRequest) (*models.EventBatchResult, error) {
+	if len(req.Events) == 0 {
+		return nil, &schema.ValidationError{
+			Message:    "invalid event batch",
+			Violations: []schema.Violation{{Path: "/events", Keyword: "minItems", Message: "batch has no events"}},
+		}
+	}
+	if len(req.Events) > MaxEventBatchSize {
+		return nil, &schema.ValidationError{
+			Message: "invalid event batch",
+			Violations: []schema.Violation{{Path: "/events", Keyword: "maxItems",
+				Message: fmt.Sprintf("batch has %d events, the maximum is %d", len(req.Events), MaxEventBatchSize)}},
+		}
+	}
+
+	result := &models.EventBatchResult{
+		Events:  make([]models.EventBatchItem, len(req.Events)),
+		Awarded: []models.EventBatchAward{},
+	}
+	var events []*models.Event
+	var items []int // Index in the batch of each event to save
+	var violations []schema.Violation
+	eventTypes := make(map[string]models.EventType)
+	for i := range req.Events {
+		result.Events[i].Index = i
+		event, err := s.newEvent(&req.Events[i], eventTypes)
+		if err != nil {
+			result.Events[i].Status = models.EventStatusRejected
+			result.Events[i].Error = err.Error()
+			violations = append(violations, schema.Violation{Path: fmt.Sprintf("/events/%d", i), Keyword: "event", Message: err.Error()})
+
+			var validationErr *schema.ValidationError
+			if errors.As(err, &validationErr) {
+				result.Events[i].Violations = validationErr.Violations
+			}
+			result.Rejected++
+			continue
+		}
+		events = append(events, event)
+		items = append(items, i)
+	}
+
+	if req.Atomic && result.Rejected > 0 {
+		return nil, &schema.ValidationError{
+			Message:    fmt.Sprintf("%d of %d events are invalid, no event was saved", result.Rejected, len(req.Events)),
+			Violations: violations,
+		}
+	}
+	if len(events) == 0 {
+		return result, nil
+	}
+
+	if err := s.DB.CreateEvents(events); err != nil {
+		return nil, fmt.Errorf("failed to save events: %w", err)
+	}
+	var saved []int // Positions in events of the events that were not replayed
+	for n, event := range events {
+		item := &result.Events[items[n]]
+		item.EventID = event.ID
+		item.Status = event.ProcessingStatus
+		item.Replayed = event.Replayed
+		if event.Replayed {
+			result.Replayed++
+			continue
+		}
+		saved = append(saved, n)
+	}
+	result.Accepted = len(saved)
+	if len(saved) == 0 {
+		return result, nil
+	}
+
+	// In async mode the worker pool picks the events up from the queue
+	if s.AsyncProcessing() {
+		s.Workers.Notify()
+		return result, nil
+	}
+
+	// Evaluate badges once per user, in the order users first appear in the batch
+	var userIDs []string
+	userEvents := make(map[string][]int) // User ID -> positions in events
+	for _, n := range saved {
+		userID := events[n].UserID
+		if _, ok := userEvents[userID]; !ok {
+			userIDs = append(userIDs, userID)
+		}
+		userEvents[userID] = append(userEvents[userID], n)
+	}
+
+	statuses := make(map[int]string) // Status of the events evaluated by this batch, by ID
+
+	for _, userID := range userIDs {
+		positions := userEvents[userID]
+		batch := make([]models.Event, len(positions))
+		ids := make([]int, len(positions))
+		for k, n := range positions {
+			batch[k] = *events[n]
+			ids[k] = events[n].ID
+		}
+
+		outcome, err := s.RuleEngine.ProcessUserEvents(userID, batch)
+		if err == nil {
+			// The awards made are reported even when some of the badges failed to evaluate,
+			// which fails the user's events
+			awarded := make(map[int]bool)
+			for _, award := range outcome.Awarded {
+				// Tiered badges are reported once, however many tiers were reached
+				if !awarded[award.BadgeID] {
+					awarded[award.BadgeID] = true
+					result.Awarded = append(result.Awarded, models.EventBatchAward{UserID: userID, BadgeID: award.BadgeID, BadgeName: award.BadgeName})
+				}
+			}
+			err = outcome.Err()
+		}
+		if err == nil {
+			err = s.DB.MarkEventsProcessed(ids)
+		}
+		if err != nil {
+			// The events are saved but marked as failed
+			message := fmt.Sprintf("failed to process event for badge evaluation: %v", err)
+			if markErr := s.DB.MarkEventsFailed(ids, err.Error()); markErr != nil {
+				message += fmt.Sprintf(" (and failed to mark it as failed: %v)", markErr)
+			}
+			for _, n := range positions {
+				result.Events[items[n]].Status = models.EventStatusFailed
+				result.Events[items[n]].Error = message
+				statuses[events[n].ID] = models.EventStatusFailed
+			}
+			continue
+		}
+
+		for _, n := range positions {
+			result.Events[items[n]].Status = models.EventStatusProcessed
+			statuses[events[n].ID] = models.EventStatusProcessed
+		}
+	}
+
+	// Events replaying one saved earlier in the batch share its outcome
+	for i := range result.Events {
+		if item := &result.Events[i]; item.Replayed && statuses[item.EventID] != "" {
+			item.Status = statuses[item.EventID]
+		}
+	}
+	s.notifyWebhooks()
+
+	return result, nil
+}
+
+// GetEvent gets an event, including its processing status
+func (s *Service) GetEvent(id int) (*models.Event, error) {
+	event, err := s.DB.GetEventByID(id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get event: %w", err)
+	}
+	return &event, nil
+}
+
+// GetEventDeadLetters gets the most recent events that failed processing after all retries
+func (s *Service) GetEventDeadLetters(limit int) ([]models.EventDeadLetter, error) {
+	if limit <= 0 {
+		limit = 100
+	}
+	return s.DB.GetEventDeadLetters(limit)
 }
 
 // GetUserBadges gets all badges awarded to a user
-func (s *Service) GetUserBadges(userID string) ([]map[string]interface{}, error) {
+func (s *Service) GetUserBadges(userID string) ([]models.UserBadgeSummary, error) {
 	if userID == "" {
 		return nil, errors.New("user ID is required")
 	}
@@ -271,6 +943,227 @@ func (s *Service) GetUserBadges(userID string) ([]map[string]interface{}, error)
 	return s.DB.GetUserBadgeDetails(userID)
 }
 
+// RevokeUserBadge manually revokes a badge from a user, recording the reason.
+// A revoked badge is kept in the user's history and is not awarded to them again automatically.
+func (s *Service) RevokeUserBadge(userID string, badgeID int, reason string) error {
+	if userID == "" {
+		return errors.New("user ID is required")
+	}
+
+	if reason == "" {
+		return errors.New("revocation reason is required")
+	}
+
+	revoked, err := s.DB.RevokeUserBadge(userID, badgeID, models.UserBadgeStatusRevoked, reason)
+	if err != nil {
+		return fmt.Errorf("failed to revoke badge: %w", err)
+	}
+
+	if len(revoked) == 0 {
+		return ErrBadgeNotHeld
+	}
+	s.notifyWebhooks()
+	for _, notification := range revoked {
+		s.Notifications.Publish(notify.FromOutbox(notification))
+	}
+
+	return nil
+}
+
+// SubscribeBadgeNotifications starts receiving the badge notifications of a user as they
+// happen, or those of every user when userID is empty
+func (s *Service) SubscribeBadgeNotifications(userID string) *notify.Subscription {
+	return s.Notifications.Subscribe(userID)
+}
+
+// UnsubscribeBadgeNotifications stops receiving badge notifications
+func (s *Service) UnsubscribeBadgeNotifications(subscription *notify.Subscription) {
+	s.Notifications.Unsubscribe(subscription)
+}
+
+// GetBadgeNotificationsAfter gets up to limit badge notifications of a user sent after the
+// notification with the given ID, or those of every user when userID is empty, so that a
+// client can resume a stream without missing any
+func (s *Service) GetBadgeNotificationsAfter(userID string, afterID int, limit int) ([]notify.Notification, error) {
+	entries, err := s.DB.GetWebhookOutboxAfter(userID, afterID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get badge notifications: %w", err)
+	}
+
+	notifications := make([]notify.Notification, 0, len(entries))
+	for _, entry := range entries {
+		notifications = append(notifications, notify.FromOutbox(entry))
+	}
+	return notifications, nil
+}
+
+// Leaderboard page sizes
+const (
+	defaultLeaderboardLimit = 20
+	maxLeaderboardLimit     = 100
+)
+
+// GetLeaderboard gets a page of a leaderboard ranking users by their active awards, by the
+// points their awards score, or by when they first earned a badge, counting only the awards
+// made between the query's From and To days when set
+func (s *Service) GetLeaderboard(query models.LeaderboardQuery) (*models.Leaderboard, error) {
+	if query.By == "" {
+		query.By = models.LeaderboardByBadges
+	}
+	if query.Limit <= 0 {
+		query.Limit = defaultLeaderboardLimit
+	}
+	if query.Limit > maxLeaderboardLimit {
+		query.Limit = maxLeaderboardLimit
+	}
+	if query.Offset < 0 {
+		query.Offset = 0
+	}
+
+	var violations []schema.Violation
+	switch query.By {
+	case models.LeaderboardByBadges, models.LeaderboardByPoints:
+		query.BadgeID = 0
+	case models.LeaderboardByBadge:
+		if query.BadgeID <= 0 {
+			violations = append(violations, schema.Violation{Path: "badge_id", Keyword: "required",
+				Message: "badge_id is required to rank the earners of a badge"})
+		} else if _, err := s.DB.GetBadgeByID(query.BadgeID); errors.Is(err, sql.ErrNoRows) {
+			violations = append(violations, schema.Violation{Path: "badge_id", Keyword: "badge",
+				Message: fmt.Sprintf("badge %d not found", query.BadgeID)})
+		} else if err != nil {
+			return nil, fmt.Errorf("failed to get badge: %w", err)
+		}
+	default:
+		violations = append(violations, schema.Violation{Path: "by", Keyword: "enum",
+			Message: fmt.Sprintf("unknown ranking '%s', expected badges, points or badge", query.By)})
+	}
+
+	var from, to time.Time
+	for _, bound := range []struct {
+		name  string
+		value string
+		date  *time.Time
+	}{{"from", query.From, &from}, {"to", query.To, &to}} {
+		if bound.value == "" {
+			continue
+		}
+		date, err := time.Parse("2006-01-02", bound.value)
+		if err != nil {
+			violations = append(violations, schema.Violation{Path: bound.name, Keyword: "format",
+				Message: fmt.Sprintf("%s '%s' is not a YYYY-MM-DD date", bound.name, bound.value)})
+			continue
+		}
+		*bound.date = date
+	}
+	if !from.IsZero() && !to.IsZero() && to.Before(from) {
+		violations = append(violations, schema.Violation{Path: "to", Keyword: "minimum",
+			Message: fmt.Sprintf("to '%s' is before from '%s'", query.To, query.From)})
+	}
+
+	if len(violations) > 0 {
+		return nil, &schema.ValidationError{Message: "invalid leaderboard query", Violations: violations}
+	}
+
+	entries, total, err := s.DB.GetLeaderboard(query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get leaderboard: %w", err)
+	}
+
+	return &models.Leaderboard{
+		By:      query.By,
+		BadgeID: query.BadgeID,
+		From:    query.From,
+		To:      query.To,
+		Total:   total,
+		Limit:   query.Limit,
+		Offset:  query.Offset,
+		Entries: entries,
+	}, nil
+}
+
+// GetUserProgress gets the user's progress towards every active badge
+func (s *Service) GetUserProgress(userID string) ([]engine.BadgeProgress, error) {
+	if userID == "" {
+		return nil, errors.New("user ID is required")
+	}
+
+	return s.RuleEngine.GetUserProgress(userID)
+}
+
+// GetUserBadgeProgress gets the user's progress towards a single badge
+func (s *Service) GetUserBadgeProgress(userID string, badgeID int) (*engine.BadgeProgress, error) {
+	if userID == "" {
+		return nil, errors.New("user ID is required")
+	}
+
+	progress, err := s.RuleEngine.EvaluateBadgeProgress(badgeID, userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrBadgeNotFound
+	}
+	return progress, err
+}
+
+// GetUserProfile gets a user's profile
+func (s *Service) GetUserProfile(userID string) (*models.UserProfile, error) {
+	if userID == "" {
+		return nil, errors.New("user ID is required")
+	}
+
+	profile, err := s.DB.GetUserProfile(userID)
+	if err != nil {
+		return nil, fmt.Errorf("user profile not found: %w", err)
+	}
+	return &profile, nil
+}
+
+// UpdateUserProfile creates or replaces a user's profile. The profile's timezone is used to
+// evaluate the user's events sent without one; when it is not set, the timezone of the
+// user's latest event that had one is used instead.
+func (s *Service) UpdateUserProfile(userID string, req *models.UserProfileRequest) (*models.UserProfile, error) {
+	if userID == "" {
+		return nil, errors.New("user ID is required")
+	}
+
+	if req.Timezone != nil && *req.Timezone != "" {
+		if _, err := engine.LoadTimezone(*req.Timezone); err != nil {
+			return nil, &schema.ValidationError{
+				Message:    "invalid user profile",
+				Violations: []schema.Violation{{Path: "/timezone", Keyword: "timezone", Message: err.Error()}},
+			}
+		}
+	} else {
+		req.Timezone = nil
+	}
+
+	profile := &models.UserProfile{UserID: userID, Timezone: req.Timezone}
+	if err := s.DB.UpsertUserProfile(profile); err != nil {
+		return nil, fmt.Errorf("failed to save user profile: %w", err)
+	}
+	return profile, nil
+}
+
+// EvaluateBadge dry-runs a badge's criteria for a user and explains the result without awarding it
+func (s *Service) EvaluateBadge(badgeID int, userID string) (*engine.EvaluationResult, error) {
+	if userID == "" {
+		return nil, errors.New("user ID is required")
+	}
+
+	return s.RuleEngine.ExplainBadgeCriteria(badgeID, userID)
+}
+
+// EvaluateFlow dry-runs an unsaved flow definition for a user and explains the result
+func (s *Service) EvaluateFlow(req *models.EvaluateFlowRequest) (*engine.EvaluationResult, error) {
+	if req.UserID == "" {
+		return nil, errors.New("user ID is required")
+	}
+	if len(req.FlowDefinition) == 0 {
+		return nil, errors.New("flow definition is required")
+	}
+
+	return s.RuleEngine.ExplainFlow(models.JSONB(req.FlowDefinition), req.UserID), nil
+}
+
 // CreateConditionType creates a new condition type
 func (s *Service) CreateConditionType(req *models.NewConditionTypeRequest) (*models.ConditionType, error) {
 	// Validate request
@@ -283,6 +1176,12 @@ func (s *Service) CreateConditionType(req *models.NewConditionTypeRequest) (*mod
 		Name:            req.Name,
 		Description:     req.Description,
 		EvaluationLogic: req.EvaluationLogic,
+		Parameters:      req.Parameters,
+		FlowTemplate:    models.JSONB(req.FlowTemplate),
+	}
+
+	if err := engine.ValidateConditionType(s.DB, *conditionType); err != nil {
+		return nil, err
 	}
 
 	if err := s.DB.CreateConditionType(conditionType); err != nil {
@@ -313,6 +1212,7 @@ func (s *Service) UpdateConditionType(id int, req *models.UpdateConditionTypeReq
 	if err != nil {
 		return nil, fmt.Errorf("condition type not found: %w", err)
 	}
+	previousName := conditionType.Name
 
 	// Update fields if provided
 	if req.Name != "" {
@@ -327,15 +1227,403 @@ func (s *Service) UpdateConditionType(id int, req *models.UpdateConditionTypeReq
 		conditionType.EvaluationLogic = req.EvaluationLogic
 	}
 
+	if req.Parameters != nil {
+		conditionType.Parameters = req.Parameters
+	}
+
+	if req.FlowTemplate != nil {
+		conditionType.FlowTemplate = models.JSONB(req.FlowTemplate)
+	}
+
+	// The badges invoking the condition type must remain valid
+	if err := engine.ValidateConditionType(s.DB, conditionType); err != nil {
+		return nil, err
+	}
+	if err := engine.CheckConditionTypeUsage(s.DB, previousName, &conditionType); err != nil {
+		return nil, err
+	}
+
 	// Update in database
 	if err := s.DB.UpdateConditionType(&conditionType); err != nil {
 		return nil, fmt.Errorf("failed to update condition type: %w", err)
 	}
 
+	// Badges invoking the condition type may depend on different events now
+	s.RuleEngine.Dependencies.Invalidate()
+
 	return &conditionType, nil
 }
 
-// DeleteConditionType deletes a condition type
+// DeleteConditionType deletes a condition type that no active badge invokes
 func (s *Service) DeleteConditionType(id int) error {
-	return s.DB.DeleteConditionType(id)
+	conditionType, err := s.DB.GetConditionTypeByID(id)
+	if err != nil {
+		return fmt.Errorf("condition type not found: %w", err)
+	}
+
+	if err := engine.CheckConditionTypeUsage(s.DB, conditionType.Name, nil); err != nil {
+		return err
+	}
+
+	if err := s.DB.DeleteConditionType(id); err != nil {
+		return err
+	}
+
+	s.RuleEngine.Dependencies.Invalidate()
+	return nil
+}
+
+// CreateHolidayCalendar creates a new holiday calendar
+func (s *Service) CreateHolidayCalendar(req *models.NewHolidayCalendarRequest) (*models.HolidayCalendar, error) {
+	calendar := &models.HolidayCalendar{
+		Name:        req.Name,
+		Description: req.Description,
+		Holidays:    req.Holidays,
+	}
+
+	if err := engine.ValidateHolidayCalendar(*calendar); err != nil {
+		return nil, err
+	}
+
+	if err := s.DB.CreateHolidayCalendar(calendar); err != nil {
+		return nil, fmt.Errorf("failed to create holiday calendar: %w", err)
+	}
+
+	return calendar, nil
+}
+
+// GetHolidayCalendars gets all holiday calendars
+func (s *Service) GetHolidayCalendars() ([]models.HolidayCalendar, error) {
+	return s.DB.GetAllHolidayCalendars()
+}
+
+// GetHolidayCalendarByID gets a holiday calendar by ID
+func (s *Service) GetHolidayCalendarByID(id int) (*models.HolidayCalendar, error) {
+	calendar, err := s.DB.GetHolidayCalendarByID(id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get holiday calendar: %w", err)
+	}
+	return &calendar, nil
+}
+
+// UpdateHolidayCalendar updates an existing holiday calendar. A calendar named by active
+// badges cannot be renamed.
+func (s *Service) UpdateHolidayCalendar(id int, req *models.UpdateHolidayCalendarRequest) (*models.HolidayCalendar, error) {
+	calendar, err := s.DB.GetHolidayCalendarByID(id)
+	if err != nil {
+		return nil, fmt.Errorf("holiday calendar not found: %w", err)
+	}
+	previousName := calendar.Name
+
+	if req.Name != "" {
+		calendar.Name = req.Name
+	}
+
+	if req.Description != nil {
+		calendar.Description = *req.Description
+	}
+
+	if req.Holidays != nil {
+		calendar.Holidays = req.Holidays
+	}
+
+	return s.saveHolidayCalendar(&calendar, previousName)
+}
+
+// ImportHolidayCalendar adds the holidays of an iCalendar file to a holiday calendar, or
+// replaces its holidays with them when replace is set
+func (s *Service) ImportHolidayCalendar(id int, ics io.Reader, replace bool) (*models.HolidayCalendar, error) {
+	calendar, err := s.DB.GetHolidayCalendarByID(id)
+	if err != nil {
+		return nil, fmt.Errorf("holiday calendar not found: %w", err)
+	}
+
+	imported, err := ical.ParseHolidays(ics)
+	if err != nil {
+		return nil, &schema.ValidationError{
+			Message:    "invalid iCalendar file",
+			Violations: []schema.Violation{{Keyword: "ics", Message: err.Error()}},
+		}
+	}
+
+	if replace {
+		calendar.Holidays = imported
+	} else {
+		// Holidays already in the calendar are not added twice
+		existing := make(map[models.Holiday]bool, len(calendar.Holidays))
+		for _, holiday := range calendar.Holidays {
+			existing[holiday] = true
+		}
+		for _, holiday := range imported {
+			if !existing[holiday] {
+				calendar.Holidays = append(calendar.Holidays, holiday)
+				existing[holiday] = true
+			}
+		}
+	}
+
+	return s.saveHolidayCalendar(&calendar, calendar.Name)
+}
+
+// saveHolidayCalendar validates and saves a changed holiday calendar, and makes the rule
+// engines read it again
+func (s *Service) saveHolidayCalendar(calendar *models.HolidayCalendar, previousName string) (*models.HolidayCalendar, error) {
+	if err := engine.ValidateHolidayCalendar(*calendar); err != nil {
+		return nil, err
+	}
+	if calendar.Name != previousName {
+		if err := engine.CheckHolidayCalendarUsage(s.DB, previousName); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := s.DB.UpdateHolidayCalendar(calendar); err != nil {
+		return nil, fmt.Errorf("failed to update holiday calendar: %w", err)
+	}
+
+	s.RuleEngine.HolidayCalendars.Invalidate(previousName, calendar.Name)
+	return calendar, nil
+}
+
+// DeleteHolidayCalendar deletes a holiday calendar that no active badge names
+func (s *Service) DeleteHolidayCalendar(id int) error {
+	calendar, err := s.DB.GetHolidayCalendarByID(id)
+	if err != nil {
+		return fmt.Errorf("holiday calendar not found: %w", err)
+	}
+
+	if err := engine.CheckHolidayCalendarUsage(s.DB, calendar.Name); err != nil {
+		return err
+	}
+
+	if err := s.DB.DeleteHolidayCalendar(id); err != nil {
+		return err
+	}
+
+	s.RuleEngine.HolidayCalendars.Invalidate(calendar.Name)
+	return nil
+}
+
+// CreateWebhookSubscription creates a new webhook subscription, generating a signing secret if none is given.
+// The returned subscription is the only place the secret is disclosed.
+func (s *Service) CreateWebhookSubscription(req *models.WebhookSubscriptionRequest) (*models.WebhookSubscription, error) {
+	if err := validateWebhookURL(req.URL); err != nil {
+		return nil, err
+	}
+	if err := validateWebhookFilter(req.Filter); err != nil {
+		return nil, err
+	}
+
+	secret := req.Secret
+	if secret == "" {
+		generated, err := generateWebhookSecret()
+		if err != nil {
+			return nil, err
+		}
+		secret = generated
+	}
+
+	subscription := &models.WebhookSubscription{
+		URL:    req.URL,
+		Secret: secret,
+		Filter: req.Filter,
+		Active: true,
+	}
+	if req.Active != nil {
+		subscription.Active = *req.Active
+	}
+
+	if err := s.DB.CreateWebhookSubscription(subscription); err != nil {
+		return nil, fmt.Errorf("failed to create webhook subscription: %w", err)
+	}
+
+	return subscription, nil
+}
+
+// GetWebhookSubscriptions gets all webhook subscriptions, without their secrets
+func (s *Service) GetWebhookSubscriptions() ([]models.WebhookSubscription, error) {
+	subscriptions, err := s.DB.GetWebhookSubscriptions()
+	if err != nil {
+		return nil, err
+	}
+	for i := range subscriptions {
+		subscriptions[i].Secret = ""
+	}
+	return subscriptions, nil
+}
+
+// GetWebhookSubscriptionByID gets a webhook subscription by ID, without its secret
+func (s *Service) GetWebhookSubscriptionByID(id int) (*models.WebhookSubscription, error) {
+	subscription, err := s.DB.GetWebhookSubscriptionByID(id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get webhook subscription: %w", err)
+	}
+	subscription.Secret = ""
+	return &subscription, nil
+}
+
+// UpdateWebhookSubscription updates an existing webhook subscription.
+// Omitted fields are left unchanged; a secret is only replaced when a new one is given.
+func (s *Service) UpdateWebhookSubscription(id int, req *models.WebhookSubscriptionRequest) (*models.WebhookSubscription, error) {
+	subscription, err := s.DB.GetWebhookSubscriptionByID(id)
+	if err != nil {
+		return nil, fmt.Errorf("webhook subscription not found: %w", err)
+	}
+
+	if req.URL != "" {
+		if err := validateWebhookURL(req.URL); err != nil {
+			return nil, err
+		}
+		subscription.URL = req.URL
+	}
+
+	if req.Secret != "" {
+		subscription.Secret = req.Secret
+	}
+
+	if req.Filter != nil {
+		if err := validateWebhookFilter(req.Filter); err != nil {
+			return nil, err
+		}
+		subscription.Filter = req.Filter
+	}
+
+	if req.Active != nil {
+		subscription.Active = *req.Active
+	}
+
+	if err := s.DB.UpdateWebhookSubscription(&subscription); err != nil {
+		return nil, fmt.Errorf("failed to update webhook subscription: %w", err)
+	}
+
+	subscription.Secret = ""
+	return &subscription, nil
+}
+
+// DeleteWebhookSubscription deletes a webhook subscription along with its delivery history
+func (s *Service) DeleteWebhookSubscription(id int) error {
+	return s.DB.DeleteWebhookSubscription(id)
+}
+
+// GetWebhookDeliveries gets the most recent deliveries of a webhook subscription with every attempt made
+func (s *Service) GetWebhookDeliveries(subscriptionID int, limit int) ([]models.WebhookDelivery, error) {
+	if _, err := s.DB.GetWebhookSubscriptionByID(subscriptionID); err != nil {
+		return nil, fmt.Errorf("webhook subscription not found: %w", err)
+	}
+	if limit <= 0 {
+		limit = 100
+	}
+	return s.DB.GetWebhookDeliveries(subscriptionID, limit)
+}
+
+// StartBackfill creates a job that evaluates the given badges for every user who has sent events,
+// awarding them to the users who already qualify, or only counting those users in a dry run.
+// The job is run in the background by the backfill runner, so it is refused when backfills are disabled.
+func (s *Service) StartBackfill(req *models.BackfillRequest) (*models.BackfillJob, error) {
+	if s.Backfills == nil {
+		return nil, ErrBackfillsDisabled
+	}
+	if len(req.BadgeIDs) == 0 {
+		return nil, errors.New("at least one badge ID is required")
+	}
+
+	var violations []schema.Violation
+	badgeIDs := make([]int64, 0, len(req.BadgeIDs))
+	seen := make(map[int]bool)
+	for i, id := range req.BadgeIDs {
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+
+		badge, err := s.DB.GetBadgeByID(id)
+		if err != nil {
+			violations = append(violations, schema.Violation{
+				Path:    fmt.Sprintf("/badge_ids/%d", i),
+				Keyword: "badge_ids",
+				Message: fmt.Sprintf("badge ID %d not found", id),
+			})
+			continue
+		}
+		if !badge.Active {
+			violations = append(violations, schema.Violation{
+				Path:    fmt.Sprintf("/badge_ids/%d", i),
+				Keyword: "badge_ids",
+				Message: fmt.Sprintf("badge '%s' is not active", badge.Name),
+			})
+			continue
+		}
+		badgeIDs = append(badgeIDs, int64(id))
+	}
+	if len(violations) > 0 {
+		return nil, &schema.ValidationError{Message: "invalid backfill badges", Violations: violations}
+	}
+
+	totalUsers, err := s.DB.CountEventUsers()
+	if err != nil {
+		return nil, fmt.Errorf("failed to count users: %w", err)
+	}
+
+	job := &models.BackfillJob{
+		BadgeIDs:   badgeIDs,
+		DryRun:     req.DryRun,
+		TotalUsers: totalUsers,
+	}
+	if err := s.DB.CreateBackfillJob(job); err != nil {
+		return nil, fmt.Errorf("failed to create backfill job: %w", err)
+	}
+
+	s.Backfills.Notify()
+	return job, nil
+}
+
+// GetBackfillJob gets a backfill job and its progress
+func (s *Service) GetBackfillJob(id int) (*models.BackfillJob, error) {
+	job, err := s.DB.GetBackfillJobByID(id)
+	if err != nil {
+		return nil, fmt.Errorf("backfill job not found: %w", err)
+	}
+	return &job, nil
+}
+
+// GetBackfillJobs gets the most recent backfill jobs
+func (s *Service) GetBackfillJobs(limit int) ([]models.BackfillJob, error) {
+	if limit <= 0 {
+		limit = 100
+	}
+	return s.DB.GetBackfillJobs(limit)
+}
+
+// validateWebhookURL checks that a webhook URL is an absolute HTTP or HTTPS URL
+func validateWebhookURL(rawURL string) error {
+	if rawURL == "" {
+		return errors.New("webhook URL is required")
+	}
+	parsed, err := url.Parse(rawURL)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		return fmt.Errorf("invalid webhook URL: %s", rawURL)
+	}
+	return nil
+}
+
+// validateWebhookFilter checks that a webhook filter only names known event types
+func validateWebhookFilter(filter *models.WebhookFilter) error {
+	if filter == nil {
+		return nil
+	}
+	for _, eventType := range filter.Events {
+		if eventType != models.WebhookEventBadgeAwarded && eventType != models.WebhookEventBadgeRevoked {
+			return fmt.Errorf("unsupported webhook event type: %s", eventType)
+		}
+	}
+	return nil
+}
+
+// generateWebhookSecret returns a random hex-encoded signing secret
+func generateWebhookSecret() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("failed to generate webhook secret: %w", err)
+	}
+	return hex.EncodeToString(buf), nil
 }
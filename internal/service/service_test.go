@@ -0,0 +1,129 @@
+package service
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/badge-assignment-system/internal/engine"
+	"github.com/badge-assignment-system/internal/models"
+	"github.com/badge-assignment-system/internal/queue"
+	"github.com/badge-assignment-system/internal/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+// queueStore is an in-memory event queue whose retries are claimable at once
+type queueStore struct {
+	mu          sync.Mutex
+	events      map[int]*models.Event
+	lastErrors  map[int]string
+	processed   []int
+	deadLetters []int
+}
+
+func newQueueStore(events ...models.Event) *queueStore {
+	store := &queueStore{events: make(map[int]*models.Event), lastErrors: make(map[int]string)}
+	for i := range events {
+		event := events[i]
+		event.ProcessingStatus = models.EventStatusPending
+		store.events[event.ID] = &event
+	}
+	return store
+}
+
+func (s *queueStore) ClaimPendingEvents(limit int, lease time.Duration) ([]models.Event, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var claimed []models.Event
+	for _, event := range s.events {
+		if len(claimed) < limit && event.ProcessingStatus == models.EventStatusPending {
+			event.ProcessingStatus = models.EventStatusProcessing
+			event.Attempts++
+			claimed = append(claimed, *event)
+		}
+	}
+	return claimed, nil
+}
+
+func (s *queueStore) MarkEventProcessed(id int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.events[id].ProcessingStatus = models.EventStatusProcessed
+	s.processed = append(s.processed, id)
+	return nil
+}
+
+func (s *queueStore) ScheduleEventRetry(id int, nextAttemptAt time.Time, lastError string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.events[id].ProcessingStatus = models.EventStatusPending
+	s.lastErrors[id] = lastError
+	return nil
+}
+
+func (s *queueStore) DeadLetterEvent(event models.Event, lastError string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.events[event.ID].ProcessingStatus = models.EventStatusDead
+	s.lastErrors[event.ID] = lastError
+	s.deadLetters = append(s.deadLetters, event.ID)
+	return nil
+}
+
+func (s *queueStore) settled() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, event := range s.events {
+		if event.ProcessingStatus != models.EventStatusProcessed && event.ProcessingStatus != models.EventStatusDead {
+			return false
+		}
+	}
+	return true
+}
+
+// TestWorkerPoolRetriesEventsWithBadgeErrors checks that a queued event one of whose badges fails
+// to evaluate is retried and dead-lettered, even though the other badges were evaluated
+func TestWorkerPoolRetriesEventsWithBadgeErrors(t *testing.T) {
+	broken := testutil.CreateTestBadgeWithCriteria(1, "Broken", map[string]interface{}{
+		"event":    "check-in",
+		"criteria": map[string]interface{}{"timestamp": "soon"},
+	})
+	earlyBird := testutil.CreateTestBadgeWithCriteria(2, "Early Bird", map[string]interface{}{
+		"event":    "check-in",
+		"criteria": map[string]interface{}{},
+	})
+	checkIn := testutil.CreateTestEvent(1, "user-1", 1, map[string]interface{}{})
+
+	mockDB := testutil.NewMockDB()
+	mockDB.On("GetActiveBadges").Return([]models.Badge{broken.Badge, earlyBird.Badge}, nil)
+	mockDB.On("GetBadgeWithCriteria", 1).Return(broken, nil)
+	mockDB.On("GetBadgeWithCriteria", 2).Return(earlyBird, nil)
+	mockDB.On("GetEventTypeByName", "check-in").Return(models.EventType{ID: 1, Name: "check-in"}, nil)
+	mockDB.On("GetEventTypeByID", 1).Return(models.EventType{ID: 1, Name: "check-in"}, nil)
+	mockDB.On("GetUserBadges", "user-1").Return([]models.UserBadge{}, nil)
+	mockDB.On("GetUserEvents", "user-1").Return([]models.Event{checkIn}, nil)
+	mockDB.On("AwardBadgeToUser", mock.Anything).Return(true, nil)
+
+	store := newQueueStore(checkIn)
+	pool := queue.NewWorkerPool(store, func() queue.Processor {
+		return eventProcessor{ruleEngine: engine.NewRuleEngine(mockDB)}
+	}, queue.Config{
+		Concurrency:  1,
+		BatchSize:    1,
+		PollInterval: 10 * time.Millisecond,
+		MaxAttempts:  2,
+	})
+	pool.Start()
+	pool.Notify()
+
+	assert.Eventually(t, store.settled, 2*time.Second, 5*time.Millisecond)
+	pool.Stop()
+
+	assert.Empty(t, store.processed)
+	assert.Equal(t, []int{1}, store.deadLetters)
+	assert.Equal(t, 2, store.events[1].Attempts)
+	assert.Contains(t, store.lastErrors[1], "badge 1 (Broken)")
+	mockDB.AssertCalled(t, "AwardBadgeToUser", mock.Anything)
+}
@@ -41,9 +41,32 @@ func (m *MockDB) GetUserBadges(userID string) ([]models.UserBadge, error) {
 }
 
 // AwardBadgeToUser mocks awarding a badge to a user
-func (m *MockDB) AwardBadgeToUser(userBadge *models.UserBadge) error {
+func (m *MockDB) AwardBadgeToUser(userBadge *models.UserBadge) (bool, error) {
 	args := m.Called(userBadge)
-	return args.Error(0)
+	return args.Bool(0), args.Error(1)
+}
+
+// GetConditionTypeByName mocks retrieving a condition type by name
+func (m *MockDB) GetConditionTypeByName(name string) (models.ConditionType, error) {
+	args := m.Called(name)
+	return args.Get(0).(models.ConditionType), args.Error(1)
+}
+
+// GetHolidayCalendarByName mocks retrieving a holiday calendar by name
+func (m *MockDB) GetHolidayCalendarByName(name string) (models.HolidayCalendar, error) {
+	args := m.Called(name)
+	return args.Get(0).(models.HolidayCalendar), args.Error(1)
+}
+
+// GetUserTimezone mocks retrieving a user's timezone. Users are in UTC unless the test expects the call.
+func (m *MockDB) GetUserTimezone(userID string) (string, error) {
+	for _, call := range m.ExpectedCalls {
+		if call.Method == "GetUserTimezone" {
+			args := m.Called(userID)
+			return args.String(0), args.Error(1)
+		}
+	}
+	return "", nil
 }
 
 // GetEventsByType mocks retrieving events by type
@@ -70,6 +93,12 @@ func (m *MockDB) GetUserEvents(userID string) ([]models.Event, error) {
 	return args.Get(0).([]models.Event), args.Error(1)
 }
 
+// GetUserEventsInRange mocks retrieving a user's events that occurred within a time range
+func (m *MockDB) GetUserEventsInRange(userID string, start, end time.Time) ([]models.Event, error) {
+	args := m.Called(userID, start, end)
+	return args.Get(0).([]models.Event), args.Error(1)
+}
+
 // GetEventType mocks retrieving an event type
 func (m *MockDB) GetEventType(eventTypeID int) (*models.EventType, error) {
 	args := m.Called(eventTypeID)
@@ -92,6 +121,15 @@ func (m *MockDB) GetEventTypeByName(name string) (models.EventType, error) {
 	return args.Get(0).(models.EventType), args.Error(1)
 }
 
+// GetEventTypeByID mocks retrieving an event type by ID
+func (m *MockDB) GetEventTypeByID(id int) (models.EventType, error) {
+	args := m.Called(id)
+	if args.Get(0) == nil {
+		return models.EventType{}, args.Error(1)
+	}
+	return args.Get(0).(models.EventType), args.Error(1)
+}
+
 // GetConditionType mocks retrieving a condition type
 func (m *MockDB) GetConditionType(conditionTypeID int) (*models.ConditionType, error) {
 	args := m.Called(conditionTypeID)
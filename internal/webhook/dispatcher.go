@@ -0,0 +1,358 @@
+package webhook
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/badge-assignment-system/internal/logging"
+	"github.com/badge-assignment-system/internal/models"
+)
+
+// Store defines the database operations needed to dispatch and deliver webhook notifications
+type Store interface {
+	GetActiveWebhookSubscriptions() ([]models.WebhookSubscription, error)
+	GetUndispatchedWebhookOutbox(limit int) ([]models.WebhookOutbox, error)
+	DispatchWebhookOutbox(outboxID int, subscriptionIDs []int) error
+	ClaimWebhookDeliveries(limit int, lease time.Duration) ([]models.PendingWebhookDelivery, error)
+	RecordWebhookAttempt(attempt *models.WebhookDeliveryAttempt, status string, nextAttemptAt time.Time) error
+}
+
+// Config controls how notifications are delivered
+type Config struct {
+	PollInterval time.Duration // How long the dispatcher waits between polls when idle
+	BatchSize    int           // Outbox entries and deliveries handled per poll
+	Lease        time.Duration // How long a claimed delivery stays locked to this dispatcher
+	Timeout      time.Duration // Timeout of each HTTP request
+	MaxAttempts  int           // Attempts before a delivery is marked as failed
+	BaseBackoff  time.Duration // Delay before the first retry
+	MaxBackoff   time.Duration // Upper bound on the retry delay
+}
+
+// DefaultConfig returns the default delivery configuration
+func DefaultConfig() Config {
+	return Config{
+		PollInterval: time.Second,
+		BatchSize:    20,
+		Lease:        2 * time.Minute,
+		Timeout:      10 * time.Second,
+		MaxAttempts:  8,
+		BaseBackoff:  10 * time.Second,
+		MaxBackoff:   time.Hour,
+	}
+}
+
+// maxErrorBackoff is the longest the dispatcher waits before polling again after errors
+const maxErrorBackoff = time.Minute
+
+// Signature headers sent with every delivery
+const (
+	HeaderEvent     = "X-Webhook-Event"
+	HeaderID        = "X-Webhook-ID"
+	HeaderDelivery  = "X-Webhook-Delivery"
+	HeaderTimestamp = "X-Webhook-Timestamp"
+	HeaderSignature = "X-Webhook-Signature"
+)
+
+// Envelope is the JSON body posted to subscribers
+type Envelope struct {
+	ID        int          `json:"id"` // Identifies the notification across retries and subscriptions
+	Event     string       `json:"event"`
+	CreatedAt time.Time    `json:"created_at"`
+	Data      models.JSONB `json:"data"`
+}
+
+// Sign computes the signature of a payload: the hex-encoded HMAC-SHA256 of "<timestamp>.<body>"
+// keyed with the subscription's secret, prefixed with "sha256="
+func Sign(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10)))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Dispatcher turns outbox entries into deliveries for the matching subscriptions
+// and sends them, retrying failed deliveries with exponential backoff
+type Dispatcher struct {
+	store  Store
+	client *http.Client
+	config Config
+	logger *logging.Logger
+	wake   chan struct{}
+	stop   chan struct{}
+	wg     sync.WaitGroup
+	now    func() time.Time
+}
+
+// NewDispatcher creates a webhook dispatcher
+func NewDispatcher(store Store, config Config) *Dispatcher {
+	defaults := DefaultConfig()
+	if config.PollInterval <= 0 {
+		config.PollInterval = defaults.PollInterval
+	}
+	if config.BatchSize <= 0 {
+		config.BatchSize = defaults.BatchSize
+	}
+	if config.Lease <= 0 {
+		config.Lease = defaults.Lease
+	}
+	if config.Timeout <= 0 {
+		config.Timeout = defaults.Timeout
+	}
+	if config.MaxAttempts <= 0 {
+		config.MaxAttempts = defaults.MaxAttempts
+	}
+	if config.BaseBackoff <= 0 {
+		config.BaseBackoff = defaults.BaseBackoff
+	}
+	if config.MaxBackoff <= 0 {
+		config.MaxBackoff = defaults.MaxBackoff
+	}
+
+	return &Dispatcher{
+		store:  store,
+		client: &http.Client{Timeout: config.Timeout},
+		config: config,
+		logger: logging.NewLogger("WEBHOOK", logging.LogLevelInfo),
+		wake:   make(chan struct{}, 1),
+		stop:   make(chan struct{}),
+		now:    time.Now,
+	}
+}
+
+// Start runs the dispatcher in the background
+func (d *Dispatcher) Start() {
+	d.logger.Info("Starting webhook dispatcher")
+	d.wg.Add(1)
+	go func() {
+		defer d.wg.Done()
+		failures := 0 // Consecutive polls that met errors
+		for {
+			select {
+			case <-d.stop:
+				return
+			default:
+			}
+
+			handled, err := d.RunOnce()
+			if err != nil {
+				// Wait longer after each failed poll instead of retrying at once, and
+				// don't let new notifications wake the dispatcher meanwhile
+				failures++
+				select {
+				case <-d.stop:
+					return
+				case <-time.After(d.errorBackoff(failures)):
+				}
+				continue
+			}
+			failures = 0
+			if handled > 0 {
+				// Keep going while there is work
+				continue
+			}
+
+			select {
+			case <-d.stop:
+				return
+			case <-d.wake:
+			case <-time.After(d.config.PollInterval):
+			}
+		}
+	}()
+}
+
+// Stop signals the dispatcher to exit and waits for in-flight deliveries to finish
+func (d *Dispatcher) Stop() {
+	close(d.stop)
+	d.wg.Wait()
+	d.logger.Info("Webhook dispatcher stopped")
+}
+
+// Notify wakes the dispatcher so new notifications are sent without waiting for the next poll
+func (d *Dispatcher) Notify() {
+	select {
+	case d.wake <- struct{}{}:
+	default:
+	}
+}
+
+// RunOnce dispatches one batch of outbox entries and sends one batch of due deliveries,
+// returning the number of entries dispatched and deliveries sent, and the first error met
+func (d *Dispatcher) RunOnce() (int, error) {
+	dispatched, dispatchErr := d.dispatchOutbox()
+	delivered, deliverErr := d.deliverBatch()
+	if dispatchErr == nil {
+		dispatchErr = deliverErr
+	}
+	return dispatched + delivered, dispatchErr
+}
+
+// dispatchOutbox creates a delivery of each new notification for every subscription whose
+// filter matches. It returns the number of entries dispatched, and the first error met.
+func (d *Dispatcher) dispatchOutbox() (int, error) {
+	entries, err := d.store.GetUndispatchedWebhookOutbox(d.config.BatchSize)
+	if err != nil {
+		d.logger.Error("Failed to retrieve webhook outbox: %v", err)
+		return 0, err
+	}
+	if len(entries) == 0 {
+		return 0, nil
+	}
+
+	subscriptions, err := d.store.GetActiveWebhookSubscriptions()
+	if err != nil {
+		d.logger.Error("Failed to retrieve webhook subscriptions: %v", err)
+		return 0, err
+	}
+
+	dispatched := 0
+	var firstErr error
+	for _, entry := range entries {
+		var subscriptionIDs []int
+		for _, subscription := range subscriptions {
+			if subscription.Filter.Matches(entry.EventType, entry.BadgeID) {
+				subscriptionIDs = append(subscriptionIDs, subscription.ID)
+			}
+		}
+
+		if err := d.store.DispatchWebhookOutbox(entry.ID, subscriptionIDs); err != nil {
+			d.logger.Error("Failed to dispatch webhook outbox entry %d: %v", entry.ID, err)
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		dispatched++
+		d.logger.Debug("Dispatched %s notification %d to %d subscriptions", entry.EventType, entry.ID, len(subscriptionIDs))
+	}
+	return dispatched, firstErr
+}
+
+// deliverBatch claims the deliveries that are due and sends them. Failed deliveries are
+// rescheduled with their own backoff, so only failing to claim deliveries is an error.
+func (d *Dispatcher) deliverBatch() (int, error) {
+	deliveries, err := d.store.ClaimWebhookDeliveries(d.config.BatchSize, d.config.Lease)
+	if err != nil {
+		d.logger.Error("Failed to claim webhook deliveries: %v", err)
+		return 0, err
+	}
+
+	for i := range deliveries {
+		d.deliver(deliveries[i])
+	}
+	return len(deliveries), nil
+}
+
+// deliver sends a single delivery and records the attempt
+func (d *Dispatcher) deliver(delivery models.PendingWebhookDelivery) {
+	start := d.now()
+	status, err := d.send(delivery)
+
+	attempt := &models.WebhookDeliveryAttempt{
+		DeliveryID: delivery.ID,
+		DurationMs: int(d.now().Sub(start).Milliseconds()),
+	}
+	if status != 0 {
+		attempt.ResponseStatus = &status
+	}
+
+	if err == nil {
+		if err := d.store.RecordWebhookAttempt(attempt, models.WebhookDeliveryDelivered, time.Time{}); err != nil {
+			d.logger.Error("Failed to record webhook delivery %d: %v", delivery.ID, err)
+		}
+		return
+	}
+
+	message := err.Error()
+	attempt.Error = &message
+
+	if delivery.Attempts >= d.config.MaxAttempts {
+		d.logger.Error("Webhook delivery %d to %s failed after %d attempts: %v", delivery.ID, delivery.URL, delivery.Attempts, err)
+		if err := d.store.RecordWebhookAttempt(attempt, models.WebhookDeliveryFailed, time.Time{}); err != nil {
+			d.logger.Error("Failed to record webhook delivery %d: %v", delivery.ID, err)
+		}
+		return
+	}
+
+	nextAttemptAt := d.now().Add(d.backoff(delivery.Attempts))
+	d.logger.Warning("Webhook delivery %d to %s failed on attempt %d, retrying at %s: %v",
+		delivery.ID, delivery.URL, delivery.Attempts, nextAttemptAt.Format(time.RFC3339), err)
+	if err := d.store.RecordWebhookAttempt(attempt, models.WebhookDeliveryPending, nextAttemptAt); err != nil {
+		d.logger.Error("Failed to record webhook delivery %d: %v", delivery.ID, err)
+	}
+}
+
+// send posts the signed notification, returning the response status if one was received.
+// Any status outside 2xx is treated as a failure.
+func (d *Dispatcher) send(delivery models.PendingWebhookDelivery) (int, error) {
+	body, err := json.Marshal(Envelope{
+		ID:        delivery.OutboxID,
+		Event:     delivery.EventType,
+		CreatedAt: delivery.OutboxCreatedAt,
+		Data:      delivery.Payload,
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to encode payload: %w", err)
+	}
+
+	req, err := http.NewRequest(http.MethodPost, delivery.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	timestamp := d.now().Unix()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "badge-assignment-system-webhooks")
+	req.Header.Set(HeaderEvent, delivery.EventType)
+	req.Header.Set(HeaderID, strconv.Itoa(delivery.OutboxID))
+	req.Header.Set(HeaderDelivery, strconv.Itoa(delivery.ID))
+	req.Header.Set(HeaderTimestamp, strconv.FormatInt(timestamp, 10))
+	req.Header.Set(HeaderSignature, Sign(delivery.Secret, timestamp, body))
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return 0, fmt.Errorf("request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64*1024))
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return resp.StatusCode, fmt.Errorf("unexpected response status %d", resp.StatusCode)
+	}
+	return resp.StatusCode, nil
+}
+
+// errorBackoff returns how long to wait before polling again after the given number of
+// consecutive failed polls, doubling from the poll interval up to maxErrorBackoff
+func (d *Dispatcher) errorBackoff(failures int) time.Duration {
+	delay := d.config.PollInterval
+	for i := 1; i < failures; i++ {
+		delay *= 2
+		if delay >= maxErrorBackoff {
+			return maxErrorBackoff
+		}
+	}
+	return delay
+}
+
+// backoff returns the exponential retry delay after the given number of attempts
+func (d *Dispatcher) backoff(attempts int) time.Duration {
+	delay := d.config.BaseBackoff
+	for i := 1; i < attempts; i++ {
+		delay *= 2
+		if delay >= d.config.MaxBackoff {
+			return d.config.MaxBackoff
+		}
+	}
+	return delay
+}
@@ -0,0 +1,224 @@
+package webhook
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/badge-assignment-system/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeStore keeps subscriptions, the outbox and deliveries in memory
+type fakeStore struct {
+	mu            sync.Mutex
+	subscriptions []models.WebhookSubscription
+	outbox        []models.WebhookOutbox
+	deliveries    []*models.WebhookDelivery
+	attempts      []models.WebhookDeliveryAttempt
+	dispatchErr   error // Returned by DispatchWebhookOutbox when set
+}
+
+func (s *fakeStore) GetActiveWebhookSubscriptions() ([]models.WebhookSubscription, error) {
+	return s.subscriptions, nil
+}
+
+func (s *fakeStore) GetUndispatchedWebhookOutbox(limit int) ([]models.WebhookOutbox, error) {
+	var entries []models.WebhookOutbox
+	for _, entry := range s.outbox {
+		if entry.DispatchedAt == nil && len(entries) < limit {
+			entries = append(entries, entry)
+		}
+	}
+	return entries, nil
+}
+
+func (s *fakeStore) DispatchWebhookOutbox(outboxID int, subscriptionIDs []int) error {
+	if s.dispatchErr != nil {
+		return s.dispatchErr
+	}
+	now := time.Now()
+	for i := range s.outbox {
+		if s.outbox[i].ID == outboxID {
+			s.outbox[i].DispatchedAt = &now
+		}
+	}
+	for _, subscriptionID := range subscriptionIDs {
+		s.deliveries = append(s.deliveries, &models.WebhookDelivery{
+			ID:             len(s.deliveries) + 1,
+			SubscriptionID: subscriptionID,
+			OutboxID:       outboxID,
+			Status:         models.WebhookDeliveryPending,
+		})
+	}
+	return nil
+}
+
+// ClaimWebhookDeliveries claims pending deliveries regardless of their next attempt time,
+// so retries are sent on the next run without waiting for the backoff
+func (s *fakeStore) ClaimWebhookDeliveries(limit int, lease time.Duration) ([]models.PendingWebhookDelivery, error) {
+	var claimed []models.PendingWebhookDelivery
+	for _, delivery := range s.deliveries {
+		if delivery.Status != models.WebhookDeliveryPending || len(claimed) == limit {
+			continue
+		}
+		delivery.Status = models.WebhookDeliveryDelivering
+		delivery.Attempts++
+
+		pending := models.PendingWebhookDelivery{WebhookDelivery: *delivery}
+		for _, subscription := range s.subscriptions {
+			if subscription.ID == delivery.SubscriptionID {
+				pending.URL, pending.Secret = subscription.URL, subscription.Secret
+			}
+		}
+		for _, entry := range s.outbox {
+			if entry.ID == delivery.OutboxID {
+				pending.EventType, pending.Payload, pending.OutboxCreatedAt = entry.EventType, entry.Payload, entry.CreatedAt
+			}
+		}
+		claimed = append(claimed, pending)
+	}
+	return claimed, nil
+}
+
+func (s *fakeStore) RecordWebhookAttempt(attempt *models.WebhookDeliveryAttempt, status string, nextAttemptAt time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.attempts = append(s.attempts, *attempt)
+	s.deliveries[attempt.DeliveryID-1].Status = status
+	return nil
+}
+
+func TestDispatcherDeliversSignedNotificationsWithRetries(t *testing.T) {
+	var mu sync.Mutex
+	var received []Envelope
+	requests := 0
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		requests++
+
+		body, _ := io.ReadAll(r.Body)
+		timestamp, err := strconv.ParseInt(r.Header.Get(HeaderTimestamp), 10, 64)
+		if err != nil || r.Header.Get(HeaderSignature) != Sign("s3cret", timestamp, body) {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		// The first request fails so the delivery is retried
+		if requests == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+
+		var envelope Envelope
+		json.Unmarshal(body, &envelope)
+		received = append(received, envelope)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer receiver.Close()
+
+	store := &fakeStore{
+		subscriptions: []models.WebhookSubscription{
+			{ID: 1, URL: receiver.URL, Secret: "s3cret", Active: true},
+			{ID: 2, URL: receiver.URL, Secret: "other", Active: true, Filter: &models.WebhookFilter{BadgeIDs: []int{99}}},
+		},
+		outbox: []models.WebhookOutbox{
+			{ID: 7, EventType: models.WebhookEventBadgeAwarded, UserID: "user-1", BadgeID: 3,
+				Payload: models.JSONB{"user_id": "user-1", "badge_id": float64(3)}, CreatedAt: time.Now()},
+		},
+	}
+
+	dispatcher := NewDispatcher(store, DefaultConfig())
+
+	// The notification only matches the first subscription, and its first attempt fails
+	dispatcher.RunOnce()
+	require.Len(t, store.deliveries, 1)
+	assert.Equal(t, 1, store.deliveries[0].SubscriptionID)
+	assert.Equal(t, models.WebhookDeliveryPending, store.deliveries[0].Status)
+
+	// The retry succeeds
+	dispatcher.RunOnce()
+	assert.Equal(t, models.WebhookDeliveryDelivered, store.deliveries[0].Status)
+
+	require.Len(t, store.attempts, 2)
+	assert.Equal(t, http.StatusServiceUnavailable, *store.attempts[0].ResponseStatus)
+	assert.NotNil(t, store.attempts[0].Error)
+	assert.Equal(t, http.StatusNoContent, *store.attempts[1].ResponseStatus)
+	assert.Nil(t, store.attempts[1].Error)
+
+	require.Len(t, received, 1)
+	assert.Equal(t, 7, received[0].ID)
+	assert.Equal(t, models.WebhookEventBadgeAwarded, received[0].Event)
+	assert.Equal(t, "user-1", received[0].Data["user_id"])
+}
+
+func TestDispatcherGivesUpAfterMaxAttempts(t *testing.T) {
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer receiver.Close()
+
+	store := &fakeStore{
+		subscriptions: []models.WebhookSubscription{{ID: 1, URL: receiver.URL, Secret: "s3cret", Active: true}},
+		outbox:        []models.WebhookOutbox{{ID: 1, EventType: models.WebhookEventBadgeRevoked, BadgeID: 1, Payload: models.JSONB{}}},
+	}
+
+	config := DefaultConfig()
+	config.MaxAttempts = 3
+	dispatcher := NewDispatcher(store, config)
+	for i := 0; i < 5; i++ {
+		dispatcher.RunOnce()
+	}
+
+	assert.Equal(t, models.WebhookDeliveryFailed, store.deliveries[0].Status)
+	assert.Len(t, store.attempts, 3)
+}
+
+func TestDispatcherReportsOnlyDispatchedEntries(t *testing.T) {
+	store := &fakeStore{
+		subscriptions: []models.WebhookSubscription{{ID: 1, URL: "http://localhost", Secret: "s3cret", Active: true}},
+		outbox: []models.WebhookOutbox{
+			{ID: 1, EventType: models.WebhookEventBadgeAwarded, BadgeID: 1, Payload: models.JSONB{}},
+			{ID: 2, EventType: models.WebhookEventBadgeAwarded, BadgeID: 2, Payload: models.JSONB{}},
+		},
+		dispatchErr: errors.New("connection refused"),
+	}
+
+	dispatcher := NewDispatcher(store, DefaultConfig())
+	handled, err := dispatcher.RunOnce()
+	assert.Equal(t, 0, handled)
+	assert.EqualError(t, err, "connection refused")
+	assert.Empty(t, store.deliveries)
+}
+
+func TestErrorBackoff(t *testing.T) {
+	dispatcher := NewDispatcher(&fakeStore{}, Config{PollInterval: 10 * time.Second})
+	assert.Equal(t, 10*time.Second, dispatcher.errorBackoff(1))
+	assert.Equal(t, 40*time.Second, dispatcher.errorBackoff(3))
+	assert.Equal(t, time.Minute, dispatcher.errorBackoff(10))
+}
+
+func TestWebhookFilterMatches(t *testing.T) {
+	var all *models.WebhookFilter
+	assert.True(t, all.Matches(models.WebhookEventBadgeAwarded, 1))
+
+	filter := &models.WebhookFilter{Events: []string{models.WebhookEventBadgeRevoked}, BadgeIDs: []int{1, 2}}
+	assert.True(t, filter.Matches(models.WebhookEventBadgeRevoked, 2))
+	assert.False(t, filter.Matches(models.WebhookEventBadgeAwarded, 2))
+	assert.False(t, filter.Matches(models.WebhookEventBadgeRevoked, 3))
+}
+
+func TestBackoff(t *testing.T) {
+	dispatcher := NewDispatcher(&fakeStore{}, Config{BaseBackoff: time.Second, MaxBackoff: 5 * time.Second})
+	assert.Equal(t, time.Second, dispatcher.backoff(1))
+	assert.Equal(t, 4*time.Second, dispatcher.backoff(3))
+	assert.Equal(t, 5*time.Second, dispatcher.backoff(10))
+}